@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/NodeFactoryIo/vedran/internal/controllers"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/script"
+	"github.com/NodeFactoryIo/vedran/internal/ui"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	apiKeyPrivateKey         string
+	apiKeyRawLoadbalancerUrl string
+	apiKeyName               string
+	apiKeyDailyQuota         int64
+	apiKeyMonthlyQuota       int64
+	apiKeyDisabled           bool
+	apiKeyVerified           bool
+
+	apiKeyLoadbalancerURL *url.URL
+)
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "api-key",
+	Short: "Manages api keys of running load balancer",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		apiKeyLoadbalancerURL, err = url.Parse(apiKeyRawLoadbalancerUrl)
+		if err != nil {
+			return fmt.Errorf("invalid loadbalancer URL: %v", err)
+		}
+		if apiKeyDailyQuota < 0 || apiKeyMonthlyQuota < 0 {
+			return errors.New("invalid quota value")
+		}
+		return nil
+	},
+}
+
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates api key and prints generated key",
+	Run: func(_ *cobra.Command, _ []string) {
+		apiKey, err := script.CreateAPIKey(apiKeyPrivateKey, apiKeyLoadbalancerURL, apiKeyRequest())
+		if err != nil {
+			log.Fatalf("Failed creating api key because of: %v", err)
+		}
+		ui.DisplayAPIKeys([]models.APIKey{*apiKey})
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists api keys with their usage",
+	Run: func(_ *cobra.Command, _ []string) {
+		apiKeys, err := script.ListAPIKeys(apiKeyPrivateKey, apiKeyLoadbalancerURL)
+		if err != nil {
+			log.Fatalf("Failed listing api keys because of: %v", err)
+		}
+		ui.DisplayAPIKeys(apiKeys)
+	},
+}
+
+var apiKeyUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Updates quotas, disabled and verified flags of api key",
+	Run: func(_ *cobra.Command, _ []string) {
+		apiKey, err := script.UpdateAPIKey(apiKeyPrivateKey, apiKeyLoadbalancerURL, apiKeyRequest())
+		if err != nil {
+			log.Fatalf("Failed updating api key because of: %v", err)
+		}
+		ui.DisplayAPIKeys([]models.APIKey{*apiKey})
+	},
+}
+
+var apiKeyDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes api key",
+	Run: func(_ *cobra.Command, _ []string) {
+		err := script.DeleteAPIKey(apiKeyPrivateKey, apiKeyLoadbalancerURL, apiKeyName)
+		if err != nil {
+			log.Fatalf("Failed deleting api key because of: %v", err)
+		}
+		fmt.Printf("Api key %s deleted\n", apiKeyName)
+	},
+}
+
+func apiKeyRequest() controllers.APIKeyRequest {
+	return controllers.APIKeyRequest{
+		Name:         apiKeyName,
+		DailyQuota:   apiKeyDailyQuota,
+		MonthlyQuota: apiKeyMonthlyQuota,
+		Disabled:     apiKeyDisabled,
+		Verified:     apiKeyVerified,
+	}
+}
+
+func init() {
+	apiKeyCmd.PersistentFlags().StringVar(
+		&apiKeyPrivateKey,
+		"private-key",
+		"",
+		"[REQUIRED] loadbalancer wallet private key, used for signing requests",
+	)
+	apiKeyCmd.PersistentFlags().StringVar(
+		&apiKeyRawLoadbalancerUrl,
+		"load-balancer-url",
+		"http://localhost:80",
+		"[OPTIONAL] url on which loadbalancer is listening",
+	)
+	_ = apiKeyCmd.MarkPersistentFlagRequired("private-key")
+
+	for _, c := range []*cobra.Command{apiKeyCreateCmd, apiKeyUpdateCmd, apiKeyDeleteCmd} {
+		c.Flags().StringVar(
+			&apiKeyName,
+			"name",
+			"",
+			"[REQUIRED] name of api key",
+		)
+		_ = c.MarkFlagRequired("name")
+	}
+	for _, c := range []*cobra.Command{apiKeyCreateCmd, apiKeyUpdateCmd} {
+		c.Flags().Int64Var(
+			&apiKeyDailyQuota,
+			"daily-quota",
+			0,
+			"[OPTIONAL] maximum number of requests per day, where 0 represents no limit",
+		)
+		c.Flags().Int64Var(
+			&apiKeyMonthlyQuota,
+			"monthly-quota",
+			0,
+			"[OPTIONAL] maximum number of requests per month, where 0 represents no limit",
+		)
+		c.Flags().BoolVar(
+			&apiKeyVerified,
+			"verified",
+			false,
+			"[OPTIONAL] verify responses to requests with api key by multiple nodes",
+		)
+	}
+	apiKeyUpdateCmd.Flags().BoolVar(
+		&apiKeyDisabled,
+		"disabled",
+		false,
+		"[OPTIONAL] disable api key, requests with disabled key are rejected",
+	)
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd, apiKeyListCmd, apiKeyUpdateCmd, apiKeyDeleteCmd)
+	RootCmd.AddCommand(apiKeyCmd)
+}
@@ -8,7 +8,22 @@ import (
 	"path"
 	"strconv"
 	"strings"
-
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/capability"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/hedge"
+	"github.com/NodeFactoryIo/vedran/internal/nodeclient"
+	"github.com/NodeFactoryIo/vedran/internal/origin"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/policy"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/rpccache"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/verify"
 	"github.com/NodeFactoryIo/vedran/internal/whitelist"
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
@@ -25,18 +40,23 @@ import (
 
 var (
 	// load balancer related flags
-	authSecret     string
-	name           string
-	certFile       string
-	keyFile        string
-	capacity       int64
-	whitelistArray []string
-	whitelistFile  string
-	fee            float32
-	selection      string
-	serverPort     int32
-	publicIP       string
-	rootDir        string
+	authSecret        string
+	adminSecret       string
+	name              string
+	certFile          string
+	keyFile           string
+	capacity          int64
+	whitelistArray    []string
+	whitelistFile     string
+	fee               float32
+	selectionStrategy string
+	subBatchSize      int
+	maxRequestSize    int64
+	maxBatchLength    int
+	maxWSFrameSize    int64
+	serverPort        int32
+	publicIP          string
+	rootDir           string
 	// payout related flags
 	payoutFeeAddress           string
 	payoutPrivateKey           string
@@ -50,6 +70,51 @@ var (
 	// tunnel related flags
 	tunnelServerPort string
 	tunnelPortRange  string
+	// node connection pool related flags
+	nodeMaxIdleConns          int
+	nodeIdleConnTimeout       time.Duration
+	nodeDialTimeout           time.Duration
+	nodeResponseHeaderTimeout time.Duration
+	// rpc cache related flags
+	rpcCacheSize int
+	// block aware routing related flags
+	blockHashesSize int
+	// node capabilities related flags
+	archiveRewardWeight float64
+	// rpc method policy related flags
+	rpcPolicyFile string
+	// penalty policy related flags
+	penaltyPolicyFile string
+	// node request related flags
+	rpcTimeout        time.Duration
+	rpcMethodTimeouts map[string]string
+	rpcRetryBudget    int
+	rpcErrorRulesFile string
+	// api key related flags
+	anonymousAccessDisabled bool
+	anonymousDailyQuota     int64
+	anonymousMonthlyQuota   int64
+	// client rate limit related flags
+	rateLimit        float64
+	rateLimitBurst   int
+	maxWSConnections int
+	trustedProxies   []string
+	// origin policy related flags
+	corsAllowedOrigins   []string
+	corsAllowedMethods   []string
+	corsAllowedHeaders   []string
+	corsAllowCredentials bool
+	corsConfigFile       string
+	// request hedging related flags
+	hedgeDelay        time.Duration
+	hedgePercentile   float64
+	hedgeMethodDelays map[string]string
+	// response verification related flags
+	verifyMethods []string
+	verifyNodes   int
+	// fallback endpoint related flags
+	fallbackHTTPURLs []string
+	fallbackWSURLs   []string
 )
 
 var startCmd = &cobra.Command{
@@ -82,9 +147,17 @@ var startCmd = &cobra.Command{
 		return nil
 	},
 	Args: func(cmd *cobra.Command, args []string) error {
-		// valid values are round-robin and random
-		if selection != "round-robin" && selection != "random" {
-			return errors.New("invalid selection option selected")
+		// valid values are names of registered selection strategies
+		if !selection.IsRegistered(selectionStrategy) {
+			return fmt.Errorf(
+				"invalid selection option selected, valid options are: %s",
+				strings.Join(selection.Names(), ", "))
+		}
+		if subBatchSize <= 0 {
+			return errors.New("invalid sub batch size value")
+		}
+		if maxRequestSize < 0 || maxBatchLength < 0 || maxWSFrameSize < 0 {
+			return errors.New("invalid request size limit value")
 		}
 		// all positive integers are valid, and -1 representing unlimited capacity
 		if capacity < -1 {
@@ -123,6 +196,73 @@ var startCmd = &cobra.Command{
 			return errors.New("port range too small for target capacity")
 		}
 
+		if nodeMaxIdleConns < 0 {
+			return errors.New("invalid node max idle connections value")
+		}
+		if nodeIdleConnTimeout <= 0 || nodeDialTimeout <= 0 || nodeResponseHeaderTimeout <= 0 {
+			return errors.New("node connection timeouts must be positive durations")
+		}
+
+		if rpcCacheSize < 0 {
+			return errors.New("invalid rpc cache size value")
+		}
+
+		if blockHashesSize < 0 {
+			return errors.New("invalid block hashes size value")
+		}
+
+		if archiveRewardWeight <= 0 {
+			return errors.New("invalid archive reward weight value, value must be positive")
+		}
+
+		if rpcTimeout <= 0 {
+			return errors.New("rpc timeout must be positive duration")
+		}
+		if _, err := rpc.ParseTimeouts(rpcMethodTimeouts); err != nil {
+			return err
+		}
+		if rpcRetryBudget < 0 {
+			return errors.New("invalid rpc retry budget value")
+		}
+
+		if anonymousDailyQuota < 0 || anonymousMonthlyQuota < 0 {
+			return errors.New("invalid anonymous quota value")
+		}
+
+		if rateLimit < 0 || rateLimitBurst < 0 {
+			return errors.New("invalid rate limit value")
+		}
+		if maxWSConnections < 0 {
+			return errors.New("invalid max ws connections value")
+		}
+		if _, err := ratelimit.ParseTrustedProxies(trustedProxies); err != nil {
+			return err
+		}
+
+		if hedgeDelay < 0 {
+			return errors.New("invalid hedge delay value")
+		}
+		if hedgePercentile < 0 || hedgePercentile > 100 {
+			return errors.New("invalid hedge percentile value, valid value is between 0 and 100")
+		}
+		if _, err := hedge.ParseMethodDelays(hedgeMethodDelays); err != nil {
+			return err
+		}
+
+		if _, err := verify.New(verify.Config{Methods: verifyMethods, Nodes: verifyNodes}); err != nil {
+			return err
+		}
+
+		if _, err := fallback.New(fallback.Config{HTTPURLs: fallbackHTTPURLs, WSURLs: fallbackWSURLs}); err != nil {
+			return err
+		}
+
+		corsFlagsSet := cmd.Flags().Changed("cors-allowed-origins") || cmd.Flags().Changed("cors-allowed-methods") ||
+			cmd.Flags().Changed("cors-allowed-headers") || cmd.Flags().Changed("cors-allow-credentials")
+		if corsFlagsSet && corsConfigFile != "" {
+			return errors.New("cors flags can't be used together with --cors-config-file flag")
+		}
+
 		if whitelistArray != nil && whitelistFile != "" {
 			return errors.New("only one flag for setting whitelisted nodes should be set")
 		}
@@ -150,6 +290,12 @@ func init() {
 		"",
 		"[REQUIRED] Authentication secret used for generating tokens")
 
+	startCmd.Flags().StringVar(
+		&adminSecret,
+		"admin-secret",
+		"",
+		"[OPTIONAL] Secret used for authenticating admin api requests, admin api is disabled if omitted")
+
 	startCmd.Flags().StringVar(
 		&name,
 		"name",
@@ -183,10 +329,34 @@ func init() {
 		"[OPTIONAL] Value between 0-1 representing fee percentage")
 
 	startCmd.Flags().StringVar(
-		&selection,
+		&selectionStrategy,
 		"selection",
-		"round-robin",
-		"[OPTIONAL] Type of selection used for choosing nodes (round-robin, random)")
+		selection.RoundRobin,
+		fmt.Sprintf("[OPTIONAL] Type of selection used for choosing nodes (%s)", strings.Join(selection.Names(), ", ")))
+
+	startCmd.Flags().IntVar(
+		&subBatchSize,
+		"sub-batch-size",
+		rpc.DefaultSubBatchSize,
+		"[OPTIONAL] Maximum number of batch elements sent to single node, larger batches are split across multiple nodes")
+
+	startCmd.Flags().Int64Var(
+		&maxRequestSize,
+		"max-request-size",
+		rpc.DefaultMaxRequestSize,
+		"[OPTIONAL] Maximum size of rpc request body in bytes, where 0 represents no limit")
+
+	startCmd.Flags().IntVar(
+		&maxBatchLength,
+		"max-batch-length",
+		rpc.DefaultMaxBatchLength,
+		"[OPTIONAL] Maximum number of elements in batch request, where 0 represents no limit")
+
+	startCmd.Flags().Int64Var(
+		&maxWSFrameSize,
+		"max-ws-frame-size",
+		rpc.DefaultMaxWSFrameSize,
+		"[OPTIONAL] Maximum size of websocket message received from client in bytes, where 0 represents no limit")
 
 	startCmd.Flags().StringVar(
 		&certFile,
@@ -268,6 +438,203 @@ func init() {
 		"",
 		"[OPTIONAL] Root directory for all generated files (e.g. database file, log file)")
 
+	startCmd.Flags().IntVar(
+		&nodeMaxIdleConns,
+		"node-max-idle-conns",
+		nodeclient.DefaultMaxIdleConnsPerNode,
+		"[OPTIONAL] Maximum number of idle keep-alive connections kept open toward each node")
+
+	startCmd.Flags().DurationVar(
+		&nodeIdleConnTimeout,
+		"node-idle-conn-timeout",
+		nodeclient.DefaultIdleConnTimeout,
+		"[OPTIONAL] Time after which idle connection toward node is closed")
+
+	startCmd.Flags().DurationVar(
+		&nodeDialTimeout,
+		"node-dial-timeout",
+		nodeclient.DefaultDialTimeout,
+		"[OPTIONAL] Maximum time to wait for connection toward node tunnel to be established")
+
+	startCmd.Flags().DurationVar(
+		&nodeResponseHeaderTimeout,
+		"node-response-header-timeout",
+		nodeclient.DefaultResponseHeaderTimeout,
+		"[OPTIONAL] Maximum time to wait for node response headers after request is sent")
+
+	startCmd.Flags().IntVar(
+		&rpcCacheSize,
+		"rpc-cache-size",
+		rpccache.DefaultSize,
+		"[OPTIONAL] Maximum number of immutable block addressed rpc responses kept in cache, where 0 disables caching")
+
+	startCmd.Flags().IntVar(
+		&blockHashesSize,
+		"block-hashes-size",
+		blocks.DefaultHashesSize,
+		"[OPTIONAL] Maximum number of recent block hashes tracked for block aware routing, where 0 disables block aware routing")
+
+	startCmd.Flags().Float64Var(
+		&archiveRewardWeight,
+		"archive-reward-weight",
+		capability.DefaultArchiveRewardWeight,
+		"[OPTIONAL] Weight of requests served by archive nodes when rewards are distributed, requests served by other nodes have weight 1")
+
+	startCmd.Flags().StringVar(
+		&rpcPolicyFile,
+		"rpc-policy-file",
+		"",
+		"[OPTIONAL] Path to JSON file with rpc method policy rules that allow, deny or rate limit methods, "+
+			"rules are applied on top of default policy which blocks node administration methods")
+
+	startCmd.Flags().StringVar(
+		&penaltyPolicyFile,
+		"penalty-policy-file",
+		"",
+		"[OPTIONAL] Path to JSON file with penalty policy that defines how nodes are penalized for each penalty reason, "+
+			"rules override default rules for same reason")
+
+	startCmd.Flags().DurationVar(
+		&rpcTimeout,
+		"rpc-timeout",
+		rpc.RequestTimeout,
+		"[OPTIONAL] Maximum time to wait for node response to rpc request")
+
+	startCmd.Flags().StringToStringVar(
+		&rpcMethodTimeouts,
+		"rpc-method-timeouts",
+		nil,
+		"[OPTIONAL] Comma separated list of method=timeout pairs (e.g. state_queryStorage=30s) that override --rpc-timeout for methods")
+
+	startCmd.Flags().IntVar(
+		&rpcRetryBudget,
+		"rpc-retry-budget",
+		rpc.DefaultRetryBudget,
+		"[OPTIONAL] Maximum number of times rpc request is retried on other nodes, where 0 represents no limit")
+
+	startCmd.Flags().StringVar(
+		&rpcErrorRulesFile,
+		"rpc-error-rules-file",
+		"",
+		"[OPTIONAL] Path to JSON file with rules that classify node errors as user errors, node faults or transient errors, "+
+			"rules are applied before default rules")
+
+	startCmd.Flags().BoolVar(
+		&anonymousAccessDisabled,
+		"anonymous-access-disabled",
+		false,
+		"[OPTIONAL] Reject rpc requests sent without valid api key")
+
+	startCmd.Flags().Int64Var(
+		&anonymousDailyQuota,
+		"anonymous-daily-quota",
+		0,
+		"[OPTIONAL] Maximum number of rpc requests without api key accepted per day, where 0 represents no limit")
+
+	startCmd.Flags().Int64Var(
+		&anonymousMonthlyQuota,
+		"anonymous-monthly-quota",
+		0,
+		"[OPTIONAL] Maximum number of rpc requests without api key accepted per month, where 0 represents no limit")
+
+	startCmd.Flags().Float64Var(
+		&rateLimit,
+		"rate-limit",
+		0,
+		"[OPTIONAL] Maximum number of rpc requests per second accepted from each client ip or api key, where 0 represents no limit")
+
+	startCmd.Flags().IntVar(
+		&rateLimitBurst,
+		"rate-limit-burst",
+		0,
+		"[OPTIONAL] Number of rpc requests client can send at once before rate limit is applied, defaults to --rate-limit value")
+
+	startCmd.Flags().IntVar(
+		&maxWSConnections,
+		"max-ws-connections",
+		0,
+		"[OPTIONAL] Maximum number of websocket connections each client ip or api key can keep open, where 0 represents no limit")
+
+	startCmd.Flags().StringSliceVar(
+		&trustedProxies,
+		"trusted-proxies",
+		nil,
+		"[OPTIONAL] Comma separated list of proxy ip addresses or CIDR networks whose X-Forwarded-For header is used to find client ip")
+
+	startCmd.Flags().StringSliceVar(
+		&corsAllowedOrigins,
+		"cors-allowed-origins",
+		origin.DefaultAllowedOrigins,
+		"[OPTIONAL] Comma separated list of browser origins allowed to call load balancer over HTTP and WS, "+
+			"origin can contain wildcard subdomain (e.g. https://*.example.com) or be * for any origin")
+
+	startCmd.Flags().StringSliceVar(
+		&corsAllowedMethods,
+		"cors-allowed-methods",
+		origin.DefaultAllowedMethods,
+		"[OPTIONAL] Comma separated list of HTTP methods allowed in cross origin requests")
+
+	startCmd.Flags().StringSliceVar(
+		&corsAllowedHeaders,
+		"cors-allowed-headers",
+		origin.DefaultAllowedHeaders,
+		"[OPTIONAL] Comma separated list of headers allowed in cross origin requests")
+
+	startCmd.Flags().BoolVar(
+		&corsAllowCredentials,
+		"cors-allow-credentials",
+		false,
+		"[OPTIONAL] Allow cross origin requests with credentials, allowed origins must be listed explicitly")
+
+	startCmd.Flags().StringVar(
+		&corsConfigFile,
+		"cors-config-file",
+		"",
+		"[OPTIONAL] Path to JSON file with origin policy, can't be used together with other cors flags")
+
+	startCmd.Flags().DurationVar(
+		&hedgeDelay,
+		"hedge-delay",
+		0,
+		"[OPTIONAL] Time after which request is also sent to second node if first node hasn't answered, where 0 disables fixed delay")
+
+	startCmd.Flags().Float64Var(
+		&hedgePercentile,
+		"hedge-percentile",
+		0,
+		"[OPTIONAL] Percentile of recent request latencies (e.g. 95) after which request is also sent to second node, "+
+			"overrides --hedge-delay once enough latencies are recorded, where 0 disables percentile delay")
+
+	startCmd.Flags().StringToStringVar(
+		&hedgeMethodDelays,
+		"hedge-method-delays",
+		nil,
+		"[OPTIONAL] Comma separated list of method=delay pairs (e.g. state_getStorage=200ms) that override hedge delay for methods")
+
+	startCmd.Flags().StringSliceVar(
+		&verifyMethods,
+		"verify-methods",
+		nil,
+		"[OPTIONAL] Comma separated list of methods whose responses are verified by comparing responses of multiple nodes")
+
+	startCmd.Flags().IntVar(
+		&verifyNodes,
+		"verify-nodes",
+		verify.DefaultNodes,
+		"[OPTIONAL] Number of distinct nodes verified request is sent to, response is returned only if majority of them agree")
+
+	startCmd.Flags().StringSliceVar(
+		&fallbackHTTPURLs,
+		"fallback-http-urls",
+		nil,
+		"[OPTIONAL] Comma separated list of http rpc endpoints requests are sent to when no node can serve them")
+
+	startCmd.Flags().StringSliceVar(
+		&fallbackWSURLs,
+		"fallback-ws-urls",
+		nil,
+		"[OPTIONAL] Comma separated list of ws rpc endpoints websocket connections are proxied to when no node accepts them")
+
 	_ = startCmd.MarkFlagRequired("private-key")
 
 	RootCmd.AddCommand(startCmd)
@@ -312,22 +679,107 @@ func startCommand(_ *cobra.Command, _ []string) {
 		}
 	}
 
+	nodeclient.Init(nodeclient.Config{
+		MaxIdleConnsPerNode:   nodeMaxIdleConns,
+		IdleConnTimeout:       nodeIdleConnTimeout,
+		DialTimeout:           nodeDialTimeout,
+		ResponseHeaderTimeout: nodeResponseHeaderTimeout,
+	})
+
+	rpccache.Init(rpcCacheSize)
+	blocks.Init(blockHashesSize)
+	err = capability.Init(archiveRewardWeight)
+	if err != nil {
+		log.Fatalf("Unable to set node capabilities because of: %v", err)
+	}
+
+	methodTimeouts, _ := rpc.ParseTimeouts(rpcMethodTimeouts)
+	rpc.SetTimeouts(rpcTimeout, methodTimeouts)
+	err = rpc.LoadErrorRules(rpcErrorRulesFile)
+	if err != nil {
+		log.Fatalf("Unable to load rpc error rules because of: %v", err)
+	}
+
+	err = policy.Init(rpcPolicyFile)
+	if err != nil {
+		log.Fatalf("Unable to load rpc method policy because of: %v", err)
+	}
+
+	err = penalty.Init(penaltyPolicyFile)
+	if err != nil {
+		log.Fatalf("Unable to load penalty policy because of: %v", err)
+	}
+	active.SetThresholds(penalty.PingInterval(), penalty.AllowedBlocksBehind())
+
+	err = origin.Init(origin.Config{
+		AllowedOrigins:   corsAllowedOrigins,
+		AllowedMethods:   corsAllowedMethods,
+		AllowedHeaders:   corsAllowedHeaders,
+		AllowCredentials: corsAllowCredentials,
+	}, corsConfigFile)
+	if err != nil {
+		log.Fatalf("Unable to set origin policy because of: %v", err)
+	}
+
+	methodDelays, _ := hedge.ParseMethodDelays(hedgeMethodDelays)
+	err = hedge.Init(hedge.Config{
+		Delay:        hedgeDelay,
+		Percentile:   hedgePercentile,
+		MethodDelays: methodDelays,
+	})
+	if err != nil {
+		log.Fatalf("Unable to set request hedging because of: %v", err)
+	}
+
+	err = verify.Init(verify.Config{
+		Methods: verifyMethods,
+		Nodes:   verifyNodes,
+	})
+	if err != nil {
+		log.Fatalf("Unable to set response verification because of: %v", err)
+	}
+
+	err = fallback.Init(fallback.Config{
+		HTTPURLs: fallbackHTTPURLs,
+		WSURLs:   fallbackWSURLs,
+	})
+	if err != nil {
+		log.Fatalf("Unable to set fallback endpoints because of: %v", err)
+	}
+
+	proxies, _ := ratelimit.ParseTrustedProxies(trustedProxies)
+	ratelimit.Init(ratelimit.Config{
+		RequestsPerSecond: rateLimit,
+		Burst:             rateLimitBurst,
+		MaxConnections:    maxWSConnections,
+		TrustedProxies:    proxies,
+	})
+
 	tunnel.StartHttpTunnelServer(tunnelServerPort, pPool)
 	loadbalancer.StartLoadBalancerServer(
 		configuration.Configuration{
-			AuthSecret:          authSecret,
-			Name:                name,
-			CertFile:            certFile,
-			KeyFile:             keyFile,
-			Capacity:            capacity,
-			Fee:                 fee,
-			Selection:           selection,
-			Port:                serverPort,
-			TunnelServerAddress: tunnelServerAddress,
-			PortPool:            pPool,
-			WhitelistEnabled:    whitelistEnabled,
-			PayoutConfiguration: payoutConfiguration,
-			RootDir:             rootDir,
+			AuthSecret:              authSecret,
+			AdminSecret:             adminSecret,
+			Name:                    name,
+			CertFile:                certFile,
+			KeyFile:                 keyFile,
+			Capacity:                capacity,
+			Fee:                     fee,
+			Selection:               selectionStrategy,
+			SubBatchSize:            subBatchSize,
+			RetryBudget:             rpcRetryBudget,
+			MaxRequestSize:          maxRequestSize,
+			MaxBatchLength:          maxBatchLength,
+			MaxWSFrameSize:          maxWSFrameSize,
+			AnonymousAccessDisabled: anonymousAccessDisabled,
+			AnonymousDailyQuota:     anonymousDailyQuota,
+			AnonymousMonthlyQuota:   anonymousMonthlyQuota,
+			Port:                    serverPort,
+			TunnelServerAddress:     tunnelServerAddress,
+			PortPool:                pPool,
+			WhitelistEnabled:        whitelistEnabled,
+			PayoutConfiguration:     payoutConfiguration,
+			RootDir:                 rootDir,
 		},
 		payoutPrivateKey,
 	)
@@ -2,11 +2,12 @@ package actions
 
 import (
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 )
 
 type Actions interface {
-	PenalizeNode(node models.Node, repositories repositories.Repos)
+	PenalizeNode(node models.Node, repositories repositories.Repos, reason penalty.Reason)
 }
 
 type actions struct{}
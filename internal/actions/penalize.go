@@ -1,17 +1,24 @@
 package actions
 
 import (
+	"github.com/NodeFactoryIo/vedran/internal/history"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/schedule/penalize"
 	log "github.com/sirupsen/logrus"
 )
 
-const InitialPenalizeIntervalInMins = 1
+// PenalizeNode records fault of node for reason and, once penalty policy decides node should be penalized,
+// removes node from active nodes, sets initial cooldown of rule for reason and schedules check for penalized
+// node by invoking penalize.ScheduleCheckForPenalizedNode. If rule has no initial cooldown node is only removed
+// from active nodes. Node that is not active is not penalized again so its scheduled check is not replaced.
+func (a *actions) PenalizeNode(node models.Node, repositories repositories.Repos, reason penalty.Reason) {
+	if !penalty.Fault(node.ID, reason) {
+		log.Debugf("Recorded %s fault of node %s", reason, node.ID)
+		return
+	}
 
-// PenalizeNode removes provided node from active nodes, sets initial cooldown of 1 minute and schedules check for
-// penalized node by invoking penalize.ScheduleCheckForPenalizedNode
-func (a *actions) PenalizeNode(node models.Node, repositories repositories.Repos) {
 	// remove node from active
 	err := repositories.NodeRepo.RemoveNodeFromActive(node.ID)
 	if err != nil {
@@ -19,14 +26,31 @@ func (a *actions) PenalizeNode(node models.Node, repositories repositories.Repos
 		return
 	}
 
+	rule := penalty.RuleFor(reason)
+	if rule.InitialCooldown == 0 {
+		history.Record(repositories, models.NodeEvent{
+			NodeID: node.ID,
+			Type:   models.NodeDeactivated,
+			Reason: string(reason),
+		})
+		log.Debugf("Removed node %s from active nodes because of %s", node.ID, reason)
+		return
+	}
+
 	// set new cooldown
-	node.Cooldown = InitialPenalizeIntervalInMins
+	node.Cooldown = rule.InitialCooldownInMins()
 	err = repositories.NodeRepo.Save(&node)
 	if err != nil {
 		log.Errorf("Failed penalizing node %s because of: %v", node.ID, err)
 		return
 	}
 
-	log.Debugf("Penalized node %s, on cooldown for 1 minute ", node.ID)
-	go penalize.ScheduleCheckForPenalizedNode(node, repositories)
+	history.Record(repositories, models.NodeEvent{
+		NodeID:   node.ID,
+		Type:     models.NodePenalized,
+		Reason:   string(reason),
+		Cooldown: node.Cooldown,
+	})
+	log.Debugf("Penalized node %s because of %s, on cooldown for %d minutes", node.ID, reason, node.Cooldown)
+	penalize.ScheduleCheckForPenalizedNode(node, reason, repositories)
 }
@@ -1,6 +1,7 @@
 package active
 
 import (
+	"github.com/NodeFactoryIo/vedran/internal/history"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	log "github.com/sirupsen/logrus"
@@ -8,12 +9,25 @@ import (
 )
 
 const (
-	IntervalFromLastPing = 10 * time.Second
-	AllowedBlocksBehind  = 10
+	IntervalFromLastProbe = 30 * time.Second
 )
 
+// IntervalFromLastPing and AllowedBlocksBehind are set from penalty policy by SetThresholds
+var (
+	IntervalFromLastPing       = 10 * time.Second
+	AllowedBlocksBehind  int64 = 10
+)
+
+// SetThresholds sets interval in which node has to ping and number of blocks node can lag behind
+// to be considered active, it should be called before any node is checked
+func SetThresholds(intervalFromLastPing time.Duration, allowedBlocksBehind int64) {
+	IntervalFromLastPing = intervalFromLastPing
+	AllowedBlocksBehind = allowedBlocksBehind
+}
+
 // CheckIfNodeActive checks if nodes last recorded ping is in last IntervalFromLastPing and if nodes last recorded
-// BestBlockHeight and FinalizedBlockHeight are lagging more than AllowedBlocksBehind blocks
+// BestBlockHeight and FinalizedBlockHeight are lagging more than AllowedBlocksBehind blocks, both as reported
+// by node and as observed by probing node
 func CheckIfNodeActive(node models.Node, repos *repositories.Repos) (bool, error) {
 	isPingActive, err := CheckIfPingActive(node.ID, repos)
 	if !isPingActive {
@@ -25,6 +39,11 @@ func CheckIfNodeActive(node models.Node, repos *repositories.Repos) (bool, error
 		return false, err
 	}
 
+	isProbeValid, err := CheckIfProbeValid(node.ID, repos)
+	if !isProbeValid {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -35,7 +54,7 @@ func CheckIfPingActive(nodeID string, repos *repositories.Repos) (bool, error) {
 		return false, err
 	}
 
-	// more than 10 seconds passed from last ping
+	// more than IntervalFromLastPing passed from last ping
 	if lastPing.Timestamp.Add(IntervalFromLastPing).Before(time.Now()) {
 		log.Debugf("Node %s not active as last ping was at %v", nodeID, lastPing.Timestamp)
 		return false, nil
@@ -71,7 +90,49 @@ func CheckIfMetricsValid(nodeID string, repos *repositories.Repos) (bool, error)
 	return true, nil
 }
 
-// ActivateNodeIfReady adds node to active nodes if latest metrics are valid and node is not penalized
+// CheckIfProbeValid checks if node was probed in last IntervalFromLastProbe, if it was healthy and if observed
+// BestBlockHeight and FinalizedBlockHeight are lagging more than AllowedBlocksBehind blocks
+func CheckIfProbeValid(nodeID string, repos *repositories.Repos) (bool, error) {
+	probe, err := repos.ProbeRepo.FindByNodeID(nodeID)
+	if err != nil {
+		if err.Error() == "not found" {
+			log.Debugf("Node %s not active as it was not probed yet", nodeID)
+			return false, nil
+		}
+		return false, err
+	}
+
+	if probe.Timestamp.Add(IntervalFromLastProbe).Before(time.Now()) {
+		log.Debugf("Node %s not active as last probe was at %v", nodeID, probe.Timestamp)
+		return false, nil
+	}
+
+	if !probe.Healthy {
+		log.Debugf("Node %s not active as last probe was unhealthy: %s", nodeID, probe.Error)
+		return false, nil
+	}
+
+	latestBlockMetrics, err := repos.ProbeRepo.GetLatestBlockMetrics()
+	if err != nil {
+		return false, err
+	}
+	if probe.BestBlockHeight <= (latestBlockMetrics.BestBlockHeight-AllowedBlocksBehind) ||
+		probe.FinalizedBlockHeight <= (latestBlockMetrics.FinalizedBlockHeight-AllowedBlocksBehind) {
+		log.Debugf(
+			"Node %s not active as probe check failed. "+
+				"Observed: BestBlockHeight[%d], FinalizedBlockHeight[%d] "+
+				"Best observed in pool: BestBlockHeight[%d], FinalizedBlockHeight[%d]",
+			nodeID,
+			probe.BestBlockHeight, probe.FinalizedBlockHeight,
+			latestBlockMetrics.BestBlockHeight, latestBlockMetrics.FinalizedBlockHeight,
+		)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ActivateNodeIfReady adds node to active nodes if latest metrics and probe are valid and node is not penalized
 func ActivateNodeIfReady(nodeID string, repos repositories.Repos) error {
 	nodeIsOnCooldown, err := repos.NodeRepo.IsNodeOnCooldown(nodeID)
 	if nodeIsOnCooldown {
@@ -83,13 +144,58 @@ func ActivateNodeIfReady(nodeID string, repos repositories.Repos) error {
 		return err
 	}
 
-	if metricsValid {
+	if !metricsValid {
+		return nil
+	}
+
+	probeValid, err := CheckIfProbeValid(nodeID, &repos)
+	if err != nil {
+		return err
+	}
+
+	if probeValid {
 		err = repos.NodeRepo.AddNodeToActive(nodeID)
 		if err != nil {
 			log.Errorf("Unable to add node %s to active nodes, because of %v", nodeID, err)
+			return nil
 		}
+		history.Record(repos, models.NodeEvent{NodeID: nodeID, Type: models.NodeActivated})
 		log.Debugf("Node %s added to active nodes", nodeID)
 	}
 
 	return nil
 }
+
+// RestoreActiveNodes adds nodes that were active before load balancer was restarted back to active nodes,
+// if their last ping is in last IntervalFromLastPing, their metrics are valid and they are not penalized.
+// Nodes that are not restored are activated as usual once they are ready.
+func RestoreActiveNodes(repos repositories.Repos) {
+	for _, nodeID := range repos.NodeRepo.GetPreviouslyActiveNodes() {
+		nodeIsOnCooldown, err := repos.NodeRepo.IsNodeOnCooldown(nodeID)
+		if err != nil || nodeIsOnCooldown {
+			continue
+		}
+
+		pingActive, err := CheckIfPingActive(nodeID, &repos)
+		if err != nil || !pingActive {
+			continue
+		}
+
+		metricsValid, err := CheckIfMetricsValid(nodeID, &repos)
+		if err != nil || !metricsValid {
+			continue
+		}
+
+		err = repos.NodeRepo.AddNodeToActive(nodeID)
+		if err != nil {
+			log.Errorf("Unable to restore node %s to active nodes, because of %v", nodeID, err)
+			continue
+		}
+		history.Record(repos, models.NodeEvent{
+			NodeID:  nodeID,
+			Type:    models.NodeActivated,
+			Details: "restored after restart",
+		})
+		log.Debugf("Node %s restored to active nodes", nodeID)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"testing"
 	"time"
 )
@@ -226,12 +227,25 @@ func TestCheckIfNodeActive(t *testing.T) {
 			metricsRepoMock.On("FindByID", test.node.ID).Return(test.nodeMetrics, test.nodeMetricsError)
 			metricsRepoMock.On("GetLatestBlockMetrics").Return(test.latestMetrics, test.latestMetricsError)
 			recordRepoMock := mocks.RecordRepository{}
+			probeRepoMock := mocks.ProbeRepository{}
+			probeRepoMock.On("FindByNodeID", test.node.ID).Return(&models.Probe{
+				NodeId:               test.node.ID,
+				Timestamp:            time.Now(),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			}, nil)
+			probeRepoMock.On("GetLatestBlockMetrics").Return(&models.LatestBlockMetrics{
+				BestBlockHeight:      1001,
+				FinalizedBlockHeight: 998,
+			}, nil)
 
 			result, err := CheckIfNodeActive(test.node, &repositories.Repos{
 				NodeRepo:    &nodeRepoMock,
 				PingRepo:    &pingRepoMock,
 				MetricsRepo: &metricsRepoMock,
 				RecordRepo:  &recordRepoMock,
+				ProbeRepo:   &probeRepoMock,
 			})
 
 			assert.Equal(t, result, test.expectedResult)
@@ -239,3 +253,145 @@ func TestCheckIfNodeActive(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckIfProbeValid(t *testing.T) {
+	tests := []struct {
+		name               string
+		nodeID             string
+		probe              *models.Probe
+		probeError         error
+		latestMetrics      *models.LatestBlockMetrics
+		latestMetricsError error
+		expectedResult     bool
+		expectedError      error
+	}{
+		{
+			name:   "valid probe",
+			nodeID: "1",
+			probe: &models.Probe{
+				NodeId:               "1",
+				Timestamp:            time.Now(),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			latestMetrics: &models.LatestBlockMetrics{
+				BestBlockHeight:      1001,
+				FinalizedBlockHeight: 998,
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "node not probed yet",
+			nodeID:         "1",
+			probe:          nil,
+			probeError:     errors.New("not found"),
+			expectedResult: false,
+			expectedError:  nil,
+		},
+		{
+			name:           "probe repo fails",
+			nodeID:         "1",
+			probe:          nil,
+			probeError:     errors.New("probe-error"),
+			expectedResult: false,
+			expectedError:  errors.New("probe-error"),
+		},
+		{
+			name:   "probe old",
+			nodeID: "1",
+			probe: &models.Probe{
+				NodeId:               "1",
+				Timestamp:            time.Unix(10, 10),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			expectedResult: false,
+		},
+		{
+			name:   "probe unhealthy",
+			nodeID: "1",
+			probe: &models.Probe{
+				NodeId:    "1",
+				Timestamp: time.Now(),
+				Healthy:   false,
+				Error:     "node is syncing",
+			},
+			expectedResult: false,
+		},
+		{
+			name:   "observed blocks lagging",
+			nodeID: "1",
+			probe: &models.Probe{
+				NodeId:               "1",
+				Timestamp:            time.Now(),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			latestMetrics: &models.LatestBlockMetrics{
+				BestBlockHeight:      1020,
+				FinalizedBlockHeight: 1015,
+			},
+			expectedResult: false,
+		},
+		{
+			name:   "probe repo fails on latest metrics",
+			nodeID: "1",
+			probe: &models.Probe{
+				NodeId:    "1",
+				Timestamp: time.Now(),
+				Healthy:   true,
+			},
+			latestMetricsError: errors.New("probe-error"),
+			expectedResult:     false,
+			expectedError:      errors.New("probe-error"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			probeRepoMock := mocks.ProbeRepository{}
+			probeRepoMock.On("FindByNodeID", test.nodeID).Return(test.probe, test.probeError)
+			probeRepoMock.On("GetLatestBlockMetrics").Return(test.latestMetrics, test.latestMetricsError)
+
+			result, err := CheckIfProbeValid(test.nodeID, &repositories.Repos{
+				ProbeRepo: &probeRepoMock,
+			})
+
+			assert.Equal(t, test.expectedResult, result)
+			assert.Equal(t, test.expectedError, err)
+		})
+	}
+}
+
+func TestRestoreActiveNodes(t *testing.T) {
+	nodeRepoMock := mocks.NodeRepository{}
+	nodeRepoMock.On("GetPreviouslyActiveNodes").Return([]string{"fresh", "stale", "lagging", "penalized"})
+	nodeRepoMock.On("IsNodeOnCooldown", "penalized").Return(true, nil)
+	nodeRepoMock.On("IsNodeOnCooldown", mock.Anything).Return(false, nil)
+	nodeRepoMock.On("AddNodeToActive", "fresh").Return(nil).Once()
+
+	pingRepoMock := mocks.PingRepository{}
+	pingRepoMock.On("FindByNodeID", "stale").Return(&models.Ping{NodeId: "stale", Timestamp: time.Unix(10, 10)}, nil)
+	pingRepoMock.On("FindByNodeID", mock.Anything).Return(&models.Ping{Timestamp: time.Now()}, nil)
+
+	metricsRepoMock := mocks.MetricsRepository{}
+	metricsRepoMock.On("FindByID", "lagging").Return(&models.Metrics{BestBlockHeight: 900, FinalizedBlockHeight: 895}, nil)
+	metricsRepoMock.On("FindByID", mock.Anything).Return(&models.Metrics{BestBlockHeight: 1000, FinalizedBlockHeight: 995}, nil)
+	metricsRepoMock.On("GetLatestBlockMetrics").Return(&models.LatestBlockMetrics{BestBlockHeight: 1001, FinalizedBlockHeight: 998}, nil)
+
+	nodeEventRepoMock := mocks.NodeEventRepository{}
+	nodeEventRepoMock.On("Save", mock.Anything).Return(nil)
+
+	RestoreActiveNodes(repositories.Repos{
+		NodeRepo:      &nodeRepoMock,
+		PingRepo:      &pingRepoMock,
+		MetricsRepo:   &metricsRepoMock,
+		NodeEventRepo: &nodeEventRepoMock,
+	})
+
+	nodeRepoMock.AssertCalled(t, "AddNodeToActive", "fresh")
+	nodeRepoMock.AssertNumberOfCalls(t, "AddNodeToActive", 1)
+	nodeEventRepoMock.AssertNumberOfCalls(t, "Save", 1)
+}
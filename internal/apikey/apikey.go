@@ -0,0 +1,389 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	Header     = "X-API-Key"
+	QueryParam = "apikey"
+	PathVar    = "key"
+
+	// AnonymousName is name under which usage of requests without api key is reported
+	AnonymousName = "anonymous"
+
+	keyLength = 32
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("api key with same name already exists")
+	ErrInvalidName   = errors.New("invalid api key name")
+)
+
+var now = time.Now
+
+// AnonymousPolicy defines if requests without api key are accepted and their shared quotas,
+// quota equal to 0 is unlimited
+type AnonymousPolicy struct {
+	Enabled      bool
+	DailyQuota   int64
+	MonthlyQuota int64
+}
+
+// Keys holds api keys in memory and counts their usage, changed keys are written to
+// repository on Flush. Writes to repository are serialized by saveMutex so flushed usage
+// can't overwrite newer key changes.
+type Keys struct {
+	repo      repositories.APIKeyRepository
+	saveMutex sync.Mutex
+
+	mutex     sync.Mutex
+	byKey     map[string]*models.APIKey
+	byName    map[string]*models.APIKey
+	anonymous AnonymousPolicy
+	anonUsage models.APIKeyUsage
+	dirty     map[string]bool
+}
+
+// New creates api keys without any key, repo can be nil in which case keys are not persisted
+func New(repo repositories.APIKeyRepository, anonymous AnonymousPolicy) *Keys {
+	return &Keys{
+		repo:      repo,
+		byKey:     make(map[string]*models.APIKey),
+		byName:    make(map[string]*models.APIKey),
+		anonymous: anonymous,
+		dirty:     make(map[string]bool),
+	}
+}
+
+// Load loads all api keys from repository
+func (k *Keys) Load() error {
+	if k.repo == nil {
+		return nil
+	}
+	apiKeys, err := k.repo.GetAll()
+	if err != nil {
+		if err.Error() == "not found" {
+			return nil
+		}
+		return err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for i := range *apiKeys {
+		apiKey := (*apiKeys)[i]
+		k.byKey[apiKey.Key] = &apiKey
+		k.byName[apiKey.Name] = &apiKey
+	}
+	return nil
+}
+
+// FromRequest returns api key sent in header, query param or path segment, empty string is
+// returned for anonymous requests
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get(Header); key != "" {
+		return key
+	}
+	if key := r.URL.Query().Get(QueryParam); key != "" {
+		return key
+	}
+	return mux.Vars(r)[PathVar]
+}
+
+// Authorize returns json rpc error if key is not valid or if key is empty and anonymous access is disabled
+func (k *Keys) Authorize(key string) *rpc.RPCError {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	_, rpcErr := k.findLocked(key)
+	return rpcErr
+}
+
+// Use authorizes key and counts requests against key quotas, json rpc error is returned if
+// key is not valid or quota would be exceeded in which case requests are not counted
+func (k *Keys) Use(key string, requests int) *rpc.RPCError {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	apiKey, rpcErr := k.findLocked(key)
+	if rpcErr != nil {
+		return rpcErr
+	}
+
+	usage := &k.anonUsage
+	dailyQuota, monthlyQuota := k.anonymous.DailyQuota, k.anonymous.MonthlyQuota
+	if apiKey != nil {
+		usage = &apiKey.Usage
+		dailyQuota, monthlyQuota = apiKey.DailyQuota, apiKey.MonthlyQuota
+	}
+	resetUsage(usage, now())
+
+	n := int64(requests)
+	if dailyQuota > 0 && usage.DailyRequests+n > dailyQuota {
+		return &rpc.RPCError{Code: rpc.LimitExceeded, Message: "Daily request quota exceeded"}
+	}
+	if monthlyQuota > 0 && usage.MonthlyRequests+n > monthlyQuota {
+		return &rpc.RPCError{Code: rpc.LimitExceeded, Message: "Monthly request quota exceeded"}
+	}
+	usage.DailyRequests += n
+	usage.MonthlyRequests += n
+	usage.TotalRequests += n
+	if apiKey != nil {
+		k.dirty[apiKey.Name] = true
+	}
+	return nil
+}
+
+// Verified returns if responses to requests with key should be verified by multiple nodes,
+// false is returned for invalid and empty keys
+func (k *Keys) Verified(key string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	apiKey, ok := k.byKey[key]
+	return ok && apiKey.Verified
+}
+
+// findLocked returns api key for key or nil for anonymous requests, mutex must be held by caller
+func (k *Keys) findLocked(key string) (*models.APIKey, *rpc.RPCError) {
+	if key == "" {
+		if !k.anonymous.Enabled {
+			return nil, &rpc.RPCError{Code: rpc.Unauthorized, Message: "API key required"}
+		}
+		return nil, nil
+	}
+	apiKey, ok := k.byKey[key]
+	if !ok || apiKey.Disabled {
+		return nil, &rpc.RPCError{Code: rpc.Unauthorized, Message: "Invalid API key"}
+	}
+	return apiKey, nil
+}
+
+// resetUsage resets daily and monthly counters if day or month changed
+func resetUsage(usage *models.APIKeyUsage, t time.Time) {
+	day, month := t.Format("2006-01-02"), t.Format("2006-01")
+	if usage.Day != day {
+		usage.Day = day
+		usage.DailyRequests = 0
+	}
+	if usage.Month != month {
+		usage.Month = month
+		usage.MonthlyRequests = 0
+	}
+}
+
+// Create creates api key with provided name, quotas and verified flag and returns it with generated key
+func (k *Keys) Create(name string, dailyQuota int64, monthlyQuota int64, verified bool) (*models.APIKey, error) {
+	if name == "" || name == AnonymousName {
+		return nil, ErrInvalidName
+	}
+
+	secret := make([]byte, keyLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	k.saveMutex.Lock()
+	defer k.saveMutex.Unlock()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, ok := k.byName[name]; ok {
+		return nil, ErrAlreadyExists
+	}
+
+	apiKey := &models.APIKey{
+		Name:         name,
+		Key:          hex.EncodeToString(secret),
+		DailyQuota:   dailyQuota,
+		MonthlyQuota: monthlyQuota,
+		Verified:     verified,
+		Created:      now(),
+	}
+	if err := k.save(apiKey); err != nil {
+		return nil, err
+	}
+	k.byKey[apiKey.Key] = apiKey
+	k.byName[apiKey.Name] = apiKey
+
+	created := *apiKey
+	return &created, nil
+}
+
+// Update changes quotas, disabled and verified flags of api key with provided name
+func (k *Keys) Update(
+	name string, dailyQuota int64, monthlyQuota int64, disabled bool, verified bool,
+) (*models.APIKey, error) {
+	k.saveMutex.Lock()
+	defer k.saveMutex.Unlock()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	apiKey, ok := k.byName[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	updated := *apiKey
+	updated.DailyQuota = dailyQuota
+	updated.MonthlyQuota = monthlyQuota
+	updated.Disabled = disabled
+	updated.Verified = verified
+	if err := k.save(&updated); err != nil {
+		return nil, err
+	}
+	*apiKey = updated
+	delete(k.dirty, name)
+
+	return &updated, nil
+}
+
+// Delete deletes api key with provided name
+func (k *Keys) Delete(name string) error {
+	k.saveMutex.Lock()
+	defer k.saveMutex.Unlock()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	apiKey, ok := k.byName[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.repo != nil {
+		if err := k.repo.Delete(apiKey); err != nil {
+			return err
+		}
+	}
+	delete(k.byKey, apiKey.Key)
+	delete(k.byName, name)
+	delete(k.dirty, name)
+	return nil
+}
+
+// List returns all api keys sorted by name without their secret keys
+func (k *Keys) List() []models.APIKey {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	t := now()
+	apiKeys := make([]models.APIKey, 0, len(k.byName))
+	for _, apiKey := range k.byName {
+		resetUsage(&apiKey.Usage, t)
+		listed := *apiKey
+		listed.Key = ""
+		apiKeys = append(apiKeys, listed)
+	}
+	sort.Slice(apiKeys, func(i, j int) bool { return apiKeys[i].Name < apiKeys[j].Name })
+	return apiKeys
+}
+
+// Usage returns usage of each api key and usage of anonymous requests, by name
+func (k *Keys) Usage() map[string]models.APIKeyUsage {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	t := now()
+	usage := make(map[string]models.APIKeyUsage, len(k.byName)+1)
+	for name, apiKey := range k.byName {
+		resetUsage(&apiKey.Usage, t)
+		usage[name] = apiKey.Usage
+	}
+	resetUsage(&k.anonUsage, t)
+	usage[AnonymousName] = k.anonUsage
+	return usage
+}
+
+// Flush saves usage counters of api keys used since last flush
+func (k *Keys) Flush() {
+	k.saveMutex.Lock()
+	defer k.saveMutex.Unlock()
+	k.mutex.Lock()
+	var changed []models.APIKey
+	for name := range k.dirty {
+		changed = append(changed, *k.byName[name])
+	}
+	k.dirty = make(map[string]bool)
+	k.mutex.Unlock()
+
+	for i := range changed {
+		err := k.save(&changed[i])
+		if err != nil {
+			log.Errorf("Failed saving usage of api key %s because of: %v", changed[i].Name, err)
+		}
+	}
+}
+
+func (k *Keys) save(apiKey *models.APIKey) error {
+	if k.repo == nil {
+		return nil
+	}
+	return k.repo.Save(apiKey)
+}
+
+var keys = New(nil, AnonymousPolicy{Enabled: true})
+
+// Init replaces default api keys with keys loaded from repository
+func Init(repo repositories.APIKeyRepository, anonymous AnonymousPolicy) error {
+	k := New(repo, anonymous)
+	if err := k.Load(); err != nil {
+		return fmt.Errorf("unable to load api keys because of %v", err)
+	}
+	keys = k
+	return nil
+}
+
+// Authorize authorizes key on default api keys
+func Authorize(key string) *rpc.RPCError {
+	return keys.Authorize(key)
+}
+
+// Use counts requests against key quotas on default api keys
+func Use(key string, requests int) *rpc.RPCError {
+	return keys.Use(key, requests)
+}
+
+// Verified checks if key is verified on default api keys
+func Verified(key string) bool {
+	return keys.Verified(key)
+}
+
+// Create creates api key on default api keys
+func Create(name string, dailyQuota int64, monthlyQuota int64, verified bool) (*models.APIKey, error) {
+	return keys.Create(name, dailyQuota, monthlyQuota, verified)
+}
+
+// Update updates api key on default api keys
+func Update(name string, dailyQuota int64, monthlyQuota int64, disabled bool, verified bool) (*models.APIKey, error) {
+	return keys.Update(name, dailyQuota, monthlyQuota, disabled, verified)
+}
+
+// Delete deletes api key from default api keys
+func Delete(name string) error {
+	return keys.Delete(name)
+}
+
+// List lists default api keys
+func List() []models.APIKey {
+	return keys.List()
+}
+
+// Usage returns usage of default api keys
+func Usage() map[string]models.APIKeyUsage {
+	return keys.Usage()
+}
+
+// Flush saves usage of default api keys
+func Flush() {
+	keys.Flush()
+}
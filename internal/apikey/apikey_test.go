@@ -0,0 +1,186 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestKeys_Use(t *testing.T) {
+	tests := []struct {
+		name          string
+		anonymous     AnonymousPolicy
+		apiKey        models.APIKey
+		key           string
+		requests      []int
+		expectedCodes []int
+	}{
+		{
+			name:          "anonymous requests are accepted without quota",
+			anonymous:     AnonymousPolicy{Enabled: true},
+			requests:      []int{1, 100},
+			expectedCodes: []int{0, 0},
+		},
+		{
+			name:          "anonymous requests are rejected if anonymous access is disabled",
+			anonymous:     AnonymousPolicy{Enabled: false},
+			requests:      []int{1},
+			expectedCodes: []int{rpc.Unauthorized},
+		},
+		{
+			name:          "anonymous requests are limited by anonymous daily quota",
+			anonymous:     AnonymousPolicy{Enabled: true, DailyQuota: 3},
+			requests:      []int{2, 2, 1},
+			expectedCodes: []int{0, rpc.LimitExceeded, 0},
+		},
+		{
+			name:          "unknown key is rejected",
+			anonymous:     AnonymousPolicy{Enabled: true},
+			apiKey:        models.APIKey{Name: "test", Key: "secret"},
+			key:           "invalid",
+			requests:      []int{1},
+			expectedCodes: []int{rpc.Unauthorized},
+		},
+		{
+			name:          "disabled key is rejected",
+			anonymous:     AnonymousPolicy{Enabled: true},
+			apiKey:        models.APIKey{Name: "test", Key: "secret", Disabled: true},
+			key:           "secret",
+			requests:      []int{1},
+			expectedCodes: []int{rpc.Unauthorized},
+		},
+		{
+			name:          "key requests are limited by daily quota",
+			anonymous:     AnonymousPolicy{Enabled: false},
+			apiKey:        models.APIKey{Name: "test", Key: "secret", DailyQuota: 2},
+			key:           "secret",
+			requests:      []int{1, 1, 1},
+			expectedCodes: []int{0, 0, rpc.LimitExceeded},
+		},
+		{
+			name:          "key requests are limited by monthly quota",
+			anonymous:     AnonymousPolicy{Enabled: true},
+			apiKey:        models.APIKey{Name: "test", Key: "secret", MonthlyQuota: 5},
+			key:           "secret",
+			requests:      []int{5, 1},
+			expectedCodes: []int{0, rpc.LimitExceeded},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys := New(nil, test.anonymous)
+			if test.apiKey.Name != "" {
+				keys.byKey[test.apiKey.Key] = &test.apiKey
+				keys.byName[test.apiKey.Name] = &test.apiKey
+			}
+
+			for i, requests := range test.requests {
+				rpcErr := keys.Use(test.key, requests)
+				if test.expectedCodes[i] == 0 {
+					assert.Nil(t, rpcErr)
+				} else {
+					assert.NotNil(t, rpcErr)
+					assert.Equal(t, test.expectedCodes[i], rpcErr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestKeys_Use_ResetsDailyUsage(t *testing.T) {
+	defer func() { now = time.Now }()
+	day := time.Date(2021, 1, 31, 23, 0, 0, 0, time.UTC)
+	now = func() time.Time { return day }
+
+	keys := New(nil, AnonymousPolicy{Enabled: true})
+	apiKey := &models.APIKey{Name: "test", Key: "secret", DailyQuota: 1}
+	keys.byKey[apiKey.Key] = apiKey
+	keys.byName[apiKey.Name] = apiKey
+
+	assert.Nil(t, keys.Use("secret", 1))
+	assert.NotNil(t, keys.Use("secret", 1))
+
+	day = day.Add(2 * time.Hour)
+	assert.Nil(t, keys.Use("secret", 1))
+
+	usage := keys.Usage()["test"]
+	assert.Equal(t, int64(1), usage.DailyRequests)
+	assert.Equal(t, int64(1), usage.MonthlyRequests)
+	assert.Equal(t, int64(2), usage.TotalRequests)
+	assert.Equal(t, "2021-02", usage.Month)
+}
+
+func TestKeys_CreateUpdateDelete(t *testing.T) {
+	repoMock := mocks.APIKeyRepository{}
+	repoMock.On("Save", mock.Anything).Return(nil)
+	repoMock.On("Delete", mock.Anything).Return(nil)
+	keys := New(&repoMock, AnonymousPolicy{Enabled: true})
+
+	created, err := keys.Create("test", 10, 0, false)
+	assert.NoError(t, err)
+	assert.Len(t, created.Key, 2*keyLength)
+	assert.Nil(t, keys.Authorize(created.Key))
+	assert.False(t, keys.Verified(created.Key))
+
+	_, err = keys.Create("test", 10, 0, false)
+	assert.Equal(t, ErrAlreadyExists, err)
+	_, err = keys.Create(AnonymousName, 10, 0, false)
+	assert.Equal(t, ErrInvalidName, err)
+
+	assert.Nil(t, keys.Use(created.Key, 1))
+	keys.Flush()
+	repoMock.AssertNumberOfCalls(t, "Save", 2)
+
+	updated, err := keys.Update("test", 20, 100, true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), updated.DailyQuota)
+	assert.True(t, keys.Verified(created.Key))
+	assert.False(t, keys.Verified(""))
+	assert.Equal(t, int64(1), updated.Usage.TotalRequests)
+	assert.NotNil(t, keys.Authorize(created.Key))
+
+	listed := keys.List()
+	assert.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Key)
+
+	_, err = keys.Update("missing", 0, 0, false, false)
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NoError(t, keys.Delete("test"))
+	assert.Equal(t, ErrNotFound, keys.Delete("test"))
+	assert.Len(t, keys.List(), 0)
+}
+
+func TestKeys_Load(t *testing.T) {
+	repoMock := mocks.APIKeyRepository{}
+	repoMock.On("GetAll").Return(&[]models.APIKey{{Name: "test", Key: "secret"}}, nil)
+	keys := New(&repoMock, AnonymousPolicy{Enabled: false})
+
+	assert.NoError(t, keys.Load())
+	assert.Nil(t, keys.Authorize("secret"))
+
+	repoMock = mocks.APIKeyRepository{}
+	repoMock.On("GetAll").Return(nil, errors.New("not found"))
+	keys = New(&repoMock, AnonymousPolicy{Enabled: false})
+	assert.NoError(t, keys.Load())
+}
+
+func TestFromRequest(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/?apikey=query", nil)
+	assert.Equal(t, "query", FromRequest(r))
+
+	r.Header.Set(Header, "header")
+	assert.Equal(t, "header", FromRequest(r))
+
+	r, _ = http.NewRequest("POST", "/path", nil)
+	r = mux.SetURLVars(r, map[string]string{PathVar: "path"})
+	assert.Equal(t, "path", FromRequest(r))
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var adminSecret string
+
+// SetAdminSecret sets secret admin api is authenticated with, falling back to ADMIN_SECRET env variable.
+// Admin api is disabled if secret is not provided. Secret must be different from auth secret, so node
+// can't use admin api. It should be called after SetAuthSecret.
+func SetAdminSecret(secret string) error {
+	adminSecret = secret
+	if adminSecret == "" {
+		adminSecret = os.Getenv("ADMIN_SECRET")
+	}
+	if adminSecret != "" && adminSecret == authSecret {
+		adminSecret = ""
+		return errors.New("admin secret must be different from auth secret")
+	}
+	return nil
+}
+
+// AdminEnabled returns if admin secret is set
+func AdminEnabled() bool {
+	return adminSecret != ""
+}
+
+// AdminMiddleware allows request only if X-Admin-Secret header matches admin secret
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !AdminEnabled() {
+			http.Error(w, "Admin api disabled", http.StatusForbidden)
+			return
+		}
+
+		secret := r.Header.Get("X-Admin-Secret")
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(adminSecret)) != 1 {
+			log.Warnf("Unauthorized admin request %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetAdminSecret(t *testing.T) {
+	authSecret = "auth-secret"
+	defer func() { authSecret = "" }()
+
+	assert.NoError(t, SetAdminSecret("admin-secret"))
+	assert.True(t, AdminEnabled())
+
+	_ = os.Setenv("ADMIN_SECRET", "admin-secret-env")
+	assert.NoError(t, SetAdminSecret(""))
+	assert.Equal(t, "admin-secret-env", adminSecret)
+	_ = os.Unsetenv("ADMIN_SECRET")
+
+	assert.NoError(t, SetAdminSecret(""))
+	assert.False(t, AdminEnabled())
+
+	assert.Error(t, SetAdminSecret("auth-secret"))
+	assert.False(t, AdminEnabled())
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		adminSecret string
+		header      string
+		status      int
+	}{
+		{name: "Authorized request", adminSecret: "admin-secret", header: "admin-secret", status: http.StatusOK},
+		{name: "Invalid secret", adminSecret: "admin-secret", header: "auth-secret", status: http.StatusUnauthorized},
+		{name: "Missing secret", adminSecret: "admin-secret", header: "", status: http.StatusUnauthorized},
+		{name: "Admin api disabled", adminSecret: "", header: "", status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adminSecret = test.adminSecret
+			defer func() { adminSecret = "" }()
+
+			req, _ := http.NewRequest("GET", "/api/v1/admin/nodes", nil)
+			req.Header.Add("X-Admin-Secret", test.header)
+			rr := httptest.NewRecorder()
+
+			handler := AdminMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, test.status, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package blocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHashesSize is number of recent block hashes with known height held by tracker
+	DefaultHashesSize = 10000
+	// NodeHashesSize is number of recent block hashes held for each node
+	NodeHashesSize = 256
+)
+
+var nullResult = []byte("null")
+
+// hashes is size bounded map of block hashes to heights that evicts oldest hash when full,
+// it is not safe for concurrent use
+type hashes struct {
+	heights map[string]int64
+	order   []string
+	next    int
+}
+
+func newHashes(size int) *hashes {
+	return &hashes{
+		heights: make(map[string]int64),
+		order:   make([]string, 0, size),
+	}
+}
+
+func (h *hashes) add(hash string, height int64) {
+	if cap(h.order) == 0 {
+		return
+	}
+	if _, ok := h.heights[hash]; ok {
+		h.heights[hash] = height
+		return
+	}
+	if len(h.order) < cap(h.order) {
+		h.order = append(h.order, hash)
+	} else {
+		delete(h.heights, h.order[h.next])
+		h.order[h.next] = hash
+		h.next = (h.next + 1) % len(h.order)
+	}
+	h.heights[hash] = height
+}
+
+func (h *hashes) get(hash string) (int64, bool) {
+	height, ok := h.heights[hash]
+	return height, ok
+}
+
+type node struct {
+	height int64
+	hashes *hashes
+}
+
+// Block is block required by request, hash is empty for requests addressed by block number
+type Block struct {
+	Hash   string
+	Height int64
+}
+
+// Tracker tracks best block height and recent block hashes of each node, as reported in metrics,
+// observed by probing and learned from node responses, so requests for recent blocks can be routed
+// only to nodes that already have requested block
+type Tracker struct {
+	mutex   sync.RWMutex
+	enabled bool
+	hashes  *hashes
+	nodes   map[string]*node
+}
+
+// NewTracker creates tracker that holds up to size recent block hashes, size 0 disables block aware routing
+func NewTracker(size int) *Tracker {
+	if size < 0 {
+		size = 0
+	}
+	return &Tracker{
+		enabled: size > 0,
+		hashes:  newHashes(size),
+		nodes:   make(map[string]*node),
+	}
+}
+
+// nodeLocked returns tracked state of node, mutex must be held by caller
+func (t *Tracker) nodeLocked(nodeID string) *node {
+	n, ok := t.nodes[nodeID]
+	if !ok {
+		n = &node{hashes: newHashes(NodeHashesSize)}
+		t.nodes[nodeID] = n
+	}
+	return n
+}
+
+// SetNodeHeight sets best block height of node as reported by node or observed by probing
+func (t *Tracker) SetNodeHeight(nodeID string, height int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nodeLocked(nodeID).height = height
+}
+
+// AddNodeHash records that node has block with hash on height, best height of node is raised to height
+func (t *Tracker) AddNodeHash(nodeID string, hash string, height int64) {
+	key, ok := normalizeHash(hash)
+	if !ok {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.hashes.add(key, height)
+	n := t.nodeLocked(nodeID)
+	n.hashes.add(key, height)
+	if height > n.height {
+		n.height = height
+	}
+}
+
+// Learn records block hashes and heights contained in successful node response to request
+func (t *Tracker) Learn(nodeID string, request rpc.RPCRequest, response []byte) {
+	var rpcResponse rpc.RPCResponse
+	err := json.Unmarshal(response, &rpcResponse)
+	if err != nil || rpcResponse.Error != nil || rpcResponse.Result == nil {
+		return
+	}
+	result := *rpcResponse.Result
+	if bytes.Equal(bytes.TrimSpace(result), nullResult) {
+		return
+	}
+
+	switch request.Method {
+	case getHeader, getBlock:
+		number, ok := resultBlockNumber(request.Method, result)
+		if !ok {
+			return
+		}
+		if hash, ok := blockHashParam(request.Method, request.Params); ok {
+			t.AddNodeHash(nodeID, hash, number)
+			return
+		}
+		// header or block requested without hash is best block of node
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if n := t.nodeLocked(nodeID); number > n.height {
+			n.height = number
+		}
+	default:
+		number, ok := blockNumberParam(request.Method, request.Params)
+		if !ok {
+			return
+		}
+		var hash string
+		if json.Unmarshal(result, &hash) == nil {
+			t.AddNodeHash(nodeID, hash, number)
+		}
+	}
+}
+
+// RequiredBlock returns block request is addressed to, false is returned if request isn't addressed
+// to block or if height of requested block hash isn't known
+func (t *Tracker) RequiredBlock(request rpc.RPCRequest) (Block, bool) {
+	if number, ok := blockNumberParam(request.Method, request.Params); ok {
+		return Block{Height: number}, true
+	}
+	hash, ok := HashParam(request)
+	if !ok {
+		return Block{}, false
+	}
+
+	height, ok := t.Height(hash)
+	if !ok {
+		return Block{}, false
+	}
+	return Block{Hash: hash, Height: height}, true
+}
+
+// HashParam returns lowercased block hash request is addressed to
+func HashParam(request rpc.RPCRequest) (string, bool) {
+	return blockHashParam(request.Method, request.Params)
+}
+
+// Height returns height of recent block hash, false is returned if hash isn't known
+func (t *Tracker) Height(hash string) (int64, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.hashes.get(hash)
+}
+
+// BestHeight returns highest best block height of all tracked nodes
+func (t *Tracker) BestHeight() int64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	best := int64(0)
+	for _, n := range t.nodes {
+		if n.height > best {
+			best = n.height
+		}
+	}
+	return best
+}
+
+// Filter returns nodes that have blocks required by all requests, in same order. If no request is
+// addressed to known block or if no node has required blocks, nodes are returned unchanged so
+// requests fall back to normal selection.
+func (t *Tracker) Filter(nodes []models.Node, requests ...rpc.RPCRequest) []models.Node {
+	if !t.enabled {
+		return nodes
+	}
+	var required []Block
+	for _, request := range requests {
+		if block, ok := t.RequiredBlock(request); ok {
+			required = append(required, block)
+		}
+	}
+	if len(required) == 0 {
+		return nodes
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	var filtered []models.Node
+	for _, n := range nodes {
+		if t.hasBlocksLocked(n.ID, required) {
+			filtered = append(filtered, n)
+		}
+	}
+	if len(filtered) == 0 {
+		log.Debugf("No node has blocks required by request, falling back to all nodes")
+		return nodes
+	}
+	return filtered
+}
+
+// hasBlocksLocked checks if node has seen block hash or if its best height covers each block,
+// mutex must be held by caller
+func (t *Tracker) hasBlocksLocked(nodeID string, blocks []Block) bool {
+	n, ok := t.nodes[nodeID]
+	if !ok {
+		return false
+	}
+	for _, block := range blocks {
+		if block.Hash != "" {
+			if _, seen := n.hashes.get(block.Hash); seen {
+				continue
+			}
+		}
+		if n.height < block.Height {
+			return false
+		}
+	}
+	return true
+}
+
+var tracker = NewTracker(DefaultHashesSize)
+
+// Init replaces default tracker with tracker that holds up to size recent block hashes
+func Init(size int) {
+	tracker = NewTracker(size)
+}
+
+// SetNodeHeight sets best block height of node on default tracker
+func SetNodeHeight(nodeID string, height int64) {
+	tracker.SetNodeHeight(nodeID, height)
+}
+
+// AddNodeHash records block hash of node on default tracker
+func AddNodeHash(nodeID string, hash string, height int64) {
+	tracker.AddNodeHash(nodeID, hash, height)
+}
+
+// Learn records blocks from node response on default tracker
+func Learn(nodeID string, request rpc.RPCRequest, response []byte) {
+	tracker.Learn(nodeID, request, response)
+}
+
+// Height returns height of recent block hash on default tracker
+func Height(hash string) (int64, bool) {
+	return tracker.Height(hash)
+}
+
+// BestHeight returns highest best block height of nodes on default tracker
+func BestHeight() int64 {
+	return tracker.BestHeight()
+}
+
+// Filter returns nodes that have blocks required by requests on default tracker
+func Filter(nodes []models.Node, requests ...rpc.RPCRequest) []models.Node {
+	return tracker.Filter(nodes, requests...)
+}
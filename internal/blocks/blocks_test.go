@@ -0,0 +1,129 @@
+package blocks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	recentHash  = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	learnedHash = "0x2222222222222222222222222222222222222222222222222222222222222222"
+	unknownHash = "0x3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func request(method string, params ...interface{}) rpc.RPCRequest {
+	rawParams, _ := json.Marshal(params)
+	return rpc.RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: rawParams}
+}
+
+func response(result string) []byte {
+	return []byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`)
+}
+
+func nodeIDs(nodes []models.Node) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
+}
+
+func TestTracker_Filter(t *testing.T) {
+	nodes := []models.Node{{ID: "behind"}, {ID: "synced"}, {ID: "unknown"}}
+
+	tests := []struct {
+		name     string
+		requests []rpc.RPCRequest
+		expected []string
+	}{
+		{
+			name:     "request without block is routed to all nodes",
+			requests: []rpc.RPCRequest{request("system_health")},
+			expected: []string{"behind", "synced", "unknown"},
+		},
+		{
+			name:     "request for old block number is routed to nodes that have it",
+			requests: []rpc.RPCRequest{request("chain_getBlockHash", 90)},
+			expected: []string{"behind", "synced"},
+		},
+		{
+			name:     "request for tip block number is routed only to synced node",
+			requests: []rpc.RPCRequest{request("chain_getBlockHash", "0x64")},
+			expected: []string{"synced"},
+		},
+		{
+			name:     "request for recent block hash is routed only to synced node",
+			requests: []rpc.RPCRequest{request("state_getStorage", "0x26aa", recentHash)},
+			expected: []string{"synced"},
+		},
+		{
+			name:     "request for unknown block hash falls back to all nodes",
+			requests: []rpc.RPCRequest{request("state_getStorage", "0x26aa", unknownHash)},
+			expected: []string{"behind", "synced", "unknown"},
+		},
+		{
+			name:     "request for future block falls back to all nodes",
+			requests: []rpc.RPCRequest{request("chain_getBlockHash", 200)},
+			expected: []string{"behind", "synced", "unknown"},
+		},
+		{
+			name:     "batch is routed to nodes that have all requested blocks",
+			requests: []rpc.RPCRequest{request("chain_getBlockHash", 80), request("chain_getHeader", recentHash)},
+			expected: []string{"synced"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := NewTracker(DefaultHashesSize)
+			tracker.SetNodeHeight("behind", 92)
+			tracker.SetNodeHeight("synced", 95)
+			tracker.AddNodeHash("synced", recentHash, 100)
+
+			assert.Equal(t, test.expected, nodeIDs(tracker.Filter(nodes, test.requests...)))
+		})
+	}
+}
+
+func TestTracker_Learn(t *testing.T) {
+	tracker := NewTracker(DefaultHashesSize)
+	tracker.Learn("node", request("chain_getBlockHash", 120), response(`"`+learnedHash+`"`))
+	tracker.Learn("other", request("chain_getBlockHash", 130), response(`null`))
+	tracker.Learn("other", request("chain_getHeader"), response(`{"number":"0x6e"}`))
+
+	block, ok := tracker.RequiredBlock(request("state_getStorage", "0x26aa", learnedHash))
+	assert.True(t, ok)
+	assert.Equal(t, Block{Hash: learnedHash, Height: 120}, block)
+
+	_, ok = tracker.RequiredBlock(request("chain_getHeader", unknownHash))
+	assert.False(t, ok)
+
+	nodes := []models.Node{{ID: "other"}, {ID: "node"}}
+	assert.Equal(t, []string{"node"}, nodeIDs(tracker.Filter(nodes, request("chain_getBlock", learnedHash))))
+	assert.Equal(t, []string{"other", "node"}, nodeIDs(tracker.Filter(nodes, request("chain_getBlockHash", 110))))
+}
+
+func TestTracker_Disabled(t *testing.T) {
+	tracker := NewTracker(0)
+	tracker.SetNodeHeight("behind", 90)
+	tracker.SetNodeHeight("synced", 100)
+
+	nodes := []models.Node{{ID: "behind"}, {ID: "synced"}}
+	assert.Equal(t, nodes, tracker.Filter(nodes, request("chain_getBlockHash", 100)))
+}
+
+func TestHashes_EvictsOldest(t *testing.T) {
+	h := newHashes(2)
+	h.add("a", 1)
+	h.add("b", 2)
+	h.add("c", 3)
+
+	_, ok := h.get("a")
+	assert.False(t, ok)
+	height, ok := h.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), height)
+}
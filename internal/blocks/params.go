@@ -0,0 +1,155 @@
+package blocks
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+const (
+	getBlockHash = "chain_getBlockHash"
+	getHeader    = "chain_getHeader"
+	getBlock     = "chain_getBlock"
+)
+
+// numberParams are positions of block number param of methods addressed by block number
+var numberParams = map[string]int{
+	getBlockHash:    0,
+	"chain_getHead": 0,
+}
+
+// hashParams are positions of block hash param of methods addressed by block hash
+var hashParams = map[string]int{
+	getHeader:                   0,
+	getBlock:                    0,
+	"state_getMetadata":         0,
+	"state_getRuntimeVersion":   0,
+	"chain_getRuntimeVersion":   0,
+	"state_traceBlock":          0,
+	"state_getStorage":          1,
+	"state_getStorageAt":        1,
+	"state_getStorageHash":      1,
+	"state_getStorageHashAt":    1,
+	"state_getStorageSize":      1,
+	"state_getStorageSizeAt":    1,
+	"state_getKeys":             1,
+	"state_getPairs":            1,
+	"state_getReadProof":        1,
+	"state_queryStorageAt":      1,
+	"payment_queryInfo":         1,
+	"system_dryRun":             1,
+	"state_call":                2,
+	"state_callAt":              2,
+	"childstate_getStorage":     2,
+	"childstate_getStorageHash": 2,
+	"childstate_getStorageSize": 2,
+	"childstate_getKeys":        2,
+	"state_getKeysPaged":        3,
+	"state_getKeysPagedAt":      3,
+}
+
+type header struct {
+	Number string `json:"number"`
+}
+
+type signedBlock struct {
+	Block struct {
+		Header header `json:"header"`
+	} `json:"block"`
+}
+
+// param returns positional param of request on position, params that can't be decoded are not found
+func param(raw json.RawMessage, position int) (interface{}, bool) {
+	var params []interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &params) != nil || position >= len(params) {
+		return nil, false
+	}
+	return params[position], params[position] != nil
+}
+
+// blockNumberParam returns block number from request params, number can be sent as number or as hex string
+func blockNumberParam(method string, raw json.RawMessage) (int64, bool) {
+	position, ok := numberParams[method]
+	if !ok {
+		return 0, false
+	}
+	value, ok := param(raw, position)
+	if !ok {
+		return 0, false
+	}
+
+	switch number := value.(type) {
+	case float64:
+		if number < 0 || number != float64(int64(number)) {
+			return 0, false
+		}
+		return int64(number), true
+	case string:
+		n, err := parseBlockNumber(number)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// blockHashParam returns lowercased block hash from request params
+func blockHashParam(method string, raw json.RawMessage) (string, bool) {
+	position, ok := hashParams[method]
+	if !ok {
+		return "", false
+	}
+	value, ok := param(raw, position)
+	if !ok {
+		return "", false
+	}
+	hash, ok := value.(string)
+	if !ok {
+		return "", false
+	}
+	return normalizeHash(hash)
+}
+
+// normalizeHash returns lowercased hash if it is valid block hash
+func normalizeHash(hash string) (string, bool) {
+	if !strings.HasPrefix(hash, "0x") || len(hash) != 66 {
+		return "", false
+	}
+	return strings.ToLower(hash), true
+}
+
+// resultBlockNumber returns block number of header or block contained in result
+func resultBlockNumber(method string, result json.RawMessage) (int64, bool) {
+	var number string
+	switch method {
+	case getHeader:
+		var h header
+		if err := json.Unmarshal(result, &h); err != nil {
+			return 0, false
+		}
+		number = h.Number
+	case getBlock:
+		var b signedBlock
+		if err := json.Unmarshal(result, &b); err != nil {
+			return 0, false
+		}
+		number = b.Block.Header.Number
+	default:
+		return 0, false
+	}
+
+	n, err := parseBlockNumber(number)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseBlockNumber(number string) (int64, error) {
+	if strings.HasPrefix(number, "0x") {
+		return strconv.ParseInt(strings.TrimPrefix(number, "0x"), 16, 64)
+	}
+	return strconv.ParseInt(number, 10, 64)
+}
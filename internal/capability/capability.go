@@ -0,0 +1,242 @@
+package capability
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Archive nodes keep state of all blocks
+	Archive = "archive"
+	// Pruned nodes keep state of recent blocks only
+	Pruned = "pruned"
+	// PrunedStateDepth is number of recent blocks whose state is kept by pruned nodes by default
+	PrunedStateDepth = 256
+	// DefaultArchiveRewardWeight is default weight of archive node requests when rewards are distributed
+	DefaultArchiveRewardWeight = 2
+)
+
+// Capabilities of node, empty values mean capability is unknown
+type Capabilities struct {
+	Pruning    string   `json:"pruning,omitempty"`
+	RPCModules []string `json:"rpc_modules,omitempty"`
+}
+
+// IsArchive returns if node keeps state of all blocks
+func (c Capabilities) IsArchive() bool {
+	return c.Pruning == Archive
+}
+
+// HasModule returns if rpc module is enabled on node, all modules are assumed enabled if modules are unknown
+func (c Capabilities) HasModule(module string) bool {
+	if len(c.RPCModules) == 0 {
+		return true
+	}
+	for _, m := range c.RPCModules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePruning returns error if pruning mode is not archive, pruned or empty
+func ValidatePruning(pruning string) error {
+	if pruning != "" && pruning != Archive && pruning != Pruned {
+		return fmt.Errorf("invalid pruning mode %s, valid modes are %s and %s", pruning, Archive, Pruned)
+	}
+	return nil
+}
+
+// Module returns rpc module of method, e.g. state for state_getStorage
+func Module(method string) string {
+	return strings.SplitN(method, "_", 2)[0]
+}
+
+// Modules returns sorted rpc modules of methods
+func Modules(methods []string) []string {
+	unique := make(map[string]bool)
+	for _, method := range methods {
+		unique[Module(method)] = true
+	}
+	modules := make([]string, 0, len(unique))
+	for module := range unique {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// Declared returns capabilities declared by node on registration
+func Declared(node models.Node) Capabilities {
+	return Capabilities{Pruning: node.Pruning, RPCModules: node.RPCModules}
+}
+
+// Observed returns capabilities of node observed by probing
+func Observed(probe models.Probe) Capabilities {
+	return Capabilities{Pruning: probe.Pruning, RPCModules: probe.RPCModules}
+}
+
+// isStateQuery returns if method reads state, so it can be answered only by nodes that keep state of queried block
+func isStateQuery(method string) bool {
+	switch Module(method) {
+	case "state", "childstate", "payment":
+		return true
+	default:
+		return method == "system_dryRun"
+	}
+}
+
+// IsHistorical returns if request queries state of block older than PrunedStateDepth blocks, that pruned
+// nodes can't answer. State queries addressed to block hashes unknown to block tracker are also historical.
+func IsHistorical(request rpc.RPCRequest) bool {
+	if !isStateQuery(request.Method) {
+		return false
+	}
+	hash, ok := blocks.HashParam(request)
+	if !ok {
+		// state of best block is queried
+		return false
+	}
+	height, ok := blocks.Height(hash)
+	if !ok {
+		return true
+	}
+	return height < blocks.BestHeight()-PrunedStateDepth
+}
+
+// Registry holds capabilities declared by nodes and observed by probing, observed capabilities
+// replace declared ones when known
+type Registry struct {
+	mutex               sync.RWMutex
+	declared            map[string]Capabilities
+	observed            map[string]Capabilities
+	archiveRewardWeight float64
+}
+
+// NewRegistry creates registry where requests of archive nodes are weighted with archiveRewardWeight
+func NewRegistry(archiveRewardWeight float64) (*Registry, error) {
+	if archiveRewardWeight <= 0 {
+		return nil, fmt.Errorf("invalid archive reward weight %v, value must be positive", archiveRewardWeight)
+	}
+	return &Registry{
+		declared:            make(map[string]Capabilities),
+		observed:            make(map[string]Capabilities),
+		archiveRewardWeight: archiveRewardWeight,
+	}, nil
+}
+
+// Declare sets capabilities declared by node
+func (r *Registry) Declare(nodeID string, capabilities Capabilities) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.declared[nodeID] = capabilities
+}
+
+// Observe sets capabilities of node observed by probing
+func (r *Registry) Observe(nodeID string, capabilities Capabilities) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.observed[nodeID] = capabilities
+}
+
+// Get returns capabilities of node
+func (r *Registry) Get(nodeID string) Capabilities {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	capabilities := r.declared[nodeID]
+	observed := r.observed[nodeID]
+	if observed.Pruning != "" {
+		capabilities.Pruning = observed.Pruning
+	}
+	if len(observed.RPCModules) > 0 {
+		capabilities.RPCModules = observed.RPCModules
+	}
+	return capabilities
+}
+
+// ArchiveRewardWeight returns weight of archive node requests when rewards are distributed
+func (r *Registry) ArchiveRewardWeight() float64 {
+	return r.archiveRewardWeight
+}
+
+// Filter returns nodes capable of answering all requests, in same order. Historical state queries
+// require archive nodes and each request requires its rpc module. If no node is capable of answering
+// requests, nodes are returned unchanged so requests fall back to normal selection.
+func (r *Registry) Filter(nodes []models.Node, requests ...rpc.RPCRequest) []models.Node {
+	historical := false
+	modules := make([]string, len(requests))
+	for i, request := range requests {
+		historical = historical || IsHistorical(request)
+		modules[i] = Module(request.Method)
+	}
+
+	var filtered []models.Node
+	for _, node := range nodes {
+		if r.capable(node.ID, historical, modules) {
+			filtered = append(filtered, node)
+		}
+	}
+	if len(filtered) == 0 {
+		log.Debugf("No node is capable of answering request, falling back to all nodes")
+		return nodes
+	}
+	return filtered
+}
+
+func (r *Registry) capable(nodeID string, historical bool, modules []string) bool {
+	capabilities := r.Get(nodeID)
+	if historical && !capabilities.IsArchive() {
+		return false
+	}
+	for _, module := range modules {
+		if !capabilities.HasModule(module) {
+			return false
+		}
+	}
+	return true
+}
+
+var registry, _ = NewRegistry(DefaultArchiveRewardWeight)
+
+// Init replaces default registry with registry that weights archive node requests with archiveRewardWeight
+func Init(archiveRewardWeight float64) error {
+	r, err := NewRegistry(archiveRewardWeight)
+	if err != nil {
+		return err
+	}
+	registry = r
+	return nil
+}
+
+// Declare sets declared capabilities of node on default registry
+func Declare(nodeID string, capabilities Capabilities) {
+	registry.Declare(nodeID, capabilities)
+}
+
+// Observe sets observed capabilities of node on default registry
+func Observe(nodeID string, capabilities Capabilities) {
+	registry.Observe(nodeID, capabilities)
+}
+
+// Get returns capabilities of node from default registry
+func Get(nodeID string) Capabilities {
+	return registry.Get(nodeID)
+}
+
+// ArchiveRewardWeight returns archive reward weight of default registry
+func ArchiveRewardWeight() float64 {
+	return registry.ArchiveRewardWeight()
+}
+
+// Filter returns nodes capable of answering requests on default registry
+func Filter(nodes []models.Node, requests ...rpc.RPCRequest) []models.Node {
+	return registry.Filter(nodes, requests...)
+}
@@ -0,0 +1,120 @@
+package capability
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	recentHash  = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	oldHash     = "0x2222222222222222222222222222222222222222222222222222222222222222"
+	unknownHash = "0x3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func request(method string, params ...interface{}) rpc.RPCRequest {
+	rawParams, _ := json.Marshal(params)
+	return rpc.RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: rawParams}
+}
+
+func nodeIDs(nodes []models.Node) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
+}
+
+func TestModules(t *testing.T) {
+	assert.Equal(t, []string{"chain", "state", "system"}, Modules([]string{
+		"state_getStorage", "chain_getHeader", "state_call", "system_health",
+	}))
+}
+
+func TestValidatePruning(t *testing.T) {
+	assert.NoError(t, ValidatePruning(""))
+	assert.NoError(t, ValidatePruning(Archive))
+	assert.NoError(t, ValidatePruning(Pruned))
+	assert.Error(t, ValidatePruning("full"))
+}
+
+func TestRegistry_Get(t *testing.T) {
+	registry, err := NewRegistry(DefaultArchiveRewardWeight)
+	assert.NoError(t, err)
+
+	registry.Declare("node", Capabilities{Pruning: Archive, RPCModules: []string{"chain", "state"}})
+	assert.Equal(t, Capabilities{Pruning: Archive, RPCModules: []string{"chain", "state"}}, registry.Get("node"))
+
+	// observed capabilities replace declared ones when known
+	registry.Observe("node", Capabilities{Pruning: Pruned})
+	assert.Equal(t, Capabilities{Pruning: Pruned, RPCModules: []string{"chain", "state"}}, registry.Get("node"))
+
+	_, err = NewRegistry(0)
+	assert.Error(t, err)
+}
+
+func TestRegistry_Filter(t *testing.T) {
+	blocks.Init(blocks.DefaultHashesSize)
+	defer blocks.Init(blocks.DefaultHashesSize)
+	blocks.SetNodeHeight("pruned", 1000)
+	blocks.AddNodeHash("pruned", recentHash, 900)
+	blocks.AddNodeHash("archive", oldHash, 100)
+
+	nodes := []models.Node{{ID: "pruned"}, {ID: "archive"}, {ID: "no-state"}}
+
+	tests := []struct {
+		name     string
+		requests []rpc.RPCRequest
+		expected []string
+	}{
+		{
+			name:     "query of best block state is routed to nodes with state module",
+			requests: []rpc.RPCRequest{request("state_getStorage", "0x26aa")},
+			expected: []string{"pruned", "archive"},
+		},
+		{
+			name:     "query of recent block state is routed to nodes with state module",
+			requests: []rpc.RPCRequest{request("state_getStorage", "0x26aa", recentHash)},
+			expected: []string{"pruned", "archive"},
+		},
+		{
+			name:     "query of old block state is routed to archive nodes",
+			requests: []rpc.RPCRequest{request("state_getStorage", "0x26aa", oldHash)},
+			expected: []string{"archive"},
+		},
+		{
+			name:     "query of unknown block state is routed to archive nodes",
+			requests: []rpc.RPCRequest{request("state_call", "Core_version", "0x", unknownHash)},
+			expected: []string{"archive"},
+		},
+		{
+			name:     "historical query falls back to all nodes if no node has its module",
+			requests: []rpc.RPCRequest{request("childstate_getStorage", "0x01", "0x02", oldHash)},
+			expected: []string{"pruned", "archive", "no-state"},
+		},
+		{
+			name:     "query of old block header is routed to all nodes",
+			requests: []rpc.RPCRequest{request("chain_getHeader", oldHash)},
+			expected: []string{"pruned", "archive", "no-state"},
+		},
+		{
+			name:     "request is routed to nodes whose modules are unknown if no node declared its module",
+			requests: []rpc.RPCRequest{request("babe_epochAuthorship")},
+			expected: []string{"pruned"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry, _ := NewRegistry(DefaultArchiveRewardWeight)
+			registry.Declare("pruned", Capabilities{Pruning: Pruned})
+			registry.Declare("archive", Capabilities{Pruning: Archive, RPCModules: []string{"chain", "state"}})
+			registry.Declare("no-state", Capabilities{RPCModules: []string{"chain", "system"}})
+
+			assert.Equal(t, test.expected, nodeIDs(registry.Filter(nodes, test.requests...)))
+		})
+	}
+}
@@ -14,19 +14,28 @@ type PayoutConfiguration struct {
 }
 
 type Configuration struct {
-	AuthSecret          string
-	Name                string
-	CertFile            string
-	KeyFile             string
-	Capacity            int64
-	WhitelistEnabled    bool
-	Fee                 float32
-	Selection           string
-	Port                int32
-	PortPool            server.Pooler
-	TunnelServerAddress string
-	PayoutConfiguration *PayoutConfiguration
-	RootDir             string
+	AuthSecret              string
+	AdminSecret             string
+	Name                    string
+	CertFile                string
+	KeyFile                 string
+	Capacity                int64
+	WhitelistEnabled        bool
+	Fee                     float32
+	Selection               string
+	SubBatchSize            int
+	RetryBudget             int
+	MaxRequestSize          int64
+	MaxBatchLength          int
+	MaxWSFrameSize          int64
+	AnonymousAccessDisabled bool
+	AnonymousDailyQuota     int64
+	AnonymousMonthlyQuota   int64
+	Port                    int32
+	PortPool                server.Pooler
+	TunnelServerAddress     string
+	PayoutConfiguration     *PayoutConfiguration
+	RootDir                 string
 }
 
 var Config Configuration
@@ -0,0 +1,472 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/history"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
+	"github.com/NodeFactoryIo/vedran/internal/schedule/penalize"
+	"github.com/NodeFactoryIo/vedran/internal/whitelist"
+	"github.com/NodeFactoryIo/vedran/pkg/util"
+	muxhelpper "github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultAuditLogLimit = 100
+	MaxAuditLogLimit     = 1000
+)
+
+// AdminNode is full state of node. Active is true if node is in active nodes and serves requests, while
+// Deactivated node is not added to active nodes until it is activated again.
+type AdminNode struct {
+	ID            string          `json:"id"`
+	PayoutAddress string          `json:"payout_address"`
+	ConfigHash    string          `json:"config_hash"`
+	Pruning       string          `json:"pruning,omitempty"`
+	RPCModules    []string        `json:"rpc_modules,omitempty"`
+	Active        bool            `json:"active"`
+	Deactivated   bool            `json:"deactivated"`
+	Banned        bool            `json:"banned"`
+	Whitelisted   *bool           `json:"whitelisted,omitempty"`
+	Cooldown      int             `json:"cooldown"`
+	Penalty       *models.Penalty `json:"penalty,omitempty"`
+	LastUsed      int64           `json:"last_used"`
+	LastPing      *time.Time      `json:"last_ping,omitempty"`
+	Metrics       *models.Metrics `json:"metrics,omitempty"`
+	// HTTPPort and WSPort are ports of node tunnels, TunnelAddress is address load balancer sends
+	// rpc requests to, they are not set if node is not connected to tunnel server
+	HTTPPort      int    `json:"http_port,omitempty"`
+	WSPort        int    `json:"ws_port,omitempty"`
+	TunnelAddress string `json:"tunnel_address,omitempty"`
+}
+
+type AdminNodesResponse struct {
+	Nodes []AdminNode `json:"nodes"`
+}
+
+type WhitelistRequest struct {
+	Id string `json:"id"`
+}
+
+type WhitelistResponse struct {
+	Enabled bool     `json:"enabled"`
+	Nodes   []string `json:"nodes"`
+}
+
+type AuditLogResponse struct {
+	Entries []models.AuditLogEntry `json:"entries"`
+	// Total is number of all entries in requested time range
+	Total int `json:"total"`
+}
+
+// handler for `GET /api/v1/admin/nodes` - admin authentication in middleware
+func (c *ApiController) AdminNodesListHandler(w http.ResponseWriter, r *http.Request) {
+	nodes, err := c.repositories.NodeRepo.GetAll()
+	if err != nil && err.Error() != "not found" {
+		log.Errorf("Failed fetching nodes because of: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := AdminNodesResponse{Nodes: []AdminNode{}}
+	if nodes != nil {
+		for _, node := range *nodes {
+			response.Nodes = append(response.Nodes, c.adminNode(node))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// handler for `GET /api/v1/admin/nodes/{id}` - admin authentication in middleware
+func (c *ApiController) AdminNodeHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `POST /api/v1/admin/nodes/{id}/activate` - admin authentication in middleware
+func (c *ApiController) AdminNodeActivateHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+	if node.Banned {
+		http.Error(w, "Node is banned, unban it to activate it", http.StatusConflict)
+		return
+	}
+
+	node, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Active = true
+		node.Cooldown = 0
+	}, c.repositories)
+	if err != nil {
+		writeNodeUpdateError(w, err)
+		return
+	}
+	c.activateIfReady(node.ID)
+
+	c.audit(r, models.AdminActivateNode, node.ID, "")
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `POST /api/v1/admin/nodes/{id}/deactivate` - admin authentication in middleware
+func (c *ApiController) AdminNodeDeactivateHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+
+	node, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Active = false
+		node.Cooldown = 0
+	}, c.repositories)
+	if err != nil {
+		writeNodeUpdateError(w, err)
+		return
+	}
+	c.removeFromActive(node.ID)
+	history.Record(c.repositories, models.NodeEvent{
+		NodeID:  node.ID,
+		Type:    models.NodeDeactivated,
+		Details: "deactivated by admin",
+	})
+
+	c.audit(r, models.AdminDeactivateNode, node.ID, "")
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `POST /api/v1/admin/nodes/{id}/ban` - admin authentication in middleware
+func (c *ApiController) AdminNodeBanHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+
+	node, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Banned = true
+		node.Active = false
+		node.Cooldown = 0
+	}, c.repositories)
+	if err != nil {
+		writeNodeUpdateError(w, err)
+		return
+	}
+	c.removeFromActive(node.ID)
+	details := ""
+	if c.whitelistEnabled && whitelist.IsNodeWhitelisted(node.ID) {
+		err = whitelist.RemoveNodeFromWhitelisted(node.ID)
+		if err != nil {
+			log.Errorf("Unable to remove banned node %s from whitelisted nodes, because of %v", node.ID, err)
+		} else {
+			details = "removed from whitelisted nodes"
+		}
+	}
+	history.Record(c.repositories, models.NodeEvent{NodeID: node.ID, Type: models.NodeBanned, Details: details})
+
+	c.audit(r, models.AdminBanNode, node.ID, details)
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `POST /api/v1/admin/nodes/{id}/unban` - admin authentication in middleware
+func (c *ApiController) AdminNodeUnbanHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+	if !node.Banned {
+		http.Error(w, "Node is not banned", http.StatusConflict)
+		return
+	}
+
+	node, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Banned = false
+		node.Active = true
+		node.Cooldown = 0
+	}, c.repositories)
+	if err != nil {
+		writeNodeUpdateError(w, err)
+		return
+	}
+	details := ""
+	if c.whitelistEnabled {
+		err = whitelist.AddNodeToWhitelisted(node.ID)
+		if err != nil {
+			log.Errorf("Unable to add unbanned node %s to whitelisted nodes, because of %v", node.ID, err)
+		} else {
+			details = "added to whitelisted nodes"
+		}
+	}
+	history.Record(c.repositories, models.NodeEvent{NodeID: node.ID, Type: models.NodeUnbanned, Details: details})
+	c.activateIfReady(node.ID)
+
+	c.audit(r, models.AdminUnbanNode, node.ID, details)
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `POST /api/v1/admin/nodes/{id}/reset-cooldown` - admin authentication in middleware
+func (c *ApiController) AdminNodeResetCooldownHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+	cooldown := node.Cooldown
+
+	node, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Cooldown = 0
+	}, c.repositories)
+	if err != nil {
+		writeNodeUpdateError(w, err)
+		return
+	}
+	history.Record(c.repositories, models.NodeEvent{
+		NodeID:  node.ID,
+		Type:    models.NodePenaltyCancelled,
+		Details: "cooldown reset by admin",
+	})
+	c.activateIfReady(node.ID)
+
+	c.audit(r, models.AdminResetNodeCooldown, node.ID, fmt.Sprintf("cooldown was %d minutes", cooldown))
+	c.writeAdminNode(w, *node)
+}
+
+// handler for `DELETE /api/v1/admin/nodes/{id}` - admin authentication in middleware
+func (c *ApiController) AdminNodeDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	node, ok := c.findAdminNode(w, r)
+	if !ok {
+		return
+	}
+
+	// removing scheduled check first, so node is not checked once it is deleted
+	_, err := penalize.UpdateNode(node.ID, func(node *models.Node) {
+		node.Cooldown = 0
+	}, c.repositories)
+	if err == nil {
+		err = c.repositories.NodeRepo.Delete(node.ID)
+	}
+	if err != nil {
+		log.Errorf("Failed deleting node %s because of: %v", node.ID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	history.Record(c.repositories, models.NodeEvent{NodeID: node.ID, Type: models.NodeDeleted})
+
+	c.audit(r, models.AdminDeleteNode, node.ID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler for `GET /api/v1/admin/whitelist` - admin authentication in middleware
+func (c *ApiController) AdminWhitelistHandler(w http.ResponseWriter, r *http.Request) {
+	response := WhitelistResponse{Enabled: c.whitelistEnabled, Nodes: []string{}}
+	if c.whitelistEnabled {
+		nodes, err := whitelist.GetWhitelistedNodes()
+		if err != nil {
+			log.Errorf("Failed fetching whitelisted nodes because of: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		response.Nodes = nodes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// handler for `POST /api/v1/admin/whitelist` - admin authentication in middleware
+func (c *ApiController) AdminWhitelistAddHandler(w http.ResponseWriter, r *http.Request) {
+	if !c.whitelistEnabled {
+		http.Error(w, "Whitelisting is disabled", http.StatusConflict)
+		return
+	}
+
+	var request WhitelistRequest
+	err := util.DecodeJSONBody(w, r, &request)
+	if err != nil {
+		var mr *util.MalformedRequest
+		if errors.As(err, &mr) {
+			log.Errorf("Malformed request error: %v", err)
+			http.Error(w, mr.Msg, mr.Status)
+		} else {
+			log.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	if request.Id == "" {
+		http.Error(w, "Node id is required", http.StatusBadRequest)
+		return
+	}
+
+	err = whitelist.AddNodeToWhitelisted(request.Id)
+	if err != nil {
+		log.Errorf("Failed adding node %s to whitelisted nodes because of: %v", request.Id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, models.AdminAddToWhitelist, request.Id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler for `DELETE /api/v1/admin/whitelist/{id}` - admin authentication in middleware
+func (c *ApiController) AdminWhitelistRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	nodeID := muxhelpper.Vars(r)["id"]
+	if !c.whitelistEnabled {
+		http.Error(w, "Whitelisting is disabled", http.StatusConflict)
+		return
+	}
+	if !whitelist.IsNodeWhitelisted(nodeID) {
+		http.Error(w, "Node not whitelisted", http.StatusNotFound)
+		return
+	}
+
+	err := whitelist.RemoveNodeFromWhitelisted(nodeID)
+	if err != nil {
+		log.Errorf("Failed removing node %s from whitelisted nodes because of: %v", nodeID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	c.audit(r, models.AdminRemoveFromWhitelist, nodeID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler for `GET /api/v1/admin/audit` - admin authentication in middleware
+func (c *ApiController) AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := parseRangeParams(r, DefaultAuditLogLimit, MaxAuditLogLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := c.repositories.AuditLogRepo.Find(params.from, params.to, params.offset, params.limit)
+	if err != nil {
+		log.Errorf("Failed fetching audit log because of: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AuditLogResponse{Entries: entries, Total: total})
+}
+
+// findAdminNode returns node from request path, or writes error response if node can't be found
+func (c *ApiController) findAdminNode(w http.ResponseWriter, r *http.Request) (*models.Node, bool) {
+	nodeID := muxhelpper.Vars(r)["id"]
+	node, err := c.repositories.NodeRepo.FindByID(nodeID)
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "Node not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Errorf("Failed fetching node %s because of: %v", nodeID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+	return node, true
+}
+
+func writeNodeUpdateError(w http.ResponseWriter, err error) {
+	log.Errorf("Failed updating node because of: %v", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// activateIfReady adds node to active nodes if it is ready, otherwise node is added once it becomes ready
+func (c *ApiController) activateIfReady(nodeID string) {
+	if c.repositories.NodeRepo.IsNodeActive(nodeID) {
+		return
+	}
+	err := active.ActivateNodeIfReady(nodeID, c.repositories)
+	if err != nil {
+		log.Debugf("Node %s not added to active nodes, because of %v", nodeID, err)
+	}
+}
+
+func (c *ApiController) removeFromActive(nodeID string) {
+	if !c.repositories.NodeRepo.IsNodeActive(nodeID) {
+		return
+	}
+	err := c.repositories.NodeRepo.RemoveNodeFromActive(nodeID)
+	if err != nil {
+		log.Errorf("Unable to remove node %s from active nodes, because of %v", nodeID, err)
+	}
+}
+
+// audit writes admin action to log and saves it to audit log, failing to save action is only logged
+func (c *ApiController) audit(r *http.Request, action string, nodeID string, details string) {
+	entry := models.AuditLogEntry{
+		Timestamp:  time.Now(),
+		Action:     action,
+		NodeID:     nodeID,
+		Details:    details,
+		RemoteAddr: ratelimit.ClientIP(r),
+	}
+	log.Infof("Admin action %s on node %s from %s", entry.Action, entry.NodeID, entry.RemoteAddr)
+	err := c.repositories.AuditLogRepo.Save(&entry)
+	if err != nil {
+		log.Errorf("Failed saving admin action %s on node %s to audit log because of: %v", action, nodeID, err)
+	}
+}
+
+func (c *ApiController) writeAdminNode(w http.ResponseWriter, node models.Node) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.adminNode(node))
+}
+
+func (c *ApiController) adminNode(node models.Node) AdminNode {
+	adminNode := AdminNode{
+		ID:            node.ID,
+		PayoutAddress: node.PayoutAddress,
+		ConfigHash:    node.ConfigHash,
+		Pruning:       node.Pruning,
+		RPCModules:    node.RPCModules,
+		Active:        c.repositories.NodeRepo.IsNodeActive(node.ID),
+		Deactivated:   !node.Active,
+		Banned:        node.Banned,
+		Cooldown:      node.Cooldown,
+		LastUsed:      node.LastUsed,
+	}
+	if c.whitelistEnabled {
+		whitelisted := whitelist.IsNodeWhitelisted(node.ID)
+		adminNode.Whitelisted = &whitelisted
+	}
+
+	if p, err := c.repositories.PenaltyRepo.FindByNodeID(node.ID); err == nil {
+		adminNode.Penalty = p
+	} else if err.Error() != "not found" {
+		log.Errorf("Failed fetching penalty of node %s because of: %v", node.ID, err)
+	}
+	if ping, err := c.repositories.PingRepo.FindByNodeID(node.ID); err == nil {
+		adminNode.LastPing = &ping.Timestamp
+	} else if err.Error() != "not found" {
+		log.Errorf("Failed fetching last ping of node %s because of: %v", node.ID, err)
+	}
+	if metrics, err := c.repositories.MetricsRepo.FindByID(node.ID); err == nil {
+		adminNode.Metrics = metrics
+	} else if err.Error() != "not found" {
+		log.Errorf("Failed fetching metrics of node %s because of: %v", node.ID, err)
+	}
+
+	if configuration.Config.PortPool != nil {
+		if port, err := configuration.Config.PortPool.GetHTTPPort(node.ID); err == nil {
+			adminNode.HTTPPort = port
+			adminNode.TunnelAddress = "127.0.0.1:" + strconv.Itoa(port)
+		}
+		if port, err := configuration.Config.PortPool.GetWSPort(node.ID); err == nil {
+			adminNode.WSPort = port
+		}
+	}
+	return adminNode
+}
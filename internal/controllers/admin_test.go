@@ -0,0 +1,313 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/whitelist"
+	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	muxhelpper "github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApiController_AdminNodeActions(t *testing.T) {
+	configuration.Config = configuration.Configuration{}
+
+	tests := []struct {
+		name            string
+		method          string
+		url             string
+		node            *models.Node
+		inActiveNodes   bool
+		httpStatus      int
+		expectedNode    *models.Node
+		removedFromPool bool
+		deleted         bool
+		auditAction     string
+	}{
+		{
+			name:         "activates deactivated node",
+			method:       "POST",
+			url:          "/api/v1/admin/nodes/1/activate",
+			node:         &models.Node{ID: "1", Cooldown: 8},
+			httpStatus:   http.StatusOK,
+			expectedNode: &models.Node{ID: "1", Active: true},
+			auditAction:  models.AdminActivateNode,
+		},
+		{
+			name:       "doesn't activate banned node",
+			method:     "POST",
+			url:        "/api/v1/admin/nodes/1/activate",
+			node:       &models.Node{ID: "1", Banned: true},
+			httpStatus: http.StatusConflict,
+		},
+		{
+			name:            "deactivates node",
+			method:          "POST",
+			url:             "/api/v1/admin/nodes/1/deactivate",
+			node:            &models.Node{ID: "1", Active: true},
+			inActiveNodes:   true,
+			httpStatus:      http.StatusOK,
+			expectedNode:    &models.Node{ID: "1"},
+			removedFromPool: true,
+			auditAction:     models.AdminDeactivateNode,
+		},
+		{
+			name:            "bans node",
+			method:          "POST",
+			url:             "/api/v1/admin/nodes/1/ban",
+			node:            &models.Node{ID: "1", Active: true, Cooldown: 2},
+			inActiveNodes:   true,
+			httpStatus:      http.StatusOK,
+			expectedNode:    &models.Node{ID: "1", Banned: true},
+			removedFromPool: true,
+			auditAction:     models.AdminBanNode,
+		},
+		{
+			name:         "unbans node",
+			method:       "POST",
+			url:          "/api/v1/admin/nodes/1/unban",
+			node:         &models.Node{ID: "1", Banned: true},
+			httpStatus:   http.StatusOK,
+			expectedNode: &models.Node{ID: "1", Active: true},
+			auditAction:  models.AdminUnbanNode,
+		},
+		{
+			name:       "doesn't unban node that is not banned",
+			method:     "POST",
+			url:        "/api/v1/admin/nodes/1/unban",
+			node:       &models.Node{ID: "1", Active: true},
+			httpStatus: http.StatusConflict,
+		},
+		{
+			name:         "resets node cooldown",
+			method:       "POST",
+			url:          "/api/v1/admin/nodes/1/reset-cooldown",
+			node:         &models.Node{ID: "1", Active: true, Cooldown: 16},
+			httpStatus:   http.StatusOK,
+			expectedNode: &models.Node{ID: "1", Active: true},
+			auditAction:  models.AdminResetNodeCooldown,
+		},
+		{
+			name:        "deletes node",
+			method:      "DELETE",
+			url:         "/api/v1/admin/nodes/1",
+			node:        &models.Node{ID: "1", Active: true},
+			httpStatus:  http.StatusNoContent,
+			deleted:     true,
+			auditAction: models.AdminDeleteNode,
+		},
+		{
+			name:       "returns not found for unknown node",
+			method:     "POST",
+			url:        "/api/v1/admin/nodes/2/ban",
+			httpStatus: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodeRepoMock := mocks.NodeRepository{}
+			nodeRepoMock.On("FindByID", "1").Return(func(string) *models.Node {
+				// each lookup returns copy, as handlers update node they found
+				node := *test.node
+				return &node
+			}, nil)
+			nodeRepoMock.On("FindByID", "2").Return(nil, errors.New("not found"))
+			nodeRepoMock.On("Save", mock.Anything).Return(nil)
+			nodeRepoMock.On("IsNodeActive", "1").Return(test.inActiveNodes)
+			nodeRepoMock.On("RemoveNodeFromActive", "1").Return(nil)
+			nodeRepoMock.On("Delete", "1").Return(nil)
+			// activating node once it is ready is covered by active package tests
+			nodeRepoMock.On("IsNodeOnCooldown", "1").Return(true, nil)
+			penaltyRepoMock := mocks.PenaltyRepository{}
+			penaltyRepoMock.On("Delete", "1").Return(nil)
+			penaltyRepoMock.On("FindByNodeID", "1").Return(nil, errors.New("not found"))
+			pingRepoMock := mocks.PingRepository{}
+			pingRepoMock.On("FindByNodeID", "1").Return(nil, errors.New("not found"))
+			metricsRepoMock := mocks.MetricsRepository{}
+			metricsRepoMock.On("FindByID", "1").Return(nil, errors.New("not found"))
+			nodeEventRepoMock := mocks.NodeEventRepository{}
+			nodeEventRepoMock.On("Save", mock.Anything).Return(nil)
+			auditLogRepoMock := mocks.AuditLogRepository{}
+			auditLogRepoMock.On("Save", mock.Anything).Return(nil)
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:      &nodeRepoMock,
+				PenaltyRepo:   &penaltyRepoMock,
+				PingRepo:      &pingRepoMock,
+				MetricsRepo:   &metricsRepoMock,
+				NodeEventRepo: &nodeEventRepoMock,
+				AuditLogRepo:  &auditLogRepoMock,
+			}, nil, nil)
+
+			req, _ := http.NewRequest(test.method, test.url, nil)
+			rr := httptest.NewRecorder()
+			router := muxhelpper.NewRouter()
+			router.HandleFunc("/api/v1/admin/nodes/{id}", apiController.AdminNodeDeleteHandler).Methods("DELETE")
+			router.HandleFunc("/api/v1/admin/nodes/{id}/activate", apiController.AdminNodeActivateHandler)
+			router.HandleFunc("/api/v1/admin/nodes/{id}/deactivate", apiController.AdminNodeDeactivateHandler)
+			router.HandleFunc("/api/v1/admin/nodes/{id}/ban", apiController.AdminNodeBanHandler)
+			router.HandleFunc("/api/v1/admin/nodes/{id}/unban", apiController.AdminNodeUnbanHandler)
+			router.HandleFunc("/api/v1/admin/nodes/{id}/reset-cooldown", apiController.AdminNodeResetCooldownHandler)
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.httpStatus, rr.Code)
+			if test.expectedNode != nil {
+				nodeRepoMock.AssertCalled(t, "Save", test.expectedNode)
+				penaltyRepoMock.AssertCalled(t, "Delete", "1")
+				var response AdminNode
+				_ = json.Unmarshal(rr.Body.Bytes(), &response)
+				assert.Equal(t, test.expectedNode.Banned, response.Banned)
+				assert.Equal(t, !test.expectedNode.Active, response.Deactivated)
+				assert.Equal(t, 0, response.Cooldown)
+			} else if !test.deleted {
+				nodeRepoMock.AssertNotCalled(t, "Save", mock.Anything)
+			}
+			if test.removedFromPool {
+				nodeRepoMock.AssertCalled(t, "RemoveNodeFromActive", "1")
+			} else {
+				nodeRepoMock.AssertNotCalled(t, "RemoveNodeFromActive", mock.Anything)
+			}
+			if test.deleted {
+				nodeRepoMock.AssertCalled(t, "Delete", "1")
+			}
+			if test.auditAction != "" {
+				auditLogRepoMock.AssertCalled(t, "Save", mock.MatchedBy(func(entry *models.AuditLogEntry) bool {
+					return entry.Action == test.auditAction && entry.NodeID == "1"
+				}))
+			} else {
+				auditLogRepoMock.AssertNotCalled(t, "Save", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestApiController_AdminNodesListHandler(t *testing.T) {
+	configuration.Config = configuration.Configuration{}
+	lastPing := time.Now().Round(time.Second)
+
+	nodeRepoMock := mocks.NodeRepository{}
+	nodeRepoMock.On("GetAll").Return(&[]models.Node{
+		{ID: "1", Active: true, PayoutAddress: "0x1"},
+		{ID: "2", Cooldown: 4, Active: true},
+	}, nil)
+	nodeRepoMock.On("IsNodeActive", "1").Return(true)
+	nodeRepoMock.On("IsNodeActive", "2").Return(false)
+	penaltyRepoMock := mocks.PenaltyRepository{}
+	penaltyRepoMock.On("FindByNodeID", "1").Return(nil, errors.New("not found"))
+	penaltyRepoMock.On("FindByNodeID", "2").Return(&models.Penalty{NodeID: "2", Cooldown: 4, Reason: "missed-ping"}, nil)
+	pingRepoMock := mocks.PingRepository{}
+	pingRepoMock.On("FindByNodeID", "1").Return(&models.Ping{NodeId: "1", Timestamp: lastPing}, nil)
+	pingRepoMock.On("FindByNodeID", "2").Return(nil, errors.New("not found"))
+	metricsRepoMock := mocks.MetricsRepository{}
+	metricsRepoMock.On("FindByID", "1").Return(&models.Metrics{NodeId: "1", BestBlockHeight: 100}, nil)
+	metricsRepoMock.On("FindByID", "2").Return(nil, errors.New("not found"))
+
+	apiController := NewApiController(false, repositories.Repos{
+		NodeRepo:    &nodeRepoMock,
+		PenaltyRepo: &penaltyRepoMock,
+		PingRepo:    &pingRepoMock,
+		MetricsRepo: &metricsRepoMock,
+	}, nil, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/admin/nodes", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(apiController.AdminNodesListHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response AdminNodesResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Len(t, response.Nodes, 2)
+
+	assert.Equal(t, "0x1", response.Nodes[0].PayoutAddress)
+	assert.True(t, response.Nodes[0].Active)
+	assert.True(t, lastPing.Equal(*response.Nodes[0].LastPing))
+	assert.Equal(t, int64(100), response.Nodes[0].Metrics.BestBlockHeight)
+	assert.Nil(t, response.Nodes[0].Penalty)
+
+	assert.False(t, response.Nodes[1].Active)
+	assert.Equal(t, 4, response.Nodes[1].Cooldown)
+	assert.Equal(t, "missed-ping", response.Nodes[1].Penalty.Reason)
+	assert.Nil(t, response.Nodes[1].LastPing)
+	assert.Nil(t, response.Nodes[1].Metrics)
+}
+
+func TestApiController_AdminWhitelistHandlers(t *testing.T) {
+	_, _ = whitelist.InitWhitelisting([]string{"1", "3"}, "")
+	auditLogRepoMock := mocks.AuditLogRepository{}
+	auditLogRepoMock.On("Save", mock.Anything).Return(nil)
+
+	router := muxhelpper.NewRouter()
+	apiController := NewApiController(true, repositories.Repos{AuditLogRepo: &auditLogRepoMock}, nil, nil)
+	router.HandleFunc("/api/v1/admin/whitelist", apiController.AdminWhitelistHandler).Methods("GET")
+	router.HandleFunc("/api/v1/admin/whitelist", apiController.AdminWhitelistAddHandler).Methods("POST")
+	router.HandleFunc("/api/v1/admin/whitelist/{id}", apiController.AdminWhitelistRemoveHandler).Methods("DELETE")
+
+	serve := func(method string, url string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("POST", "/api/v1/admin/whitelist", `{"id": "5"}`)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.True(t, whitelist.IsNodeWhitelisted("5"))
+
+	rr = serve("GET", "/api/v1/admin/whitelist", "")
+	var response WhitelistResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, WhitelistResponse{Enabled: true, Nodes: []string{"1", "3", "5"}}, response)
+
+	rr = serve("DELETE", "/api/v1/admin/whitelist/5", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.False(t, whitelist.IsNodeWhitelisted("5"))
+
+	rr = serve("DELETE", "/api/v1/admin/whitelist/5", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve("POST", "/api/v1/admin/whitelist", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	auditLogRepoMock.AssertNumberOfCalls(t, "Save", 2)
+
+	// whitelist can't be edited if whitelisting is disabled
+	disabledController := NewApiController(false, repositories.Repos{AuditLogRepo: &auditLogRepoMock}, nil, nil)
+	req, _ := http.NewRequest("POST", "/api/v1/admin/whitelist", bytes.NewReader([]byte(`{"id": "5"}`)))
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(disabledController.AdminWhitelistAddHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestApiController_AdminAuditLogHandler(t *testing.T) {
+	entries := []models.AuditLogEntry{
+		{ID: 1, Action: models.AdminBanNode, NodeID: "1", RemoteAddr: "10.0.0.1"},
+	}
+	auditLogRepoMock := mocks.AuditLogRepository{}
+	auditLogRepoMock.On("Find", time.Time{}, time.Time{}, 20, 10).Return(entries, 21, nil)
+	apiController := NewApiController(false, repositories.Repos{AuditLogRepo: &auditLogRepoMock}, nil, nil)
+
+	req, _ := http.NewRequest("GET", "/api/v1/admin/audit?offset=20&limit=10", nil)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(apiController.AdminAuditLogHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response AuditLogResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, AuditLogResponse{Entries: entries, Total: 21}, response)
+
+	req, _ = http.NewRequest("GET", "/api/v1/admin/audit?limit=0", nil)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(apiController.AdminAuditLogHandler).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -2,23 +2,33 @@ package controllers
 
 import (
 	"github.com/NodeFactoryIo/vedran/internal/actions"
+	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/ws"
 )
 
 type ApiController struct {
 	whitelistEnabled bool
 	repositories     repositories.Repos
 	actions          actions.Actions
+	selector         selection.Selector
+	hub              *ws.Hub
 }
 
 func NewApiController(
 	whitelistEnabled bool,
 	repositories repositories.Repos,
 	actions actions.Actions,
+	selector selection.Selector,
 ) *ApiController {
 	return &ApiController{
 		whitelistEnabled: whitelistEnabled,
 		repositories:     repositories,
 		actions:          actions,
+		selector:         selector,
+		hub: ws.NewHub(repositories, actions, func() []models.Node {
+			return selector.Select(*repositories.NodeRepo.GetActiveNodes())
+		}),
 	}
 }
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/pkg/util"
+	muxhelpper "github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+type APIKeyRequest struct {
+	Name         string `json:"name"`
+	DailyQuota   int64  `json:"daily_quota"`
+	MonthlyQuota int64  `json:"monthly_quota"`
+	Disabled     bool   `json:"disabled"`
+	Verified     bool   `json:"verified"`
+}
+
+type APIKeysStatsResponse struct {
+	Stats map[string]models.APIKeyUsage `json:"stats"`
+}
+
+// handler for `GET /api/v1/keys` - signature verification in middleware
+func (c *ApiController) APIKeysListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(apikey.List())
+}
+
+// handler for `POST /api/v1/keys` - signature verification in middleware
+func (c *ApiController) APIKeysCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var request APIKeyRequest
+	if !decodeAPIKeyRequest(w, r, &request) {
+		return
+	}
+
+	apiKey, err := apikey.Create(request.Name, request.DailyQuota, request.MonthlyQuota, request.Verified)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(apiKey)
+}
+
+// handler for `PUT /api/v1/keys/{name}` - signature verification in middleware
+func (c *ApiController) APIKeysUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	var request APIKeyRequest
+	if !decodeAPIKeyRequest(w, r, &request) {
+		return
+	}
+
+	apiKey, err := apikey.Update(
+		muxhelpper.Vars(r)["name"], request.DailyQuota, request.MonthlyQuota, request.Disabled, request.Verified)
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+	apiKey.Key = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(apiKey)
+}
+
+// handler for `DELETE /api/v1/keys/{name}` - signature verification in middleware
+func (c *ApiController) APIKeysDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	err := apikey.Delete(muxhelpper.Vars(r)["name"])
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handler for `GET /api/v1/stats/keys` - signature verification in middleware
+func (c *ApiController) StatisticsHandlerStatsForAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(APIKeysStatsResponse{
+		Stats: apikey.Usage(),
+	})
+}
+
+func decodeAPIKeyRequest(w http.ResponseWriter, r *http.Request, request *APIKeyRequest) bool {
+	err := util.DecodeJSONBody(w, r, request)
+	if err != nil {
+		var mr *util.MalformedRequest
+		if errors.As(err, &mr) {
+			log.Errorf("Malformed request error: %v", err)
+			http.Error(w, mr.Msg, mr.Status)
+		} else {
+			log.Error(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return false
+	}
+	if request.DailyQuota < 0 || request.MonthlyQuota < 0 {
+		http.Error(w, "Quotas can't be negative", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeAPIKeyError(w http.ResponseWriter, err error) {
+	switch err {
+	case apikey.ErrNotFound:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case apikey.ErrAlreadyExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case apikey.ErrInvalidName:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Errorf("Failed saving api key because of: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
+	muxhelpper "github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiController_APIKeysHandlers(t *testing.T) {
+	_ = apikey.Init(nil, apikey.AnonymousPolicy{Enabled: false})
+	defer func() { _ = apikey.Init(nil, apikey.AnonymousPolicy{Enabled: true}) }()
+
+	apiController := NewApiController(false, repositories.Repos{}, new(actionMocks.Actions), selection.NewRoundRobinSelector())
+	router := muxhelpper.NewRouter()
+	router.HandleFunc("/api/v1/keys", apiController.APIKeysCreateHandler).Methods("POST")
+	router.HandleFunc("/api/v1/keys", apiController.APIKeysListHandler).Methods("GET")
+	router.HandleFunc("/api/v1/keys/{name}", apiController.APIKeysUpdateHandler).Methods("PUT")
+	router.HandleFunc("/api/v1/keys/{name}", apiController.APIKeysDeleteHandler).Methods("DELETE")
+	router.HandleFunc("/api/v1/stats/keys", apiController.StatisticsHandlerStatsForAPIKeys).Methods("GET")
+	router.HandleFunc("/", apiController.RPCHandler).Methods("POST")
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("POST", "/api/v1/keys", `{"name": "test", "daily_quota": -1}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = send("POST", "/api/v1/keys", `{"name": "test", "daily_quota": 1}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created models.APIKey
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+	assert.NotEmpty(t, created.Key)
+
+	rr = send("POST", "/api/v1/keys", `{"name": "test"}`)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// requests without key are rejected and requests over quota are limited
+	rr = send("POST", "/", `{"jsonrpc": "2.0", "id": 1, "method": "author_insertKey"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	var response rpc.RPCResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, rpc.Unauthorized, response.Error.Code)
+
+	rr = send("POST", "/?apikey="+created.Key, `{"jsonrpc": "2.0", "id": 1, "method": "author_insertKey"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = send("POST", "/?apikey="+created.Key, `{"jsonrpc": "2.0", "id": 1, "method": "author_insertKey"}`)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	rr = send("GET", "/api/v1/stats/keys", "")
+	var stats APIKeysStatsResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &stats)
+	assert.Equal(t, int64(1), stats.Stats["test"].TotalRequests)
+
+	rr = send("PUT", "/api/v1/keys/missing", `{"daily_quota": 1}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = send("PUT", "/api/v1/keys/test", `{"daily_quota": 5}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = send("GET", "/api/v1/keys", "")
+	var listed []models.APIKey
+	_ = json.Unmarshal(rr.Body.Bytes(), &listed)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, int64(5), listed[0].DailyQuota)
+	assert.Empty(t, listed[0].Key)
+
+	rr = send("DELETE", "/api/v1/keys/test", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = send("DELETE", "/api/v1/keys/test", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
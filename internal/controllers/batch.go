@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/policy"
+	"github.com/NodeFactoryIo/vedran/internal/record"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/verify"
+	log "github.com/sirupsen/logrus"
+)
+
+// subBatch is part of batch request sent to single node, indices point to elements of original batch
+type subBatch struct {
+	node    models.Node
+	indices []int
+}
+
+// subBatchResult holds responses for elements of sub batch that node successfully handled
+type subBatchResult struct {
+	responses map[int]json.RawMessage
+	nodeError bool
+}
+
+// handleBatch splits batch into sub batches sent to multiple nodes in parallel and merges responses
+// in request order. Elements that failed are retried on nodes that didn't handle them yet. Invalid
+// elements and elements rejected by method policy are answered with their error responses and
+// notifications are forwarded without response. Elements that have to be verified are verified
+// separately by multiple nodes.
+func (c ApiController) handleBatch(
+	w http.ResponseWriter, reqRPCBodies []rpc.RPCRequest, errResponses []*rpc.RPCResponse, client string, verifiedKey bool,
+) {
+	responses := make([]json.RawMessage, len(reqRPCBodies))
+	var pending []int
+	var verified []int
+	var notifications []rpc.RPCRequest
+	for i, request := range reqRPCBodies {
+		if errResponses[i] != nil {
+			responses[i], _ = json.Marshal(errResponses[i])
+		} else if rpcErr := policy.Check(client, request); rpcErr != nil {
+			log.Debugf("Batch element rejected by method policy: %s", rpcErr.Message)
+			if !request.IsNotification() {
+				responses[i], _ = json.Marshal(rpc.CreateSingleRPCError(request.ID, rpcErr.Code, rpcErr.Message))
+			}
+		} else if request.IsNotification() {
+			notifications = append(notifications, request)
+		} else if verify.Required(request.Method, verifiedKey) {
+			verified = append(verified, i)
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	if len(pending) > 0 || len(verified) > 0 || len(notifications) > 0 {
+		var routed []rpc.RPCRequest
+		for _, index := range append(pending, verified...) {
+			routed = append(routed, reqRPCBodies[index])
+		}
+		nodes := c.selectNodes(routed...)
+		if len(notifications) > 0 {
+			reqBody, _ := json.Marshal(notifications)
+			c.sendNotification(nodes, reqBody)
+		}
+		if len(nodes) == 0 {
+			log.Error("Request failed because vedran has no available nodes")
+			sendBatchToFallback(responses, reqRPCBodies, append(pending, verified...), "No available nodes")
+		} else {
+			var wg sync.WaitGroup
+			for _, index := range verified {
+				wg.Add(1)
+				go func(index int) {
+					defer wg.Done()
+					var response bytes.Buffer
+					reqBody, _ := json.Marshal(reqRPCBodies[index])
+					c.verifyRequest(&response, reqRPCBodies[index], reqBody, nodes)
+					responses[index] = response.Bytes()
+				}(index)
+			}
+			c.sendBatch(responses, reqRPCBodies, pending, nodes)
+			wg.Wait()
+		}
+	}
+
+	var answered []json.RawMessage
+	for i, request := range reqRPCBodies {
+		if errResponses[i] != nil || !request.IsNotification() {
+			answered = append(answered, responses[i])
+		}
+	}
+	// batch that contains only notifications must not be answered
+	if len(answered) > 0 {
+		_, _ = w.Write(mergeBatchResponses(answered))
+	}
+}
+
+// sendBatch sends pending batch elements to nodes and stores their responses on element positions
+func (c ApiController) sendBatch(
+	responses []json.RawMessage, reqRPCBodies []rpc.RPCRequest, pending []int, nodes []models.Node,
+) {
+	subBatchSize := configuration.Config.SubBatchSize
+	if subBatchSize <= 0 {
+		subBatchSize = len(pending)
+	}
+
+	tried := make([]map[string]bool, len(reqRPCBodies))
+	for _, index := range pending {
+		tried[index] = make(map[string]bool)
+	}
+
+	available := nodes
+	for round := 0; len(pending) > 0 && len(available) > 0; round++ {
+		if round > 0 && !canRetry(round) {
+			break
+		}
+		subBatches, exhausted := splitBatch(pending, subBatchSize, available, tried)
+		if len(subBatches) == 0 {
+			break
+		}
+
+		results := make([]subBatchResult, len(subBatches))
+		var wg sync.WaitGroup
+		for i, sb := range subBatches {
+			wg.Add(1)
+			go func(i int, sb subBatch) {
+				defer wg.Done()
+				results[i] = c.sendSubBatch(sb, reqRPCBodies)
+			}(i, sb)
+		}
+		wg.Wait()
+
+		failedNodes := make(map[string]bool)
+		failed := exhausted
+		for i, sb := range subBatches {
+			if results[i].nodeError {
+				failedNodes[sb.node.ID] = true
+			}
+			for _, index := range sb.indices {
+				tried[index][sb.node.ID] = true
+				if response, ok := results[i].responses[index]; ok {
+					responses[index] = response
+				} else {
+					failed = append(failed, index)
+				}
+			}
+		}
+		pending = failed
+
+		var stillAvailable []models.Node
+		for _, node := range available {
+			if !failedNodes[node.ID] {
+				stillAvailable = append(stillAvailable, node)
+			}
+		}
+		available = stillAvailable
+	}
+
+	if len(pending) > 0 {
+		log.Errorf("Request failed because nodes returned invalid rpc response for %d batch elements", len(pending))
+		sendBatchToFallback(responses, reqRPCBodies, pending, "Internal Server Error")
+	}
+}
+
+// sendBatchToFallback sends batch elements that no node could answer to fallback endpoints as single batch
+// and stores their responses on element positions. Elements fallback didn't answer are answered with error
+// response with provided message.
+func sendBatchToFallback(responses []json.RawMessage, reqRPCBodies []rpc.RPCRequest, indices []int, message string) {
+	if !fallback.HTTPEnabled() || len(indices) == 0 {
+		setErrorResponses(responses, reqRPCBodies, indices, message)
+		return
+	}
+
+	requests := make([]rpc.RPCRequest, len(indices))
+	methods := make([]string, len(indices))
+	indicesByID := make(map[string][]int)
+	for i, index := range indices {
+		requests[i] = reqRPCBodies[index]
+		methods[i] = reqRPCBodies[index].Method
+		id := rpc.IDKey(reqRPCBodies[index].ID)
+		indicesByID[id] = append(indicesByID[id], index)
+	}
+	reqBody, _ := json.Marshal(requests)
+
+	ctx, cancel := rpc.WithTimeout(context.Background(), methods...)
+	defer cancel()
+	byteResponse, err := fallback.Send(ctx, true, reqBody)
+	var rawResponses []json.RawMessage
+	if err == nil {
+		err = json.Unmarshal(byteResponse, &rawResponses)
+	}
+	if err != nil {
+		log.Errorf("Request failed on fallback endpoints because of: %v", err)
+		setErrorResponses(responses, reqRPCBodies, indices, message)
+		return
+	}
+
+	answered := make(map[int]bool)
+	for _, rawResponse := range rawResponses {
+		var rpcResponse rpc.RPCResponse
+		if json.Unmarshal(rawResponse, &rpcResponse) != nil {
+			continue
+		}
+		id := rpc.IDKey(rpcResponse.ID)
+		matched := indicesByID[id]
+		if len(matched) == 0 {
+			continue
+		}
+		responses[matched[0]] = rawResponse
+		answered[matched[0]] = true
+		indicesByID[id] = matched[1:]
+	}
+
+	var unanswered []int
+	for _, index := range indices {
+		if !answered[index] {
+			unanswered = append(unanswered, index)
+		}
+	}
+	log.Debugf("%d batch elements served by fallback endpoint", len(indices)-len(unanswered))
+	setErrorResponses(responses, reqRPCBodies, unanswered, message)
+}
+
+func setErrorResponses(responses []json.RawMessage, reqRPCBodies []rpc.RPCRequest, indices []int, message string) {
+	for _, index := range indices {
+		responses[index], _ = json.Marshal(
+			rpc.CreateSingleRPCError(reqRPCBodies[index].ID, rpc.InternalServerError, message))
+	}
+}
+
+// sendNotification forwards notification or batch of notifications to first node that accepts it,
+// notification is sent to fallback endpoints if no node accepted it
+func (c ApiController) sendNotification(nodes []models.Node, reqBody []byte) {
+	for i, node := range nodes {
+		if i > 0 && !canRetry(i) {
+			break
+		}
+		done := selection.Track(node.ID)
+		err := rpc.SendNotificationToNode(node.ID, reqBody)
+		done()
+		if err != nil {
+			c.recordFailedRequest(node, err)
+			continue
+		}
+
+		go record.SuccessfulRequest(node, c.repositories)
+		return
+	}
+	if fallback.HTTPEnabled() {
+		err := fallback.SendNotification(reqBody)
+		if err == nil {
+			return
+		}
+		log.Errorf("Notification failed on fallback endpoints because of: %v", err)
+	}
+	log.Error("Notification failed because no node accepted it")
+}
+
+// splitBatch assigns each pending element to node that didn't handle it yet, spreading consecutive groups
+// of size elements across nodes, and splits elements assigned to same node into sub batches of at most
+// size elements. Elements that were already tried on all nodes are returned as exhausted.
+func splitBatch(
+	pending []int, size int, nodes []models.Node, tried []map[string]bool,
+) (subBatches []subBatch, exhausted []int) {
+	assigned := make([][]int, len(nodes))
+	for position, index := range pending {
+		preferred := position / size
+		found := false
+		for k := 0; k < len(nodes); k++ {
+			n := (preferred + k) % len(nodes)
+			if !tried[index][nodes[n].ID] {
+				assigned[n] = append(assigned[n], index)
+				found = true
+				break
+			}
+		}
+		if !found {
+			exhausted = append(exhausted, index)
+		}
+	}
+
+	for n, indices := range assigned {
+		for start := 0; start < len(indices); start += size {
+			end := start + size
+			if end > len(indices) {
+				end = len(indices)
+			}
+			subBatches = append(subBatches, subBatch{node: nodes[n], indices: indices[start:end]})
+		}
+	}
+	return subBatches, exhausted
+}
+
+// sendSubBatch sends sub batch to node and matches returned responses to batch elements by id
+func (c ApiController) sendSubBatch(sb subBatch, reqRPCBodies []rpc.RPCRequest) subBatchResult {
+	requests := make([]rpc.RPCRequest, len(sb.indices))
+	for i, index := range sb.indices {
+		requests[i] = reqRPCBodies[index]
+	}
+	reqBody, _ := json.Marshal(requests)
+	methods := make([]string, len(requests))
+	for i, request := range requests {
+		methods[i] = request.Method
+	}
+
+	ctx, cancel := rpc.WithTimeout(context.Background(), methods...)
+	defer cancel()
+	done := selection.Track(sb.node.ID)
+	byteResponse, err := rpc.SendRequestToNodeContext(ctx, true, sb.node.ID, reqBody)
+	done()
+	if err != nil {
+		c.recordFailedRequest(sb.node, err)
+		return subBatchResult{nodeError: true}
+	}
+
+	var rawResponses []json.RawMessage
+	err = json.Unmarshal(byteResponse, &rawResponses)
+	if err != nil {
+		c.recordFailedRequest(sb.node, err)
+		return subBatchResult{nodeError: true}
+	}
+
+	// ids in batch don't have to be unique so responses with same id are matched in request order
+	indicesByID := make(map[string][]int)
+	for _, index := range sb.indices {
+		id := rpc.IDKey(reqRPCBodies[index].ID)
+		indicesByID[id] = append(indicesByID[id], index)
+	}
+
+	result := subBatchResult{responses: make(map[int]json.RawMessage)}
+	nodeFault := false
+	for _, rawResponse := range rawResponses {
+		var rpcResponse rpc.RPCResponse
+		if json.Unmarshal(rawResponse, &rpcResponse) != nil {
+			nodeFault = true
+			continue
+		}
+		// elements with errors that are not user errors are retried on other nodes
+		if rpcResponse.Error != nil {
+			if class := rpc.ClassifyError(rpcResponse.Error); class != rpc.UserError {
+				nodeFault = nodeFault || class == rpc.NodeFault
+				continue
+			}
+		}
+		id := rpc.IDKey(rpcResponse.ID)
+		indices := indicesByID[id]
+		if len(indices) == 0 {
+			continue
+		}
+		result.responses[indices[0]] = rawResponse
+		blocks.Learn(sb.node.ID, reqRPCBodies[indices[0]], rawResponse)
+		indicesByID[id] = indices[1:]
+	}
+
+	if nodeFault {
+		log.Errorf("Request to node %s returned invalid rpc response for some batch elements", sb.node.ID)
+		go record.FailedRequest(sb.node, c.repositories, c.actions, penalty.RPCFailure)
+	} else {
+		go record.SuccessfulRequest(sb.node, c.repositories)
+	}
+	return result
+}
+
+func mergeBatchResponses(responses []json.RawMessage) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteByte('[')
+	for i, response := range responses {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(response)
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes()
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
+	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
+	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// batchNode answers batch requests in reversed order so responses must be matched by id,
+// elements with ids contained in failIDs are answered with internal error
+type batchNode struct {
+	failAll bool
+	failIDs map[uint64]bool
+	mutex   sync.Mutex
+	served  []uint64
+}
+
+func (n *batchNode) handle(w http.ResponseWriter, r *http.Request) {
+	if n.failAll {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var requests []rpc.RPCRequest
+	_ = json.NewDecoder(r.Body).Decode(&requests)
+
+	responses := make([]json.RawMessage, 0, len(requests))
+	for i := len(requests) - 1; i >= 0; i-- {
+		id, _ := strconv.ParseUint(string(requests[i].ID), 10, 64)
+		n.mutex.Lock()
+		n.served = append(n.served, id)
+		n.mutex.Unlock()
+		if n.failIDs[id] {
+			responses = append(responses, json.RawMessage(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32603,"message":"Internal error"}}`, id)))
+		} else {
+			responses = append(responses, json.RawMessage(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"%d"}`, id, id)))
+		}
+	}
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+func TestApiController_BatchRPCHandler_Split(t *testing.T) {
+	tests := []struct {
+		name                string
+		batchSize           int
+		subBatchSize        int
+		firstNode           *batchNode
+		secondNode          *batchNode
+		firstNodeMinServed  int
+		secondNodeMinServed int
+		failedIDs           map[uint64]bool
+	}{
+		{
+			name:                "batch is split across nodes",
+			batchSize:           10,
+			subBatchSize:        3,
+			firstNode:           &batchNode{},
+			secondNode:          &batchNode{},
+			firstNodeMinServed:  1,
+			secondNodeMinServed: 1,
+		},
+		{
+			name:                "failed elements are retried on other node",
+			batchSize:           10,
+			subBatchSize:        5,
+			firstNode:           &batchNode{failIDs: map[uint64]bool{2: true, 4: true}},
+			secondNode:          &batchNode{failIDs: map[uint64]bool{7: true}},
+			firstNodeMinServed:  6,
+			secondNodeMinServed: 6,
+		},
+		{
+			name:                "sub batches of failed node are retried on other node",
+			batchSize:           10,
+			subBatchSize:        2,
+			firstNode:           &batchNode{failAll: true},
+			secondNode:          &batchNode{},
+			secondNodeMinServed: 10,
+		},
+		{
+			name:         "elements failed on all nodes return error",
+			batchSize:    4,
+			subBatchSize: 2,
+			firstNode:    &batchNode{failIDs: map[uint64]bool{1: true}},
+			secondNode:   &batchNode{failIDs: map[uint64]bool{1: true}},
+			failedIDs:    map[uint64]bool{1: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			firstServer := httptest.NewServer(http.HandlerFunc(test.firstNode.handle))
+			defer firstServer.Close()
+			secondServer := httptest.NewServer(http.HandlerFunc(test.secondNode.handle))
+			defer secondServer.Close()
+
+			poolerMock := &tunnelMocks.Pooler{}
+			poolerMock.On("GetHTTPPort", "node-1").Return(serverPort(firstServer), nil)
+			poolerMock.On("GetHTTPPort", "node-2").Return(serverPort(secondServer), nil)
+			configuration.Config.PortPool = poolerMock
+			configuration.Config.SubBatchSize = test.subBatchSize
+			defer func() { configuration.Config.SubBatchSize = 0 }()
+
+			nodes := []models.Node{{ID: "node-1"}, {ID: "node-2"}}
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetActiveNodes").Return(&nodes)
+			nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+			recordRepoMock := repoMocks.RecordRepository{}
+			recordRepoMock.On("Save", mock.Anything).Return(nil)
+			actionsMockObject := new(actionMocks.Actions)
+			actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, actionsMockObject, selection.NewRoundRobinSelector())
+
+			requests := make([]rpc.RPCRequest, test.batchSize)
+			for i := range requests {
+				requests[i] = rpc.RPCRequest{JSONRPC: "2.0", ID: json.RawMessage(strconv.Itoa(i)), Method: "state_getStorage"}
+			}
+			reqBody, _ := json.Marshal(requests)
+			req, _ := http.NewRequest("POST", "/", bytes.NewReader(reqBody))
+			rr := httptest.NewRecorder()
+
+			http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+			var responses []rpc.RPCResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &responses)
+			assert.Nil(t, err)
+			assert.Len(t, responses, test.batchSize)
+			for i, response := range responses {
+				assert.Equal(t, json.RawMessage(strconv.Itoa(i)), response.ID, "responses should be in request order")
+				if test.failedIDs[uint64(i)] {
+					assert.NotNil(t, response.Error)
+				} else {
+					assert.Nil(t, response.Error)
+					assert.Equal(t, json.RawMessage(fmt.Sprintf(`"%d"`, i)), *response.Result)
+				}
+			}
+			assert.GreaterOrEqual(t, len(test.firstNode.served), test.firstNodeMinServed)
+			assert.GreaterOrEqual(t, len(test.secondNode.served), test.secondNodeMinServed)
+		})
+	}
+}
+
+func serverPort(server *httptest.Server) int {
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	return port
+}
+
+func TestApiController_BatchRPCHandler_Elements(t *testing.T) {
+	tests := []struct {
+		name         string
+		rpcRequest   string
+		wantResponse string
+	}{
+		{
+			name: "Invalid elements are answered on their position",
+			rpcRequest: `[{"jsonrpc": "2.0", "id": 1, "method": "system_health"}, 1, ` +
+				`{"jsonrpc": "2.0", "id": "2"}, {"jsonrpc": "2.0", "id": 3, "method": "system_health"}]`,
+			wantResponse: `[{"jsonrpc":"2.0","id":1,"result":"1"},` +
+				`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}},` +
+				`{"jsonrpc":"2.0","id":"2","error":{"code":-32600,"message":"Invalid Request"}},` +
+				`{"jsonrpc":"2.0","id":3,"result":"3"}]`,
+		},
+		{
+			name: "Notifications are not answered",
+			rpcRequest: `[{"jsonrpc": "2.0", "method": "system_health"}, ` +
+				`{"jsonrpc": "2.0", "id": 1, "method": "system_health"}]`,
+			wantResponse: `[{"jsonrpc":"2.0","id":1,"result":"1"}]`,
+		},
+		{
+			name: "Elements rejected by method policy are answered on their position",
+			rpcRequest: `[{"jsonrpc": "2.0", "id": 1, "method": "author_insertKey"}, ` +
+				`{"jsonrpc": "2.0", "method": "author_rotateKeys"}, {"jsonrpc": "2.0", "id": 2, "method": "system_health"}]`,
+			wantResponse: `[{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method author_insertKey is not allowed"}},` +
+				`{"jsonrpc":"2.0","id":2,"result":"2"}]`,
+		},
+		{
+			name:         "Batch of notifications is not answered",
+			rpcRequest:   `[{"jsonrpc": "2.0", "method": "system_health"}, {"jsonrpc": "2.0", "method": "system_health"}]`,
+			wantResponse: ``,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := &batchNode{}
+			nodeServer := httptest.NewServer(http.HandlerFunc(node.handle))
+			defer nodeServer.Close()
+
+			poolerMock := &tunnelMocks.Pooler{}
+			poolerMock.On("GetHTTPPort", "node-1").Return(serverPort(nodeServer), nil)
+			configuration.Config.PortPool = poolerMock
+
+			nodes := []models.Node{{ID: "node-1"}}
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetActiveNodes").Return(&nodes)
+			nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+			recordRepoMock := repoMocks.RecordRepository{}
+			recordRepoMock.On("Save", mock.Anything).Return(nil)
+			actionsMockObject := new(actionMocks.Actions)
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, actionsMockObject, selection.NewRoundRobinSelector())
+
+			req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.rpcRequest)))
+			rr := httptest.NewRecorder()
+
+			http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.wantResponse, rr.Body.String())
+		})
+	}
+}
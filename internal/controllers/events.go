@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	muxhelpper "github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultNodeEventsLimit = 100
+	MaxNodeEventsLimit     = 1000
+)
+
+type NodeEventsResponse struct {
+	Events []models.NodeEvent `json:"events"`
+	// Total is number of all events of node in requested time range
+	Total int `json:"total"`
+}
+
+// handler for `GET /api/v1/nodes/{id}/events`
+func (c *ApiController) NodeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	nodeID := muxhelpper.Vars(r)["id"]
+	params, err := parseRangeParams(r, DefaultNodeEventsLimit, MaxNodeEventsLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.repositories.NodeRepo.FindByID(nodeID)
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "Node not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed fetching node %s because of: %v", nodeID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	events, total, err := c.repositories.NodeEventRepo.FindByNodeID(nodeID, params.from, params.to, params.offset, params.limit)
+	if err != nil {
+		log.Errorf("Failed fetching events of node %s because of: %v", nodeID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(NodeEventsResponse{Events: events, Total: total})
+}
+
+// rangeParams are time range and pagination query params, time is zero if range is not bounded on that side
+type rangeParams struct {
+	from   time.Time
+	to     time.Time
+	offset int
+	limit  int
+}
+
+// parseRangeParams parses optional from and to RFC3339 times, offset and limit query params of request,
+// returned error is message for client
+func parseRangeParams(r *http.Request, defaultLimit int, maxLimit int) (rangeParams, error) {
+	query := r.URL.Query()
+	params := rangeParams{limit: defaultLimit}
+
+	var err error
+	if value := query.Get("from"); value != "" {
+		params.from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, errors.New("Invalid from param, expected RFC3339 time")
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		params.to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return params, errors.New("Invalid to param, expected RFC3339 time")
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		params.offset, err = strconv.Atoi(value)
+		if err != nil || params.offset < 0 {
+			return params, errors.New("Invalid offset param, expected non negative number")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		params.limit, err = strconv.Atoi(value)
+		if err != nil || params.limit < 1 || params.limit > maxLimit {
+			return params, fmt.Errorf("Invalid limit param, expected number between 1 and %d", maxLimit)
+		}
+	}
+	return params, nil
+}
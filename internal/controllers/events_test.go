@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	muxhelpper "github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApiController_NodeEventsHandler(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2021-02-01T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2021-02-02T00:00:00Z")
+	events := []models.NodeEvent{
+		{ID: 1, NodeID: "1", Type: models.NodePenalized, Timestamp: from, Reason: "missed-ping", Cooldown: 1},
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		httpStatus     int
+		expectedFrom   time.Time
+		expectedTo     time.Time
+		expectedOffset int
+		expectedLimit  int
+	}{
+		{
+			name:          "returns events with default pagination",
+			url:           "/api/v1/nodes/1/events",
+			httpStatus:    http.StatusOK,
+			expectedLimit: DefaultNodeEventsLimit,
+		},
+		{
+			name:           "returns events in time range",
+			url:            "/api/v1/nodes/1/events?from=2021-02-01T00:00:00Z&to=2021-02-02T00:00:00Z&offset=10&limit=5",
+			httpStatus:     http.StatusOK,
+			expectedFrom:   from,
+			expectedTo:     to,
+			expectedOffset: 10,
+			expectedLimit:  5,
+		},
+		{
+			name:       "rejects invalid time",
+			url:        "/api/v1/nodes/1/events?to=yesterday",
+			httpStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejects limit over maximum",
+			url:        "/api/v1/nodes/1/events?limit=5000",
+			httpStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejects negative offset",
+			url:        "/api/v1/nodes/1/events?offset=-1",
+			httpStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "returns not found for unknown node",
+			url:        "/api/v1/nodes/2/events",
+			httpStatus: http.StatusNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodeRepoMock := mocks.NodeRepository{}
+			nodeRepoMock.On("FindByID", "1").Return(&models.Node{ID: "1"}, nil)
+			nodeRepoMock.On("FindByID", "2").Return(nil, errors.New("not found"))
+			nodeEventRepoMock := mocks.NodeEventRepository{}
+			nodeEventRepoMock.On(
+				"FindByNodeID", "1", test.expectedFrom, test.expectedTo, test.expectedOffset, test.expectedLimit,
+			).Return(events, 11, nil)
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:      &nodeRepoMock,
+				NodeEventRepo: &nodeEventRepoMock,
+			}, nil, nil)
+
+			req, _ := http.NewRequest("GET", test.url, nil)
+			rr := httptest.NewRecorder()
+			router := muxhelpper.NewRouter()
+			router.HandleFunc("/api/v1/nodes/{id}/events", apiController.NodeEventsHandler)
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.httpStatus, rr.Code)
+			if rr.Code != http.StatusOK {
+				nodeEventRepoMock.AssertNotCalled(t, "FindByNodeID", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			var response NodeEventsResponse
+			_ = json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.Equal(t, 11, response.Total)
+			assert.Equal(t, events, response.Events)
+		})
+	}
+}
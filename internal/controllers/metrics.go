@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/NodeFactoryIo/vedran/internal/active"
 	"github.com/NodeFactoryIo/vedran/internal/auth"
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/pkg/util"
 	log "github.com/sirupsen/logrus"
@@ -50,6 +51,8 @@ func (c ApiController) SaveMetricsHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	blocks.SetNodeHeight(requestContext.NodeId, metricsRequest.BestBlockHeight)
+
 	log.Debugf(
 		"Node %s saved new metrics { finalized_block_height: %d, best_block_height: %d }",
 		requestContext.NodeId,
@@ -238,14 +238,31 @@ func TestApiController_SaveMetricsHandler(t *testing.T) {
 				test.metricsRepoSaveError,
 			)
 			downtimeRepoMock := mocks.DowntimeRepository{}
+			probeRepoMock := mocks.ProbeRepository{}
+			probeRepoMock.On("FindByNodeID", test.nodeId).Return(&models.Probe{
+				NodeId:               test.nodeId,
+				Timestamp:            time.Now(),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			}, nil)
+			probeRepoMock.On("GetLatestBlockMetrics").Return(&models.LatestBlockMetrics{
+				BestBlockHeight:      1001,
+				FinalizedBlockHeight: 998,
+			}, nil)
+
+			nodeEventRepoMock := mocks.NodeEventRepository{}
+			nodeEventRepoMock.On("Save", mock.Anything).Return(nil)
 
 			apiController := NewApiController(false, repositories.Repos{
-				NodeRepo:     &nodeRepoMock,
-				PingRepo:     &pingRepoMock,
-				MetricsRepo:  &metricsRepoMock,
-				RecordRepo:   &recordRepoMock,
-				DowntimeRepo: &downtimeRepoMock,
-			}, nil)
+				NodeRepo:      &nodeRepoMock,
+				PingRepo:      &pingRepoMock,
+				MetricsRepo:   &metricsRepoMock,
+				RecordRepo:    &recordRepoMock,
+				DowntimeRepo:  &downtimeRepoMock,
+				ProbeRepo:     &probeRepoMock,
+				NodeEventRepo: &nodeEventRepoMock,
+			}, nil, nil)
 
 			handler := http.HandlerFunc(apiController.SaveMetricsHandler)
 
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/schedule/penalize"
+	muxhelpper "github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+type PenaltiesResponse struct {
+	Penalties []models.Penalty `json:"penalties"`
+}
+
+// handler for `GET /api/v1/penalties` - signature verification in middleware
+func (c *ApiController) PenaltiesListHandler(w http.ResponseWriter, r *http.Request) {
+	penalties, err := c.repositories.PenaltyRepo.GetAll()
+	if err != nil && err.Error() != "not found" {
+		log.Errorf("Failed fetching penalties because of: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if penalties == nil {
+		penalties = []models.Penalty{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(PenaltiesResponse{Penalties: penalties})
+}
+
+// handler for `DELETE /api/v1/penalties/{id}` - signature verification in middleware
+func (c *ApiController) PenaltiesCancelHandler(w http.ResponseWriter, r *http.Request) {
+	nodeID := muxhelpper.Vars(r)["id"]
+	err := penalize.CancelPenalty(nodeID, c.repositories)
+	if err != nil {
+		if err.Error() == "not found" {
+			http.Error(w, "Penalty not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed cancelling penalty of node %s because of: %v", nodeID, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,7 +10,9 @@ import (
 	"github.com/NodeFactoryIo/vedran/internal/whitelist"
 
 	"github.com/NodeFactoryIo/vedran/internal/auth"
+	"github.com/NodeFactoryIo/vedran/internal/capability"
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/history"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/pkg/util"
 	log "github.com/sirupsen/logrus"
@@ -20,6 +22,10 @@ type RegisterRequest struct {
 	Id            string `json:"id"`
 	ConfigHash    string `json:"config_hash"`
 	PayoutAddress string `json:"payout_address"`
+	// Pruning is pruning mode of node, either archive or pruned, and RPCModules are rpc modules
+	// enabled on node, both are optional and replaced by capabilities observed by probing
+	Pruning    string   `json:"pruning,omitempty"`
+	RPCModules []string `json:"rpc_modules,omitempty"`
 }
 
 type RegisterResponse struct {
@@ -44,6 +50,11 @@ func (c ApiController) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = capability.ValidatePruning(registerRequest.Pruning); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if c.whitelistEnabled {
 		if !whitelist.IsNodeWhitelisted(registerRequest.Id) {
 			http.Error(w, fmt.Sprintf("Node %s is not whitelisted", registerRequest.Id), http.StatusBadRequest)
@@ -72,6 +83,8 @@ func (c ApiController) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 				Token:         token,
 				LastUsed:      time.Now().Unix(),
 				Active:        true,
+				Pruning:       registerRequest.Pruning,
+				RPCModules:    registerRequest.RPCModules,
 			}
 			err = c.repositories.NodeRepo.Save(node)
 			if err != nil {
@@ -80,12 +93,28 @@ func (c ApiController) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			history.Record(c.repositories, models.NodeEvent{NodeID: node.ID, Type: models.NodeRegistered})
 			log.Infof("New node %s registered", node.ID)
 		} else {
 			log.Errorf("Unable to check if node %s already created, error: %v", node.ID, err)
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	} else if node.Banned {
+		http.Error(w, fmt.Sprintf("Node %s is banned", registerRequest.Id), http.StatusForbidden)
+		return
+	} else if node.Pruning != registerRequest.Pruning || !equalModules(node.RPCModules, registerRequest.RPCModules) {
+		// node declared new capabilities when registering again
+		node.Pruning = registerRequest.Pruning
+		node.RPCModules = registerRequest.RPCModules
+		err = c.repositories.NodeRepo.Save(node)
+		if err != nil {
+			log.Errorf("Unable to save node %s capabilities to database, error: %v", node.ID, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
 		}
 	}
+	capability.Declare(node.ID, capability.Declared(*node))
 
 	// return token
 	w.Header().Set("Content-Type", "application/json")
@@ -94,3 +123,15 @@ func (c ApiController) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		TunnelServerAddress: configuration.Config.TunnelServerAddress,
 	})
 }
+
+func equalModules(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
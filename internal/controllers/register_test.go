@@ -11,12 +11,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/NodeFactoryIo/vedran/internal/capability"
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/whitelist"
 	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestApiController_RegisterHandler(t *testing.T) {
@@ -114,6 +116,26 @@ func TestApiController_RegisterHandler(t *testing.T) {
 			findByIDError:         nil,
 			findByIDNumberOfCalls: 1,
 		},
+		{
+			name: "Registration request for node that is banned",
+			registerRequest: RegisterRequest{
+				Id:            "3",
+				ConfigHash:    "dadf2e32dwq12",
+				PayoutAddress: "0xdafe2cdscdsa",
+			},
+			httpStatus:            http.StatusForbidden,
+			registerResponse:      RegisterResponse{},
+			isWhitelisted:         false,
+			saveMockReturns:       nil,
+			saveMockNumberOfCalls: 0,
+			findByIDReturns: &models.Node{
+				ID:     "3",
+				Token:  "test-token",
+				Banned: true,
+			},
+			findByIDError:         nil,
+			findByIDNumberOfCalls: 1,
+		},
 	}
 	_ = os.Setenv("AUTH_SECRET", "test-auth-secret")
 	_, _ = whitelist.InitWhitelisting([]string{"1", "3"}, "")
@@ -139,14 +161,17 @@ func TestApiController_RegisterHandler(t *testing.T) {
 				test.findByIDReturns, test.findByIDError,
 			)
 			downtimeRepoMock := mocks.DowntimeRepository{}
+			nodeEventRepoMock := mocks.NodeEventRepository{}
+			nodeEventRepoMock.On("Save", mock.Anything).Return(nil)
 
 			apiController := NewApiController(test.isWhitelisted, repositories.Repos{
-				NodeRepo:     &nodeRepoMock,
-				PingRepo:     &pingRepoMock,
-				MetricsRepo:  &metricsRepoMock,
-				RecordRepo:   &recordRepoMock,
-				DowntimeRepo: &downtimeRepoMock,
-			}, nil)
+				NodeRepo:      &nodeRepoMock,
+				PingRepo:      &pingRepoMock,
+				MetricsRepo:   &metricsRepoMock,
+				RecordRepo:    &recordRepoMock,
+				DowntimeRepo:  &downtimeRepoMock,
+				NodeEventRepo: &nodeEventRepoMock,
+			}, nil, nil)
 
 			handler := http.HandlerFunc(apiController.RegisterHandler)
 
@@ -172,8 +197,63 @@ func TestApiController_RegisterHandler(t *testing.T) {
 
 			nodeRepoMock.AssertNumberOfCalls(t, "Save", test.saveMockNumberOfCalls)
 			nodeRepoMock.AssertNumberOfCalls(t, "FindByID", test.findByIDNumberOfCalls)
+			if test.httpStatus == http.StatusOK && test.saveMockNumberOfCalls == 1 {
+				nodeEventRepoMock.AssertCalled(t, "Save", mock.MatchedBy(func(event *models.NodeEvent) bool {
+					return event.NodeID == test.registerRequest.Id && event.Type == models.NodeRegistered
+				}))
+			}
 			assert.True(t, nodeRepoMock.AssertNumberOfCalls(t, "Save", test.saveMockNumberOfCalls))
 		})
 	}
 	_ = os.Setenv("AUTH_SECRET", "")
 }
+
+func TestApiController_RegisterHandler_Capabilities(t *testing.T) {
+	tests := []struct {
+		name                  string
+		registerRequest       RegisterRequest
+		httpStatus            int
+		saveMockNumberOfCalls int
+		expectedCapabilities  capability.Capabilities
+	}{
+		{
+			name:                  "Registration with invalid pruning mode is rejected",
+			registerRequest:       RegisterRequest{Id: "4", Pruning: "full"},
+			httpStatus:            http.StatusBadRequest,
+			saveMockNumberOfCalls: 0,
+		},
+		{
+			name:                  "Registered node declares new capabilities",
+			registerRequest:       RegisterRequest{Id: "4", Pruning: capability.Archive, RPCModules: []string{"chain", "state"}},
+			httpStatus:            http.StatusOK,
+			saveMockNumberOfCalls: 1,
+			expectedCapabilities:  capability.Capabilities{Pruning: capability.Archive, RPCModules: []string{"chain", "state"}},
+		},
+		{
+			name:                  "Registered node declares same capabilities",
+			registerRequest:       RegisterRequest{Id: "4", Pruning: capability.Pruned},
+			httpStatus:            http.StatusOK,
+			saveMockNumberOfCalls: 0,
+			expectedCapabilities:  capability.Capabilities{Pruning: capability.Pruned},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodeRepoMock := mocks.NodeRepository{}
+			nodeRepoMock.On("FindByID", "4").Return(&models.Node{ID: "4", Token: "token", Pruning: capability.Pruned}, nil)
+			nodeRepoMock.On("Save", mock.Anything).Return(nil)
+			apiController := NewApiController(false, repositories.Repos{NodeRepo: &nodeRepoMock}, nil, nil)
+
+			rb, _ := json.Marshal(test.registerRequest)
+			req, _ := http.NewRequest("POST", "/api/v1/node", bytes.NewReader(rb))
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(apiController.RegisterHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.httpStatus, rr.Code)
+			nodeRepoMock.AssertNumberOfCalls(t, "Save", test.saveMockNumberOfCalls)
+			if test.httpStatus == http.StatusOK {
+				assert.Equal(t, test.expectedCapabilities, capability.Get("4"))
+			}
+		})
+	}
+}
@@ -1,13 +1,32 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/capability"
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/hedge"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/policy"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
 	"github.com/NodeFactoryIo/vedran/internal/record"
 	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/rpccache"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/verify"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -15,56 +34,338 @@ func (c ApiController) RPCHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	defer r.Body.Close()
-	reqBody, err := ioutil.ReadAll(r.Body)
+	body := r.Body
+	if configuration.Config.MaxRequestSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, configuration.Config.MaxRequestSize)
+	}
+	reqBody, err := ioutil.ReadAll(body)
 	if err != nil {
 		log.Errorf("Request failed because of: %v", err)
+		if configuration.Config.MaxRequestSize > 0 && int64(len(reqBody)) >= configuration.Config.MaxRequestSize {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			_ = json.NewEncoder(w).Encode(
+				rpc.CreateSingleRPCError(nil, rpc.InvalidRequest, "Request body too large"))
+			return
+		}
 		_ = json.NewEncoder(w).Encode(
-			rpc.CreateRPCError(false, rpc.RPCRequest{}, nil, rpc.ParseError, "Parse error"))
+			rpc.CreateSingleRPCError(nil, rpc.ParseError, "Parse error"))
+		return
+	}
+
+	consumer := apikey.FromRequest(r)
+	client := ratelimit.ClientKey(r, consumer)
+	if rpc.IsBatch(reqBody) {
+		reqRPCBodies, errResponses, errResponse := rpc.ParseBatch(reqBody)
+		if errResponse != nil {
+			log.Errorf("Request failed because of: %s", errResponse.Error.Message)
+			_ = json.NewEncoder(w).Encode(errResponse)
+			return
+		}
+		if maxLength := configuration.Config.MaxBatchLength; maxLength > 0 && len(reqRPCBodies) > maxLength {
+			log.Debugf("Batch rejected because it has %d elements", len(reqRPCBodies))
+			_ = json.NewEncoder(w).Encode(rpc.CreateSingleRPCError(
+				nil, rpc.InvalidRequest, fmt.Sprintf("Batch too large, maximum length is %d", maxLength)))
+			return
+		}
+		if rpcErr := admitConsumer(consumer, client, len(reqRPCBodies)); rpcErr != nil {
+			writeConsumerError(w, nil, rpcErr)
+			return
+		}
+		c.handleBatch(w, reqRPCBodies, errResponses, client, apikey.Verified(consumer))
+		return
+	}
+
+	reqRPCBody, errResponse := rpc.ParseRequest(reqBody)
+	if errResponse != nil {
+		log.Errorf("Request failed because of: %s", errResponse.Error.Message)
+		_ = json.NewEncoder(w).Encode(errResponse)
 		return
 	}
+	if rpcErr := admitConsumer(consumer, client, 1); rpcErr != nil {
+		writeConsumerError(w, reqRPCBody.ID, rpcErr)
+		return
+	}
+	c.handleSingle(w, reqRPCBody, client, apikey.Verified(consumer))
+}
 
-	var reqRPCBody rpc.RPCRequest
-	var reqRPCBodies []rpc.RPCRequest
-	isBatch := rpc.IsBatch(reqBody)
-	if isBatch {
-		err = json.Unmarshal(reqBody, &reqRPCBodies)
+// admitConsumer authorizes api key of request and counts requests against client rate limit
+// and api key quotas, clients with invalid api key are rejected before they are rate limited
+func admitConsumer(consumer string, client string, requests int) *rpc.RPCError {
+	if rpcErr := apikey.Authorize(consumer); rpcErr != nil {
+		return rpcErr
+	}
+	if rpcErr := ratelimit.Allow(client, requests); rpcErr != nil {
+		return rpcErr
+	}
+	return apikey.Use(consumer, requests)
+}
+
+// writeConsumerError writes error for request rejected because of api key or rate limit, with http
+// status that tells if api key is invalid or if limit is exceeded
+func writeConsumerError(w http.ResponseWriter, id json.RawMessage, rpcErr *rpc.RPCError) {
+	log.Debugf("Request rejected because of: %s", rpcErr.Message)
+	if rpcErr.Code == rpc.LimitExceeded {
+		if retryAfter := rpcErr.RetryAfter(); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
 	} else {
-		err = json.Unmarshal(reqBody, &reqRPCBody)
+		w.WriteHeader(http.StatusUnauthorized)
 	}
+	_ = json.NewEncoder(w).Encode(rpc.CreateRPCErrorResponse(id, rpcErr))
+}
 
-	if err != nil {
-		log.Errorf("Request failed because of: %v", err)
-		_ = json.NewEncoder(w).Encode(
-			rpc.CreateRPCError(isBatch, reqRPCBody, reqRPCBodies, rpc.ParseError, "Parse error"))
+// handleSingle routes non batch request and streams response, notifications are not answered
+func (c ApiController) handleSingle(w http.ResponseWriter, reqRPCBody rpc.RPCRequest, client string, verifiedKey bool) {
+	c.forwardRequest(w, reqRPCBody, client, true, verifiedKey)
+}
+
+// routeRequest routes non batch request to first node that returns valid response and returns
+// that response, notifications are routed same way but nil is returned as they are not answered
+func (c ApiController) routeRequest(reqRPCBody rpc.RPCRequest, client string, verifiedKey bool) []byte {
+	var response bytes.Buffer
+	c.forwardRequest(&response, reqRPCBody, client, false, verifiedKey)
+	if response.Len() == 0 {
+		return nil
+	}
+	return response.Bytes()
+}
+
+// forwardRequest routes non batch request to first node that returns valid response and writes that
+// response to w, nothing is written for notifications. If stream is set, node response is streamed to w
+// instead of being read whole, except for responses that could be cached. Requests with verified methods
+// or sent with verified api key are verified by multiple nodes instead. Request is forwarded as parsed,
+// so nodes execute same method that was checked against method policy.
+func (c ApiController) forwardRequest(
+	w io.Writer, reqRPCBody rpc.RPCRequest, client string, stream bool, verifiedKey bool,
+) {
+	if rpcErr := policy.Check(client, reqRPCBody); rpcErr != nil {
+		log.Debugf("Request rejected by method policy: %s", rpcErr.Message)
+		if !reqRPCBody.IsNotification() {
+			writeJSON(w, rpc.CreateSingleRPCError(reqRPCBody.ID, rpcErr.Code, rpcErr.Message))
+		}
 		return
 	}
+	reqBody, _ := json.Marshal(reqRPCBody)
 
-	nodes := c.repositories.NodeRepo.GetActiveNodes(configuration.Config.Selection)
-	if len(*nodes) == 0 {
+	verified := !reqRPCBody.IsNotification() && verify.Required(reqRPCBody.Method, verifiedKey)
+	// cached responses are not verified so they are only used for requests that don't have to be
+	if result, ok := rpccache.Get(reqRPCBody); ok && !reqRPCBody.IsNotification() && !verified {
+		writeJSON(w, rpc.RPCResponse{
+			JSONRPC: "2.0",
+			ID:      reqRPCBody.ID,
+			Result:  &result,
+		})
+		return
+	}
+
+	nodes := c.selectNodes(reqRPCBody)
+	if reqRPCBody.IsNotification() {
+		c.sendNotification(nodes, reqBody)
+		return
+	}
+
+	if len(nodes) == 0 {
 		log.Error("Request failed because vedran has no available nodes")
-		_ = json.NewEncoder(w).Encode(
-			rpc.CreateRPCError(isBatch, reqRPCBody, reqRPCBodies, rpc.InternalServerError, "No available nodes"))
+		sendToFallback(w, reqRPCBody, reqBody, "No available nodes")
 		return
 	}
 
-	for _, node := range *nodes {
-		byteResponse, err := rpc.SendRequestToNode(
-			isBatch,
-			node.ID,
-			reqBody,
-		)
-		if err != nil {
-			log.Errorf("Request failed to node %s because of: %v", node.ID, err)
-			go record.FailedRequest(node, c.repositories, c.actions)
-			continue
+	if verified {
+		c.verifyRequest(w, reqRPCBody, reqBody, nodes)
+		return
+	}
+
+	stream = stream && !rpccache.Cacheable(reqRPCBody)
+	answer, ok := c.raceNodes(nodes, reqRPCBody.Method, func(ctx context.Context, node models.Node) (nodeAnswer, error) {
+		if stream {
+			response, err := rpc.OpenRequestToNode(ctx, node.ID, reqBody)
+			return nodeAnswer{response: response}, err
+		}
+		byteResponse, err := rpc.SendRequestToNodeContext(ctx, false, node.ID, reqBody)
+		return nodeAnswer{body: byteResponse}, err
+	})
+	if !ok {
+		log.Error("Request failed because all nodes returned invalid rpc response")
+		sendToFallback(w, reqRPCBody, reqBody, "Internal Server Error")
+		return
+	}
+	defer answer.close()
+	hedge.Observe(answer.latency)
+
+	if !stream {
+		rpccache.Put(reqRPCBody, answer.body)
+		blocks.Learn(answer.node.ID, reqRPCBody, answer.body)
+		_, _ = w.Write(answer.body)
+		go record.SuccessfulRequest(answer.node, c.repositories)
+		return
+	}
+
+	err := answer.response.Stream(w)
+	var writeErr *rpc.ClientWriteError
+	if err != nil && !errors.As(err, &writeErr) {
+		// response is partially written so it can't be routed to other node
+		log.Errorf("Streaming response from node %s failed because of: %v", answer.node.ID, err)
+		go record.FailedRequest(answer.node, c.repositories, c.actions, penalty.RPCFailure)
+		return
+	}
+	if err != nil {
+		log.Debugf("Request to node %s failed because of: %v", answer.node.ID, err)
+	}
+	go record.SuccessfulRequest(answer.node, c.repositories)
+}
+
+// sendToFallback sends request that no node could answer to fallback endpoints and writes their response,
+// error response with provided message is written if fallback is not configured or failed too. Fallback
+// responses are not recorded as node requests, so they are never rewarded.
+func sendToFallback(w io.Writer, reqRPCBody rpc.RPCRequest, reqBody []byte, message string) {
+	if !fallback.HTTPEnabled() {
+		writeJSON(w, rpc.CreateSingleRPCError(reqRPCBody.ID, rpc.InternalServerError, message))
+		return
+	}
+
+	ctx, cancel := rpc.WithTimeout(context.Background(), reqRPCBody.Method)
+	defer cancel()
+	response, err := fallback.Send(ctx, false, reqBody)
+	if err != nil {
+		log.Errorf("Request failed on fallback endpoints because of: %v", err)
+		writeJSON(w, rpc.CreateSingleRPCError(reqRPCBody.ID, rpc.InternalServerError, message))
+		return
+	}
+	log.Debugf("Request %s served by fallback endpoint", reqRPCBody.Method)
+	rpccache.Put(reqRPCBody, response)
+	_, _ = w.Write(response)
+}
+
+// selectNodes returns active nodes ordered by selector, limited to nodes capable of answering requests
+// and to nodes that have blocks requests are addressed to
+func (c ApiController) selectNodes(requests ...rpc.RPCRequest) []models.Node {
+	nodes := c.selector.Select(*c.repositories.NodeRepo.GetActiveNodes())
+	return blocks.Filter(capability.Filter(nodes, requests...), requests...)
+}
+
+// nodeAnswer is valid node response, either read whole or held open until it is streamed
+type nodeAnswer struct {
+	node     models.Node
+	body     []byte
+	response *rpc.NodeResponse
+	latency  time.Duration
+	cancel   context.CancelFunc
+	done     func()
+}
+
+// close releases node request of answer
+func (a nodeAnswer) close() {
+	if a.response != nil {
+		_ = a.response.Close()
+	}
+	a.cancel()
+	a.done()
+}
+
+type nodeAttempt struct {
+	answer nodeAnswer
+	err    error
+}
+
+// raceNodes sends request to nodes in order until one of them returns valid answer or retry budget is spent,
+// each request is limited by method timeout. If method is hedged and node hasn't answered within hedge delay,
+// request is also sent to next node, so up to two nodes handle request at once. First valid answer wins and
+// other request is cancelled. Nodes that failed are recorded, while recording node that answered is left to
+// caller, so only node that served response is rewarded.
+func (c ApiController) raceNodes(
+	nodes []models.Node, method string,
+	send func(ctx context.Context, node models.Node) (nodeAnswer, error),
+) (nodeAnswer, bool) {
+	delay, hedged := hedge.Delay(method)
+	attempts := make(chan nodeAttempt, len(nodes))
+	cancels := make([]context.CancelFunc, 0, len(nodes))
+	next, inFlight := 0, 0
+	var hedgeTimeout <-chan time.Time
+
+	launch := func() {
+		node := nodes[next]
+		ctx, cancel := rpc.WithTimeout(context.Background(), method)
+		cancels = append(cancels, cancel)
+		next++
+		inFlight++
+		go func() {
+			start := time.Now()
+			done := selection.Track(node.ID)
+			answer, err := send(ctx, node)
+			if err != nil {
+				done()
+				cancel()
+			}
+			answer.node = node
+			answer.latency = time.Since(start)
+			answer.cancel = cancel
+			answer.done = done
+			attempts <- nodeAttempt{answer: answer, err: err}
+		}()
+
+		hedgeTimeout = nil
+		if hedged && inFlight == 1 && next < len(nodes) && canRetry(next) {
+			hedgeTimeout = time.After(delay)
 		}
+	}
+
+	launch()
+	for inFlight > 0 {
+		select {
+		case <-hedgeTimeout:
+			log.Debugf("Node %s didn't answer within %s, hedging request to node %s", nodes[next-1].ID, delay, nodes[next].ID)
+			launch()
+		case attempt := <-attempts:
+			inFlight--
+			if attempt.err == nil {
+				for i, cancel := range cancels {
+					if nodes[i].ID != attempt.answer.node.ID {
+						cancel()
+					}
+				}
+				go discardAttempts(attempts, inFlight)
+				return attempt.answer, true
+			}
 
-		go record.SuccessfulRequest(node, c.repositories)
-		_, _ = w.Write(byteResponse)
+			c.recordFailedRequest(attempt.answer.node, attempt.err)
+			if next < len(nodes) && canRetry(next) {
+				launch()
+			}
+		}
+	}
+	return nodeAnswer{}, false
+}
+
+// canRetry returns if request that was already sent to provided number of nodes can be sent to another node
+func canRetry(sent int) bool {
+	budget := configuration.Config.RetryBudget
+	return budget <= 0 || sent <= budget
+}
+
+// recordFailedRequest logs error returned by node and penalizes node, unless error is transient
+func (c ApiController) recordFailedRequest(node models.Node, err error) {
+	log.Errorf("Request failed to node %s because of: %v", node.ID, err)
+	if rpc.ClassOf(err) == rpc.Transient {
 		return
 	}
+	go record.FailedRequest(node, c.repositories, c.actions, penalty.RPCFailure)
+}
+
+// discardAttempts waits for cancelled requests and releases answers that arrived before they were cancelled
+func discardAttempts(attempts <-chan nodeAttempt, inFlight int) {
+	for ; inFlight > 0; inFlight-- {
+		attempt := <-attempts
+		if attempt.err == nil {
+			attempt.answer.close()
+			continue
+		}
+		log.Debugf("Hedged request to node %s cancelled: %v", attempt.answer.node.ID, attempt.err)
+	}
+}
 
-	log.Error("Request failed because all nodes returned invalid rpc response")
-	_ = json.NewEncoder(w).Encode(
-		rpc.CreateRPCError(isBatch, reqRPCBody, reqRPCBodies, rpc.InternalServerError, "Internal Server Error"))
+// writeJSON writes v marshaled to json without trailing newline, so it can be used as websocket message
+func writeJSON(w io.Writer, v interface{}) {
+	response, _ := json.Marshal(v)
+	_, _ = w.Write(response)
 }
@@ -5,20 +5,31 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/hedge"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/verify"
 	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
 	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
 	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -42,21 +53,18 @@ func TestApiController_RPCHandler(t *testing.T) {
 	setup()
 	defer teardown()
 
-	poolerMock := &tunnelMocks.Pooler{}
-	configuration.Config.PortPool = poolerMock
-
 	nodeRepoMock := repoMocks.NodeRepository{}
 	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
 	recordRepoMock := repoMocks.RecordRepository{}
 	recordRepoMock.On("Save", mock.Anything).Return(nil)
 
 	actionsMockObject := new(actionMocks.Actions)
-	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything).Return()
+	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
 
 	apiController := NewApiController(false, repositories.Repos{
 		NodeRepo:   &nodeRepoMock,
 		RecordRepo: &recordRepoMock,
-	}, actionsMockObject)
+	}, actionsMockObject, selection.NewRoundRobinSelector())
 
 	handler := http.HandlerFunc(apiController.RPCHandler)
 
@@ -71,7 +79,7 @@ func TestApiController_RPCHandler(t *testing.T) {
 			name:       "Returns response if node returnes valid rpc response",
 			rpcRequest: `{"jsonrpc": "2.0", "id": 1, "method": "system"}`,
 			rpcResponse: rpc.RPCResponse{
-				ID:      1,
+				ID:      json.RawMessage("1"),
 				JSONRPC: "2.0",
 				Error:   nil,
 			},
@@ -83,18 +91,53 @@ func TestApiController_RPCHandler(t *testing.T) {
 			name:       "Returns parse error if json invalid",
 			rpcRequest: `INVALID`,
 			rpcResponse: rpc.RPCResponse{
-				ID:      0,
+				ID:      json.RawMessage("null"),
 				JSONRPC: "2.0",
 				Error:   &rpc.RPCError{Code: -32700, Message: "Parse error"},
 			},
 			handleFunc: func(w http.ResponseWriter, r *http.Request) {
 				_, _ = io.WriteString(w, `{"id": 1, "jsonrpc": "2.0"}`)
 			}},
+		{
+			name:       "Returns response with string id",
+			rpcRequest: `{"jsonrpc": "2.0", "id": "abc", "method": "system"}`,
+			rpcResponse: rpc.RPCResponse{
+				ID:      json.RawMessage(`"abc"`),
+				JSONRPC: "2.0",
+				Error:   nil,
+			},
+			nodes: []models.Node{{ID: "test-id"}},
+			handleFunc: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"id": "abc", "jsonrpc": "2.0"}`)
+			}},
+		{
+			name:       "Returns invalid request error if batch is empty",
+			rpcRequest: `[]`,
+			rpcResponse: rpc.RPCResponse{
+				ID:      json.RawMessage("null"),
+				JSONRPC: "2.0",
+				Error:   &rpc.RPCError{Code: -32600, Message: "Invalid Request"},
+			},
+			handleFunc: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"id": 1, "jsonrpc": "2.0"}`)
+			}},
+		{
+			name:       "Returns method not found error if method is not allowed",
+			rpcRequest: `{"jsonrpc": "2.0", "id": 1, "method": "author_rotateKeys"}`,
+			rpcResponse: rpc.RPCResponse{
+				ID:      json.RawMessage("1"),
+				JSONRPC: "2.0",
+				Error:   &rpc.RPCError{Code: -32601, Message: "Method author_rotateKeys is not allowed"},
+			},
+			nodes: []models.Node{{ID: "test-id"}},
+			handleFunc: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"id": 1, "jsonrpc": "2.0"}`)
+			}},
 		{
 			name:       "Returns server error if no available nodes",
 			rpcRequest: `{"jsonrpc": "2.0", "id": 1, "method": "system"}`,
 			rpcResponse: rpc.RPCResponse{
-				ID:      1,
+				ID:      json.RawMessage("1"),
 				JSONRPC: "2.0",
 				Error:   &rpc.RPCError{Code: -32603, Message: "No available nodes"},
 			},
@@ -106,13 +149,13 @@ func TestApiController_RPCHandler(t *testing.T) {
 			name:       "Returns server error if all nodes return invalid rpc response",
 			rpcRequest: `{"jsonrpc": "2.0", "id": 1, "method": "system"}`,
 			rpcResponse: rpc.RPCResponse{
-				ID:      1,
+				ID:      json.RawMessage("1"),
 				JSONRPC: "2.0",
 				Error:   &rpc.RPCError{Code: -32603, Message: "Internal Server Error"},
 			},
 			nodes: []models.Node{{ID: "test-id"}},
 			handleFunc: func(w http.ResponseWriter, r *http.Request) {
-				_, _ = io.WriteString(w, `{"id": 1, "jsonrpc": "2.0"}`)
+				_, _ = io.WriteString(w, `{"id": 1, "jsonrpc": "2.0", "error": {"code": -32603, "message": "Internal error"}}`)
 			},
 		},
 	}
@@ -123,11 +166,13 @@ func TestApiController_RPCHandler(t *testing.T) {
 
 			serverURL, _ := url.Parse(server.URL)
 			port, _ := strconv.Atoi(serverURL.Port())
+			poolerMock := &tunnelMocks.Pooler{}
 			poolerMock.On("GetHTTPPort", mock.Anything).Once().Return(port, nil)
+			configuration.Config.PortPool = poolerMock
 
 			mux.HandleFunc("/", test.handleFunc)
 
-			nodeRepoMock.On("GetActiveNodes", mock.Anything).Return(&test.nodes, nil)
+			nodeRepoMock.On("GetActiveNodes").Return(&test.nodes, nil)
 
 			req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.rpcRequest)))
 			rr := httptest.NewRecorder()
@@ -137,7 +182,7 @@ func TestApiController_RPCHandler(t *testing.T) {
 			var body rpc.RPCResponse
 			_ = json.Unmarshal(rr.Body.Bytes(), &body)
 
-			if test.rpcResponse != (rpc.RPCResponse{}) && !reflect.DeepEqual(body, test.rpcResponse) {
+			if !reflect.DeepEqual(test.rpcResponse, rpc.RPCResponse{}) && !reflect.DeepEqual(body, test.rpcResponse) {
 				t.Errorf("SendRequestToNode() body = %v, want %v", body, test.rpcResponse)
 				return
 			}
@@ -160,12 +205,12 @@ func TestApiController_BatchRPCHandler(t *testing.T) {
 	recordRepoMock.On("Save", mock.Anything).Return(nil)
 
 	actionsMockObject := new(actionMocks.Actions)
-	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything).Return()
+	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
 
 	apiController := NewApiController(false, repositories.Repos{
 		NodeRepo:   &nodeRepoMock,
 		RecordRepo: &recordRepoMock,
-	}, actionsMockObject)
+	}, actionsMockObject, selection.NewRoundRobinSelector())
 
 	handler := http.HandlerFunc(apiController.RPCHandler)
 
@@ -181,7 +226,7 @@ func TestApiController_BatchRPCHandler(t *testing.T) {
 			rpcRequest: `[{"jsonrpc": "2.0", "id": 1, "method": "system"}]`,
 			rpcResponses: []rpc.RPCResponse{
 				{
-					ID:      1,
+					ID:      json.RawMessage("1"),
 					JSONRPC: "2.0",
 					Error:   &rpc.RPCError{Code: -32603, Message: "Internal Server Error"}},
 			},
@@ -200,7 +245,7 @@ func TestApiController_BatchRPCHandler(t *testing.T) {
 				mux.HandleFunc("/", test.handleFunc)
 			}
 
-			nodeRepoMock.On("GetActiveNodes", mock.Anything).Return(&test.nodes, nil)
+			nodeRepoMock.On("GetActiveNodes").Return(&test.nodes, nil)
 
 			req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.rpcRequest)))
 			rr := httptest.NewRecorder()
@@ -236,15 +281,15 @@ func TestApiController_RPCHandler_InvalidBody(t *testing.T) {
 		{
 			name: "Returns parse error if reading request body fails",
 			rpcResponse: rpc.RPCResponse{
-				ID:      0,
+				ID:      json.RawMessage("null"),
 				JSONRPC: "2.0",
 				Error:   &rpc.RPCError{Code: -32700, Message: "Parse error"}}},
 	}
 
 	actionsMockObject := new(actionMocks.Actions)
-	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything).Return()
+	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
 
-	apiController := NewApiController(false, repositories.Repos{}, actionsMockObject)
+	apiController := NewApiController(false, repositories.Repos{}, actionsMockObject, selection.NewRoundRobinSelector())
 
 	handler := http.HandlerFunc(apiController.RPCHandler)
 
@@ -267,3 +312,399 @@ func TestApiController_RPCHandler_InvalidBody(t *testing.T) {
 		teardown()
 	}
 }
+
+func TestApiController_RPCHandler_RateLimited(t *testing.T) {
+	ratelimit.Init(ratelimit.Config{RequestsPerSecond: 1})
+	defer ratelimit.Init(ratelimit.Config{})
+
+	apiController := NewApiController(false, repositories.Repos{}, new(actionMocks.Actions), selection.NewRoundRobinSelector())
+	handler := http.HandlerFunc(apiController.RPCHandler)
+
+	// denied method is answered without node so first request is accepted by rate limiter
+	for i, expectedStatus := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req, _ := http.NewRequest("POST", "/", bytes.NewReader(
+			[]byte(`{"jsonrpc": "2.0", "id": 1, "method": "author_rotateKeys"}`)))
+		req.RemoteAddr = "1.1.1.1:1234"
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, expectedStatus, rr.Code)
+		var body rpc.RPCResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		if i == 0 {
+			assert.Equal(t, rpc.MethodNotFound, body.Error.Code)
+			continue
+		}
+		assert.Equal(t, rpc.LimitExceeded, body.Error.Code)
+		assert.Equal(t, 1, body.Error.RetryAfter())
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	}
+}
+
+func TestApiController_RPCHandler_SizeLimits(t *testing.T) {
+	configuration.Config.MaxBatchLength = 2
+	defer func() {
+		configuration.Config.MaxRequestSize = 0
+		configuration.Config.MaxBatchLength = 0
+	}()
+
+	tests := []struct {
+		name           string
+		maxRequestSize int64
+		rpcRequest     string
+		httpStatus     int
+		wantResponse   rpc.RPCResponse
+	}{
+		{
+			name:           "Returns error if request body is too large",
+			maxRequestSize: 100,
+			rpcRequest:     `{"jsonrpc": "2.0", "id": 1, "method": "system_health", "params": ["` + strings.Repeat("a", 100) + `"]}`,
+			httpStatus:     http.StatusRequestEntityTooLarge,
+			wantResponse: rpc.RPCResponse{
+				ID:      json.RawMessage("null"),
+				JSONRPC: "2.0",
+				Error:   &rpc.RPCError{Code: rpc.InvalidRequest, Message: "Request body too large"}},
+		},
+		{
+			name:           "Returns error if batch is too long",
+			maxRequestSize: 1000,
+			rpcRequest: `[{"jsonrpc": "2.0", "id": 1, "method": "a"}, {"jsonrpc": "2.0", "id": 2, "method": "b"}, ` +
+				`{"jsonrpc": "2.0", "id": 3, "method": "c"}]`,
+			httpStatus: http.StatusOK,
+			wantResponse: rpc.RPCResponse{
+				ID:      json.RawMessage("null"),
+				JSONRPC: "2.0",
+				Error:   &rpc.RPCError{Code: rpc.InvalidRequest, Message: "Batch too large, maximum length is 2"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configuration.Config.MaxRequestSize = test.maxRequestSize
+			apiController := NewApiController(false, repositories.Repos{}, new(actionMocks.Actions), selection.NewRoundRobinSelector())
+			req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.rpcRequest)))
+			rr := httptest.NewRecorder()
+
+			http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.httpStatus, rr.Code)
+			var body rpc.RPCResponse
+			_ = json.Unmarshal(rr.Body.Bytes(), &body)
+			assert.Equal(t, test.wantResponse, body)
+		})
+	}
+}
+
+func TestApiController_RPCHandler_Hedging(t *testing.T) {
+	err := hedge.Init(hedge.Config{Delay: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	defer func() { _ = hedge.Init(hedge.Config{}) }()
+
+	tests := []struct {
+		name         string
+		method       string
+		stream       bool
+		wantResult   string
+		wantDuration time.Duration
+	}{
+		{
+			name:         "Returns response of second node if first node is slow",
+			method:       "state_getStorage",
+			wantResult:   `"fast"`,
+			wantDuration: 150 * time.Millisecond,
+		},
+		{
+			name:         "Streams response of second node if first node is slow",
+			method:       "state_getStorage",
+			stream:       true,
+			wantResult:   `"fast"`,
+			wantDuration: 150 * time.Millisecond,
+		},
+		{
+			name:       "Doesn't hedge non idempotent methods",
+			method:     "author_submitExtrinsic",
+			wantResult: `"slow"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(200 * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+				_, _ = io.WriteString(w, `{"jsonrpc": "2.0", "id": 1, "result": "slow"}`)
+			}))
+			defer slowServer.Close()
+			fastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"jsonrpc": "2.0", "id": 1, "result": "fast"}`)
+			}))
+			defer fastServer.Close()
+
+			poolerMock := &tunnelMocks.Pooler{}
+			poolerMock.On("GetHTTPPort", "slow-node").Return(serverPort(slowServer), nil)
+			poolerMock.On("GetHTTPPort", "fast-node").Return(serverPort(fastServer), nil)
+			configuration.Config.PortPool = poolerMock
+
+			nodes := []models.Node{{ID: "slow-node"}, {ID: "fast-node"}}
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetActiveNodes").Return(&nodes)
+			nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+			recordRepoMock := repoMocks.RecordRepository{}
+			recordRepoMock.On("Save", mock.Anything).Return(nil)
+			actionsMockObject := new(actionMocks.Actions)
+			actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, actionsMockObject, selection.NewRoundRobinSelector())
+
+			reqBody := []byte(`{"jsonrpc": "2.0", "id": 1, "method": "` + test.method + `"}`)
+			reqRPCBody, _ := rpc.ParseRequest(reqBody)
+			var response []byte
+			start := time.Now()
+			if test.stream {
+				rr := httptest.NewRecorder()
+				apiController.handleSingle(rr, reqRPCBody, "client", false)
+				response = rr.Body.Bytes()
+			} else {
+				response = apiController.routeRequest(reqRPCBody, "client", false)
+			}
+			duration := time.Since(start)
+
+			var body rpc.RPCResponse
+			err := json.Unmarshal(response, &body)
+			assert.NoError(t, err)
+			assert.NotNil(t, body.Result)
+			if body.Result != nil {
+				assert.Equal(t, json.RawMessage(test.wantResult), *body.Result)
+			}
+			if test.wantDuration > 0 {
+				assert.Less(t, int64(duration), int64(test.wantDuration))
+			}
+		})
+	}
+}
+
+func TestApiController_RPCHandler_ErrorClassification(t *testing.T) {
+	configuration.Config.RetryBudget = 1
+	defer func() { configuration.Config.RetryBudget = 0 }()
+
+	tests := []struct {
+		name       string
+		responses  []string
+		wantCalls  []int
+		wantResult bool
+		wantCode   int
+	}{
+		{
+			name:      "Returns user error as is",
+			responses: []string{`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32602, "message": "Invalid params"}}`},
+			wantCalls: []int{1, 0, 0},
+			wantCode:  -32602,
+		},
+		{
+			name:       "Retries transient error on other node",
+			responses:  []string{"503", `{"jsonrpc": "2.0", "id": 1, "result": "0x"}`},
+			wantCalls:  []int{1, 1, 0},
+			wantResult: true,
+		},
+		{
+			name: "Stops retrying when retry budget is spent",
+			responses: []string{
+				`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32000, "message": "Server error"}}`,
+				`{"jsonrpc": "2.0", "id": 1, "error": {"code": -32603, "message": "Internal error"}}`,
+				`{"jsonrpc": "2.0", "id": 1, "result": "0x"}`,
+			},
+			wantCalls: []int{1, 1, 0},
+			wantCode:  rpc.InternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			calls := make([]int, 3)
+			poolerMock := &tunnelMocks.Pooler{}
+			nodes := make([]models.Node, 3)
+			for i := range nodes {
+				i := i
+				response := `{"jsonrpc": "2.0", "id": 1, "result": "0x"}`
+				if i < len(test.responses) {
+					response = test.responses[i]
+				}
+				nodeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mutex.Lock()
+					calls[i]++
+					mutex.Unlock()
+					if status, err := strconv.Atoi(response); err == nil {
+						w.WriteHeader(status)
+						return
+					}
+					_, _ = io.WriteString(w, response)
+				}))
+				defer nodeServer.Close()
+				nodes[i] = models.Node{ID: "node-" + strconv.Itoa(i)}
+				poolerMock.On("GetHTTPPort", nodes[i].ID).Return(serverPort(nodeServer), nil)
+			}
+			configuration.Config.PortPool = poolerMock
+
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetActiveNodes").Return(&nodes)
+			nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+			recordRepoMock := repoMocks.RecordRepository{}
+			recordRepoMock.On("Save", mock.Anything).Return(nil)
+			actionsMockObject := new(actionMocks.Actions)
+			actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, actionsMockObject, selection.NewRoundRobinSelector())
+
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "state_getStorage"}`))
+			rr := httptest.NewRecorder()
+
+			http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+			var body rpc.RPCResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &body)
+			assert.NoError(t, err)
+			mutex.Lock()
+			assert.Equal(t, test.wantCalls, calls)
+			mutex.Unlock()
+			assert.Equal(t, test.wantResult, body.Result != nil)
+			if test.wantCode != 0 && assert.NotNil(t, body.Error) {
+				assert.Equal(t, test.wantCode, body.Error.Code)
+			}
+		})
+	}
+}
+
+func TestApiController_RPCHandler_Verification(t *testing.T) {
+	err := verify.Init(verify.Config{Nodes: 3, Methods: []string{"state_getStorage"}})
+	assert.NoError(t, err)
+	defer func() { _ = verify.Init(verify.Config{Nodes: verify.DefaultNodes}) }()
+
+	responses := []string{
+		`{"jsonrpc": "2.0", "id": 1, "result": {"a": 1, "b": 2}}`,
+		`{"jsonrpc": "2.0", "id": 1, "result": "0xbad"}`,
+		`{"id": 1, "jsonrpc": "2.0", "result": {"b": 2, "a": 1}}`,
+	}
+	poolerMock := &tunnelMocks.Pooler{}
+	nodes := make([]models.Node, len(responses))
+	for i, response := range responses {
+		response := response
+		nodeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, response)
+		}))
+		defer nodeServer.Close()
+		nodes[i] = models.Node{ID: "node-" + strconv.Itoa(i)}
+		poolerMock.On("GetHTTPPort", nodes[i].ID).Return(serverPort(nodeServer), nil)
+	}
+	configuration.Config.PortPool = poolerMock
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("GetActiveNodes").Return(&nodes)
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	penalized := make(chan models.Node, len(nodes))
+	actionsMockObject := new(actionMocks.Actions)
+	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, penalty.ConsensusMismatch).Return().Run(func(args mock.Arguments) {
+		penalized <- args.Get(0).(models.Node)
+	})
+	saved := make(chan *models.Disagreement, 1)
+	disagreementRepoMock := repoMocks.DisagreementRepository{}
+	disagreementRepoMock.On("Save", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		saved <- args.Get(0).(*models.Disagreement)
+	})
+
+	apiController := NewApiController(false, repositories.Repos{
+		NodeRepo:         &nodeRepoMock,
+		RecordRepo:       &recordRepoMock,
+		DisagreementRepo: &disagreementRepoMock,
+	}, actionsMockObject, selection.NewRoundRobinSelector())
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "state_getStorage", "params": ["0x01"]}`))
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+	var body rpc.RPCResponse
+	err = json.Unmarshal(rr.Body.Bytes(), &body)
+	assert.NoError(t, err)
+	if assert.NotNil(t, body.Result) {
+		assert.JSONEq(t, `{"a": 1, "b": 2}`, string(*body.Result))
+	}
+
+	select {
+	case node := <-penalized:
+		assert.Equal(t, "node-1", node.ID)
+	case <-time.After(time.Second):
+		t.Fatal("faulty node was not penalized")
+	}
+	select {
+	case disagreement := <-saved:
+		assert.Equal(t, "state_getStorage", disagreement.Method)
+		assert.Equal(t, `["0x01"]`, disagreement.Params)
+		assert.Equal(t, []string{"node-1"}, disagreement.FaultyNodes)
+		assert.Equal(t, `{"result":{"a":1,"b":2}}`, disagreement.Majority)
+		assert.Len(t, disagreement.Responses, 3)
+	case <-time.After(time.Second):
+		t.Fatal("disagreement was not stored")
+	}
+}
+
+func TestApiController_RPCHandler_Fallback(t *testing.T) {
+	fallbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if rpc.IsBatch(body) {
+			_, _ = io.WriteString(w, `[{"jsonrpc": "2.0", "id": 2, "result": "0x02"}, {"jsonrpc": "2.0", "id": 1, "result": "0x01"}]`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"jsonrpc": "2.0", "id": 1, "result": "0x01"}`)
+	}))
+	defer fallbackServer.Close()
+	assert.NoError(t, fallback.Init(fallback.Config{HTTPURLs: []string{fallbackServer.URL}}))
+	defer func() { _ = fallback.Init(fallback.Config{}) }()
+
+	tests := []struct {
+		name       string
+		rpcRequest string
+		want       string
+	}{
+		{
+			name:       "Sends request to fallback if no available nodes",
+			rpcRequest: `{"jsonrpc": "2.0", "id": 1, "method": "chain_getBlockHash"}`,
+			want:       `{"jsonrpc": "2.0", "id": 1, "result": "0x01"}`,
+		},
+		{
+			name:       "Sends batch to fallback if no available nodes",
+			rpcRequest: `[{"jsonrpc": "2.0", "id": 1, "method": "chain_getBlockHash"}, {"jsonrpc": "2.0", "id": 2, "method": "chain_getBlockHash"}]`,
+			want:       `[{"jsonrpc": "2.0", "id": 1, "result": "0x01"}, {"jsonrpc": "2.0", "id": 2, "result": "0x02"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// fallback requests are never recorded, so record and node repositories must not be used
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetActiveNodes").Return(&[]models.Node{})
+			recordRepoMock := repoMocks.RecordRepository{}
+
+			apiController := NewApiController(false, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, new(actionMocks.Actions), selection.NewRoundRobinSelector())
+
+			req, _ := http.NewRequest("POST", "/", strings.NewReader(test.rpcRequest))
+			rr := httptest.NewRecorder()
+
+			http.HandlerFunc(apiController.RPCHandler).ServeHTTP(rr, req)
+
+			assert.JSONEq(t, test.want, rr.Body.String())
+			recordRepoMock.AssertNotCalled(t, "Save", mock.Anything)
+		})
+	}
+}
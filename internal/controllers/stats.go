@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/stats"
 
@@ -153,3 +154,15 @@ func (c *ApiController) StatisticsHandlerStatsForLoadBalancer(w http.ResponseWri
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(statsResponse)
 }
+
+type FallbackStatsResponse struct {
+	Endpoints []fallback.EndpointStats `json:"endpoints"`
+}
+
+// handler for `GET /api/v1/stats/fallback` - signature verification in middleware
+func (c *ApiController) StatisticsHandlerFallback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(FallbackStatsResponse{
+		Endpoints: fallback.Stats(),
+	})
+}
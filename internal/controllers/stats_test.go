@@ -100,7 +100,7 @@ func TestApiController_StatisticsHandlerAllStats(t *testing.T) {
 			nodeRepoMock.On("FindByID", test.nodeId).Return(&models.Node{
 				ID:            test.nodeId,
 				PayoutAddress: test.payoutAddress,
-			}, nil)
+			}, nil, nil)
 			recordRepoMock := mocks.RecordRepository{}
 			recordRepoMock.On("FindSuccessfulRecordsInsideInterval",
 				test.nodeId, mock.Anything, mock.Anything,
@@ -137,7 +137,7 @@ func TestApiController_StatisticsHandlerAllStats(t *testing.T) {
 				RecordRepo:   &recordRepoMock,
 				DowntimeRepo: &downtimeRepoMock,
 				PayoutRepo:   &payoutRepoMock,
-			}, nil)
+			}, nil, nil)
 			handler := http.HandlerFunc(apiController.StatisticsHandlerAllStats)
 			req, _ := http.NewRequest("GET", "/api/v1/stats", bytes.NewReader(nil))
 			rr := httptest.NewRecorder()
@@ -319,7 +319,7 @@ func TestApiController_StatisticsHandlerAllStatsForLoadbalancer(t *testing.T) {
 			nodeRepoMock.On("FindByID", test.nodeId).Return(&models.Node{
 				ID:            test.nodeId,
 				PayoutAddress: "0xtest-address",
-			}, nil)
+			}, nil, nil)
 			recordRepoMock := mocks.RecordRepository{}
 			recordRepoMock.On("FindSuccessfulRecordsInsideInterval",
 				test.nodeId, mock.Anything, mock.Anything,
@@ -359,7 +359,7 @@ func TestApiController_StatisticsHandlerAllStatsForLoadbalancer(t *testing.T) {
 				DowntimeRepo: &downtimeRepoMock,
 				PayoutRepo:   &payoutRepoMock,
 				FeeRepo:      &feeRepoMock,
-			}, nil)
+			}, nil, nil)
 
 			handler := middleware.VerifySignatureMiddleware(
 				http.HandlerFunc(apiController.StatisticsHandlerAllStatsForLoadbalancer),
@@ -492,7 +492,7 @@ func TestApiController_StatisticsHandlerStatsForNode(t *testing.T) {
 				RecordRepo:   &recordRepoMock,
 				DowntimeRepo: &downtimeRepoMock,
 				PayoutRepo:   &payoutRepoMock,
-			}, nil)
+			}, nil, nil)
 			type ContextKey string
 			req, _ := http.NewRequest("GET", "/api/v1/stats/node/1", bytes.NewReader(nil))
 			req = req.WithContext(context.WithValue(req.Context(), ContextKey(test.contextKey), "1"))
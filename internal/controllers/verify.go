@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/record"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/rpccache"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
+	"github.com/NodeFactoryIo/vedran/internal/verify"
+	log "github.com/sirupsen/logrus"
+)
+
+type DisagreementsResponse struct {
+	Disagreements []models.Disagreement `json:"disagreements"`
+}
+
+// handler for `GET /api/v1/stats/disagreements` - signature verification in middleware
+func (c *ApiController) StatisticsHandlerDisagreements(w http.ResponseWriter, r *http.Request) {
+	var from time.Time
+	if value := r.URL.Query().Get("from"); value != "" {
+		var err error
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from param, expected RFC3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	disagreements, err := c.repositories.DisagreementRepo.FindSince(from)
+	if err != nil {
+		log.Errorf("Failed fetching disagreements because of: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(DisagreementsResponse{Disagreements: disagreements})
+}
+
+// verifiedResponse is valid response of node to verified request
+type verifiedResponse struct {
+	node      models.Node
+	body      []byte
+	canonical string
+}
+
+// verifyRequest sends request to multiple distinct nodes in parallel and writes response returned by
+// quorum of nodes. Nodes that failed are replaced by other nodes while retry budget allows it. Nodes that
+// returned response different from quorum are penalized and each disagreement is stored for audit.
+func (c ApiController) verifyRequest(w io.Writer, reqRPCBody rpc.RPCRequest, reqBody []byte, nodes []models.Node) {
+	var responses []verifiedResponse
+	next := 0
+	for round := 0; len(responses) < verify.Nodes() && next < len(nodes); round++ {
+		if round > 0 && !canRetry(round) {
+			break
+		}
+		count := verify.Nodes() - len(responses)
+		if next+count > len(nodes) {
+			count = len(nodes) - next
+		}
+		responses = append(responses, c.collectResponses(reqRPCBody.Method, reqBody, nodes[next:next+count])...)
+		next += count
+	}
+
+	byNode := make(map[string]string, len(responses))
+	for _, response := range responses {
+		byNode[response.node.ID] = response.canonical
+	}
+	majority, faulty, ok := verify.Vote(byNode, verify.Quorum())
+	if len(faulty) > 0 || (!ok && len(responses) > 1) {
+		log.Warnf("Nodes returned different responses to verified request %s", reqRPCBody.Method)
+		go c.storeDisagreement(reqRPCBody, byNode, majority, faulty)
+	}
+
+	isFaulty := make(map[string]bool, len(faulty))
+	for _, nodeID := range faulty {
+		isFaulty[nodeID] = true
+	}
+	var answer []byte
+	for _, response := range responses {
+		if isFaulty[response.node.ID] {
+			log.Errorf("Node %s returned response that differs from other nodes", response.node.ID)
+			go record.FailedRequest(response.node, c.repositories, c.actions, penalty.ConsensusMismatch)
+			continue
+		}
+		if ok {
+			answer = response.body
+			blocks.Learn(response.node.ID, reqRPCBody, response.body)
+			go record.SuccessfulRequest(response.node, c.repositories)
+		}
+	}
+
+	if !ok {
+		log.Errorf("Request failed because no response was returned by %d nodes", verify.Quorum())
+		writeJSON(w, rpc.CreateSingleRPCError(reqRPCBody.ID, rpc.InternalServerError, "Unable to verify response"))
+		return
+	}
+	rpccache.Put(reqRPCBody, answer)
+	_, _ = w.Write(answer)
+}
+
+// collectResponses sends request to nodes in parallel and returns valid responses, nodes that failed are recorded
+func (c ApiController) collectResponses(method string, reqBody []byte, nodes []models.Node) []verifiedResponse {
+	results := make([]*verifiedResponse, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node models.Node) {
+			defer wg.Done()
+			ctx, cancel := rpc.WithTimeout(context.Background(), method)
+			defer cancel()
+			done := selection.Track(node.ID)
+			body, err := rpc.SendRequestToNodeContext(ctx, false, node.ID, reqBody)
+			done()
+			if err != nil {
+				c.recordFailedRequest(node, err)
+				return
+			}
+			canonical, err := verify.Canonicalize(body)
+			if err != nil {
+				c.recordFailedRequest(node, err)
+				return
+			}
+			results[i] = &verifiedResponse{node: node, body: body, canonical: canonical}
+		}(i, node)
+	}
+	wg.Wait()
+
+	var responses []verifiedResponse
+	for _, result := range results {
+		if result != nil {
+			responses = append(responses, *result)
+		}
+	}
+	return responses
+}
+
+func (c ApiController) storeDisagreement(
+	reqRPCBody rpc.RPCRequest, responses map[string]string, majority string, faulty []string,
+) {
+	err := c.repositories.DisagreementRepo.Save(&models.Disagreement{
+		Timestamp:   time.Now(),
+		Method:      reqRPCBody.Method,
+		Params:      string(reqRPCBody.Params),
+		Responses:   responses,
+		Majority:    majority,
+		FaultyNodes: faulty,
+	})
+	if err != nil {
+		log.Errorf("Failed saving disagreement because of: %v", err)
+	}
+}
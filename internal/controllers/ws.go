@@ -3,7 +3,14 @@ package controllers
 import (
 	"net/http"
 
-	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/origin"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
 	"github.com/NodeFactoryIo/vedran/internal/ws"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
@@ -12,14 +19,33 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin:     origin.CheckOrigin,
 }
 
 func (c ApiController) WSHandler(w http.ResponseWriter, r *http.Request) {
-	nodes := c.repositories.NodeRepo.GetActiveNodes(configuration.Config.Selection)
-	if len(*nodes) == 0 {
+	consumer := apikey.FromRequest(r)
+	if rpcErr := apikey.Authorize(consumer); rpcErr != nil {
+		log.Debugf("Connection rejected because of: %s", rpcErr.Message)
+		http.Error(w, rpcErr.Message, http.StatusUnauthorized)
+		return
+	}
+
+	client := ratelimit.ClientKey(r, consumer)
+	release, rpcErr := ratelimit.Connect(client)
+	if rpcErr != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeConsumerError(w, nil, rpcErr)
+		return
+	}
+	started := false
+	defer func() {
+		if !started {
+			release()
+		}
+	}()
+
+	nodes := c.selector.Select(*c.repositories.NodeRepo.GetActiveNodes())
+	if len(nodes) == 0 && !fallback.WSEnabled() {
 		log.Error("Request failed because vedran has no available nodes")
 		http.Error(w, "No available nodes", 503)
 		return
@@ -32,32 +58,45 @@ func (c ApiController) WSHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	connErr := make(chan *ws.ConnectionError)
-	messages := make(chan ws.Message)
-	wsConnection := make(chan *websocket.Conn)
-	for _, node := range *nodes {
-		go ws.EstablishNodeConn(node.ID, wsConnection, messages, connErr)
-
-		connectionError := <-connErr
-		connToNode := <-wsConnection
+	verifiedKey := apikey.Verified(consumer)
+	session := ws.NewSession(connToLoadbalancer, c.repositories, c.actions, func() []models.Node {
+		return c.selector.Select(*c.repositories.NodeRepo.GetActiveNodes())
+	}, ws.SessionOptions{
+		Route: func(request rpc.RPCRequest) []byte {
+			return c.routeRequest(request, client, verifiedKey)
+		},
+		Hub:      c.hub,
+		Consumer: consumer,
+		Client:   client,
+		OnClose:  release,
+	})
+	for _, node := range nodes {
+		done := selection.Track(node.ID)
+		connToNode, connectionError := ws.DialNode(node.ID)
+		done()
 		if connectionError != nil {
-			log.Errorf("Establishing connection failed because of %v", err)
+			log.Errorf("Establishing connection failed because of %v", connectionError)
 			if connectionError.IsNodeError() {
-				c.actions.PenalizeNode(node, c.repositories)
+				c.actions.PenalizeNode(node, c.repositories, penalty.WSHandshakeFailure)
 			}
 			continue
 		}
 
 		go c.repositories.NodeRepo.UpdateNodeUsed(node)
 
-		go ws.SendRequestToNode(connToLoadbalancer, connToNode, node, c.repositories, c.actions)
-		go ws.SendResponseToClient(connToLoadbalancer, connToNode, messages, node, c.repositories)
+		started = true
+		session.Start(node, connToNode)
+		return
+	}
+
+	connToFallback, endpoint, err := fallback.Dial()
+	if err == nil {
+		log.Debugf("No node accepted connection, connection served by fallback endpoint %s", endpoint.Name())
+		started = true
+		session.StartFallback(endpoint, connToFallback)
 		return
 	}
 
 	log.Error("Failed establishing connection with any node")
 	_ = connToLoadbalancer.Close()
-	close(connErr)
-	close(messages)
-	close(wsConnection)
 }
@@ -16,7 +16,9 @@ import (
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
 	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
 	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
 	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
@@ -72,7 +74,7 @@ func TestApiController_WSHandler(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			nodeRepoMock := mocks.NodeRepository{}
-			nodeRepoMock.On("GetActiveNodes", mock.Anything).Return(&test.nodeRepoGetActiveNodesReturn)
+			nodeRepoMock.On("GetActiveNodes").Return(&test.nodeRepoGetActiveNodesReturn)
 			nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
 
 			recordRepoMock := mocks.RecordRepository{}
@@ -81,12 +83,13 @@ func TestApiController_WSHandler(t *testing.T) {
 			actionsMockObject := new(actionMocks.Actions)
 			actionsMockObject.On(
 				"PenalizeNode", mock.MatchedBy(func(n models.Node) bool { return n.ID == "1" }), mock.Anything,
+				penalty.WSHandshakeFailure,
 			).Return()
 
 			apiController := NewApiController(false, repositories.Repos{
 				NodeRepo:   &nodeRepoMock,
 				RecordRepo: &recordRepoMock,
-			}, actionsMockObject)
+			}, actionsMockObject, selection.NewRoundRobinSelector())
 
 			// start test loadbalancer ws server
 			router := mm.NewRouter()
@@ -0,0 +1,424 @@
+package fallback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultHealthCheckInterval is interval on which health of fallback endpoints is checked
+	DefaultHealthCheckInterval = 10 * time.Second
+	// HealthCheckTimeout is maximum time single health check of fallback endpoint can take
+	HealthCheckTimeout = 5 * time.Second
+
+	HTTP = "http"
+	WS   = "ws"
+)
+
+var (
+	// ErrNoHealthyEndpoint is returned if fallback is not configured or none of fallback endpoints is healthy
+	ErrNoHealthyEndpoint = errors.New("no healthy fallback endpoint")
+
+	healthRequest = []byte(`{"jsonrpc":"2.0","id":1,"method":"system_health","params":[]}`)
+)
+
+// Config holds static upstream rpc endpoints requests are sent to when no node can serve them
+type Config struct {
+	// HTTPURLs are http or https rpc endpoints requests are sent to
+	HTTPURLs []string
+	// WSURLs are ws or wss rpc endpoints client websocket connections are proxied to
+	WSURLs []string
+}
+
+// Endpoint is static upstream rpc endpoint, endpoints are healthy until health check fails
+type Endpoint struct {
+	url      string
+	name     string
+	kind     string
+	healthy  int32
+	requests uint64
+	failures uint64
+}
+
+func newEndpoint(rawURL string, kind string, schemes ...string) (*Endpoint, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallback url %s: %v", rawURL, err)
+	}
+	if u.Host == "" || (u.Scheme != schemes[0] && u.Scheme != schemes[1]) {
+		return nil, fmt.Errorf("invalid fallback url %s, expected %s or %s url", rawURL, schemes[0], schemes[1])
+	}
+	return &Endpoint{
+		url:     rawURL,
+		name:    u.Scheme + "://" + u.Host,
+		kind:    kind,
+		healthy: 1,
+	}, nil
+}
+
+// Name returns endpoint url without credentials, path and query, so it can be shown
+// in logs and stats without exposing api keys of upstream provider
+func (e *Endpoint) Name() string {
+	return e.name
+}
+
+// Healthy returns if last health check of endpoint succeeded
+func (e *Endpoint) Healthy() bool {
+	return atomic.LoadInt32(&e.healthy) == 1
+}
+
+// RecordRequest counts request successfully served by endpoint
+func (e *Endpoint) RecordRequest() {
+	atomic.AddUint64(&e.requests, 1)
+}
+
+// RecordFailure counts request endpoint failed to serve
+func (e *Endpoint) RecordFailure() {
+	atomic.AddUint64(&e.failures, 1)
+}
+
+func (e *Endpoint) setHealthy(healthy bool) {
+	var value int32
+	if healthy {
+		value = 1
+	}
+	if atomic.SwapInt32(&e.healthy, value) != value {
+		if healthy {
+			log.Infof("Fallback endpoint %s is healthy", e.name)
+		} else {
+			log.Warnf("Fallback endpoint %s is unhealthy", e.name)
+		}
+	}
+}
+
+// EndpointStats are traffic stats of fallback endpoint, kept separately from node stats so
+// fallback traffic is never credited to nodes
+type EndpointStats struct {
+	Endpoint string `json:"endpoint"`
+	Type     string `json:"type"`
+	Healthy  bool   `json:"healthy"`
+	Requests uint64 `json:"requests"`
+	Failures uint64 `json:"failures"`
+}
+
+// Pool holds fallback endpoints, requests are sent to first healthy endpoint in configured order
+type Pool struct {
+	http   []*Endpoint
+	ws     []*Endpoint
+	client *http.Client
+}
+
+// New creates pool from config, error is returned if any url is invalid
+func New(config Config) (*Pool, error) {
+	p := &Pool{client: &http.Client{}}
+	for _, rawURL := range config.HTTPURLs {
+		endpoint, err := newEndpoint(rawURL, HTTP, "http", "https")
+		if err != nil {
+			return nil, err
+		}
+		p.http = append(p.http, endpoint)
+	}
+	for _, rawURL := range config.WSURLs {
+		endpoint, err := newEndpoint(rawURL, WS, "ws", "wss")
+		if err != nil {
+			return nil, err
+		}
+		p.ws = append(p.ws, endpoint)
+	}
+	return p, nil
+}
+
+// HTTPEnabled returns if http fallback endpoints are configured
+func (p *Pool) HTTPEnabled() bool {
+	return len(p.http) > 0
+}
+
+// WSEnabled returns if websocket fallback endpoints are configured
+func (p *Pool) WSEnabled() bool {
+	return len(p.ws) > 0
+}
+
+// Send sends request to healthy http endpoints in order until one returns valid response, response
+// is checked same as node response. Request is cancelled when ctx is done.
+func (p *Pool) Send(ctx context.Context, isBatch bool, reqBody []byte) ([]byte, error) {
+	err := ErrNoHealthyEndpoint
+	for _, endpoint := range p.http {
+		if !endpoint.Healthy() {
+			continue
+		}
+		var body []byte
+		body, err = p.post(ctx, endpoint, reqBody)
+		if err == nil {
+			if isBatch {
+				_, err = rpc.CheckBatchRPCResponse(body)
+			} else {
+				_, err = rpc.CheckSingleRPCResponse(body)
+			}
+		}
+		if err != nil {
+			log.Errorf("Request to fallback endpoint %s failed because of: %v", endpoint.name, err)
+			endpoint.RecordFailure()
+			continue
+		}
+		endpoint.RecordRequest()
+		return body, nil
+	}
+	return nil, err
+}
+
+// SendNotification sends notification or batch of notifications to first healthy http endpoint
+// that accepts it, response is ignored as notifications are not answered
+func (p *Pool) SendNotification(reqBody []byte) error {
+	err := ErrNoHealthyEndpoint
+	for _, endpoint := range p.http {
+		if !endpoint.Healthy() {
+			continue
+		}
+		_, err = p.post(context.Background(), endpoint, reqBody)
+		if err != nil {
+			log.Errorf("Notification to fallback endpoint %s failed because of: %v", endpoint.name, err)
+			endpoint.RecordFailure()
+			continue
+		}
+		endpoint.RecordRequest()
+		return nil
+	}
+	return err
+}
+
+// Dial establishes websocket connection with first healthy ws endpoint that accepts it
+func (p *Pool) Dial() (*websocket.Conn, *Endpoint, error) {
+	err := ErrNoHealthyEndpoint
+	for _, endpoint := range p.ws {
+		if !endpoint.Healthy() {
+			continue
+		}
+		var conn *websocket.Conn
+		conn, err = dial(endpoint)
+		if err != nil {
+			log.Errorf("Establishing connection with fallback endpoint %s failed because of: %v", endpoint.name, err)
+			endpoint.RecordFailure()
+			continue
+		}
+		return conn, endpoint, nil
+	}
+	return nil, nil, err
+}
+
+func (p *Pool) post(ctx context.Context, endpoint *Endpoint, reqBody []byte) ([]byte, error) {
+	client := *p.client
+	// requests with deadline are limited by their context
+	if _, ok := ctx.Deadline(); !ok {
+		client.Timeout = rpc.Timeout()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Status code %d is not 200", resp.StatusCode)
+	}
+	return body, nil
+}
+
+func dial(endpoint *Endpoint) (*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = HealthCheckTimeout
+	conn, _, err := dialer.Dial(endpoint.url, nil)
+	return conn, err
+}
+
+// CheckHealth checks health of all endpoints concurrently, endpoint is healthy if it answers
+// system_health request and is not syncing
+func (p *Pool) CheckHealth() {
+	var wg sync.WaitGroup
+	for _, endpoint := range append(append([]*Endpoint{}, p.http...), p.ws...) {
+		wg.Add(1)
+		go func(endpoint *Endpoint) {
+			defer wg.Done()
+			err := p.checkEndpoint(endpoint)
+			if err != nil {
+				log.Debugf("Health check of fallback endpoint %s failed because of: %v", endpoint.name, err)
+			}
+			endpoint.setHealthy(err == nil)
+		}(endpoint)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) checkEndpoint(endpoint *Endpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+	defer cancel()
+
+	var body []byte
+	var err error
+	if endpoint.kind == HTTP {
+		body, err = p.post(ctx, endpoint, healthRequest)
+	} else {
+		body, err = checkWS(endpoint)
+	}
+	if err != nil {
+		return err
+	}
+
+	response, err := rpc.CheckSingleRPCResponse(body)
+	if err != nil {
+		return err
+	}
+	if response.Error != nil || response.Result == nil {
+		return errors.New("system_health returned no result")
+	}
+	var health struct {
+		IsSyncing bool `json:"isSyncing"`
+	}
+	if err = json.Unmarshal(*response.Result, &health); err != nil {
+		return err
+	}
+	if health.IsSyncing {
+		return errors.New("endpoint is syncing")
+	}
+	return nil
+}
+
+func checkWS(endpoint *Endpoint) ([]byte, error) {
+	conn, err := dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(HealthCheckTimeout))
+	err = conn.WriteMessage(websocket.TextMessage, healthRequest)
+	if err != nil {
+		return nil, err
+	}
+	_, msg, err := conn.ReadMessage()
+	return msg, err
+}
+
+// StartHealthChecks checks health of endpoints on provided interval
+func (p *Pool) StartHealthChecks(interval time.Duration) {
+	if !p.HTTPEnabled() && !p.WSEnabled() {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		p.CheckHealth()
+		for range ticker.C {
+			p.CheckHealth()
+		}
+	}()
+}
+
+// Stats returns traffic stats of all endpoints
+func (p *Pool) Stats() []EndpointStats {
+	stats := make([]EndpointStats, 0, len(p.http)+len(p.ws))
+	for _, endpoint := range append(append([]*Endpoint{}, p.http...), p.ws...) {
+		stats = append(stats, EndpointStats{
+			Endpoint: endpoint.name,
+			Type:     endpoint.kind,
+			Healthy:  endpoint.Healthy(),
+			Requests: atomic.LoadUint64(&endpoint.requests),
+			Failures: atomic.LoadUint64(&endpoint.failures),
+		})
+	}
+	return stats
+}
+
+var pool, _ = New(Config{})
+
+// Init replaces default pool with pool created from config
+func Init(config Config) error {
+	p, err := New(config)
+	if err != nil {
+		return err
+	}
+	pool = p
+	return nil
+}
+
+// HTTPEnabled returns if http fallback endpoints are configured on default pool
+func HTTPEnabled() bool {
+	return pool.HTTPEnabled()
+}
+
+// WSEnabled returns if websocket fallback endpoints are configured on default pool
+func WSEnabled() bool {
+	return pool.WSEnabled()
+}
+
+// Send sends request to default pool
+func Send(ctx context.Context, isBatch bool, reqBody []byte) ([]byte, error) {
+	return pool.Send(ctx, isBatch, reqBody)
+}
+
+// SendNotification sends notification to default pool
+func SendNotification(reqBody []byte) error {
+	return pool.SendNotification(reqBody)
+}
+
+// Dial establishes websocket connection with endpoint of default pool
+func Dial() (*websocket.Conn, *Endpoint, error) {
+	return pool.Dial()
+}
+
+// StartHealthChecks checks health of default pool endpoints on DefaultHealthCheckInterval
+func StartHealthChecks() {
+	pool.StartHealthChecks(DefaultHealthCheckInterval)
+}
+
+// Stats returns traffic stats of default pool endpoints
+func Stats() []EndpointStats {
+	return pool.Stats()
+}
+
+// Requests returns total number of requests served by default pool endpoints
+func Requests() uint64 {
+	var total uint64
+	for _, stats := range pool.Stats() {
+		total += stats.Requests
+	}
+	return total
+}
+
+// Failures returns total number of requests default pool endpoints failed to serve
+func Failures() uint64 {
+	var total uint64
+	for _, stats := range pool.Stats() {
+		total += stats.Failures
+	}
+	return total
+}
+
+// HealthyEndpoints returns number of healthy default pool endpoints
+func HealthyEndpoints() int {
+	healthy := 0
+	for _, stats := range pool.Stats() {
+		if stats.Healthy {
+			healthy++
+		}
+	}
+	return healthy
+}
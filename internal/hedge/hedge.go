@@ -0,0 +1,180 @@
+package hedge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWindowSize is number of latest request latencies used to calculate latency percentile
+	DefaultWindowSize = 512
+	// MinSamples is number of latencies that must be recorded before percentile threshold is used
+	MinSamples = 20
+
+	recalculateInterval = 32
+)
+
+// nonIdempotentMethods change node state or create subscriptions, so sending them to
+// multiple nodes could submit same extrinsic twice or leave subscriptions open on losing node
+var nonIdempotentMethods = map[string]bool{
+	"author_submitExtrinsic":         true,
+	"author_submitAndWatchExtrinsic": true,
+	"author_removeExtrinsic":         true,
+	"author_insertKey":               true,
+	"author_rotateKeys":              true,
+	"offchain_localStorageSet":       true,
+	"system_addReservedPeer":         true,
+	"system_removeReservedPeer":      true,
+	"system_addLogFilter":            true,
+	"system_resetLogFilter":          true,
+}
+
+// IsIdempotent returns if method can be sent to multiple nodes without side effects
+func IsIdempotent(method string) bool {
+	if nonIdempotentMethods[method] {
+		return false
+	}
+	lower := strings.ToLower(method)
+	return !strings.Contains(lower, "subscribe") && !strings.Contains(lower, "watch")
+}
+
+// Config defines after how long request is sent to second node if first node hasn't answered.
+// Zero values disable corresponding threshold, and hedging is disabled if all thresholds are disabled.
+type Config struct {
+	// Delay is fixed threshold used for methods without method delay when percentile is not set
+	// or not enough latencies are recorded yet
+	Delay time.Duration
+	// Percentile of recent request latencies used as threshold, between 0 and 100
+	Percentile float64
+	// MethodDelays are thresholds for specific methods that override other thresholds
+	MethodDelays map[string]time.Duration
+}
+
+// Hedger decides when requests are hedged based on configured thresholds and recorded latencies
+type Hedger struct {
+	config Config
+
+	mutex     sync.Mutex
+	latencies []time.Duration
+	next      int
+	observed  int
+	threshold time.Duration
+}
+
+// New creates hedger from config, error is returned if threshold is invalid or set for non idempotent method
+func New(config Config) (*Hedger, error) {
+	if config.Delay < 0 {
+		return nil, fmt.Errorf("invalid hedge delay %s", config.Delay)
+	}
+	if config.Percentile < 0 || config.Percentile > 100 {
+		return nil, fmt.Errorf("invalid hedge percentile %v, value must be between 0 and 100", config.Percentile)
+	}
+	for method, delay := range config.MethodDelays {
+		if delay <= 0 {
+			return nil, fmt.Errorf("invalid hedge delay %s for method %s", delay, method)
+		}
+		if !IsIdempotent(method) {
+			return nil, fmt.Errorf("method %s can't be hedged because it is not idempotent", method)
+		}
+	}
+	return &Hedger{
+		config:    config,
+		latencies: make([]time.Duration, DefaultWindowSize),
+	}, nil
+}
+
+// ParseMethodDelays parses method delays given as method names mapped to durations, e.g. {"state_getStorage": "200ms"}
+func ParseMethodDelays(delays map[string]string) (map[string]time.Duration, error) {
+	parsed := make(map[string]time.Duration, len(delays))
+	for method, value := range delays {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hedge delay %s for method %s", value, method)
+		}
+		parsed[method] = delay
+	}
+	return parsed, nil
+}
+
+// Delay returns after how long request with method should be sent to second node, false is
+// returned if request must not be hedged
+func (h *Hedger) Delay(method string) (time.Duration, bool) {
+	if !IsIdempotent(method) {
+		return 0, false
+	}
+	if delay, ok := h.config.MethodDelays[method]; ok {
+		return delay, true
+	}
+	if h.config.Percentile > 0 {
+		h.mutex.Lock()
+		threshold := h.threshold
+		h.mutex.Unlock()
+		if threshold > 0 {
+			return threshold, true
+		}
+	}
+	if h.config.Delay > 0 {
+		return h.config.Delay, true
+	}
+	return 0, false
+}
+
+// Observe records latency of successful request used to calculate percentile threshold
+func (h *Hedger) Observe(latency time.Duration) {
+	if h.config.Percentile <= 0 {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % len(h.latencies)
+	h.observed++
+	if h.observed >= MinSamples && (h.threshold == 0 || h.observed%recalculateInterval == 0) {
+		h.threshold = h.percentileLocked()
+	}
+}
+
+// percentileLocked calculates configured percentile of recorded latencies, mutex must be held by caller
+func (h *Hedger) percentileLocked() time.Duration {
+	count := h.observed
+	if count > len(h.latencies) {
+		count = len(h.latencies)
+	}
+	sorted := make([]time.Duration, count)
+	_ = copy(sorted, h.latencies[:count])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(h.config.Percentile/100*float64(count)+0.5) - 1
+	if index < 0 {
+		index = 0
+	} else if index >= count {
+		index = count - 1
+	}
+	return sorted[index]
+}
+
+var hedger, _ = New(Config{})
+
+// Init replaces default hedger with hedger created from config
+func Init(config Config) error {
+	h, err := New(config)
+	if err != nil {
+		return err
+	}
+	hedger = h
+	return nil
+}
+
+// Delay returns hedge delay for method on default hedger
+func Delay(method string) (time.Duration, bool) {
+	return hedger.Delay(method)
+}
+
+// Observe records request latency on default hedger
+func Observe(latency time.Duration) {
+	hedger.Observe(latency)
+}
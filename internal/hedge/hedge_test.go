@@ -0,0 +1,110 @@
+package hedge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	assert.True(t, IsIdempotent("state_getStorage"))
+	assert.True(t, IsIdempotent("chain_getBlockHash"))
+	assert.False(t, IsIdempotent("author_submitExtrinsic"))
+	assert.False(t, IsIdempotent("author_submitAndWatchExtrinsic"))
+	assert.False(t, IsIdempotent("chain_subscribeNewHeads"))
+	assert.False(t, IsIdempotent("state_unsubscribeStorage"))
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(Config{Delay: -time.Second})
+	assert.Error(t, err)
+	_, err = New(Config{Percentile: 101})
+	assert.Error(t, err)
+	_, err = New(Config{MethodDelays: map[string]time.Duration{"author_submitExtrinsic": time.Second}})
+	assert.Error(t, err)
+	_, err = New(Config{MethodDelays: map[string]time.Duration{"state_getStorage": 0}})
+	assert.Error(t, err)
+}
+
+func TestHedger_Delay(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     Config
+		latencies  int
+		method     string
+		wantDelay  time.Duration
+		wantHedged bool
+	}{
+		{
+			name:       "hedging is disabled by default",
+			config:     Config{},
+			method:     "state_getStorage",
+			wantHedged: false,
+		},
+		{
+			name:       "fixed delay is used",
+			config:     Config{Delay: 100 * time.Millisecond},
+			method:     "state_getStorage",
+			wantDelay:  100 * time.Millisecond,
+			wantHedged: true,
+		},
+		{
+			name:       "non idempotent methods are not hedged",
+			config:     Config{Delay: 100 * time.Millisecond},
+			method:     "author_submitExtrinsic",
+			wantHedged: false,
+		},
+		{
+			name: "method delay overrides other delays",
+			config: Config{
+				Delay:        100 * time.Millisecond,
+				Percentile:   50,
+				MethodDelays: map[string]time.Duration{"state_getStorage": 20 * time.Millisecond},
+			},
+			latencies:  100,
+			method:     "state_getStorage",
+			wantDelay:  20 * time.Millisecond,
+			wantHedged: true,
+		},
+		{
+			name:       "fixed delay is used until enough latencies are recorded",
+			config:     Config{Delay: 100 * time.Millisecond, Percentile: 90},
+			latencies:  MinSamples - 1,
+			method:     "state_getStorage",
+			wantDelay:  100 * time.Millisecond,
+			wantHedged: true,
+		},
+		{
+			name:       "percentile of recorded latencies is used",
+			config:     Config{Delay: 100 * time.Millisecond, Percentile: 50},
+			latencies:  64,
+			method:     "state_getStorage",
+			wantDelay:  32 * time.Millisecond,
+			wantHedged: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := New(test.config)
+			assert.NoError(t, err)
+			// latencies are 1ms, 2ms ... so percentile matches latency in ms
+			for i := 1; i <= test.latencies; i++ {
+				h.Observe(time.Duration(i) * time.Millisecond)
+			}
+
+			delay, hedged := h.Delay(test.method)
+			assert.Equal(t, test.wantHedged, hedged)
+			assert.Equal(t, test.wantDelay, delay)
+		})
+	}
+}
+
+func TestParseMethodDelays(t *testing.T) {
+	delays, err := ParseMethodDelays(map[string]string{"state_getStorage": "200ms"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"state_getStorage": 200 * time.Millisecond}, delays)
+
+	_, err = ParseMethodDelays(map[string]string{"state_getStorage": "fast"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,19 @@
+package history
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	log "github.com/sirupsen/logrus"
+)
+
+// Record saves node event at current time. Failing to save event is only logged, as history of
+// node doesn't affect node state.
+func Record(repos repositories.Repos, event models.NodeEvent) {
+	event.Timestamp = time.Now()
+	err := repos.NodeEventRepo.Save(&event)
+	if err != nil {
+		log.Errorf("Failed saving %s event of node %s because of: %v", event.Type, event.NodeID, err)
+	}
+}
@@ -8,18 +8,25 @@ import (
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/actions"
+	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
 	"github.com/NodeFactoryIo/vedran/internal/auth"
+	"github.com/NodeFactoryIo/vedran/internal/capability"
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
 	"github.com/NodeFactoryIo/vedran/internal/controllers"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/origin"
 	"github.com/NodeFactoryIo/vedran/internal/prometheus"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/router"
+	scheduleapikey "github.com/NodeFactoryIo/vedran/internal/schedule/apikey"
 	"github.com/NodeFactoryIo/vedran/internal/schedule/checkactive"
 	schedulepayout "github.com/NodeFactoryIo/vedran/internal/schedule/payout"
 	"github.com/NodeFactoryIo/vedran/internal/schedule/penalize"
+	scheduleprobe "github.com/NodeFactoryIo/vedran/internal/schedule/probe"
+	"github.com/NodeFactoryIo/vedran/internal/selection"
 	"github.com/asdine/storm/v3"
-	"github.com/gorilla/handlers"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -35,6 +42,13 @@ func StartLoadBalancerServer(
 		// terminate app: no auth secret provided
 		log.Fatalf("Unable to start vedran load balancer: %v", err)
 	}
+	err = auth.SetAdminSecret(props.AdminSecret)
+	if err != nil {
+		log.Fatalf("Unable to start vedran load balancer: %v", err)
+	}
+	if !auth.AdminEnabled() {
+		log.Debug("Admin api disabled as admin secret is not provided")
+	}
 
 	// init database
 	database, err := storm.Open(path.Join(props.RootDir, "vedran-load-balancer.db"))
@@ -53,6 +67,14 @@ func StartLoadBalancerServer(
 	repos.DowntimeRepo = repositories.NewDowntimeRepo(database)
 	repos.PayoutRepo = repositories.NewPayoutRepo(database)
 	repos.FeeRepo = repositories.NewFeeRepo(database)
+	repos.ProbeRepo = repositories.NewProbeRepo(database)
+	repos.APIKeyRepo = repositories.NewAPIKeyRepo(database)
+	repos.DisagreementRepo = repositories.NewDisagreementRepo(database)
+	repos.PenaltyRepo = repositories.NewPenaltyRepo(database)
+	repos.NodeEventRepo = repositories.NewNodeEventRepo(database)
+	repos.AuditLogRepo = repositories.NewAuditLogRepo(database)
+	// restore active nodes before pings are reset, so only nodes that pinged right before restart are restored
+	active.RestoreActiveNodes(*repos)
 	err = repos.PingRepo.ResetAllPings()
 	if err != nil {
 		log.Fatalf("Failed reseting pings because of: %v", err)
@@ -72,18 +94,40 @@ func StartLoadBalancerServer(
 		}
 	}
 
-	penalizedNodes, err := repos.NodeRepo.GetPenalizedNodes()
+	err = apikey.Init(repos.APIKeyRepo, apikey.AnonymousPolicy{
+		Enabled:      !props.AnonymousAccessDisabled,
+		DailyQuota:   props.AnonymousDailyQuota,
+		MonthlyQuota: props.AnonymousMonthlyQuota,
+	})
 	if err != nil {
-		log.Fatalf("Failed fetching penalized nodes because of: %v", err)
+		log.Fatalf("Unable to start vedran load balancer: %v", err)
 	}
+	// starts task that saves api key usage
+	scheduleapikey.StartScheduledTask()
 
-	for _, node := range *penalizedNodes {
-		go penalize.ScheduleCheckForPenalizedNode(node, *repos)
+	// restore capabilities declared by registered nodes, observed capabilities are restored by probing
+	registeredNodes, err := repos.NodeRepo.GetAll()
+	if err != nil && err.Error() != "not found" {
+		log.Fatalf("Failed fetching registered nodes because of: %v", err)
+	}
+	if err == nil {
+		for _, node := range *registeredNodes {
+			capability.Declare(node.ID, capability.Declared(node))
+		}
 	}
 
+	// starts task that checks penalized nodes once their cooldown expires
+	penalize.StartScheduledTask(repos)
+
 	// starts task that checks active nodes
 	checkactive.StartScheduledTask(repos)
 
+	// starts task that probes nodes through tunnel
+	scheduleprobe.StartScheduledTask(repos)
+
+	// starts task that checks health of fallback endpoints
+	fallback.StartHealthChecks()
+
 	// start scheduled payout if auto payout enabled
 	if props.PayoutConfiguration != nil {
 		schedulepayout.StartScheduledPayout(
@@ -94,8 +138,12 @@ func StartLoadBalancerServer(
 
 	// start server
 	log.Infof("Starting vedran load balancer on port :%d...", props.Port)
+	selector, err := selection.New(props.Selection)
+	if err != nil {
+		log.Fatalf("Unable to start vedran load balancer: %v", err)
+	}
 	apiController := controllers.NewApiController(
-		props.WhitelistEnabled, *repos, actions.NewActions(),
+		props.WhitelistEnabled, *repos, actions.NewActions(), selector,
 	)
 	r := router.CreateNewApiRouter(apiController, privateKey)
 	prometheus.RecordMetrics(*repos)
@@ -103,12 +151,12 @@ func StartLoadBalancerServer(
 		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS10}
 		server := &http.Server{
 			Addr:      fmt.Sprintf(":%d", props.Port),
-			Handler:   handlers.CORS()(r),
+			Handler:   origin.Middleware(r),
 			TLSConfig: tlsConfig,
 		}
 		err = server.ListenAndServeTLS(props.CertFile, props.KeyFile)
 	} else {
-		err = http.ListenAndServe(fmt.Sprintf(":%d", props.Port), handlers.CORS()(r))
+		err = http.ListenAndServe(fmt.Sprintf(":%d", props.Port), origin.Middleware(r))
 	}
 	if err != nil {
 		log.Error(err)
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// APIKey identifies consumer of rpc api. Quota equal to 0 is unlimited. Responses to requests
+// with verified key are verified by multiple nodes.
+type APIKey struct {
+	Name         string      `storm:"id" json:"name"`
+	Key          string      `storm:"unique" json:"key,omitempty"`
+	DailyQuota   int64       `json:"daily_quota"`
+	MonthlyQuota int64       `json:"monthly_quota"`
+	Disabled     bool        `json:"disabled"`
+	Verified     bool        `json:"verified"`
+	Created      time.Time   `json:"created"`
+	Usage        APIKeyUsage `json:"usage"`
+}
+
+// APIKeyUsage holds request counters of api key, daily and monthly counters refer
+// to Day and Month and are reset when they change
+type APIKeyUsage struct {
+	Day             string `json:"day"`
+	DailyRequests   int64  `json:"daily_requests"`
+	Month           string `json:"month"`
+	MonthlyRequests int64  `json:"monthly_requests"`
+	TotalRequests   int64  `json:"total_requests"`
+}
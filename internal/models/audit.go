@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Actions of admin recorded in audit log
+const (
+	AdminActivateNode        = "activate-node"
+	AdminDeactivateNode      = "deactivate-node"
+	AdminBanNode             = "ban-node"
+	AdminUnbanNode           = "unban-node"
+	AdminResetNodeCooldown   = "reset-node-cooldown"
+	AdminDeleteNode          = "delete-node"
+	AdminAddToWhitelist      = "add-to-whitelist"
+	AdminRemoveFromWhitelist = "remove-from-whitelist"
+)
+
+// AuditLogEntry is stored for each action taken through admin api. RemoteAddr is address of
+// client that took action.
+type AuditLogEntry struct {
+	ID         int       `storm:"id,increment" json:"id"`
+	Timestamp  time.Time `storm:"index" json:"timestamp"`
+	Action     string    `json:"action"`
+	NodeID     string    `json:"node_id"`
+	Details    string    `json:"details,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+}
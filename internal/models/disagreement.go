@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Disagreement is stored when nodes returned different responses to verified request.
+// Responses are canonical json responses of nodes by node id.
+type Disagreement struct {
+	ID          int               `storm:"id,increment" json:"id"`
+	Timestamp   time.Time         `storm:"index" json:"timestamp"`
+	Method      string            `json:"method"`
+	Params      string            `json:"params"`
+	Responses   map[string]string `json:"responses"`
+	Majority    string            `json:"majority"`
+	FaultyNodes []string          `json:"faulty_nodes"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Types of node events
+const (
+	NodeRegistered        = "registered"
+	NodeActivated         = "activated"
+	NodeDeactivated       = "deactivated"
+	NodePenalized         = "penalized"
+	NodeCooldownIncreased = "cooldown-increased"
+	NodePenaltyCancelled  = "penalty-cancelled"
+	NodeReactivated       = "reactivated"
+	NodeExpelled          = "expelled"
+	NodeBanned            = "banned"
+	NodeUnbanned          = "unbanned"
+	NodeDeleted           = "deleted"
+)
+
+// NodeEvent is stored on each node state transition, so operators can see why node was not
+// serving requests. Reason is penalty reason and Cooldown is node cooldown in minutes after
+// transition, if they apply to event type.
+type NodeEvent struct {
+	ID        int       `storm:"id,increment" json:"id"`
+	NodeID    string    `storm:"index" json:"node_id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `storm:"index" json:"timestamp"`
+	Reason    string    `json:"reason,omitempty"`
+	Cooldown  int       `json:"cooldown,omitempty"`
+	Details   string    `json:"details,omitempty"`
+}
@@ -8,4 +8,9 @@ type Node struct {
 	Cooldown      int
 	LastUsed      int64
 	Active        bool
+	// Banned node can't register and is not activated until it is unbanned by admin
+	Banned bool
+	// Pruning and RPCModules are capabilities declared by node on registration
+	Pruning    string
+	RPCModules []string
 }
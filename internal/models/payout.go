@@ -10,6 +10,11 @@ type Payout struct {
 }
 
 type NodeStatsDetails struct {
-	TotalPings    float64 `json:"total_pings"`
-	TotalRequests float64 `json:"total_requests"`
+	TotalPings    float64  `json:"total_pings"`
+	TotalRequests float64  `json:"total_requests"`
+	Pruning       string   `json:"pruning,omitempty"`
+	RPCModules    []string `json:"rpc_modules,omitempty"`
+	// RewardWeight multiplies requests of archive nodes when rewards are distributed,
+	// requests of other nodes have weight 1
+	RewardWeight float64 `json:"reward_weight,omitempty"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Penalty is scheduled check of penalized node, node is checked once penalty is due.
+// Each node has at most one penalty as penalties are stored by node id.
+type Penalty struct {
+	NodeID   string    `storm:"id" json:"node_id"`
+	Cooldown int       `json:"cooldown"`
+	Reason   string    `json:"reason"`
+	DueAt    time.Time `storm:"index" json:"due_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Probe holds state of node observed by load balancer through node tunnel
+type Probe struct {
+	NodeId               string `storm:"id"`
+	Timestamp            time.Time
+	Healthy              bool
+	IsSyncing            bool
+	PeerCount            int32
+	BestBlockHeight      int64
+	BestBlockHash        string
+	FinalizedBlockHeight int64
+	FinalizedBlockHash   string
+	// MetricsMismatch is set if metrics reported by node daemon differ from observed state
+	MetricsMismatch bool
+	// Pruning and RPCModules are observed capabilities of node, empty if they couldn't be observed
+	Pruning    string
+	RPCModules []string
+	Error      string
+}
@@ -0,0 +1,120 @@
+package nodeclient
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxIdleConnsPerNode   = 64
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultDialTimeout           = 1 * time.Second
+	DefaultResponseHeaderTimeout = 3 * time.Second
+)
+
+// Config holds connection pool settings applied to every node transport
+type Config struct {
+	// MaxIdleConnsPerNode is maximum number of idle keep-alive connections kept open toward single node
+	MaxIdleConnsPerNode int
+	// IdleConnTimeout is maximum amount of time idle connection remains open before closing itself
+	IdleConnTimeout time.Duration
+	// DialTimeout is maximum amount of time dial to tunnel port will wait for connect to complete
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout is amount of time to wait for node response headers after writing request
+	ResponseHeaderTimeout time.Duration
+}
+
+// DefaultConfig returns Config populated with default values
+func DefaultConfig() Config {
+	return Config{
+		MaxIdleConnsPerNode:   DefaultMaxIdleConnsPerNode,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		DialTimeout:           DefaultDialTimeout,
+		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+	}
+}
+
+// Registry holds one pooled transport for each tunnel port
+type Registry struct {
+	config     Config
+	mutex      sync.Mutex
+	transports map[int]*http.Transport
+}
+
+// NewRegistry creates empty registry that creates node transports with provided config
+func NewRegistry(config Config) *Registry {
+	return &Registry{
+		config:     config,
+		transports: make(map[int]*http.Transport),
+	}
+}
+
+// Transport returns pooled transport for provided tunnel port, creating it on first use
+func (r *Registry) Transport(port int) *http.Transport {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	transport, ok := r.transports[port]
+	if !ok {
+		transport = r.newTransport()
+		r.transports[port] = transport
+		log.Debugf("Created pooled transport for tunnel port %d", port)
+	}
+	return transport
+}
+
+// Release closes all idle connections of transport for provided tunnel port and removes it from registry
+func (r *Registry) Release(port int) {
+	r.mutex.Lock()
+	transport, ok := r.transports[port]
+	delete(r.transports, port)
+	r.mutex.Unlock()
+
+	if ok {
+		transport.CloseIdleConnections()
+		log.Debugf("Released pooled transport for tunnel port %d", port)
+	}
+}
+
+// Size returns number of transports currently held by registry
+func (r *Registry) Size() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.transports)
+}
+
+func (r *Registry) newTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   r.config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          r.config.MaxIdleConnsPerNode,
+		MaxIdleConnsPerHost:   r.config.MaxIdleConnsPerNode,
+		IdleConnTimeout:       r.config.IdleConnTimeout,
+		ResponseHeaderTimeout: r.config.ResponseHeaderTimeout,
+		DisableCompression:    true,
+	}
+}
+
+var registry = NewRegistry(DefaultConfig())
+
+// Init replaces default registry with registry that uses provided config
+func Init(config Config) {
+	registry = NewRegistry(config)
+}
+
+// Transport returns pooled transport for provided tunnel port from default registry
+func Transport(port int) *http.Transport {
+	return registry.Transport(port)
+}
+
+// Release tears down transport for provided tunnel port in default registry
+func Release(port int) {
+	registry.Release(port)
+}
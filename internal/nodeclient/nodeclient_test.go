@@ -0,0 +1,35 @@
+package nodeclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Transport(t *testing.T) {
+	registry := NewRegistry(DefaultConfig())
+
+	first := registry.Transport(20000)
+	second := registry.Transport(20000)
+	other := registry.Transport(20001)
+
+	assert.Same(t, first, second, "Transport should be reused for same port")
+	assert.NotSame(t, first, other, "Each port should have its own transport")
+	assert.Equal(t, 2, registry.Size())
+	assert.Equal(t, DefaultMaxIdleConnsPerNode, first.MaxIdleConnsPerHost)
+	assert.Equal(t, DefaultResponseHeaderTimeout, first.ResponseHeaderTimeout)
+}
+
+func TestRegistry_Release(t *testing.T) {
+	registry := NewRegistry(DefaultConfig())
+
+	released := registry.Transport(20000)
+	registry.Release(20000)
+	assert.Equal(t, 0, registry.Size())
+
+	// releasing unknown port is noop
+	registry.Release(20001)
+	assert.Equal(t, 0, registry.Size())
+
+	assert.NotSame(t, released, registry.Transport(20000), "New transport should be created after release")
+}
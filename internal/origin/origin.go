@@ -0,0 +1,257 @@
+package origin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const allOrigins = "*"
+
+// Config defines which browser origins can call load balancer and which methods and headers
+// they can use. Origins can be exact (https://app.example.com), wildcard subdomains
+// (https://*.example.com) or "*" for any origin.
+type Config struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods,omitempty"`
+	AllowedHeaders   []string `json:"allowedHeaders,omitempty"`
+	ExposedHeaders   []string `json:"exposedHeaders,omitempty"`
+	AllowCredentials bool     `json:"allowCredentials,omitempty"`
+	MaxAge           int      `json:"maxAge,omitempty"`
+}
+
+var (
+	DefaultAllowedOrigins = []string{allOrigins}
+	DefaultAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	DefaultAllowedHeaders = []string{"Content-Type", "X-API-Key", "X-Auth-Header", "X-Signature"}
+)
+
+// DefaultConfig allows any origin to call load balancer without credentials
+func DefaultConfig() Config {
+	return Config{
+		AllowedOrigins: DefaultAllowedOrigins,
+		AllowedMethods: DefaultAllowedMethods,
+		AllowedHeaders: DefaultAllowedHeaders,
+	}
+}
+
+// pattern is allowed origin split on wildcard
+type pattern struct {
+	prefix   string
+	suffix   string
+	wildcard bool
+}
+
+func (p pattern) matches(origin string) bool {
+	if !p.wildcard {
+		return origin == p.prefix
+	}
+	if len(origin) <= len(p.prefix)+len(p.suffix) ||
+		!strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// wildcard matches only subdomain labels
+	subdomain := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	for _, c := range subdomain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(subdomain, ".") && !strings.Contains(subdomain, "..")
+}
+
+// Policy checks origins of browser requests and sets CORS headers
+type Policy struct {
+	config    Config
+	allowAll  bool
+	patterns  []pattern
+	methods   map[string]bool
+	headers   map[string]bool
+	anyHeader bool
+}
+
+// New creates policy from config
+func New(config Config) (*Policy, error) {
+	p := &Policy{
+		config:  config,
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, allowed := range config.AllowedOrigins {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		switch {
+		case allowed == "":
+			continue
+		case allowed == allOrigins:
+			p.allowAll = true
+		case strings.Count(allowed, "*") > 1:
+			return nil, fmt.Errorf("allowed origin %s can contain only one wildcard", allowed)
+		case strings.Contains(allowed, "*"):
+			parts := strings.SplitN(allowed, "*", 2)
+			if !strings.HasSuffix(parts[0], "://") || !strings.HasPrefix(parts[1], ".") {
+				return nil, fmt.Errorf("wildcard in allowed origin %s must replace subdomain, e.g. https://*.example.com", allowed)
+			}
+			p.patterns = append(p.patterns, pattern{prefix: parts[0], suffix: parts[1], wildcard: true})
+		default:
+			p.patterns = append(p.patterns, pattern{prefix: strings.TrimSuffix(allowed, "/")})
+		}
+	}
+	if p.allowAll && config.AllowCredentials {
+		return nil, errors.New("credentials can't be allowed for any origin, allowed origins must be listed")
+	}
+	for _, method := range config.AllowedMethods {
+		p.methods[strings.ToUpper(strings.TrimSpace(method))] = true
+	}
+	for _, header := range config.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	return p, nil
+}
+
+// Load creates policy from JSON config file on path
+func Load(path string) (*Policy, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read origin policy file %s because of %v", path, err)
+	}
+
+	config := DefaultConfig()
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid origin policy file %s: %v", path, err)
+	}
+	return New(config)
+}
+
+// Allowed returns if origin can call load balancer, requests without origin are not sent by
+// browsers and are always allowed
+func (p *Policy) Allowed(origin string) bool {
+	if origin == "" || p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, pattern := range p.patterns {
+		if pattern.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOrigin checks origin of websocket upgrade request and logs rejection
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if !p.Allowed(origin) {
+		log.Warnf("Rejected websocket connection from origin %s", origin)
+		return false
+	}
+	return true
+}
+
+// Middleware rejects requests from origins that are not allowed, answers preflight requests
+// and sets CORS headers on responses to allowed origins
+func (p *Policy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !p.allowAll {
+			w.Header().Add("Vary", "Origin")
+		}
+		if !p.Allowed(origin) {
+			log.Warnf("Rejected %s request to %s from origin %s", r.Method, r.URL.Path, origin)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if p.allowAll {
+			w.Header().Set("Access-Control-Allow-Origin", allOrigins)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || method == "" {
+			if len(p.config.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.config.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// preflight request
+		if !p.methods[strings.ToUpper(method)] {
+			log.Warnf("Rejected preflight request for method %s from origin %s", method, origin)
+			http.Error(w, "Method not allowed", http.StatusForbidden)
+			return
+		}
+		var headers []string
+		for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header == "" {
+				continue
+			}
+			if !p.anyHeader && !p.headers[header] {
+				log.Warnf("Rejected preflight request with header %s from origin %s", header, origin)
+				http.Error(w, "Header not allowed", http.StatusForbidden)
+				return
+			}
+			headers = append(headers, header)
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.ToUpper(method))
+		if len(headers) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		}
+		if p.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(p.config.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+var policy, _ = New(DefaultConfig())
+
+// Init replaces default policy with policy created from config, or loaded from file on path if path is set
+func Init(config Config, path string) error {
+	var p *Policy
+	var err error
+	if path != "" {
+		p, err = Load(path)
+	} else {
+		p, err = New(config)
+	}
+	if err != nil {
+		return err
+	}
+	policy = p
+	return nil
+}
+
+// Middleware wraps handler with default policy
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy.Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// CheckOrigin checks origin of websocket upgrade request with default policy
+func CheckOrigin(r *http.Request) bool {
+	return policy.CheckOrigin(r)
+}
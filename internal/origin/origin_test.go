@@ -0,0 +1,175 @@
+package origin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Allowed(t *testing.T) {
+	p, err := New(Config{AllowedOrigins: []string{"https://app.example.com", "https://*.dapp.io"}})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "", allowed: true},
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "HTTPS://APP.EXAMPLE.COM", allowed: true},
+		{origin: "http://app.example.com", allowed: false},
+		{origin: "https://other.example.com", allowed: false},
+		{origin: "https://app.example.com.evil.com", allowed: false},
+		{origin: "https://a.dapp.io", allowed: true},
+		{origin: "https://a.b.dapp.io", allowed: true},
+		{origin: "https://dapp.io", allowed: false},
+		{origin: "https://evil-dapp.io", allowed: false},
+		{origin: "https://evil.com/.dapp.io", allowed: false},
+		{origin: "https://a.dapp.io:8080", allowed: false},
+	}
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			assert.Equal(t, test.allowed, p.Allowed(test.origin))
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(Config{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.Error(t, err)
+	_, err = New(Config{AllowedOrigins: []string{"https://*.*.example.com"}})
+	assert.Error(t, err)
+	_, err = New(Config{AllowedOrigins: []string{"https://app*.example.com"}})
+	assert.Error(t, err)
+}
+
+func TestPolicy_Middleware(t *testing.T) {
+	p, err := New(Config{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"POST"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		method          string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:            "request without origin is served",
+			method:          "POST",
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "request from allowed origin is served with cors headers",
+			method:         "POST",
+			origin:         "https://app.example.com",
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:           "request from other origin is rejected",
+			method:         "POST",
+			origin:         "https://evil.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "preflight request is answered",
+			method:         "OPTIONS",
+			origin:         "https://app.example.com",
+			requestMethod:  "POST",
+			requestHeaders: "content-type",
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "POST",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:           "preflight request with method that is not allowed is rejected",
+			method:         "OPTIONS",
+			origin:         "https://app.example.com",
+			requestMethod:  "DELETE",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "preflight request with header that is not allowed is rejected",
+			method:         "OPTIONS",
+			origin:         "https://app.example.com",
+			requestMethod:  "POST",
+			requestHeaders: "Content-Type, X-Custom",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req, _ := http.NewRequest(test.method, "/", nil)
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			if test.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", test.requestMethod)
+			}
+			if test.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", test.requestHeaders)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.expectedStatus, rr.Code)
+			for header, value := range test.expectedHeaders {
+				assert.Equal(t, value, rr.Header().Get(header), header)
+			}
+		})
+	}
+}
+
+func TestPolicy_CheckOrigin(t *testing.T) {
+	p, _ := New(Config{AllowedOrigins: []string{"https://app.example.com"}})
+
+	req, _ := http.NewRequest("GET", "/ws", nil)
+	assert.True(t, p.CheckOrigin(req))
+	req.Header.Set("Origin", "https://app.example.com")
+	assert.True(t, p.CheckOrigin(req))
+	req.Header.Set("Origin", "https://evil.com")
+	assert.False(t, p.CheckOrigin(req))
+}
+
+func TestLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "origin")
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "cors.json")
+
+	_ = ioutil.WriteFile(file, []byte(`{"allowedOrigins": ["https://*.example.com"], "allowCredentials": true}`), 0600)
+	p, err := Load(file)
+	assert.NoError(t, err)
+	assert.True(t, p.Allowed("https://app.example.com"))
+	assert.False(t, p.Allowed("https://evil.com"))
+	assert.True(t, p.methods["POST"])
+
+	_ = ioutil.WriteFile(file, []byte(`{"origins": []}`), 0600)
+	_, err = Load(file)
+	assert.Error(t, err)
+}
@@ -44,7 +44,7 @@ func CalculatePayoutDistributionByNode(
 	var totalNumberOfRequests = float64(0)
 	for _, node := range payoutDetails {
 		totalNumberOfPings += node.TotalPings
-		totalNumberOfRequests += node.TotalRequests
+		totalNumberOfRequests += weightedRequests(node)
 	}
 
 	totalDistributedLivelinessRewards := float64(0)
@@ -62,7 +62,7 @@ func CalculatePayoutDistributionByNode(
 		// requests rewards
 		requestsReward := float64(0)
 		if totalNumberOfRequests != 0 && nodeStatsDetails.TotalRequests != 0 {
-			nodeRequestsRewardPercentage := nodeStatsDetails.TotalRequests / totalNumberOfRequests
+			nodeRequestsRewardPercentage := weightedRequests(nodeStatsDetails) / totalNumberOfRequests
 			requestsReward = requestsRewardPool * nodeRequestsRewardPercentage
 			requestsReward = math.Floor(requestsReward)
 			totalDistributedRequestsRewards += requestsReward
@@ -75,3 +75,12 @@ func CalculatePayoutDistributionByNode(
 
 	return payoutAmountDistributionByNodes
 }
+
+// weightedRequests returns node requests multiplied by node reward weight, stats without
+// reward weight have weight 1
+func weightedRequests(details models.NodeStatsDetails) float64 {
+	if details.RewardWeight <= 0 {
+		return details.TotalRequests
+	}
+	return details.TotalRequests * details.RewardWeight
+}
@@ -97,6 +97,27 @@ func Test_CalculatePayoutDistributionByNode(t *testing.T) {
 			},
 			feeAddress: "0xfee",
 		},
+		{ // archive node requests are weighted with reward weight
+			name: "test distribution with weighted requests",
+			payoutDetails: map[string]models.NodeStatsDetails{
+				"0x1": {
+					TotalPings:    100,
+					TotalRequests: 10,
+					RewardWeight:  2,
+				},
+				"0x2": {
+					TotalPings:    100,
+					TotalRequests: 20,
+				},
+			},
+			totalReward:     1000,
+			loadBalancerFee: 0,
+			resultDistribution: map[string]big.Int{
+				"0x1": *big.NewInt(500), // 100P 10R with weight 2
+				"0x2": *big.NewInt(500), // 100P 20R
+			},
+			feeAddress: "",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
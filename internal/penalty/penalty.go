@@ -0,0 +1,330 @@
+package penalty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+)
+
+// Reason is fault node is penalized for
+type Reason string
+
+const (
+	MissedPing         = Reason("missed-ping")
+	BlockLag           = Reason("block-lag")
+	ProbeFailure       = Reason("probe-failure")
+	RPCFailure         = Reason("rpc-failure")
+	WSHandshakeFailure = Reason("ws-handshake-failure")
+	ConsensusMismatch  = Reason("consensus-mismatch")
+)
+
+// Action is applied to node once its cooldown would exceed maximum cooldown
+type Action string
+
+const (
+	// RemoveFromWhitelist sets node as inactive and removes it from whitelisted nodes
+	RemoveFromWhitelist = Action("remove-from-whitelist")
+	// Deactivate sets node as inactive, node can register again
+	Deactivate = Action("deactivate")
+	// Cap keeps node penalized and checks it on maximum cooldown
+	Cap = Action("cap")
+)
+
+const (
+	// Threshold is score node is penalized on
+	Threshold = 1.0
+
+	DefaultPingInterval        = 10 * time.Second
+	DefaultAllowedBlocksBehind = 10
+)
+
+// Duration is time.Duration written as string in policy file, e.g. "90s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be string, e.g. \"90s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule defines how node is penalized for reason. Each fault adds Weight to node score for reason, score is
+// halved every Decay, and node is penalized once score reaches Threshold, so rule with weight 1 penalizes
+// node on first fault. Penalized node is on InitialCooldown, which is multiplied by Escalation each time node
+// is still not active once cooldown expires. Node is only removed from active nodes if InitialCooldown is 0.
+// OnMaxCooldown is applied once cooldown would exceed MaxCooldown.
+type Rule struct {
+	Weight          float64  `json:"weight"`
+	Decay           Duration `json:"decay"`
+	InitialCooldown Duration `json:"initialCooldown"`
+	Escalation      float64  `json:"escalation"`
+	MaxCooldown     Duration `json:"maxCooldown"`
+	OnMaxCooldown   Action   `json:"onMaxCooldown"`
+}
+
+// InitialCooldownInMins returns initial cooldown rounded up to whole minutes
+func (r Rule) InitialCooldownInMins() int {
+	return int(math.Ceil(time.Duration(r.InitialCooldown).Minutes()))
+}
+
+// MaxCooldownInMins returns maximum cooldown rounded down to whole minutes
+func (r Rule) MaxCooldownInMins() int {
+	return int(time.Duration(r.MaxCooldown) / time.Minute)
+}
+
+// ExceedsMaxCooldown returns if cooldown in minutes is longer than maximum cooldown
+func (r Rule) ExceedsMaxCooldown(cooldown int) bool {
+	return time.Duration(cooldown)*time.Minute > time.Duration(r.MaxCooldown)
+}
+
+// DefaultRule is applied for reasons without rule, e.g. penalties scheduled before reasons were recorded
+var DefaultRule = Rule{
+	Weight:          1,
+	InitialCooldown: Duration(time.Minute),
+	Escalation:      2,
+	MaxCooldown:     Duration(17 * time.Hour),
+	OnMaxCooldown:   RemoveFromWhitelist,
+}
+
+// DefaultRules penalize node on first fault, except for failed rpc requests where node is penalized after
+// few failures in short time. Lagging node is only removed from active nodes until it catches up and node
+// that returned response different from other nodes is penalized for longer.
+func DefaultRules() map[Reason]Rule {
+	rpcFailure := DefaultRule
+	rpcFailure.Weight = 0.35
+	rpcFailure.Decay = Duration(5 * time.Minute)
+
+	blockLag := DefaultRule
+	blockLag.InitialCooldown = 0
+
+	consensusMismatch := DefaultRule
+	consensusMismatch.InitialCooldown = Duration(10 * time.Minute)
+	consensusMismatch.Escalation = 4
+
+	return map[Reason]Rule{
+		MissedPing:         DefaultRule,
+		BlockLag:           blockLag,
+		ProbeFailure:       DefaultRule,
+		RPCFailure:         rpcFailure,
+		WSHandshakeFailure: DefaultRule,
+		ConsensusMismatch:  consensusMismatch,
+	}
+}
+
+// Config is penalty policy, PingInterval and AllowedBlocksBehind define when node is considered active
+type Config struct {
+	PingInterval        Duration        `json:"pingInterval"`
+	AllowedBlocksBehind int64           `json:"allowedBlocksBehind"`
+	Rules               map[Reason]Rule `json:"rules"`
+}
+
+// DefaultConfig returns default penalty policy
+func DefaultConfig() Config {
+	return Config{
+		PingInterval:        Duration(DefaultPingInterval),
+		AllowedBlocksBehind: DefaultAllowedBlocksBehind,
+		Rules:               DefaultRules(),
+	}
+}
+
+// file is format of policy file, rules for each reason override only fields set in file
+type file struct {
+	PingInterval        *Duration                  `json:"pingInterval"`
+	AllowedBlocksBehind *int64                     `json:"allowedBlocksBehind"`
+	Rules               map[Reason]json.RawMessage `json:"rules"`
+}
+
+var now = time.Now
+
+type scoreKey struct {
+	nodeID string
+	reason Reason
+}
+
+type score struct {
+	value   float64
+	updated time.Time
+}
+
+// Policy decides when node is penalized and for how long
+type Policy struct {
+	config Config
+	mutex  sync.Mutex
+	scores map[scoreKey]score
+}
+
+// New creates policy from config, error is returned if any rule is invalid
+func New(config Config) (*Policy, error) {
+	if config.PingInterval <= 0 {
+		return nil, fmt.Errorf("ping interval must be positive")
+	}
+	if config.AllowedBlocksBehind < 0 {
+		return nil, fmt.Errorf("allowed blocks behind can't be negative")
+	}
+	for reason, rule := range config.Rules {
+		if err := validate(rule); err != nil {
+			return nil, fmt.Errorf("invalid rule for %s: %v", reason, err)
+		}
+	}
+	return &Policy{config: config, scores: make(map[scoreKey]score)}, nil
+}
+
+// Load creates policy from DefaultConfig overridden with policy file on path
+func Load(path string) (*Policy, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read penalty policy file %s because of %v", path, err)
+	}
+
+	var f file
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid penalty policy file %s: %v", path, err)
+	}
+
+	config := DefaultConfig()
+	if f.PingInterval != nil {
+		config.PingInterval = *f.PingInterval
+	}
+	if f.AllowedBlocksBehind != nil {
+		config.AllowedBlocksBehind = *f.AllowedBlocksBehind
+	}
+	for reason, raw := range f.Rules {
+		rule, ok := config.Rules[reason]
+		if !ok {
+			return nil, fmt.Errorf("invalid penalty policy file %s: unknown penalty reason %q", path, reason)
+		}
+		decoder = json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&rule); err != nil {
+			return nil, fmt.Errorf("invalid penalty policy file %s: rule for %s: %v", path, reason, err)
+		}
+		config.Rules[reason] = rule
+	}
+
+	return New(config)
+}
+
+func validate(rule Rule) error {
+	if rule.Weight < 0 {
+		return fmt.Errorf("weight can't be negative")
+	}
+	if rule.Decay < 0 || rule.InitialCooldown < 0 {
+		return fmt.Errorf("decay and initial cooldown can't be negative")
+	}
+	if rule.InitialCooldown == 0 {
+		return nil
+	}
+	if rule.InitialCooldown < Duration(time.Minute) {
+		return fmt.Errorf("initial cooldown must be 0 or at least 1m, as cooldown is kept in whole minutes")
+	}
+	if rule.Escalation < 1 {
+		return fmt.Errorf("escalation must be at least 1")
+	}
+	if rule.MaxCooldown < rule.InitialCooldown {
+		return fmt.Errorf("max cooldown must be at least initial cooldown")
+	}
+	switch rule.OnMaxCooldown {
+	case RemoveFromWhitelist, Deactivate, Cap:
+		return nil
+	default:
+		return fmt.Errorf("unknown max cooldown action %q", rule.OnMaxCooldown)
+	}
+}
+
+// Rule returns rule for reason, or DefaultRule if policy has no rule for reason
+func (p *Policy) Rule(reason Reason) Rule {
+	if rule, ok := p.config.Rules[reason]; ok {
+		return rule
+	}
+	return DefaultRule
+}
+
+// Fault records fault of node and returns if node should be penalized for it. Node score for reason is
+// reset once node is penalized.
+func (p *Policy) Fault(nodeID string, reason Reason) bool {
+	rule := p.Rule(reason)
+	if rule.Weight >= Threshold {
+		return true
+	}
+	if rule.Weight == 0 {
+		return false
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	t := now()
+	key := scoreKey{nodeID: nodeID, reason: reason}
+	value := rule.Weight
+	if previous, ok := p.scores[key]; ok && rule.Decay > 0 {
+		halvings := float64(t.Sub(previous.updated)) / float64(rule.Decay)
+		value += previous.value * math.Pow(0.5, halvings)
+	}
+	if value >= Threshold {
+		delete(p.scores, key)
+		return true
+	}
+	p.scores[key] = score{value: value, updated: t}
+	return false
+}
+
+// PingInterval returns interval in which node has to ping to be considered active
+func (p *Policy) PingInterval() time.Duration {
+	return time.Duration(p.config.PingInterval)
+}
+
+// AllowedBlocksBehind returns number of blocks node can lag behind best node to be considered active
+func (p *Policy) AllowedBlocksBehind() int64 {
+	return p.config.AllowedBlocksBehind
+}
+
+var policy, _ = New(DefaultConfig())
+
+// Init replaces default policy with policy loaded from file on path, if path is empty DefaultConfig is used
+func Init(path string) error {
+	p, err := New(DefaultConfig())
+	if path != "" {
+		p, err = Load(path)
+	}
+	if err != nil {
+		return err
+	}
+	policy = p
+	return nil
+}
+
+// RuleFor returns rule of default policy for reason
+func RuleFor(reason Reason) Rule {
+	return policy.Rule(reason)
+}
+
+// Fault records fault of node in default policy and returns if node should be penalized for it
+func Fault(nodeID string, reason Reason) bool {
+	return policy.Fault(nodeID, reason)
+}
+
+// PingInterval returns ping interval of default policy
+func PingInterval() time.Duration {
+	return policy.PingInterval()
+}
+
+// AllowedBlocksBehind returns allowed blocks behind of default policy
+func AllowedBlocksBehind() int64 {
+	return policy.AllowedBlocksBehind()
+}
@@ -0,0 +1,95 @@
+package penalty
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Fault(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	p, _ := New(DefaultConfig())
+
+	// wrong fork penalizes node on first fault
+	assert.True(t, p.Fault("1", ConsensusMismatch))
+
+	// failed requests penalize node only if they happen in short time
+	assert.False(t, p.Fault("1", RPCFailure))
+	assert.False(t, p.Fault("1", RPCFailure))
+	assert.True(t, p.Fault("1", RPCFailure))
+
+	assert.False(t, p.Fault("2", RPCFailure))
+	current = current.Add(5 * time.Minute)
+	assert.False(t, p.Fault("2", RPCFailure))
+	current = current.Add(5 * time.Minute)
+	assert.False(t, p.Fault("2", RPCFailure))
+	// scores are kept for each node separately
+	assert.False(t, p.Fault("3", RPCFailure))
+}
+
+func TestRule_Cooldown(t *testing.T) {
+	rule := DefaultRules()[ConsensusMismatch]
+	assert.Equal(t, 10, rule.InitialCooldownInMins())
+	assert.Equal(t, 1020, rule.MaxCooldownInMins())
+	assert.False(t, rule.ExceedsMaxCooldown(1020))
+	assert.True(t, rule.ExceedsMaxCooldown(1021))
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []Rule{
+		{Weight: -1},
+		{Weight: 1, Decay: Duration(-time.Minute)},
+		{Weight: 1, InitialCooldown: Duration(30 * time.Second), Escalation: 2, MaxCooldown: Duration(time.Hour), OnMaxCooldown: Cap},
+		{Weight: 1, InitialCooldown: Duration(time.Minute), Escalation: 0.5, MaxCooldown: Duration(time.Hour), OnMaxCooldown: Cap},
+		{Weight: 1, InitialCooldown: Duration(time.Hour), Escalation: 2, MaxCooldown: Duration(time.Minute), OnMaxCooldown: Cap},
+		{Weight: 1, InitialCooldown: Duration(time.Minute), Escalation: 2, MaxCooldown: Duration(time.Hour), OnMaxCooldown: "ban"},
+	}
+	for _, rule := range tests {
+		config := DefaultConfig()
+		config.Rules[RPCFailure] = rule
+		_, err := New(config)
+		assert.Error(t, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "penalty")
+	defer os.RemoveAll(dir)
+
+	validFile := path.Join(dir, "valid.json")
+	_ = ioutil.WriteFile(validFile, []byte(`{
+		"pingInterval": "30s",
+		"rules": {"rpc-failure": {"weight": 0.5, "onMaxCooldown": "cap"}}
+	}`), 0644)
+	unknownReasonFile := path.Join(dir, "unknown.json")
+	_ = ioutil.WriteFile(unknownReasonFile, []byte(`{"rules": {"slow-response": {"weight": 1}}}`), 0644)
+	invalidFile := path.Join(dir, "invalid.json")
+	_ = ioutil.WriteFile(invalidFile, []byte(`{"rules": {"rpc-failure": {"decay": 60}}}`), 0644)
+
+	p, err := Load(validFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, p.PingInterval())
+	assert.Equal(t, int64(DefaultAllowedBlocksBehind), p.AllowedBlocksBehind())
+	// fields not set in file are kept from default rule
+	rule := p.Rule(RPCFailure)
+	assert.Equal(t, 0.5, rule.Weight)
+	assert.Equal(t, Cap, rule.OnMaxCooldown)
+	assert.Equal(t, DefaultRules()[RPCFailure].Decay, rule.Decay)
+	assert.Equal(t, DefaultRule, p.Rule(""))
+
+	_, err = Load(unknownReasonFile)
+	assert.Error(t, err)
+
+	_, err = Load(invalidFile)
+	assert.Error(t, err)
+
+	_, err = Load(path.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,276 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+)
+
+type Action string
+
+const (
+	Allow     = Action("allow")
+	Deny      = Action("deny")
+	RateLimit = Action("rate-limit")
+)
+
+// Rule applies action to methods matched by exact method name or by namespace prefix. If
+// EmptyParamsOnly is set rule only matches requests without params or with empty first param,
+// e.g. state_getKeys without key prefix. Rate limited methods are limited to Rate requests per
+// second with bursts of up to Burst requests for each client.
+type Rule struct {
+	Method          string  `json:"method,omitempty"`
+	Prefix          string  `json:"prefix,omitempty"`
+	EmptyParamsOnly bool    `json:"emptyParamsOnly,omitempty"`
+	Action          Action  `json:"action"`
+	Rate            float64 `json:"rate,omitempty"`
+	Burst           int     `json:"burst,omitempty"`
+}
+
+// File is format of policy file
+type File struct {
+	Rules []Rule `json:"rules"`
+}
+
+// DefaultRules block node administration methods and methods that iterate over whole storage
+var DefaultRules = []Rule{
+	{Method: "author_rotateKeys", Action: Deny},
+	{Method: "author_insertKey", Action: Deny},
+	{Method: "author_hasKey", Action: Deny},
+	{Method: "author_hasSessionKeys", Action: Deny},
+	{Method: "author_removeExtrinsic", Action: Deny},
+	{Method: "system_addReservedPeer", Action: Deny},
+	{Method: "system_removeReservedPeer", Action: Deny},
+	{Method: "system_addLogFilter", Action: Deny},
+	{Method: "system_resetLogFilter", Action: Deny},
+	{Method: "system_networkState", Action: Deny},
+	{Method: "system_peers", Action: Deny},
+	{Prefix: "offchain_", Action: Deny},
+	{Method: "state_getKeys", EmptyParamsOnly: true, Action: Deny},
+	{Method: "state_getPairs", EmptyParamsOnly: true, Action: Deny},
+}
+
+var now = time.Now
+
+// sweepInterval is how often buckets of clients that are back at full burst are removed
+const sweepInterval = time.Minute
+
+// bucket is token bucket limiting rate of requests of single client
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type compiledRule struct {
+	Rule
+	burst float64
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// take counts request of client against rate limit of rule and returns if request is allowed,
+// each client has its own bucket so clients can't exhaust limit of other clients
+func (r *compiledRule) take(client string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t := now()
+	r.sweepLocked(t)
+	b, ok := r.buckets[client]
+	if !ok {
+		b = &bucket{tokens: r.burst, last: t}
+		r.buckets[client] = b
+	}
+	b.tokens = math.Min(r.burst, b.tokens+t.Sub(b.last).Seconds()*r.Rate)
+	b.last = t
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweepLocked removes buckets that are refilled and no longer needed, mutex must be held by caller
+func (r *compiledRule) sweepLocked(t time.Time) {
+	if t.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = t
+	for client, b := range r.buckets {
+		if b.tokens+t.Sub(b.last).Seconds()*r.Rate >= r.burst {
+			delete(r.buckets, client)
+		}
+	}
+}
+
+// Policy decides if rpc method can be forwarded to nodes
+type Policy struct {
+	rules []*compiledRule
+}
+
+// New creates policy from rules. Rule that matches request more specifically is applied, exact method
+// name is more specific than any prefix and longer prefix is more specific than shorter. Rules matching
+// same method or prefix override earlier ones, so rules can override DefaultRules when appended to them.
+func New(rules []Rule) (*Policy, error) {
+	byKey := make(map[string]int)
+	var compiled []*compiledRule
+	for _, rule := range rules {
+		if err := validate(rule); err != nil {
+			return nil, err
+		}
+
+		c := &compiledRule{Rule: rule}
+		if rule.Action == RateLimit {
+			burst := float64(rule.Burst)
+			if burst < 1 {
+				burst = math.Max(1, math.Ceil(rule.Rate))
+			}
+			c.burst = burst
+			c.buckets = make(map[string]*bucket)
+		}
+
+		key := fmt.Sprintf("%s|%s|%t", rule.Method, rule.Prefix, rule.EmptyParamsOnly)
+		if i, ok := byKey[key]; ok {
+			compiled[i] = c
+			continue
+		}
+		byKey[key] = len(compiled)
+		compiled = append(compiled, c)
+	}
+
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return specificity(compiled[i].Rule) > specificity(compiled[j].Rule)
+	})
+	return &Policy{rules: compiled}, nil
+}
+
+// Load creates policy from DefaultRules extended with rules from policy file on path
+func Load(path string) (*Policy, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file %s because of %v", path, err)
+	}
+
+	var file File
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+
+	return New(append(append([]Rule{}, DefaultRules...), file.Rules...))
+}
+
+func validate(rule Rule) error {
+	if (rule.Method == "") == (rule.Prefix == "") {
+		return fmt.Errorf("policy rule must set exactly one of method and prefix")
+	}
+	switch rule.Action {
+	case Allow, Deny:
+		return nil
+	case RateLimit:
+		if rule.Rate <= 0 {
+			return fmt.Errorf("rate limit rule for %s%s must set positive rate", rule.Method, rule.Prefix)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown policy action %q", rule.Action)
+	}
+}
+
+func specificity(rule Rule) int {
+	score := len(rule.Prefix) * 2
+	if rule.Method != "" {
+		score = math.MaxInt32 - 1
+	}
+	if rule.EmptyParamsOnly {
+		score++
+	}
+	return score
+}
+
+func (r *compiledRule) matches(request rpc.RPCRequest) bool {
+	if r.Method != "" && r.Method != request.Method {
+		return false
+	}
+	if r.Prefix != "" && !strings.HasPrefix(request.Method, r.Prefix) {
+		return false
+	}
+	return !r.EmptyParamsOnly || hasEmptyParams(request.Params)
+}
+
+// hasEmptyParams returns if request has no params or its first param is empty
+func hasEmptyParams(params json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(params)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return true
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(params, &list) != nil {
+		return false
+	}
+	if len(list) == 0 {
+		return true
+	}
+	var first interface{}
+	if json.Unmarshal(list[0], &first) != nil {
+		return false
+	}
+	return first == nil || first == "" || first == "0x"
+}
+
+// Check returns json rpc error if request of client is not allowed by policy, rate limited methods
+// are counted against limit of client on each allowed call
+func (p *Policy) Check(client string, request rpc.RPCRequest) *rpc.RPCError {
+	for _, rule := range p.rules {
+		if !rule.matches(request) {
+			continue
+		}
+		switch rule.Action {
+		case Deny:
+			return &rpc.RPCError{
+				Code:    rpc.MethodNotFound,
+				Message: fmt.Sprintf("Method %s is not allowed", request.Method),
+			}
+		case RateLimit:
+			if !rule.take(client) {
+				return &rpc.RPCError{
+					Code:    rpc.LimitExceeded,
+					Message: fmt.Sprintf("Rate limit for method %s exceeded", request.Method),
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+var policy, _ = New(DefaultRules)
+
+// Init replaces default policy with policy loaded from file on path, if path is empty DefaultRules are used
+func Init(path string) error {
+	p, err := New(DefaultRules)
+	if path != "" {
+		p, err = Load(path)
+	}
+	if err != nil {
+		return err
+	}
+	policy = p
+	return nil
+}
+
+// Check checks request of client against default policy
+func Check(client string, request rpc.RPCRequest) *rpc.RPCError {
+	return policy.Check(client, request)
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func request(method string, params string) rpc.RPCRequest {
+	var rawParams json.RawMessage
+	if params != "" {
+		rawParams = json.RawMessage(params)
+	}
+	return rpc.RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: rawParams}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        []Rule
+		request      rpc.RPCRequest
+		expectedCode int
+	}{
+		{
+			name:    "allows method without rule",
+			rules:   DefaultRules,
+			request: request("chain_getBlock", "[]"),
+		},
+		{
+			name:         "denies node administration method by default",
+			rules:        DefaultRules,
+			request:      request("author_rotateKeys", ""),
+			expectedCode: rpc.MethodNotFound,
+		},
+		{
+			name:         "denies method by prefix",
+			rules:        DefaultRules,
+			request:      request("offchain_localStorageGet", `["PERSISTENT","0x00"]`),
+			expectedCode: rpc.MethodNotFound,
+		},
+		{
+			name:         "denies storage iteration without key prefix",
+			rules:        DefaultRules,
+			request:      request("state_getKeys", `["0x"]`),
+			expectedCode: rpc.MethodNotFound,
+		},
+		{
+			name:         "denies storage iteration without params",
+			rules:        DefaultRules,
+			request:      request("state_getPairs", ""),
+			expectedCode: rpc.MethodNotFound,
+		},
+		{
+			name:    "allows storage iteration with key prefix",
+			rules:   DefaultRules,
+			request: request("state_getKeys", `["0x26aa394eea5630e07c48ae0c9558cef7"]`),
+		},
+		{
+			name: "exact method rule overrides prefix rule",
+			rules: []Rule{
+				{Prefix: "system_", Action: Deny},
+				{Method: "system_health", Action: Allow},
+			},
+			request: request("system_health", "[]"),
+		},
+		{
+			name: "longer prefix overrides shorter prefix",
+			rules: []Rule{
+				{Prefix: "sys", Action: Allow},
+				{Prefix: "system_", Action: Deny},
+			},
+			request:      request("system_name", "[]"),
+			expectedCode: rpc.MethodNotFound,
+		},
+		{
+			name:    "later rule for same method overrides default rule",
+			rules:   append(append([]Rule{}, DefaultRules...), Rule{Method: "author_rotateKeys", Action: Allow}),
+			request: request("author_rotateKeys", ""),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := New(test.rules)
+			assert.NoError(t, err)
+
+			rpcErr := p.Check("client", test.request)
+			if test.expectedCode == 0 {
+				assert.Nil(t, rpcErr)
+			} else {
+				assert.NotNil(t, rpcErr)
+				assert.Equal(t, test.expectedCode, rpcErr.Code)
+			}
+		})
+	}
+}
+
+func TestPolicy_Check_RateLimit(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	p, err := New([]Rule{{Method: "state_getKeysPaged", Action: RateLimit, Rate: 1, Burst: 2}})
+	assert.NoError(t, err)
+	req := request("state_getKeysPaged", `["0x00", 10]`)
+
+	assert.Nil(t, p.Check("client", req))
+	assert.Nil(t, p.Check("client", req))
+	rpcErr := p.Check("client", req)
+	assert.NotNil(t, rpcErr)
+	assert.Equal(t, rpc.LimitExceeded, rpcErr.Code)
+	assert.Nil(t, p.Check("client", request("state_getStorage", `["0x00"]`)))
+
+	assert.Nil(t, p.Check("other-client", req), "clients are limited separately")
+
+	current = current.Add(time.Second)
+	assert.Nil(t, p.Check("client", req))
+	assert.NotNil(t, p.Check("client", req))
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "missing method and prefix", rule: Rule{Action: Deny}},
+		{name: "both method and prefix", rule: Rule{Method: "a_b", Prefix: "a_", Action: Deny}},
+		{name: "unknown action", rule: Rule{Method: "a_b", Action: "block"}},
+		{name: "rate limit without rate", rule: Rule{Method: "a_b", Action: RateLimit}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New([]Rule{test.rule})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "policy")
+	defer os.RemoveAll(dir)
+
+	validFile := path.Join(dir, "valid.json")
+	_ = ioutil.WriteFile(validFile, []byte(`{"rules":[{"prefix":"state_","action":"deny"}]}`), 0644)
+	invalidFile := path.Join(dir, "invalid.json")
+	_ = ioutil.WriteFile(invalidFile, []byte(`{"rules":[{"method":"state_getKeys","action":"deny","limit":1}]}`), 0644)
+
+	p, err := Load(validFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, p.Check("client", request("state_getStorage", `["0x00"]`)))
+	assert.NotNil(t, p.Check("client", request("author_insertKey", "")))
+
+	_, err = Load(invalidFile)
+	assert.Error(t, err)
+
+	_, err = Load(path.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
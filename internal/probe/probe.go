@@ -0,0 +1,200 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/capability"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+)
+
+const (
+	systemHealthID = iota + 1
+	bestHeaderID
+	finalizedHeadID
+	finalizedHeaderID
+	bestHashID
+	rpcMethodsID
+	firstBlockHashID
+	firstBlockStateID
+)
+
+type systemHealth struct {
+	Peers           int32 `json:"peers"`
+	IsSyncing       bool  `json:"isSyncing"`
+	ShouldHavePeers bool  `json:"shouldHavePeers"`
+}
+
+type header struct {
+	Number string `json:"number"`
+}
+
+type rpcMethods struct {
+	Methods []string `json:"methods"`
+}
+
+// ProbeNode sends system_health, chain_getHeader and chain_getFinalizedHead through node
+// http tunnel and returns observed node state. If any of queries fails returned probe
+// is marked as unhealthy and contains error. Node capabilities are observed with rpc_methods
+// and by querying state of first block, which only archive nodes keep, but failing to observe
+// them doesn't make probe unhealthy.
+func ProbeNode(nodeID string) *models.Probe {
+	probe := &models.Probe{
+		NodeId:    nodeID,
+		Timestamp: time.Now(),
+	}
+
+	err := probeNode(probe)
+	if err != nil {
+		probe.Healthy = false
+		probe.Error = err.Error()
+		return probe
+	}
+
+	probe.Healthy = !probe.IsSyncing
+	return probe
+}
+
+func probeNode(probe *models.Probe) error {
+	responses, err := sendBatch(probe.NodeId, []rpc.RPCRequest{
+		{JSONRPC: "2.0", ID: requestID(systemHealthID), Method: "system_health"},
+		{JSONRPC: "2.0", ID: requestID(bestHeaderID), Method: "chain_getHeader"},
+		{JSONRPC: "2.0", ID: requestID(finalizedHeadID), Method: "chain_getFinalizedHead"},
+		{JSONRPC: "2.0", ID: requestID(rpcMethodsID), Method: "rpc_methods"},
+		{JSONRPC: "2.0", ID: requestID(firstBlockHashID), Method: "chain_getBlockHash", Params: requestParams(1)},
+	})
+	if err != nil {
+		return err
+	}
+
+	var health systemHealth
+	if err = decodeResult(responses, systemHealthID, &health); err != nil {
+		return err
+	}
+	probe.IsSyncing = health.IsSyncing
+	probe.PeerCount = health.Peers
+	if health.ShouldHavePeers && health.Peers == 0 {
+		return fmt.Errorf("node has no peers")
+	}
+
+	var bestHeader header
+	if err = decodeResult(responses, bestHeaderID, &bestHeader); err != nil {
+		return err
+	}
+	if probe.BestBlockHeight, err = parseBlockNumber(bestHeader.Number); err != nil {
+		return err
+	}
+
+	if err = decodeResult(responses, finalizedHeadID, &probe.FinalizedBlockHash); err != nil {
+		return err
+	}
+
+	var methods rpcMethods
+	if decodeResult(responses, rpcMethodsID, &methods) == nil {
+		probe.RPCModules = capability.Modules(methods.Methods)
+	}
+	var firstBlockHash string
+	_ = decodeResult(responses, firstBlockHashID, &firstBlockHash)
+
+	requests := []rpc.RPCRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      requestID(finalizedHeaderID),
+			Method:  "chain_getHeader",
+			Params:  requestParams(probe.FinalizedBlockHash),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      requestID(bestHashID),
+			Method:  "chain_getBlockHash",
+			Params:  requestParams(probe.BestBlockHeight),
+		},
+	}
+	if firstBlockHash != "" {
+		requests = append(requests, rpc.RPCRequest{
+			JSONRPC: "2.0",
+			ID:      requestID(firstBlockStateID),
+			Method:  "state_getRuntimeVersion",
+			Params:  requestParams(firstBlockHash),
+		})
+	}
+	responses, err = sendBatch(probe.NodeId, requests)
+	if err != nil {
+		return err
+	}
+	probe.Pruning = observePruning(responses, firstBlockHash, probe.BestBlockHeight)
+
+	var finalizedHeader header
+	if err = decodeResult(responses, finalizedHeaderID, &finalizedHeader); err != nil {
+		return err
+	}
+	if probe.FinalizedBlockHeight, err = parseBlockNumber(finalizedHeader.Number); err != nil {
+		return err
+	}
+
+	return decodeResult(responses, bestHashID, &probe.BestBlockHash)
+}
+
+// observePruning returns pruning mode observed by querying state of first block, pruning mode
+// can't be observed until chain is longer than state kept by pruned nodes
+func observePruning(responses []rpc.RPCResponse, firstBlockHash string, bestBlockHeight int64) string {
+	if firstBlockHash == "" || bestBlockHeight <= capability.PrunedStateDepth {
+		return ""
+	}
+	var version interface{}
+	if decodeResult(responses, firstBlockStateID, &version) != nil {
+		return capability.Pruned
+	}
+	return capability.Archive
+}
+
+func sendBatch(nodeID string, requests []rpc.RPCRequest) ([]rpc.RPCResponse, error) {
+	reqBody, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := rpc.SendRequestToNode(true, nodeID, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpc.CheckBatchRPCResponse(body)
+}
+
+func requestID(id int) json.RawMessage {
+	return json.RawMessage(strconv.Itoa(id))
+}
+
+func requestParams(params ...interface{}) json.RawMessage {
+	rawParams, _ := json.Marshal(params)
+	return rawParams
+}
+
+func decodeResult(responses []rpc.RPCResponse, id int, result interface{}) error {
+	for _, response := range responses {
+		if rpc.IDKey(response.ID) != strconv.Itoa(id) {
+			continue
+		}
+		if response.Error != nil {
+			return fmt.Errorf("probe request %d failed with code %d: %s", id, response.Error.Code, response.Error.Message)
+		}
+		if response.Result == nil {
+			return fmt.Errorf("probe request %d returned empty result", id)
+		}
+		return json.Unmarshal(*response.Result, result)
+	}
+	return fmt.Errorf("missing response for probe request %d", id)
+}
+
+func parseBlockNumber(number string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimPrefix(number, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block number %s", number)
+	}
+	return n, nil
+}
@@ -8,9 +8,13 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
 	"github.com/NodeFactoryIo/vedran/internal/payout"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpccache"
 	schedulepayout "github.com/NodeFactoryIo/vedran/internal/schedule/payout"
 	"github.com/NodeFactoryIo/vedran/pkg/version"
 	"github.com/prometheus/client_golang/prometheus"
@@ -45,6 +49,64 @@ var (
 		Name: "vedran_number_of_penalized_nodes",
 		Help: "The total number of nodes which are on cooldown",
 	})
+	metricsMismatchNodes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "vedran_number_of_nodes_with_metrics_mismatch",
+		Help: "The total number of nodes whose reported metrics don't match state observed by probing",
+	})
+	rpcCacheHits = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_rpc_cache_hits_total",
+		Help: "The total number of block addressed requests served from cache",
+	}, func() float64 {
+		return float64(rpccache.Hits())
+	})
+	rpcCacheMisses = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_rpc_cache_misses_total",
+		Help: "The total number of block addressed requests not found in cache",
+	}, func() float64 {
+		return float64(rpccache.Misses())
+	})
+	rpcCacheSize = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "vedran_rpc_cache_size",
+		Help: "The number of responses currently held in cache",
+	}, func() float64 {
+		return float64(rpccache.Len())
+	})
+	rateLimitedRequests = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_rate_limited_requests_total",
+		Help: "The total number of requests rejected because client exceeded rate limit",
+	}, func() float64 {
+		return float64(ratelimit.RejectedRequests())
+	})
+	rateLimitedConnections = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_rate_limited_ws_connections_total",
+		Help: "The total number of websocket connections rejected because client exceeded connection limit",
+	}, func() float64 {
+		return float64(ratelimit.RejectedConnections())
+	})
+	openWSConnections = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "vedran_open_ws_connections",
+		Help: "The number of currently open client websocket connections",
+	}, func() float64 {
+		return float64(ratelimit.OpenConnections())
+	})
+	fallbackRequests = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_fallback_requests_total",
+		Help: "The total number of requests served by fallback endpoints, not credited to any node",
+	}, func() float64 {
+		return float64(fallback.Requests())
+	})
+	fallbackFailures = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "vedran_fallback_failed_requests_total",
+		Help: "The total number of requests fallback endpoints failed to serve",
+	}, func() float64 {
+		return float64(fallback.Failures())
+	})
+	healthyFallbackEndpoints = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "vedran_healthy_fallback_endpoints",
+		Help: "The number of fallback endpoints that passed last health check",
+	}, func() float64 {
+		return float64(fallback.HealthyEndpoints())
+	})
 	successfulRequests = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "vedran_number_of_successful_requests",
 		Help: "The total number of successful requests served via vedran",
@@ -53,6 +115,13 @@ var (
 		Name: "vedran_number_of_failed_requests",
 		Help: "The total number of successful requests served via vedran",
 	})
+	apiKeyRequests = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vedran_api_key_requests",
+			Help: "The number of requests made with each api key in current day, current month and in total",
+		},
+		[]string{"name", "period"},
+	)
 	payoutDistribution = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "vedran_payout_distribution",
@@ -119,10 +188,12 @@ func RecordMetrics(repos repositories.Repos) {
 	setUpCollectionIntervals()
 
 	go recordPayoutDistribution(repos)
-	go recordActiveNodeCount(repos.NodeRepo)
+	recordActiveNodeCount(repos.NodeRepo)
 	go recordPenalizedNodeCount(repos.NodeRepo)
+	go recordMetricsMismatchNodeCount(repos.ProbeRepo)
 	go recordSuccessfulRequestCount(repos.RecordRepo)
 	go recordFailedRequestCount(repos.RecordRepo)
+	go recordAPIKeyRequestCount()
 	go recordPayoutDate(repos)
 	go recordLbFeeAmount(repos.PayoutRepo)
 	go recordNodeFees(repos.FeeRepo)
@@ -209,11 +280,12 @@ func recordPayoutDate(repos repositories.Repos) {
 	}
 }
 
+// recordActiveNodeCount sets active node count on each change of active nodes
 func recordActiveNodeCount(nodeRepo repositories.NodeRepository) {
-	for {
-		activeNodes.Set(float64(len(*nodeRepo.GetAllActiveNodes())))
-		time.Sleep(nodeStatsCollectionInterval)
-	}
+	nodeRepo.OnActiveNodesChange(func(change repositories.ActiveNodesChange) {
+		activeNodes.Set(float64(change.Count))
+	})
+	activeNodes.Set(float64(len(*nodeRepo.GetAllActiveNodes())))
 }
 
 func recordPenalizedNodeCount(nodeRepo repositories.NodeRepository) {
@@ -224,6 +296,22 @@ func recordPenalizedNodeCount(nodeRepo repositories.NodeRepository) {
 	}
 }
 
+func recordMetricsMismatchNodeCount(probeRepo repositories.ProbeRepository) {
+	for {
+		probes, err := probeRepo.GetAll()
+		if err == nil {
+			count := 0
+			for _, p := range *probes {
+				if p.MetricsMismatch {
+					count++
+				}
+			}
+			metricsMismatchNodes.Set(float64(count))
+		}
+		time.Sleep(nodeStatsCollectionInterval)
+	}
+}
+
 func recordSuccessfulRequestCount(recordRepo repositories.RecordRepository) {
 	for {
 		count, _ := recordRepo.CountSuccessfulRequests()
@@ -240,6 +328,19 @@ func recordFailedRequestCount(recordRepo repositories.RecordRepository) {
 	}
 }
 
+func recordAPIKeyRequestCount() {
+	for {
+		// reset removes deleted api keys
+		apiKeyRequests.Reset()
+		for name, usage := range apikey.Usage() {
+			apiKeyRequests.With(prometheus.Labels{"name": name, "period": "day"}).Set(float64(usage.DailyRequests))
+			apiKeyRequests.With(prometheus.Labels{"name": name, "period": "month"}).Set(float64(usage.MonthlyRequests))
+			apiKeyRequests.With(prometheus.Labels{"name": name, "period": "total"}).Set(float64(usage.TotalRequests))
+		}
+		time.Sleep(requestStatsCollectionInterval)
+	}
+}
+
 func setUpCollectionIntervals() {
 	fsi := os.Getenv(FeeStatsIntervalEnv)
 	if fsi != "" {
@@ -0,0 +1,274 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+)
+
+const (
+	// ConnectionRetryAfter is retry hint returned when client has too many open connections
+	ConnectionRetryAfter = 5 * time.Second
+
+	sweepInterval = time.Minute
+)
+
+var now = time.Now
+
+// Config defines limits applied to each client, zero values represent no limit
+type Config struct {
+	// RequestsPerSecond is rate at which client requests are accepted, each batch element is counted as request
+	RequestsPerSecond float64
+	// Burst is number of requests client can send at once, defaults to RequestsPerSecond rounded up
+	Burst int
+	// MaxConnections is maximum number of websocket connections client can keep open
+	MaxConnections int
+	// TrustedProxies are networks of proxies whose X-Forwarded-For header is trusted
+	TrustedProxies []*net.IPNet
+}
+
+// bucket is token bucket of single client, tokens can go below zero when client sends batch
+// larger than remaining tokens in which case client has to wait until debt is refilled
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter limits rate of requests and number of open websocket connections per client. Clients
+// are identified by api key or by ip address if they don't use api key.
+type Limiter struct {
+	// accessed atomically, kept first for 64-bit alignment
+	openConnections     int64
+	rejectedRequests    uint64
+	rejectedConnections uint64
+
+	config Config
+	burst  float64
+
+	mutex       sync.Mutex
+	buckets     map[string]*bucket
+	connections map[string]int
+	lastSweep   time.Time
+}
+
+// New creates limiter with provided limits
+func New(config Config) *Limiter {
+	burst := float64(config.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(config.RequestsPerSecond))
+	}
+	return &Limiter{
+		config:      config,
+		burst:       burst,
+		buckets:     make(map[string]*bucket),
+		connections: make(map[string]int),
+	}
+}
+
+// ParseTrustedProxies parses list of ip addresses and CIDR networks
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy address %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy network %s", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ClientKey returns key under which requests are limited, api key if set or client ip address
+func (l *Limiter) ClientKey(r *http.Request, apiKey string) string {
+	if apiKey != "" {
+		return "key:" + apiKey
+	}
+	return "ip:" + l.ClientIP(r)
+}
+
+// ClientIP returns ip address of client. If request comes from trusted proxy, X-Forwarded-For
+// addresses are walked from right to left and first address that is not trusted proxy is returned.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.isTrusted(net.ParseIP(host)) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			break
+		}
+		host = ip.String()
+		if !l.isTrusted(ip) {
+			break
+		}
+	}
+	return host
+}
+
+func (l *Limiter) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.config.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow counts requests against client rate limit and returns json rpc error with retry hint
+// if client has no remaining requests
+func (l *Limiter) Allow(client string, requests int) *rpc.RPCError {
+	if l.config.RequestsPerSecond <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	t := now()
+	l.sweepLocked(t)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: t}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+t.Sub(b.last).Seconds()*l.config.RequestsPerSecond)
+	b.last = t
+
+	if b.tokens < 1 {
+		atomic.AddUint64(&l.rejectedRequests, uint64(requests))
+		wait := time.Duration((1 - b.tokens) / l.config.RequestsPerSecond * float64(time.Second))
+		return rpc.NewLimitExceededError("Rate limit exceeded", wait)
+	}
+	b.tokens -= float64(requests)
+	return nil
+}
+
+// sweepLocked removes buckets that are refilled and no longer needed, mutex must be held by caller
+func (l *Limiter) sweepLocked(t time.Time) {
+	if t.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = t
+	for client, b := range l.buckets {
+		if b.tokens+t.Sub(b.last).Seconds()*l.config.RequestsPerSecond >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Connect counts websocket connection of client and returns function that must be called when
+// connection is closed, json rpc error with retry hint is returned if client has too many connections
+func (l *Limiter) Connect(client string) (func(), *rpc.RPCError) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.config.MaxConnections > 0 && l.connections[client] >= l.config.MaxConnections {
+		atomic.AddUint64(&l.rejectedConnections, 1)
+		return nil, rpc.NewLimitExceededError("Too many open connections", ConnectionRetryAfter)
+	}
+	l.connections[client]++
+	atomic.AddInt64(&l.openConnections, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			l.connections[client]--
+			if l.connections[client] <= 0 {
+				delete(l.connections, client)
+			}
+			atomic.AddInt64(&l.openConnections, -1)
+		})
+	}, nil
+}
+
+// OpenConnections returns number of open websocket connections
+func (l *Limiter) OpenConnections() int64 {
+	return atomic.LoadInt64(&l.openConnections)
+}
+
+// RejectedRequests returns number of requests rejected because of rate limit
+func (l *Limiter) RejectedRequests() uint64 {
+	return atomic.LoadUint64(&l.rejectedRequests)
+}
+
+// RejectedConnections returns number of websocket connections rejected because of connection limit
+func (l *Limiter) RejectedConnections() uint64 {
+	return atomic.LoadUint64(&l.rejectedConnections)
+}
+
+var limiter = New(Config{})
+
+// Init replaces default limiter with limiter using provided limits
+func Init(config Config) {
+	limiter = New(config)
+}
+
+// ClientKey returns client key on default limiter
+func ClientKey(r *http.Request, apiKey string) string {
+	return limiter.ClientKey(r, apiKey)
+}
+
+// ClientIP returns client ip address on default limiter
+func ClientIP(r *http.Request) string {
+	return limiter.ClientIP(r)
+}
+
+// Allow counts requests on default limiter
+func Allow(client string, requests int) *rpc.RPCError {
+	return limiter.Allow(client, requests)
+}
+
+// Connect counts websocket connection on default limiter
+func Connect(client string) (func(), *rpc.RPCError) {
+	return limiter.Connect(client)
+}
+
+// OpenConnections returns number of open websocket connections on default limiter
+func OpenConnections() int64 {
+	return limiter.OpenConnections()
+}
+
+// RejectedRequests returns number of rejected requests on default limiter
+func RejectedRequests() uint64 {
+	return limiter.RejectedRequests()
+}
+
+// RejectedConnections returns number of rejected connections on default limiter
+func RejectedConnections() uint64 {
+	return limiter.RejectedConnections()
+}
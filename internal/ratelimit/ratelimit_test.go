@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+	tests := []struct {
+		name              string
+		config            Config
+		requests          []int
+		offsets           []time.Duration
+		expectedRejected  []bool
+		expectedRetryHint []int
+	}{
+		{
+			name:             "no limit",
+			config:           Config{},
+			requests:         []int{100, 100},
+			offsets:          []time.Duration{0, 0},
+			expectedRejected: []bool{false, false},
+		},
+		{
+			name:              "requests over burst are rejected",
+			config:            Config{RequestsPerSecond: 1, Burst: 2},
+			requests:          []int{1, 1, 1},
+			offsets:           []time.Duration{0, 0, 0},
+			expectedRejected:  []bool{false, false, true},
+			expectedRetryHint: []int{0, 0, 1},
+		},
+		{
+			name:             "tokens are refilled over time",
+			config:           Config{RequestsPerSecond: 2},
+			requests:         []int{1, 1, 1, 1},
+			offsets:          []time.Duration{0, 0, 0, 500 * time.Millisecond},
+			expectedRejected: []bool{false, false, true, false},
+		},
+		{
+			name:              "large batch has to wait until its debt is refilled",
+			config:            Config{RequestsPerSecond: 1, Burst: 2},
+			requests:          []int{5, 1, 1},
+			offsets:           []time.Duration{0, 2 * time.Second, 4 * time.Second},
+			expectedRejected:  []bool{false, true, false},
+			expectedRetryHint: []int{0, 2, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New(test.config)
+			for i, requests := range test.requests {
+				now = func() time.Time { return start.Add(test.offsets[i]) }
+				rpcErr := limiter.Allow("client", requests)
+				if !test.expectedRejected[i] {
+					assert.Nil(t, rpcErr)
+					continue
+				}
+				assert.NotNil(t, rpcErr)
+				assert.Equal(t, rpc.LimitExceeded, rpcErr.Code)
+				if test.expectedRetryHint != nil {
+					assert.Equal(t, test.expectedRetryHint[i], rpcErr.RetryAfter())
+				}
+			}
+		})
+	}
+}
+
+func TestLimiter_Allow_SeparatesClients(t *testing.T) {
+	limiter := New(Config{RequestsPerSecond: 1})
+	assert.Nil(t, limiter.Allow("first", 1))
+	assert.NotNil(t, limiter.Allow("first", 1))
+	assert.Nil(t, limiter.Allow("second", 1))
+	assert.Equal(t, uint64(1), limiter.RejectedRequests())
+}
+
+func TestLimiter_Connect(t *testing.T) {
+	limiter := New(Config{MaxConnections: 2})
+
+	first, rpcErr := limiter.Connect("client")
+	assert.Nil(t, rpcErr)
+	_, rpcErr = limiter.Connect("client")
+	assert.Nil(t, rpcErr)
+	_, rpcErr = limiter.Connect("client")
+	assert.NotNil(t, rpcErr)
+	assert.Equal(t, int(ConnectionRetryAfter/time.Second), rpcErr.RetryAfter())
+	_, rpcErr = limiter.Connect("other")
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, int64(3), limiter.OpenConnections())
+
+	// release is counted only once
+	first()
+	first()
+	assert.Equal(t, int64(2), limiter.OpenConnections())
+	_, rpcErr = limiter.Connect("client")
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, uint64(1), limiter.RejectedConnections())
+}
+
+func TestLimiter_ClientKey(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	assert.NoError(t, err)
+	limiter := New(Config{TrustedProxies: proxies})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		apiKey       string
+		expectedKey  string
+	}{
+		{
+			name:        "api key is used if set",
+			remoteAddr:  "1.1.1.1:1234",
+			apiKey:      "secret",
+			expectedKey: "key:secret",
+		},
+		{
+			name:         "forwarded header from untrusted client is ignored",
+			remoteAddr:   "1.1.1.1:1234",
+			forwardedFor: []string{"2.2.2.2"},
+			expectedKey:  "ip:1.1.1.1",
+		},
+		{
+			name:         "first untrusted address from right is used",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"3.3.3.3, 2.2.2.2", "192.168.1.1"},
+			expectedKey:  "ip:2.2.2.2",
+		},
+		{
+			name:         "invalid forwarded address stops search",
+			remoteAddr:   "192.168.1.1:1234",
+			forwardedFor: []string{"2.2.2.2, invalid, 10.1.1.1"},
+			expectedKey:  "ip:10.1.1.1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := http.NewRequest("POST", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, forwarded := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			assert.Equal(t, test.expectedKey, limiter.ClientKey(r, test.apiKey))
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::1", " 127.0.0.1 "})
+	assert.NoError(t, err)
+	assert.Len(t, networks, 3)
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.Error(t, err)
+}
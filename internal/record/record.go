@@ -3,15 +3,16 @@ package record
 import (
 	"github.com/NodeFactoryIo/vedran/internal/actions"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	log "github.com/sirupsen/logrus"
 	"time"
 )
 
-// FailedRequest should be called when rpc response is invalid to penalize node.
+// FailedRequest should be called when rpc response is invalid to penalize node for reason.
 // It does not return value as it should be called in separate goroutine
-func FailedRequest(node models.Node, repositories repositories.Repos, actions actions.Actions) {
-	actions.PenalizeNode(node, repositories)
+func FailedRequest(node models.Node, repositories repositories.Repos, actions actions.Actions, reason penalty.Reason) {
+	actions.PenalizeNode(node, repositories, reason)
 
 	err := repositories.RecordRepo.Save(&models.Record{
 		NodeId:    node.ID,
@@ -41,3 +42,14 @@ func SuccessfulRequest(node models.Node, repositories repositories.Repos) {
 
 	log.Debugf("Node %s served successful request", node.ID)
 }
+
+// SharedNotification should be called when notification of subscription shared between clients
+// is fanned out to subscribers. Node sent notification once so it is rewarded as for single
+// successful request, regardless of number of subscribers, as otherwise node that happens to
+// serve shared subscription would collect rewards for requests other nodes would serve.
+// It does not return value as it should be called in separate goroutine
+func SharedNotification(node models.Node, repositories repositories.Repos, subscribers int) {
+	SuccessfulRequest(node, repositories)
+
+	log.Debugf("Node %s notification was fanned out to %d subscribers", node.ID, subscribers)
+}
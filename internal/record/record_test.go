@@ -3,6 +3,7 @@ package record
 import (
 	"fmt"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	aMock "github.com/NodeFactoryIo/vedran/mocks/actions"
 	mocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
@@ -40,11 +41,11 @@ func TestFailedRequest(t *testing.T) {
 			recordRepoMock.On("Save", mock.Anything).Once().Return(tt.saveNodeRecordResult)
 
 			actionsMock := aMock.Actions{}
-			actionsMock.On("PenalizeNode", node, mock.Anything).Return()
+			actionsMock.On("PenalizeNode", node, mock.Anything, penalty.RPCFailure).Return()
 
 			FailedRequest(node, repositories.Repos{
 				RecordRepo: &recordRepoMock,
-			}, &actionsMock)
+			}, &actionsMock, penalty.RPCFailure)
 
 			actionsMock.AssertNumberOfCalls(t, "PenalizeNode", tt.penalizedNodeCallCount)
 			recordRepoMock.AssertNumberOfCalls(t, "Save", tt.saveNodeRecordCallCount)
@@ -95,3 +96,37 @@ func TestSuccessfulRequest(t *testing.T) {
 
 	}
 }
+
+func TestSharedNotification(t *testing.T) {
+	tests := []struct {
+		name                    string
+		subscribers             int
+		saveNodeRecordCallCount int
+	}{
+		{name: "Saves single record for single subscriber", subscribers: 1, saveNodeRecordCallCount: 1},
+		{name: "Saves single record for many subscribers", subscribers: 100, saveNodeRecordCallCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := models.Node{
+				ID: "test-id",
+			}
+
+			nodeRepoMock := mocks.NodeRepository{}
+			nodeRepoMock.On("UpdateNodeUsed", node).Return()
+
+			recordRepoMock := mocks.RecordRepository{}
+			recordRepoMock.On("Save", mock.MatchedBy(func(r *models.Record) bool {
+				return r.NodeId == node.ID && r.Status == "successful"
+			})).Return(nil)
+
+			SharedNotification(node, repositories.Repos{
+				NodeRepo:   &nodeRepoMock,
+				RecordRepo: &recordRepoMock,
+			}, tt.subscribers)
+
+			recordRepoMock.AssertNumberOfCalls(t, "Save", tt.saveNodeRecordCallCount)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// ActiveNodesChange is notification that node was added to or removed from active nodes
+type ActiveNodesChange struct {
+	Node   models.Node
+	Active bool
+	// Count is number of active nodes after change
+	Count int
+}
+
+// ActiveSet is concurrency safe set of active nodes. Reads return snapshots that are safe to iterate and
+// reorder while set is modified, and listeners are notified of each change in order changes were made.
+type ActiveSet struct {
+	mutex     sync.RWMutex
+	nodes     []models.Node
+	persist   func(IDs []string) error
+	listeners []func(ActiveNodesChange)
+	// notifyMutex keeps notifications in order changes were made without holding set lock
+	notifyMutex sync.Mutex
+}
+
+// NewActiveSet creates empty active set, persist, if set, is called with IDs of active nodes on each
+// change so set can be restored after restart
+func NewActiveSet(persist func(IDs []string) error) *ActiveSet {
+	return &ActiveSet{
+		nodes:   make([]models.Node, 0),
+		persist: persist,
+	}
+}
+
+// Snapshot returns copy of active nodes
+func (s *ActiveSet) Snapshot() []models.Node {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	nodes := make([]models.Node, len(s.nodes))
+	_ = copy(nodes, s.nodes)
+	return nodes
+}
+
+// Len returns number of active nodes
+func (s *ActiveSet) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.nodes)
+}
+
+// Contains returns if node is active
+func (s *ActiveSet) Contains(ID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.indexOf(ID) >= 0
+}
+
+// Add adds node to active nodes, error is returned if node is already active
+func (s *ActiveSet) Add(node models.Node) error {
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+
+	s.mutex.Lock()
+	if s.indexOf(node.ID) >= 0 {
+		s.mutex.Unlock()
+		return fmt.Errorf("node %s already set as active", node.ID)
+	}
+	s.nodes = append(s.nodes, node)
+	count := len(s.nodes)
+	s.persistLocked()
+	s.mutex.Unlock()
+
+	s.notify(ActiveNodesChange{Node: node, Active: true, Count: count})
+	return nil
+}
+
+// Remove removes node from active nodes, error is returned if node is not active
+func (s *ActiveSet) Remove(ID string) error {
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+
+	s.mutex.Lock()
+	i := s.indexOf(ID)
+	if i < 0 {
+		s.mutex.Unlock()
+		return fmt.Errorf("no target node %s in memory", ID)
+	}
+	node := s.nodes[i]
+	// snapshots don't share backing array with set, so remaining nodes can be shifted in place
+	s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+	count := len(s.nodes)
+	s.persistLocked()
+	s.mutex.Unlock()
+
+	s.notify(ActiveNodesChange{Node: node, Active: false, Count: count})
+	return nil
+}
+
+// SetLastUsed sets time node was last used, if node is active
+func (s *ActiveSet) SetLastUsed(ID string, lastUsed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if i := s.indexOf(ID); i >= 0 {
+		s.nodes[i].LastUsed = lastUsed
+	}
+}
+
+// Subscribe registers listener that is called after each change of active nodes, listener must not
+// modify active nodes
+func (s *ActiveSet) Subscribe(listener func(ActiveNodesChange)) {
+	s.notifyMutex.Lock()
+	defer s.notifyMutex.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *ActiveSet) indexOf(ID string) int {
+	for i, node := range s.nodes {
+		if node.ID == ID {
+			return i
+		}
+	}
+	return -1
+}
+
+// persistLocked saves IDs of active nodes, failing to save them doesn't fail change as it only
+// affects which nodes are restored after restart
+func (s *ActiveSet) persistLocked() {
+	if s.persist == nil {
+		return
+	}
+	IDs := make([]string, len(s.nodes))
+	for i, node := range s.nodes {
+		IDs[i] = node.ID
+	}
+	if err := s.persist(IDs); err != nil {
+		log.Errorf("Failed persisting active nodes because of: %v", err)
+	}
+}
+
+func (s *ActiveSet) notify(change ActiveNodesChange) {
+	for _, listener := range s.listeners {
+		listener(change)
+	}
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActiveSet(t *testing.T) {
+	var persisted []string
+	var changes []ActiveNodesChange
+	set := NewActiveSet(func(IDs []string) error {
+		persisted = IDs
+		return nil
+	})
+	set.Subscribe(func(change ActiveNodesChange) {
+		changes = append(changes, change)
+	})
+
+	assert.NoError(t, set.Add(models.Node{ID: "1"}))
+	assert.NoError(t, set.Add(models.Node{ID: "2"}))
+	assert.Error(t, set.Add(models.Node{ID: "1"}))
+
+	snapshot := set.Snapshot()
+	assert.NoError(t, set.Remove("1"))
+	assert.Error(t, set.Remove("1"))
+
+	// snapshot taken before change is not affected by it
+	assert.Equal(t, []models.Node{{ID: "1"}, {ID: "2"}}, snapshot)
+	assert.Equal(t, []models.Node{{ID: "2"}}, set.Snapshot())
+	assert.Equal(t, []string{"2"}, persisted)
+	assert.Equal(t, []ActiveNodesChange{
+		{Node: models.Node{ID: "1"}, Active: true, Count: 1},
+		{Node: models.Node{ID: "2"}, Active: true, Count: 2},
+		{Node: models.Node{ID: "1"}, Active: false, Count: 1},
+	}, changes)
+}
+
+func TestActiveSet_Concurrent(t *testing.T) {
+	set := NewActiveSet(nil)
+	count := 0
+	set.Subscribe(func(change ActiveNodesChange) {
+		count = change.Count
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(ID string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_ = set.Add(models.Node{ID: ID})
+				set.SetLastUsed(ID, int64(j))
+				for _, node := range set.Snapshot() {
+					_ = set.Contains(node.ID)
+				}
+				_ = set.Remove(ID)
+			}
+			_ = set.Add(models.Node{ID: ID})
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	assert.Equal(t, 20, set.Len())
+	assert.Equal(t, 20, count)
+}
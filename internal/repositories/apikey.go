@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+)
+
+type APIKeyRepository interface {
+	GetAll() (*[]models.APIKey, error)
+	Save(apiKey *models.APIKey) error
+	Delete(apiKey *models.APIKey) error
+}
+
+type apiKeyRepo struct {
+	db *storm.DB
+}
+
+func NewAPIKeyRepo(db *storm.DB) APIKeyRepository {
+	return &apiKeyRepo{
+		db: db,
+	}
+}
+
+func (r *apiKeyRepo) GetAll() (*[]models.APIKey, error) {
+	var apiKeys []models.APIKey
+	err := r.db.All(&apiKeys)
+	return &apiKeys, err
+}
+
+func (r *apiKeyRepo) Save(apiKey *models.APIKey) error {
+	return r.db.Save(apiKey)
+}
+
+func (r *apiKeyRepo) Delete(apiKey *models.APIKey) error {
+	return r.db.DeleteStruct(apiKey)
+}
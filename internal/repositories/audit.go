@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+type AuditLogRepository interface {
+	Save(entry *models.AuditLogEntry) error
+	// Find returns at most limit models.AuditLogEntry stored at or after from and before to, ordered by time
+	// and skipping first offset entries, together with number of all entries in that range. Range is not
+	// bounded on side where time is zero.
+	Find(from time.Time, to time.Time, offset int, limit int) ([]models.AuditLogEntry, int, error)
+}
+
+type auditLogRepo struct {
+	db *storm.DB
+}
+
+func NewAuditLogRepo(db *storm.DB) AuditLogRepository {
+	return &auditLogRepo{
+		db: db,
+	}
+}
+
+func (r *auditLogRepo) Save(entry *models.AuditLogEntry) error {
+	return r.db.Save(entry)
+}
+
+func (r *auditLogRepo) Find(from time.Time, to time.Time, offset int, limit int) ([]models.AuditLogEntry, int, error) {
+	var matchers []q.Matcher
+	if !from.IsZero() {
+		matchers = append(matchers, q.Gte("Timestamp", from))
+	}
+	if !to.IsZero() {
+		matchers = append(matchers, q.Lt("Timestamp", to))
+	}
+
+	total, err := r.db.Select(matchers...).Count(&models.AuditLogEntry{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditLogEntry
+	err = r.db.Select(matchers...).OrderBy("Timestamp").Skip(offset).Limit(limit).Find(&entries)
+	if err != nil && err.Error() == "not found" {
+		return []models.AuditLogEntry{}, total, nil
+	}
+	return entries, total, err
+}
@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+type DisagreementRepository interface {
+	Save(disagreement *models.Disagreement) error
+	// FindSince returns all models.Disagreement stored at or after from, ordered by time
+	FindSince(from time.Time) ([]models.Disagreement, error)
+}
+
+type disagreementRepo struct {
+	db *storm.DB
+}
+
+func NewDisagreementRepo(db *storm.DB) DisagreementRepository {
+	return &disagreementRepo{
+		db: db,
+	}
+}
+
+func (r *disagreementRepo) Save(disagreement *models.Disagreement) error {
+	return r.db.Save(disagreement)
+}
+
+func (r *disagreementRepo) FindSince(from time.Time) ([]models.Disagreement, error) {
+	var disagreements []models.Disagreement
+	err := r.db.Select(q.Gte("Timestamp", from)).OrderBy("Timestamp").Find(&disagreements)
+	if err != nil && err.Error() == "not found" {
+		return []models.Disagreement{}, nil
+	}
+	return disagreements, err
+}
@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+type NodeEventRepository interface {
+	Save(event *models.NodeEvent) error
+	// FindByNodeID returns at most limit models.NodeEvent of node stored at or after from and before to, ordered
+	// by time and skipping first offset events, together with number of all events of node in that range.
+	// Range is not bounded on side where time is zero.
+	FindByNodeID(nodeID string, from time.Time, to time.Time, offset int, limit int) ([]models.NodeEvent, int, error)
+}
+
+type nodeEventRepo struct {
+	db *storm.DB
+}
+
+func NewNodeEventRepo(db *storm.DB) NodeEventRepository {
+	return &nodeEventRepo{
+		db: db,
+	}
+}
+
+func (r *nodeEventRepo) Save(event *models.NodeEvent) error {
+	return r.db.Save(event)
+}
+
+func (r *nodeEventRepo) FindByNodeID(
+	nodeID string, from time.Time, to time.Time, offset int, limit int,
+) ([]models.NodeEvent, int, error) {
+	matchers := []q.Matcher{q.Eq("NodeID", nodeID)}
+	if !from.IsZero() {
+		matchers = append(matchers, q.Gte("Timestamp", from))
+	}
+	if !to.IsZero() {
+		matchers = append(matchers, q.Lt("Timestamp", to))
+	}
+
+	total, err := r.db.Select(matchers...).Count(&models.NodeEvent{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.NodeEvent
+	err = r.db.Select(matchers...).OrderBy("Timestamp").Skip(offset).Limit(limit).Find(&events)
+	if err != nil && err.Error() == "not found" {
+		return []models.NodeEvent{}, total, nil
+	}
+	return events, total, err
+}
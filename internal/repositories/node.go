@@ -1,10 +1,7 @@
 package repositories
 
 import (
-	"fmt"
-	"math/rand"
-	"sort"
-	"sync"
+	"math"
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/models"
@@ -13,34 +10,51 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var activeNodes []models.Node
-var mutex = &sync.Mutex{}
+const (
+	activeNodesBucket = "ActiveNodes"
+	activeNodesKey    = "IDs"
+)
 
 type NodeRepository interface {
 	FindByID(ID string) (*models.Node, error)
 	Save(node *models.Node) error
+	Delete(ID string) error
 	GetAll() (*[]models.Node, error)
-	GetActiveNodes(selection string) *[]models.Node
+	GetActiveNodes() *[]models.Node
 	GetPenalizedNodes() (*[]models.Node, error)
 	GetAllActiveNodes() *[]models.Node
+	GetPreviouslyActiveNodes() []string
+	OnActiveNodesChange(listener func(ActiveNodesChange))
 	IsNodeActive(ID string) bool
 	RemoveNodeFromActive(ID string) error
 	AddNodeToActive(ID string) error
 	UpdateNodeUsed(node models.Node)
-	IncreaseNodeCooldown(ID string) (*models.Node, error)
+	IncreaseNodeCooldown(ID string, escalation float64) (*models.Node, error)
 	ResetNodeCooldown(ID string) (*models.Node, error)
 	IsNodeOnCooldown(ID string) (bool, error)
 }
 
 type nodeRepo struct {
-	db *storm.DB
+	db               *storm.DB
+	active           *ActiveSet
+	previouslyActive []string
 }
 
+// NewNodeRepo creates node repository with empty active set, IDs of nodes that were active when
+// previous active set was last changed are loaded so they can be restored
 func NewNodeRepo(db *storm.DB) NodeRepository {
-	activeNodes = make([]models.Node, 0)
+	var previouslyActive []string
+	err := db.Get(activeNodesBucket, activeNodesKey, &previouslyActive)
+	if err != nil && err != storm.ErrNotFound {
+		log.Errorf("Failed loading previously active nodes because of: %v", err)
+	}
 
 	return &nodeRepo{
 		db: db,
+		active: NewActiveSet(func(IDs []string) error {
+			return db.Set(activeNodesBucket, activeNodesKey, IDs)
+		}),
+		previouslyActive: previouslyActive,
 	}
 }
 
@@ -58,47 +72,44 @@ func (r *nodeRepo) Save(node *models.Node) error {
 	return nil
 }
 
+// Delete removes node from active nodes and deletes it from db
+func (r *nodeRepo) Delete(ID string) error {
+	node, err := r.FindByID(ID)
+	if err != nil {
+		return err
+	}
+	if r.active.Contains(ID) {
+		_ = r.active.Remove(ID)
+	}
+	return r.db.DeleteStruct(node)
+}
+
 func (r *nodeRepo) GetAll() (*[]models.Node, error) {
 	var nodes []models.Node
 	err := r.db.All(&nodes)
 	return &nodes, err
 }
 
-func (r *nodeRepo) getRandomNodes() *[]models.Node {
-	nodes := make([]models.Node, len(activeNodes))
-
-	_ = copy(nodes[:], activeNodes)
-
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(nodes), func(i, j int) {
-		nodes[i], nodes[j] = nodes[j], nodes[i]
-	})
-
+// GetActiveNodes returns copy of active nodes that is safe to reorder
+func (r *nodeRepo) GetActiveNodes() *[]models.Node {
+	nodes := r.active.Snapshot()
 	return &nodes
 }
 
-func (r *nodeRepo) getRoundRobinNodes() *[]models.Node {
-	nodes := make([]models.Node, len(activeNodes))
-
-	_ = copy(nodes[:], activeNodes)
-
-	sort.Slice(nodes[:], func(i, j int) bool {
-		return nodes[i].LastUsed < nodes[j].LastUsed
-	})
-
+// GetAllActiveNodes returns copy of active nodes that is safe to iterate while active nodes change
+func (r *nodeRepo) GetAllActiveNodes() *[]models.Node {
+	nodes := r.active.Snapshot()
 	return &nodes
 }
 
-func (r *nodeRepo) GetActiveNodes(selection string) *[]models.Node {
-	if selection == "round-robin" {
-		return r.getRoundRobinNodes()
-	}
-
-	return r.getRandomNodes()
+// GetPreviouslyActiveNodes returns IDs of nodes that were active before load balancer was restarted
+func (r *nodeRepo) GetPreviouslyActiveNodes() []string {
+	return r.previouslyActive
 }
 
-func (r *nodeRepo) GetAllActiveNodes() *[]models.Node {
-	return &activeNodes
+// OnActiveNodesChange registers listener called after node is added to or removed from active nodes
+func (r *nodeRepo) OnActiveNodesChange(listener func(ActiveNodesChange)) {
+	r.active.Subscribe(listener)
 }
 
 func (r *nodeRepo) GetPenalizedNodes() (*[]models.Node, error) {
@@ -114,29 +125,8 @@ func (r *nodeRepo) GetPenalizedNodes() (*[]models.Node, error) {
 	return &nodes, err
 }
 
-func (r *nodeRepo) updateMemoryLastUsedTime(targetNode models.Node) {
-	// protect updating in memory activeNodes from concurrency problems
-	mutex.Lock()
-	for i, node := range activeNodes {
-		if targetNode.ID == node.ID {
-			tempNode := &activeNodes[i]
-			tempNode.LastUsed = time.Now().Unix()
-			break
-		}
-	}
-	mutex.Unlock()
-}
-
 func (r *nodeRepo) RemoveNodeFromActive(ID string) error {
-	for i, node := range activeNodes {
-		if ID == node.ID {
-			activeNodes[i] = activeNodes[len(activeNodes)-1]
-			activeNodes = activeNodes[:len(activeNodes)-1]
-			return nil
-		}
-	}
-
-	return fmt.Errorf("no target node %s in memory", ID)
+	return r.active.Remove(ID)
 }
 
 func (r *nodeRepo) AddNodeToActive(ID string) error {
@@ -145,37 +135,28 @@ func (r *nodeRepo) AddNodeToActive(ID string) error {
 	if err != nil {
 		return err
 	}
-	// check if already active
-	for _, activeNode := range activeNodes {
-		if activeNode.ID == ID {
-			return fmt.Errorf("node %s already set as active", ID)
-		}
-	}
-
-	activeNodes = append(activeNodes, *node)
-	return nil
+	return r.active.Add(*node)
 }
 
 func (r *nodeRepo) UpdateNodeUsed(node models.Node) {
-	r.updateMemoryLastUsedTime(node)
-
 	node.LastUsed = time.Now().Unix()
+	r.active.SetLastUsed(node.ID, node.LastUsed)
+
 	err := r.db.Update(&node)
 	if err != nil {
 		log.Errorf("Failed updating node last used time because of: %v", err)
 	}
 }
 
-// IncreaseNodeCooldown doubles node cooldown and saves it to db
-func (r *nodeRepo) IncreaseNodeCooldown(ID string) (*models.Node, error) {
+// IncreaseNodeCooldown multiplies node cooldown by escalation, rounded up to whole minutes, and saves it to db
+func (r *nodeRepo) IncreaseNodeCooldown(ID string, escalation float64) (*models.Node, error) {
 	var node models.Node
 	err := r.db.One("ID", ID, &node)
 	if err != nil {
 		return nil, err
 	}
 
-	newCooldown := 2 * node.Cooldown
-	node.Cooldown = newCooldown
+	node.Cooldown = int(math.Ceil(float64(node.Cooldown) * escalation))
 
 	err = r.db.Save(&node)
 	return &node, err
@@ -211,10 +192,5 @@ func (r *nodeRepo) IsNodeOnCooldown(ID string) (bool, error) {
 }
 
 func (r *nodeRepo) IsNodeActive(ID string) bool {
-	for _, node := range *r.GetAllActiveNodes() {
-		if node.ID == ID {
-			return true
-		}
-	}
-	return false
+	return r.active.Contains(ID)
 }
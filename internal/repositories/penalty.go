@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+type PenaltyRepository interface {
+	// Save stores penalty, replacing existing penalty of same node
+	Save(penalty *models.Penalty) error
+	FindByNodeID(nodeID string) (*models.Penalty, error)
+	GetAll() ([]models.Penalty, error)
+	// FindDue returns all models.Penalty due at or before due, ordered by due time
+	FindDue(due time.Time) ([]models.Penalty, error)
+	Delete(nodeID string) error
+}
+
+type penaltyRepo struct {
+	db *storm.DB
+}
+
+func NewPenaltyRepo(db *storm.DB) PenaltyRepository {
+	return &penaltyRepo{
+		db: db,
+	}
+}
+
+func (r *penaltyRepo) Save(penalty *models.Penalty) error {
+	return r.db.Save(penalty)
+}
+
+func (r *penaltyRepo) FindByNodeID(nodeID string) (*models.Penalty, error) {
+	var penalty models.Penalty
+	err := r.db.One("NodeID", nodeID, &penalty)
+	return &penalty, err
+}
+
+func (r *penaltyRepo) GetAll() ([]models.Penalty, error) {
+	var penalties []models.Penalty
+	err := r.db.All(&penalties)
+	return penalties, err
+}
+
+func (r *penaltyRepo) FindDue(due time.Time) ([]models.Penalty, error) {
+	var penalties []models.Penalty
+	err := r.db.Select(q.Lte("DueAt", due)).OrderBy("DueAt").Find(&penalties)
+	if err != nil && err.Error() == "not found" {
+		return []models.Penalty{}, nil
+	}
+	return penalties, err
+}
+
+func (r *penaltyRepo) Delete(nodeID string) error {
+	return r.db.DeleteStruct(&models.Penalty{NodeID: nodeID})
+}
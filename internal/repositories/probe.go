@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/asdine/storm/v3"
+)
+
+type ProbeRepository interface {
+	FindByNodeID(nodeId string) (*models.Probe, error)
+	Save(probe *models.Probe) error
+	GetAll() (*[]models.Probe, error)
+	// GetLatestBlockMetrics returns highest best and finalized block observed on healthy nodes
+	GetLatestBlockMetrics() (*models.LatestBlockMetrics, error)
+}
+
+type probeRepo struct {
+	db *storm.DB
+}
+
+func NewProbeRepo(db *storm.DB) ProbeRepository {
+	return &probeRepo{
+		db: db,
+	}
+}
+
+func (r *probeRepo) FindByNodeID(nodeId string) (*models.Probe, error) {
+	var probe models.Probe
+	err := r.db.One("NodeId", nodeId, &probe)
+	return &probe, err
+}
+
+func (r *probeRepo) Save(probe *models.Probe) error {
+	return r.db.Save(probe)
+}
+
+func (r *probeRepo) GetAll() (*[]models.Probe, error) {
+	var probes []models.Probe
+	err := r.db.All(&probes)
+	return &probes, err
+}
+
+func (r *probeRepo) GetLatestBlockMetrics() (*models.LatestBlockMetrics, error) {
+	all, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	latestBlockMetrics := models.LatestBlockMetrics{
+		BestBlockHeight:      0,
+		FinalizedBlockHeight: 0,
+	}
+	for _, p := range *all {
+		if !p.Healthy {
+			continue
+		}
+		if p.BestBlockHeight > latestBlockMetrics.BestBlockHeight {
+			latestBlockMetrics.BestBlockHeight = p.BestBlockHeight
+		}
+		if p.FinalizedBlockHeight > latestBlockMetrics.FinalizedBlockHeight {
+			latestBlockMetrics.FinalizedBlockHeight = p.FinalizedBlockHeight
+		}
+	}
+	return &latestBlockMetrics, err
+}
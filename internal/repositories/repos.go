@@ -2,11 +2,17 @@ package repositories
 
 // Repos structure holds all available repositories
 type Repos struct {
-	NodeRepo     NodeRepository
-	PingRepo     PingRepository
-	MetricsRepo  MetricsRepository
-	RecordRepo   RecordRepository
-	DowntimeRepo DowntimeRepository
-	PayoutRepo   PayoutRepository
-	FeeRepo      FeeRepository
+	NodeRepo         NodeRepository
+	PingRepo         PingRepository
+	MetricsRepo      MetricsRepository
+	RecordRepo       RecordRepository
+	DowntimeRepo     DowntimeRepository
+	PayoutRepo       PayoutRepository
+	FeeRepo          FeeRepository
+	ProbeRepo        ProbeRepository
+	APIKeyRepo       APIKeyRepository
+	DisagreementRepo DisagreementRepository
+	PenaltyRepo      PenaltyRepository
+	NodeEventRepo    NodeEventRepository
+	AuditLogRepo     AuditLogRepository
 }
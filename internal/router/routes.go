@@ -23,8 +23,34 @@ func createRoutes(apiController *controllers.ApiController, router *mux.Router,
 
 	createTrackedRoute("/", "POST", std.Handler("/", mdlw, http.HandlerFunc(apiController.RPCHandler)), router)
 	createTrackedRoute("/ws", "GET", std.Handler("/ws", mdlw, http.HandlerFunc(apiController.WSHandler)), router)
+	// api key as path segment
+	createTrackedRoute("/{key}", "POST", std.Handler("/", mdlw, http.HandlerFunc(apiController.RPCHandler)), router)
+	createTrackedRoute("/ws/{key}", "GET", std.Handler("/ws", mdlw, http.HandlerFunc(apiController.WSHandler)), router)
 
 	createSignatureVerificationRoute("/api/v1/stats", "POST", apiController.StatisticsHandlerAllStatsForLoadbalancer, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/stats/keys", "GET", apiController.StatisticsHandlerStatsForAPIKeys, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/stats/disagreements", "GET", apiController.StatisticsHandlerDisagreements, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/stats/fallback", "GET", apiController.StatisticsHandlerFallback, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/keys", "GET", apiController.APIKeysListHandler, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/keys", "POST", apiController.APIKeysCreateHandler, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/keys/{name}", "PUT", apiController.APIKeysUpdateHandler, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/keys/{name}", "DELETE", apiController.APIKeysDeleteHandler, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/penalties", "GET", apiController.PenaltiesListHandler, router, privateKey)
+	createSignatureVerificationRoute("/api/v1/penalties/{id}", "DELETE", apiController.PenaltiesCancelHandler, router, privateKey)
+
+	// admin
+	createAdminRoute("/api/v1/admin/nodes", "GET", apiController.AdminNodesListHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}", "GET", apiController.AdminNodeHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}", "DELETE", apiController.AdminNodeDeleteHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}/activate", "POST", apiController.AdminNodeActivateHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}/deactivate", "POST", apiController.AdminNodeDeactivateHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}/ban", "POST", apiController.AdminNodeBanHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}/unban", "POST", apiController.AdminNodeUnbanHandler, router)
+	createAdminRoute("/api/v1/admin/nodes/{id}/reset-cooldown", "POST", apiController.AdminNodeResetCooldownHandler, router)
+	createAdminRoute("/api/v1/admin/whitelist", "GET", apiController.AdminWhitelistHandler, router)
+	createAdminRoute("/api/v1/admin/whitelist", "POST", apiController.AdminWhitelistAddHandler, router)
+	createAdminRoute("/api/v1/admin/whitelist/{id}", "DELETE", apiController.AdminWhitelistRemoveHandler, router)
+	createAdminRoute("/api/v1/admin/audit", "GET", apiController.AdminAuditLogHandler, router)
 
 	// authorized
 	createRoute("/api/v1/nodes/pings", "POST", apiController.PingHandler, router, true)
@@ -33,6 +59,7 @@ func createRoutes(apiController *controllers.ApiController, router *mux.Router,
 	createRoute("/api/v1/nodes", "POST", apiController.RegisterHandler, router, false)
 	createRoute("/api/v1/stats", "GET", apiController.StatisticsHandlerAllStats, router, false)
 	createRoute("/api/v1/stats/node/{id}", "GET", apiController.StatisticsHandlerStatsForNode, router, false)
+	createRoute("/api/v1/nodes/{id}/events", "GET", apiController.NodeEventsHandler, router, false)
 	createRoute("/api/v1/stats/lb", "GET", apiController.StatisticsHandlerStatsForLoadBalancer, router, false)
 	createRoute("/metrics", "GET", promhttp.Handler().ServeHTTP, router, false)
 }
@@ -63,6 +90,13 @@ func createSignatureVerificationRoute(
 	setUpRoute(route, method, r)
 }
 
+func createAdminRoute(
+	route string, method string, handler http.HandlerFunc, router *mux.Router,
+) {
+	r := router.Handle(route, auth.AdminMiddleware(handler))
+	setUpRoute(route, method, r)
+}
+
 func setUpRoute(route string, method string, r *mux.Route) {
 	r.Methods(method)
 	r.Name(route)
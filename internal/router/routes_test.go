@@ -25,6 +25,7 @@ func TestApiRouter(t *testing.T) {
 			RecordRepo:  &recordRepoMock,
 		},
 		nil,
+		nil,
 	)
 
 	tests := []struct {
@@ -35,6 +36,23 @@ func TestApiRouter(t *testing.T) {
 		{name: "Test register route", url: "/api/v1/nodes", methods: []string{"POST"}},
 		{name: "Test ping route", url: "/api/v1/nodes/pings", methods: []string{"POST"}},
 		{name: "Test metrics route", url: "/api/v1/nodes/metrics", methods: []string{"PUT"}},
+		{name: "Test api key stats route", url: "/api/v1/stats/keys", methods: []string{"GET"}},
+		{name: "Test disagreements route", url: "/api/v1/stats/disagreements", methods: []string{"GET"}},
+		{name: "Test fallback stats route", url: "/api/v1/stats/fallback", methods: []string{"GET"}},
+		{name: "Test api key delete route", url: "/api/v1/keys/{name}", methods: []string{"DELETE"}},
+		{name: "Test penalties route", url: "/api/v1/penalties", methods: []string{"GET"}},
+		{name: "Test penalty cancel route", url: "/api/v1/penalties/{id}", methods: []string{"DELETE"}},
+		{name: "Test node events route", url: "/api/v1/nodes/{id}/events", methods: []string{"GET"}},
+		{name: "Test admin nodes route", url: "/api/v1/admin/nodes", methods: []string{"GET"}},
+		{name: "Test admin node activate route", url: "/api/v1/admin/nodes/{id}/activate", methods: []string{"POST"}},
+		{name: "Test admin node deactivate route", url: "/api/v1/admin/nodes/{id}/deactivate", methods: []string{"POST"}},
+		{name: "Test admin node ban route", url: "/api/v1/admin/nodes/{id}/ban", methods: []string{"POST"}},
+		{name: "Test admin node unban route", url: "/api/v1/admin/nodes/{id}/unban", methods: []string{"POST"}},
+		{name: "Test admin node reset cooldown route", url: "/api/v1/admin/nodes/{id}/reset-cooldown", methods: []string{"POST"}},
+		{name: "Test admin whitelist remove route", url: "/api/v1/admin/whitelist/{id}", methods: []string{"DELETE"}},
+		{name: "Test admin audit log route", url: "/api/v1/admin/audit", methods: []string{"GET"}},
+		{name: "Test rpc route with api key", url: "/{key}", methods: []string{"POST"}},
+		{name: "Test ws route with api key", url: "/ws/{key}", methods: []string{"GET"}},
 	}
 
 	router := mux.NewRouter()
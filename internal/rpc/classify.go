@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// ErrorClass decides how load balancer handles node response with error
+type ErrorClass string
+
+const (
+	// UserError is caused by request, response is returned to client as is and node is rewarded
+	UserError = ErrorClass("user-error")
+	// NodeFault is caused by node, node is penalized and request is retried on other node
+	NodeFault = ErrorClass("node-fault")
+	// Transient is temporary error, request is retried on other node without penalizing node
+	Transient = ErrorClass("transient")
+)
+
+// ErrorRule classifies json rpc error codes from Code to MaxCode or http statuses from Status to
+// MaxStatus, if max value is not set rule matches only single code or status
+type ErrorRule struct {
+	Code      int        `json:"code,omitempty"`
+	MaxCode   int        `json:"maxCode,omitempty"`
+	Status    int        `json:"status,omitempty"`
+	MaxStatus int        `json:"maxStatus,omitempty"`
+	Class     ErrorClass `json:"class"`
+}
+
+// ErrorRulesFile is format of error rules file
+type ErrorRulesFile struct {
+	Rules []ErrorRule `json:"rules"`
+}
+
+// DefaultErrorRules treat internal and implementation defined server errors as node faults and
+// overloaded or unavailable nodes as transient errors. Other json rpc errors are user errors and
+// other http statuses are node faults.
+var DefaultErrorRules = []ErrorRule{
+	{Code: InternalServerError, Class: NodeFault},
+	{Code: -32099, MaxCode: -32000, Class: NodeFault},
+	{Status: http.StatusTooManyRequests, Class: Transient},
+	{Status: http.StatusBadGateway, MaxStatus: http.StatusGatewayTimeout, Class: Transient},
+}
+
+// NodeError is node fault or transient error returned when routing request to node
+type NodeError struct {
+	Class ErrorClass
+	err   error
+}
+
+func (e *NodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.err
+}
+
+// ClassOf returns class of error returned when routing request to node. Errors that are not
+// classified by rules, e.g. connection errors and timeouts, are node faults.
+func ClassOf(err error) ErrorClass {
+	var nodeErr *NodeError
+	if errors.As(err, &nodeErr) {
+		return nodeErr.Class
+	}
+	return NodeFault
+}
+
+func (r ErrorRule) validate() error {
+	if r.Class != UserError && r.Class != NodeFault && r.Class != Transient {
+		return fmt.Errorf("invalid error class %s", r.Class)
+	}
+	if (r.Code == 0) == (r.Status == 0) {
+		return errors.New("error rule must set either code or status")
+	}
+	if r.MaxCode != 0 && r.MaxCode < r.Code || r.MaxStatus != 0 && r.MaxStatus < r.Status {
+		return errors.New("error rule max value must not be lower than min value")
+	}
+	return nil
+}
+
+func matches(value int, min int, max int) bool {
+	if max == 0 {
+		return value == min
+	}
+	return value >= min && value <= max
+}
+
+var errorRules = DefaultErrorRules
+
+// SetErrorRules sets rules used to classify node errors, rules are checked before DefaultErrorRules
+// and first matching rule is applied
+func SetErrorRules(rules []ErrorRule) error {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	errorRules = append(append([]ErrorRule{}, rules...), DefaultErrorRules...)
+	return nil
+}
+
+// LoadErrorRules sets error rules from file on path, if path is empty DefaultErrorRules are used
+func LoadErrorRules(path string) error {
+	if path == "" {
+		return SetErrorRules(nil)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read error rules file %s because of %v", path, err)
+	}
+
+	var file ErrorRulesFile
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil {
+		return fmt.Errorf("invalid error rules file %s: %v", path, err)
+	}
+	return SetErrorRules(file.Rules)
+}
+
+// ClassifyError returns class of json rpc error returned by node
+func ClassifyError(rpcErr *RPCError) ErrorClass {
+	for _, rule := range errorRules {
+		if rule.Code != 0 && matches(rpcErr.Code, rule.Code, rule.MaxCode) {
+			return rule.Class
+		}
+	}
+	return UserError
+}
+
+// ClassifyStatus returns class of http status other than 200 returned by node
+func ClassifyStatus(status int) ErrorClass {
+	for _, rule := range errorRules {
+		if rule.Status != 0 && matches(status, rule.Status, rule.MaxStatus) {
+			return rule.Class
+		}
+	}
+	return NodeFault
+}
+
+// checkError returns node error if rpc error is not user error
+func checkError(rpcErr *RPCError) error {
+	if rpcErr == nil {
+		return nil
+	}
+	if class := ClassifyError(rpcErr); class != UserError {
+		return &NodeError{Class: class, err: fmt.Errorf("Invalid rpc code %d", rpcErr.Code)}
+	}
+	return nil
+}
+
+var (
+	defaultTimeout = RequestTimeout
+	methodTimeouts = map[string]time.Duration{}
+)
+
+// SetTimeouts sets timeout of requests toward nodes, methods without method timeout use default timeout
+func SetTimeouts(timeout time.Duration, timeouts map[string]time.Duration) {
+	defaultTimeout = timeout
+	methodTimeouts = timeouts
+}
+
+// Timeout returns longest timeout of provided methods, default timeout is returned if no method is provided
+func Timeout(methods ...string) time.Duration {
+	timeout := time.Duration(0)
+	for _, method := range methods {
+		methodTimeout, ok := methodTimeouts[method]
+		if !ok {
+			methodTimeout = defaultTimeout
+		}
+		if methodTimeout > timeout {
+			timeout = methodTimeout
+		}
+	}
+	if timeout == 0 {
+		return defaultTimeout
+	}
+	return timeout
+}
+
+// ParseTimeouts parses timeouts given as method names mapped to durations, e.g. {"state_queryStorage": "30s"}
+func ParseTimeouts(timeouts map[string]string) (map[string]time.Duration, error) {
+	parsed := make(map[string]time.Duration, len(timeouts))
+	for method, value := range timeouts {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %s for method %s", value, method)
+		}
+		parsed[method] = timeout
+	}
+	return parsed, nil
+}
+
+// WithTimeout returns context that is cancelled after timeout of provided methods
+func WithTimeout(ctx context.Context, methods ...string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, Timeout(methods...))
+}
@@ -0,0 +1,97 @@
+package rpc
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	defer func() { _ = SetErrorRules(nil) }()
+
+	tests := []struct {
+		name  string
+		rules []ErrorRule
+		code  int
+		want  ErrorClass
+	}{
+		{name: "internal error is node fault", code: InternalServerError, want: NodeFault},
+		{name: "server error is node fault", code: -32000, want: NodeFault},
+		{name: "invalid params is user error", code: -32602, want: UserError},
+		{name: "unknown error is user error", code: 1010, want: UserError},
+		{
+			name:  "rule overrides default rules",
+			rules: []ErrorRule{{Code: -32001, MaxCode: -32000, Class: Transient}},
+			code:  -32000,
+			want:  Transient,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, SetErrorRules(test.rules))
+			assert.Equal(t, test.want, ClassifyError(&RPCError{Code: test.code}))
+		})
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	assert.Equal(t, Transient, ClassifyStatus(http.StatusTooManyRequests))
+	assert.Equal(t, Transient, ClassifyStatus(http.StatusServiceUnavailable))
+	assert.Equal(t, NodeFault, ClassifyStatus(http.StatusInternalServerError))
+	assert.Equal(t, NodeFault, ClassifyStatus(http.StatusNotFound))
+}
+
+func TestClassOf(t *testing.T) {
+	_, err := CheckSingleRPCResponse([]byte(`{"id": 1, "error": {"code": -32000}}`))
+	assert.Equal(t, NodeFault, ClassOf(err))
+	_, err = CheckSingleRPCResponse([]byte(`{"id": 1, "error": {"code": -32602}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, NodeFault, ClassOf(errors.New("connection refused")))
+	assert.Equal(t, Transient, ClassOf(&NodeError{Class: Transient, err: errors.New("Status code 503 is not 200")}))
+}
+
+func TestCheckBatchRPCResponse_Classification(t *testing.T) {
+	_, err := CheckBatchRPCResponse([]byte(`[{"id": 1, "error": {"code": -32603}}, {"id": 2, "error": {"code": -32000}}]`))
+	assert.Error(t, err)
+	responses, err := CheckBatchRPCResponse([]byte(`[{"id": 1, "error": {"code": -32603}}, {"id": 2, "result": "0x"}]`))
+	assert.NoError(t, err)
+	assert.Len(t, responses, 2)
+}
+
+func TestLoadErrorRules(t *testing.T) {
+	defer func() { _ = SetErrorRules(nil) }()
+	dir, _ := ioutil.TempDir("", "rpc")
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "rules.json")
+
+	_ = ioutil.WriteFile(file, []byte(`{"rules": [{"status": 503, "class": "node-fault"}]}`), 0600)
+	assert.NoError(t, LoadErrorRules(file))
+	assert.Equal(t, NodeFault, ClassifyStatus(http.StatusServiceUnavailable))
+
+	for _, content := range []string{
+		`{"rules": [{"code": -32000, "class": "ignore"}]}`,
+		`{"rules": [{"code": -32000, "status": 500, "class": "transient"}]}`,
+		`{"rules": [{"code": -32000, "maxCode": -32099, "class": "transient"}]}`,
+	} {
+		_ = ioutil.WriteFile(file, []byte(content), 0600)
+		assert.Error(t, LoadErrorRules(file), content)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	SetTimeouts(time.Second, map[string]time.Duration{"state_queryStorage": 30 * time.Second})
+	defer SetTimeouts(RequestTimeout, map[string]time.Duration{})
+
+	assert.Equal(t, time.Second, Timeout())
+	assert.Equal(t, time.Second, Timeout("state_getStorage"))
+	assert.Equal(t, 30*time.Second, Timeout("state_getStorage", "state_queryStorage"))
+
+	_, err := ParseTimeouts(map[string]string{"state_queryStorage": "-1s"})
+	assert.Error(t, err)
+}
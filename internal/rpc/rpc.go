@@ -2,43 +2,176 @@ package rpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/nodeclient"
 )
 
 type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int              `json:"code"`
+	Message string           `json:"message"`
+	Data    *json.RawMessage `json:"data,omitempty"`
 }
 
 type RPCResponse struct {
 	JSONRPC string           `json:"jsonrpc"`
-	ID      uint64           `json:"id"`
+	ID      json.RawMessage  `json:"id"`
 	Result  *json.RawMessage `json:"result,omitempty"`
 	Error   *RPCError        `json:"error,omitempty"`
 }
 
+// RPCRequest is single json rpc request, id and params are kept as raw json so they are forwarded
+// to node unchanged. Request without id is notification.
 type RPCRequest struct {
-	JSONRPC string      `json:"jsonrpc"`
-	ID      uint64      `json:"id"`
-	Method  string      `json:"method,omitempty"`
-	Params  interface{} `json:"params,omitempty"`
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
 }
 
 const (
 	InternalServerError = -32603
 	ParseError          = -32700
 	InvalidRequest      = -32600
+	MethodNotFound      = -32601
+	LimitExceeded       = -32005
+	Unauthorized        = -32001
 
+	// RequestTimeout is default timeout of requests toward nodes
 	RequestTimeout = 3 * time.Second
+
+	DefaultRetryBudget = 3
+
+	DefaultSubBatchSize = 100
+
+	DefaultMaxRequestSize = 10 * 1024 * 1024
+	DefaultMaxBatchLength = 1000
+	DefaultMaxWSFrameSize = 10 * 1024 * 1024
 )
 
+var nullID = json.RawMessage("null")
+
+// RetryHint is data of LimitExceeded errors telling client after how many seconds request can be retried
+type RetryHint struct {
+	RetryAfter int `json:"retryAfter"`
+}
+
+// NewLimitExceededError returns LimitExceeded error with retry hint rounded up to whole seconds
+func NewLimitExceededError(message string, retryAfter time.Duration) *RPCError {
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	data, _ := json.Marshal(RetryHint{RetryAfter: seconds})
+	raw := json.RawMessage(data)
+	return &RPCError{Code: LimitExceeded, Message: message, Data: &raw}
+}
+
+// RetryAfter returns retry hint of error in seconds, 0 is returned if error has no retry hint
+func (e *RPCError) RetryAfter() int {
+	if e.Data == nil {
+		return 0
+	}
+	var hint RetryHint
+	if json.Unmarshal(*e.Data, &hint) != nil {
+		return 0
+	}
+	return hint.RetryAfter
+}
+
+// IsNotification returns if request is notification, meaning client doesn't expect response
+func (r RPCRequest) IsNotification() bool {
+	return r.ID == nil
+}
+
+// validate checks if request is valid json rpc 2.0 request object
+func (r RPCRequest) validate() error {
+	if r.JSONRPC != "2.0" {
+		return errors.New("jsonrpc must be exactly \"2.0\"")
+	}
+	if r.Method == "" {
+		return errors.New("method must be non empty string")
+	}
+	if r.ID != nil && !isValidID(r.ID) {
+		return errors.New("id must be string, number or null")
+	}
+	if r.Params != nil {
+		params := bytes.TrimSpace(r.Params)
+		if !bytes.Equal(params, nullID) && (len(params) == 0 || (params[0] != '[' && params[0] != '{')) {
+			return errors.New("params must be array or object")
+		}
+	}
+	return nil
+}
+
+// requestFields are keys of json rpc request object
+var requestFields = map[string]bool{"jsonrpc": true, "id": true, "method": true, "params": true}
+
+// checkKeys rejects request objects with duplicate keys or with keys that differ from request fields
+// only in case. Such keys are matched differently by json.Unmarshal and by node json parser, so
+// method checked by load balancer could differ from method executed by node.
+func checkKeys(element json.RawMessage) error {
+	decoder := json.NewDecoder(bytes.NewReader(element))
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('{') {
+		return errors.New("request must be object")
+	}
+	seen := make(map[string]bool)
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		folded := strings.ToLower(key)
+		if seen[folded] {
+			return fmt.Errorf("duplicate key %s", key)
+		}
+		if requestFields[folded] && key != folded {
+			return fmt.Errorf("unknown key %s", key)
+		}
+		seen[folded] = true
+
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isValidID(id json.RawMessage) bool {
+	id = bytes.TrimSpace(id)
+	if len(id) == 0 {
+		return false
+	}
+	switch c := id[0]; {
+	case c == '"', c == '-', c >= '0' && c <= '9':
+		return true
+	default:
+		return bytes.Equal(id, nullID)
+	}
+}
+
+// IDKey returns canonical representation of id that can be used for matching responses to requests
+func IDKey(id json.RawMessage) string {
+	var buffer bytes.Buffer
+	if json.Compact(&buffer, id) != nil {
+		return string(id)
+	}
+	return buffer.String()
+}
+
 // IsBatch returns if request contains batch rpc requests
 func IsBatch(reqBody []byte) bool {
 	x := bytes.TrimLeft(reqBody, " \t\r\n")
@@ -49,7 +182,69 @@ func IsBatch(reqBody []byte) bool {
 	return false
 }
 
-func createSingleRPCError(id uint64, code int, message string) RPCResponse {
+// ParseRequest parses non batch request, returns error response if request is not valid json
+// or valid json rpc request
+func ParseRequest(reqBody []byte) (RPCRequest, *RPCResponse) {
+	if !json.Valid(reqBody) {
+		errResponse := CreateSingleRPCError(nil, ParseError, "Parse error")
+		return RPCRequest{}, &errResponse
+	}
+
+	return parseElement(reqBody)
+}
+
+// ParseBatch parses batch request. If batch is valid, returns parsed elements and for each element that is not
+// valid json rpc request InvalidRequest error response on same position. If whole batch is invalid or empty,
+// returns single error response.
+func ParseBatch(reqBody []byte) ([]RPCRequest, []*RPCResponse, *RPCResponse) {
+	var elements []json.RawMessage
+	err := json.Unmarshal(reqBody, &elements)
+	if err != nil {
+		errResponse := CreateSingleRPCError(nil, ParseError, "Parse error")
+		return nil, nil, &errResponse
+	}
+	if len(elements) == 0 {
+		errResponse := CreateSingleRPCError(nil, InvalidRequest, "Invalid Request")
+		return nil, nil, &errResponse
+	}
+
+	requests := make([]RPCRequest, len(elements))
+	errResponses := make([]*RPCResponse, len(elements))
+	for i, element := range elements {
+		requests[i], errResponses[i] = parseElement(element)
+	}
+	return requests, errResponses, nil
+}
+
+func parseElement(element json.RawMessage) (RPCRequest, *RPCResponse) {
+	var request RPCRequest
+	err := checkKeys(element)
+	if err == nil {
+		err = json.Unmarshal(element, &request)
+	}
+	if err == nil {
+		err = request.validate()
+	}
+	if err != nil {
+		// id is returned only if it can be read from invalid request
+		var id json.RawMessage
+		var withID struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(element, &withID) == nil && withID.ID != nil && isValidID(withID.ID) {
+			id = withID.ID
+		}
+		errResponse := CreateSingleRPCError(id, InvalidRequest, "Invalid Request")
+		return RPCRequest{}, &errResponse
+	}
+	return request, nil
+}
+
+// CreateSingleRPCError returns rpc error response for request id, missing id is returned as null
+func CreateSingleRPCError(id json.RawMessage, code int, message string) RPCResponse {
+	if id == nil {
+		id = nullID
+	}
 	return RPCResponse{
 		ID: id,
 		Error: &RPCError{
@@ -60,36 +255,48 @@ func createSingleRPCError(id uint64, code int, message string) RPCResponse {
 	}
 }
 
-// CreateRPCError returns rpc errors for appropriate request ids
+// CreateRPCErrorResponse returns response with rpc error for request id, error data is kept
+func CreateRPCErrorResponse(id json.RawMessage, rpcErr *RPCError) RPCResponse {
+	response := CreateSingleRPCError(id, rpcErr.Code, rpcErr.Message)
+	response.Error.Data = rpcErr.Data
+	return response
+}
+
+// CreateRPCError returns rpc errors for appropriate request ids, notifications are skipped
+// as they must not be answered
 func CreateRPCError(isBatch bool, reqRPCBody RPCRequest, reqRPCBodies []RPCRequest, code int, message string) interface{} {
 	if !isBatch {
-		return createSingleRPCError(reqRPCBody.ID, code, message)
+		return CreateSingleRPCError(reqRPCBody.ID, code, message)
 	}
 
-	rpcResponses := make([]RPCResponse, len(reqRPCBodies))
-	for i, body := range reqRPCBodies {
-		rpcResponses[i] = createSingleRPCError(body.ID, code, message)
+	rpcResponses := make([]RPCResponse, 0, len(reqRPCBodies))
+	for _, body := range reqRPCBodies {
+		if body.IsNotification() {
+			continue
+		}
+		rpcResponses = append(rpcResponses, CreateSingleRPCError(body.ID, code, message))
 	}
 	return rpcResponses
 }
 
-// CheckSingleRPCResponse checks for errors in non batch rpc response
+// CheckSingleRPCResponse checks for errors in non batch rpc response, NodeError is returned if
+// response contains error that is not user error
 func CheckSingleRPCResponse(body []byte) (RPCResponse, error) {
 	var rpcResponse RPCResponse
 
 	err := json.Unmarshal(body, &rpcResponse)
 	if err != nil {
 		return RPCResponse{}, err
-	} else if rpcResponse.Error != nil {
-		if rpcResponse.Error.Code == InternalServerError {
-			return RPCResponse{}, fmt.Errorf("Invalid rpc code %d", InternalServerError)
-		}
+	} else if err = checkError(rpcResponse.Error); err != nil {
+		return RPCResponse{}, err
 	}
 
 	return rpcResponse, nil
 }
 
-// CheckBatchRPCResponse checks for errors in batch rpc response
+// CheckBatchRPCResponse checks for errors in batch rpc response, NodeError is returned if all responses
+// contain errors that are not user errors. Responses have to be classified separately with ClassifyError
+// if only some of them contain such errors.
 func CheckBatchRPCResponse(body []byte) ([]RPCResponse, error) {
 	var rpcResponses []RPCResponse
 
@@ -98,45 +305,224 @@ func CheckBatchRPCResponse(body []byte) ([]RPCResponse, error) {
 		return nil, err
 	}
 
+	var firstErr error
+	for _, rpcResponse := range rpcResponses {
+		err = checkError(rpcResponse.Error)
+		if err == nil {
+			return rpcResponses, nil
+		}
+		if firstErr == nil || ClassOf(err) == NodeFault {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
 	return rpcResponses, nil
 }
 
 // SendRequestToNode routes request to node and checks response
 func SendRequestToNode(isBatch bool, nodeID string, reqBody []byte) ([]byte, error) {
+	return SendRequestToNodeContext(context.Background(), isBatch, nodeID, reqBody)
+}
+
+// SendRequestToNodeContext routes request to node same as SendRequestToNode, request is cancelled when ctx is done
+func SendRequestToNodeContext(ctx context.Context, isBatch bool, nodeID string, reqBody []byte) ([]byte, error) {
+	body, err := postToNode(ctx, nodeID, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if isBatch {
+		_, err = CheckBatchRPCResponse(body)
+	} else {
+		_, err = CheckSingleRPCResponse(body)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// SendNotificationToNode routes notification or batch of notifications to node, node response is
+// ignored as notifications are not answered
+func SendNotificationToNode(nodeID string, reqBody []byte) error {
+	_, err := postToNode(context.Background(), nodeID, reqBody)
+	return err
+}
+
+func postToNode(ctx context.Context, nodeID string, reqBody []byte) ([]byte, error) {
+	resp, err := openNodeResponse(ctx, nodeID, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// openNodeResponse posts request to node and returns response with status 200, caller must close
+// response body
+func openNodeResponse(ctx context.Context, nodeID string, reqBody []byte) (*http.Response, error) {
 	port, err := configuration.Config.PortPool.GetHTTPPort(nodeID)
 	if err != nil {
 		return nil, err
 	}
 
 	client := http.Client{
-		Timeout: RequestTimeout,
+		Transport: nodeclient.Transport(port),
+	}
+	// requests with deadline are limited by their context
+	if _, ok := ctx.Deadline(); !ok {
+		client.Timeout = Timeout()
 	}
-	resp, err := client.Post(
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
 		"http://127.0.0.1:"+strconv.Itoa(port)+"/",
-		"application/json",
 		bytes.NewBuffer(reqBody),
 	)
 	if err != nil {
 		return nil, err
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Status code is not 200")
 	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 
-	if isBatch {
-		_, err = CheckBatchRPCResponse(body)
-	} else {
-		_, err = CheckSingleRPCResponse(body)
+	if resp.StatusCode != http.StatusOK {
+		// body must be fully read and closed so connection can be reused by transport
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, &NodeError{
+			Class: ClassifyStatus(resp.StatusCode),
+			err:   fmt.Errorf("Status code %d is not 200", resp.StatusCode),
+		}
+	}
+	return resp, nil
+}
+
+// StreamRequestToNode routes non batch request to node and streams its response to w. Response is
+// checked same as in SendRequestToNode, but only until result field is reached, so nothing is written
+// to w if node returned error and request can be routed to other node. Returned started flag tells
+// if response was partially written when error occurred, in which case request can't be retried.
+func StreamRequestToNode(nodeID string, reqBody []byte, w io.Writer) (started bool, err error) {
+	response, err := OpenRequestToNode(context.Background(), nodeID, reqBody)
+	if err != nil {
+		return false, err
 	}
+	defer response.Close()
+	return true, response.Stream(w)
+}
+
+// NodeResponse is node response to non batch request whose start is checked, rest of response
+// is not read until it is streamed
+type NodeResponse struct {
+	prefix []byte
+	body   io.ReadCloser
+}
 
+// OpenRequestToNode routes non batch request to node and checks start of its response same as
+// StreamRequestToNode, without writing anything. Request is cancelled when ctx is done, so ctx
+// must not be cancelled before response is streamed. Caller must close returned response.
+func OpenRequestToNode(ctx context.Context, nodeID string, reqBody []byte) (*NodeResponse, error) {
+	resp, err := openNodeResponse(ctx, nodeID, reqBody)
 	if err != nil {
 		return nil, err
 	}
 
-	return body, nil
+	prefix, err := checkResponseStart(resp.Body)
+	if err != nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return &NodeResponse{prefix: prefix, body: resp.Body}, nil
+}
+
+// Stream writes whole response to w, ClientWriteError is returned if writing to w failed
+func (r *NodeResponse) Stream(w io.Writer) error {
+	if _, err := w.Write(r.prefix); err != nil {
+		return &ClientWriteError{err: err}
+	}
+	body := &errorRecordingReader{reader: r.body}
+	_, err := io.Copy(w, body)
+	if err != nil && body.err == nil {
+		return &ClientWriteError{err: err}
+	}
+	return err
+}
+
+// Close closes response body
+func (r *NodeResponse) Close() error {
+	return r.body.Close()
+}
+
+// ClientWriteError is returned if streamed response couldn't be written to client, meaning node
+// response was valid
+type ClientWriteError struct {
+	err error
+}
+
+func (e *ClientWriteError) Error() string {
+	return fmt.Sprintf("writing response to client failed: %v", e.err)
+}
+
+// errorRecordingReader records read error so node errors can be told apart from client errors
+type errorRecordingReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *errorRecordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// checkResponseStart reads top level fields of response until result field is reached and returns
+// bytes read from body. Error is returned if response is not json object or if it contains error that
+// is not user error, same as in CheckSingleRPCResponse.
+func checkResponseStart(body io.Reader) ([]byte, error) {
+	var prefix bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(body, &prefix))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("response is not json object")
+	}
+	for decoder.More() {
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token == "result" {
+			return prefix.Bytes(), nil
+		}
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if token == "error" {
+			var rpcError *RPCError
+			if err = json.Unmarshal(value, &rpcError); err != nil {
+				return nil, err
+			}
+			if err = checkError(rpcError); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err = decoder.Token(); err != nil {
+		return nil, err
+	}
+	return prefix.Bytes(), nil
 }
@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,11 +10,13 @@ import (
 	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/NodeFactoryIo/vedran/internal/configuration"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -193,12 +196,20 @@ func TestCreateRPCError(t *testing.T) {
 	}{
 		{
 			name: "Returns single error if it is not batch",
-			args: args{false, RPCRequest{ID: 3}, []RPCRequest{}, -32300, "Error"},
-			want: RPCResponse{JSONRPC: "2.0", ID: 3, Error: &RPCError{Code: -32300, Message: "Error"}}},
+			args: args{false, RPCRequest{ID: json.RawMessage("3")}, []RPCRequest{}, -32300, "Error"},
+			want: RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("3"), Error: &RPCError{Code: -32300, Message: "Error"}}},
 		{
 			name: "Returns array of errors if they are batch",
-			args: args{true, RPCRequest{}, []RPCRequest{{ID: 3}}, -32300, "Error"},
-			want: []RPCResponse{{JSONRPC: "2.0", ID: 3, Error: &RPCError{Code: -32300, Message: "Error"}}}},
+			args: args{true, RPCRequest{}, []RPCRequest{{ID: json.RawMessage("3")}}, -32300, "Error"},
+			want: []RPCResponse{{JSONRPC: "2.0", ID: json.RawMessage("3"), Error: &RPCError{Code: -32300, Message: "Error"}}}},
+		{
+			name: "Returns null id if request id is missing",
+			args: args{false, RPCRequest{}, []RPCRequest{}, -32300, "Error"},
+			want: RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: -32300, Message: "Error"}}},
+		{
+			name: "Skips notifications in batch",
+			args: args{true, RPCRequest{}, []RPCRequest{{ID: json.RawMessage(`"a"`)}, {}}, -32300, "Error"},
+			want: []RPCResponse{{JSONRPC: "2.0", ID: json.RawMessage(`"a"`), Error: &RPCError{Code: -32300, Message: "Error"}}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -234,7 +245,7 @@ func TestCheckSingleRPCResponse(t *testing.T) {
 		{
 			name:    "Returns rpc response if valid",
 			args:    args{[]byte(`{"id": 1}`)},
-			want:    RPCResponse{ID: 1},
+			want:    RPCResponse{ID: json.RawMessage("1")},
 			wantErr: false},
 	}
 	for _, tt := range tests {
@@ -269,7 +280,7 @@ func TestCheckBatchRPCResponse(t *testing.T) {
 		{
 			name:    "Returns rpc response if valid",
 			args:    args{[]byte(`[{"id": 1}]`)},
-			want:    []RPCResponse{{ID: 1}},
+			want:    []RPCResponse{{ID: json.RawMessage("1")}},
 			wantErr: false},
 	}
 	for _, tt := range tests {
@@ -285,3 +296,186 @@ func TestCheckBatchRPCResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		reqBody         string
+		wantRequest     RPCRequest
+		wantErrResponse *RPCResponse
+	}{
+		{
+			name:        "Parses request with number id",
+			reqBody:     `{"jsonrpc": "2.0", "id": 1, "method": "system_health"}`,
+			wantRequest: RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: "system_health"},
+		},
+		{
+			name:    "Parses request with string id and params",
+			reqBody: `{"jsonrpc": "2.0", "id": "abc", "method": "chain_getBlockHash", "params": [1]}`,
+			wantRequest: RPCRequest{
+				JSONRPC: "2.0", ID: json.RawMessage(`"abc"`), Method: "chain_getBlockHash", Params: json.RawMessage("[1]"),
+			},
+		},
+		{
+			name:        "Parses request with null id",
+			reqBody:     `{"jsonrpc": "2.0", "id": null, "method": "system_health"}`,
+			wantRequest: RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("null"), Method: "system_health"},
+		},
+		{
+			name:        "Parses notification",
+			reqBody:     `{"jsonrpc": "2.0", "method": "author_submitExtrinsic", "params": ["0x00"]}`,
+			wantRequest: RPCRequest{JSONRPC: "2.0", Method: "author_submitExtrinsic", Params: json.RawMessage(`["0x00"]`)},
+		},
+		{
+			name:            "Returns parse error if json invalid",
+			reqBody:         `{"jsonrpc": "2.0", "method"`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: ParseError, Message: "Parse error"}},
+		},
+		{
+			name:            "Returns invalid request error with id if method missing",
+			reqBody:         `{"jsonrpc": "2.0", "id": "x"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage(`"x"`), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error if version invalid",
+			reqBody:         `{"jsonrpc": "1.0", "id": 1, "method": "system_health"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("1"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error with null id if id invalid",
+			reqBody:         `{"jsonrpc": "2.0", "id": {}, "method": "system_health"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error if params are not structured",
+			reqBody:         `{"jsonrpc": "2.0", "id": 1, "method": "system_health", "params": "x"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("1"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error if request is not object",
+			reqBody:         `1`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error if method key is duplicated",
+			reqBody:         `{"jsonrpc": "2.0", "id": 1, "method": "author_rotateKeys", "method": "system_health"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("1"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns invalid request error if method key differs in case",
+			reqBody:         `{"jsonrpc": "2.0", "id": 1, "method": "author_rotateKeys", "Method": "system_health"}`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("1"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, errResponse := ParseRequest([]byte(tt.reqBody))
+			if !reflect.DeepEqual(errResponse, tt.wantErrResponse) {
+				t.Errorf("ParseRequest() error response = %v, want %v", errResponse, tt.wantErrResponse)
+			}
+			if tt.wantErrResponse == nil && !reflect.DeepEqual(request, tt.wantRequest) {
+				t.Errorf("ParseRequest() = %v, want %v", request, tt.wantRequest)
+			}
+		})
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	tests := []struct {
+		name             string
+		reqBody          string
+		wantRequests     int
+		wantErrResponses []bool
+		wantErrResponse  *RPCResponse
+	}{
+		{
+			name:             "Parses batch with invalid elements",
+			reqBody:          `[{"jsonrpc": "2.0", "id": 1, "method": "system_health"}, 1, {"jsonrpc": "2.0"}, {"jsonrpc": "2.0", "method": "a"}]`,
+			wantRequests:     4,
+			wantErrResponses: []bool{false, true, true, false},
+		},
+		{
+			name:            "Returns invalid request error if batch is empty",
+			reqBody:         `[]`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: InvalidRequest, Message: "Invalid Request"}},
+		},
+		{
+			name:            "Returns parse error if json invalid",
+			reqBody:         `[{"jsonrpc": "2.0", "method"`,
+			wantErrResponse: &RPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: ParseError, Message: "Parse error"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, errResponses, errResponse := ParseBatch([]byte(tt.reqBody))
+			if !reflect.DeepEqual(errResponse, tt.wantErrResponse) {
+				t.Errorf("ParseBatch() error response = %v, want %v", errResponse, tt.wantErrResponse)
+			}
+			if len(requests) != tt.wantRequests {
+				t.Errorf("ParseBatch() returned %d requests, want %d", len(requests), tt.wantRequests)
+			}
+			for i, wantErr := range tt.wantErrResponses {
+				if (errResponses[i] != nil) != wantErr {
+					t.Errorf("ParseBatch() element %d error response = %v, want error %v", i, errResponses[i], wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamRequestToNode(t *testing.T) {
+	largeResult := `"0x` + strings.Repeat("ab", 100000) + `"`
+	tests := []struct {
+		name        string
+		response    string
+		wantErr     bool
+		wantWritten string
+	}{
+		{
+			name:        "Streams response with result",
+			response:    `{"jsonrpc":"2.0","result":` + largeResult + `,"id":1}`,
+			wantWritten: `{"jsonrpc":"2.0","result":` + largeResult + `,"id":1}`,
+		},
+		{
+			name:        "Streams error response that is not internal error",
+			response:    `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":1}`,
+			wantWritten: `{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"},"id":1}`,
+		},
+		{
+			name:     "Returns error without writing if node returns internal error",
+			response: `{"jsonrpc":"2.0","error":{"code":-32603,"message":"Internal error"},"id":1}`,
+			wantErr:  true,
+		},
+		{
+			name:     "Returns error without writing if response is not json object",
+			response: `[{"jsonrpc":"2.0","result":"0x","id":1}]`,
+			wantErr:  true,
+		},
+		{
+			name:     "Returns error without writing if response is invalid json",
+			response: `{"jsonrpc":"2.0",`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, tt.response)
+			}))
+			defer nodeServer.Close()
+
+			serverURL, _ := url.Parse(nodeServer.URL)
+			port, _ := strconv.Atoi(serverURL.Port())
+			poolerMock := &tunnelMocks.Pooler{}
+			poolerMock.On("GetHTTPPort", "1").Return(port, nil)
+			configuration.Config.PortPool = poolerMock
+
+			var written bytes.Buffer
+			started, err := StreamRequestToNode("1", []byte(`{}`), &written)
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, !tt.wantErr, started)
+			assert.Equal(t, tt.wantWritten, written.String())
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package rpccache
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSize = 10000
+)
+
+var nullResult = []byte("null")
+
+// Cache holds results of block addressed rpc requests that can't change because they refer to finalized blocks.
+// Results are only stored after they are proven to be at or below finalized height tracked by load balancer.
+type Cache struct {
+	mutex           sync.Mutex
+	results         *lru
+	finalizedHashes *lru
+	finalizedHeight int64
+	hits            uint64
+	misses          uint64
+}
+
+// NewCache creates cache that holds up to size results, size 0 disables caching
+func NewCache(size int) *Cache {
+	return &Cache{
+		results:         newLRU(size),
+		finalizedHashes: newLRU(size),
+	}
+}
+
+// SetFinalizedHeight sets latest finalized block height, height can't be decreased
+func (c *Cache) SetFinalizedHeight(height int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if height > c.finalizedHeight {
+		c.finalizedHeight = height
+	}
+}
+
+// AddFinalizedHash marks block hash as finalized if height is not above tracked finalized height
+func (c *Cache) AddFinalizedHash(hash string, height int64) {
+	key, ok := blockHashParam([]interface{}{hash})
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if height <= c.finalizedHeight {
+		c.finalizedHashes.add(key, height)
+	}
+}
+
+// Get returns cached result for request, hits and misses are only counted for block addressed requests
+func (c *Cache) Get(request rpc.RPCRequest) (json.RawMessage, bool) {
+	key, ok := requestKey(request.Method, decodeParams(request.Params))
+	if !ok || c.results.size <= 0 {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	result, ok := c.results.get(key)
+	c.mutex.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return result.(json.RawMessage), true
+}
+
+// Cacheable returns if response of request could be cached
+func (c *Cache) Cacheable(request rpc.RPCRequest) bool {
+	_, ok := requestKey(request.Method, decodeParams(request.Params))
+	return ok && c.results.size > 0
+}
+
+// Put stores result of successful node response if request is block addressed and result is proven immutable
+func (c *Cache) Put(request rpc.RPCRequest, response []byte) {
+	key, ok := requestKey(request.Method, decodeParams(request.Params))
+	if !ok || c.results.size <= 0 {
+		return
+	}
+
+	var rpcResponse rpc.RPCResponse
+	err := json.Unmarshal(response, &rpcResponse)
+	if err != nil || rpcResponse.Error != nil || rpcResponse.Result == nil {
+		return
+	}
+	result := *rpcResponse.Result
+	if bytes.Equal(bytes.TrimSpace(result), nullResult) {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.isImmutable(request, result) {
+		return
+	}
+	c.results.add(key, result)
+	log.Debugf("Cached %s response", key)
+}
+
+// isImmutable checks if result refers to finalized block, mutex must be held by caller
+func (c *Cache) isImmutable(request rpc.RPCRequest, result json.RawMessage) bool {
+	params := decodeParams(request.Params)
+	switch request.Method {
+	case getBlockHash:
+		number, _ := blockNumberParam(params)
+		if number > c.finalizedHeight {
+			return false
+		}
+		var hash string
+		if err := json.Unmarshal(result, &hash); err == nil {
+			if key, ok := blockHashParam([]interface{}{hash}); ok {
+				c.finalizedHashes.add(key, number)
+			}
+		}
+		return true
+	case getHeader, getBlock:
+		number, ok := resultBlockNumber(request.Method, result)
+		if !ok || number > c.finalizedHeight {
+			return false
+		}
+		hash, _ := blockHashParam(params)
+		c.finalizedHashes.add(hash, number)
+		return true
+	default:
+		// state queries don't contain block number so block hash must already be known as finalized
+		hash, _ := blockHashParam(params)
+		_, ok := c.finalizedHashes.get(hash)
+		return ok
+	}
+}
+
+// Len returns number of cached results
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.results.len()
+}
+
+// Hits returns number of block addressed requests served from cache
+func (c *Cache) Hits() uint64 {
+	return atomic.LoadUint64(&c.hits)
+}
+
+// Misses returns number of block addressed requests that weren't found in cache
+func (c *Cache) Misses() uint64 {
+	return atomic.LoadUint64(&c.misses)
+}
+
+var cache = NewCache(DefaultSize)
+
+// Init replaces default cache with cache that holds up to size results
+func Init(size int) {
+	cache = NewCache(size)
+}
+
+// Get returns cached result for request from default cache
+func Get(request rpc.RPCRequest) (json.RawMessage, bool) {
+	return cache.Get(request)
+}
+
+// Cacheable returns if response of request could be cached in default cache
+func Cacheable(request rpc.RPCRequest) bool {
+	return cache.Cacheable(request)
+}
+
+// Put stores node response for request in default cache if it is immutable
+func Put(request rpc.RPCRequest, response []byte) {
+	cache.Put(request, response)
+}
+
+// SetFinalizedHeight sets latest finalized block height on default cache
+func SetFinalizedHeight(height int64) {
+	cache.SetFinalizedHeight(height)
+}
+
+// AddFinalizedHash marks block hash as finalized on default cache
+func AddFinalizedHash(hash string, height int64) {
+	cache.AddFinalizedHash(hash, height)
+}
+
+// Len returns number of results in default cache
+func Len() int {
+	return cache.Len()
+}
+
+// Hits returns number of hits on default cache
+func Hits() uint64 {
+	return cache.Hits()
+}
+
+// Misses returns number of misses on default cache
+func Misses() uint64 {
+	return cache.Misses()
+}
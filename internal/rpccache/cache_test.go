@@ -0,0 +1,190 @@
+package rpccache
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	finalizedHash = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	unknownHash   = "0x2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func request(method string, params ...interface{}) rpc.RPCRequest {
+	rawParams, _ := json.Marshal(params)
+	return rpc.RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: rawParams}
+}
+
+func response(result string) []byte {
+	return []byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`)
+}
+
+func TestCache_PutAndGet(t *testing.T) {
+	tests := []struct {
+		name          string
+		putRequest    rpc.RPCRequest
+		putResponse   []byte
+		getRequest    rpc.RPCRequest
+		expectedFound bool
+	}{
+		{
+			name:          "block hash below finalized height is cached",
+			putRequest:    request("chain_getBlockHash", 90),
+			putResponse:   response(`"` + unknownHash + `"`),
+			getRequest:    request("chain_getBlockHash", "0x5a"),
+			expectedFound: true,
+		},
+		{
+			name:          "block hash above finalized height is not cached",
+			putRequest:    request("chain_getBlockHash", 101),
+			putResponse:   response(`"` + unknownHash + `"`),
+			getRequest:    request("chain_getBlockHash", 101),
+			expectedFound: false,
+		},
+		{
+			name:          "block hash without params is not cached",
+			putRequest:    request("chain_getBlockHash"),
+			putResponse:   response(`"` + unknownHash + `"`),
+			getRequest:    request("chain_getBlockHash"),
+			expectedFound: false,
+		},
+		{
+			name:          "finalized header by hash is cached",
+			putRequest:    request("chain_getHeader", unknownHash),
+			putResponse:   response(`{"number":"0x50"}`),
+			getRequest:    request("chain_getHeader", unknownHash),
+			expectedFound: true,
+		},
+		{
+			name:          "unfinalized header by hash is not cached",
+			putRequest:    request("chain_getHeader", unknownHash),
+			putResponse:   response(`{"number":"0x70"}`),
+			getRequest:    request("chain_getHeader", unknownHash),
+			expectedFound: false,
+		},
+		{
+			name:          "finalized block by hash is cached",
+			putRequest:    request("chain_getBlock", unknownHash),
+			putResponse:   response(`{"block":{"header":{"number":"0x50"},"extrinsics":[]}}`),
+			getRequest:    request("chain_getBlock", unknownHash),
+			expectedFound: true,
+		},
+		{
+			name:          "metadata at finalized hash is cached",
+			putRequest:    request("state_getMetadata", finalizedHash),
+			putResponse:   response(`"0x6d657461"`),
+			getRequest:    request("state_getMetadata", finalizedHash),
+			expectedFound: true,
+		},
+		{
+			name:          "runtime version alias shares cached result",
+			putRequest:    request("state_getRuntimeVersion", finalizedHash),
+			putResponse:   response(`{"specVersion":1}`),
+			getRequest:    request("chain_getRuntimeVersion", finalizedHash),
+			expectedFound: true,
+		},
+		{
+			name:          "metadata at unknown hash is not cached",
+			putRequest:    request("state_getMetadata", unknownHash),
+			putResponse:   response(`"0x6d657461"`),
+			getRequest:    request("state_getMetadata", unknownHash),
+			expectedFound: false,
+		},
+		{
+			name:          "error response is not cached",
+			putRequest:    request("chain_getBlockHash", 90),
+			putResponse:   []byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"Invalid params"}}`),
+			getRequest:    request("chain_getBlockHash", 90),
+			expectedFound: false,
+		},
+		{
+			name:          "null result is not cached",
+			putRequest:    request("chain_getHeader", unknownHash),
+			putResponse:   response(`null`),
+			getRequest:    request("chain_getHeader", unknownHash),
+			expectedFound: false,
+		},
+		{
+			name:          "mutable method is not cached",
+			putRequest:    request("system_health"),
+			putResponse:   response(`{"peers":1}`),
+			getRequest:    request("system_health"),
+			expectedFound: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewCache(10)
+			cache.SetFinalizedHeight(100)
+			cache.AddFinalizedHash(finalizedHash, 100)
+
+			cache.Put(test.putRequest, test.putResponse)
+			_, found := cache.Get(test.getRequest)
+
+			assert.Equal(t, test.expectedFound, found)
+		})
+	}
+}
+
+func TestCache_HitsAndMisses(t *testing.T) {
+	cache := NewCache(10)
+	cache.SetFinalizedHeight(100)
+
+	_, found := cache.Get(request("chain_getBlockHash", 10))
+	assert.False(t, found)
+	cache.Put(request("chain_getBlockHash", 10), response(`"`+unknownHash+`"`))
+	result, found := cache.Get(request("chain_getBlockHash", 10))
+	assert.True(t, found)
+	assert.Equal(t, json.RawMessage(`"`+unknownHash+`"`), result)
+
+	// requests that can't be cached are not counted
+	_, _ = cache.Get(request("system_health"))
+
+	assert.Equal(t, uint64(1), cache.Hits())
+	assert.Equal(t, uint64(1), cache.Misses())
+}
+
+func TestCache_Eviction(t *testing.T) {
+	cache := NewCache(2)
+	cache.SetFinalizedHeight(100)
+
+	cache.Put(request("chain_getBlockHash", 1), response(`"0x01"`))
+	cache.Put(request("chain_getBlockHash", 2), response(`"0x02"`))
+	// use first entry so second one is least recently used
+	_, _ = cache.Get(request("chain_getBlockHash", 1))
+	cache.Put(request("chain_getBlockHash", 3), response(`"0x03"`))
+
+	assert.Equal(t, 2, cache.Len())
+	_, found := cache.Get(request("chain_getBlockHash", 1))
+	assert.True(t, found)
+	_, found = cache.Get(request("chain_getBlockHash", 2))
+	assert.False(t, found)
+	_, found = cache.Get(request("chain_getBlockHash", 3))
+	assert.True(t, found)
+}
+
+func TestCache_Disabled(t *testing.T) {
+	cache := NewCache(0)
+	cache.SetFinalizedHeight(100)
+
+	cache.Put(request("chain_getBlockHash", 1), response(`"0x01"`))
+	_, found := cache.Get(request("chain_getBlockHash", 1))
+
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, uint64(0), cache.Misses())
+}
+
+func TestCache_FinalizedHeightDoesNotDecrease(t *testing.T) {
+	cache := NewCache(10)
+	cache.SetFinalizedHeight(100)
+	cache.SetFinalizedHeight(50)
+
+	cache.Put(request("chain_getBlockHash", 90), response(`"`+unknownHash+`"`))
+	_, found := cache.Get(request("chain_getBlockHash", 90))
+
+	assert.True(t, found)
+}
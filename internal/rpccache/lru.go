@@ -0,0 +1,57 @@
+package rpccache
+
+import (
+	"container/list"
+)
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+// lru is size bounded map that evicts least recently used entry when full, it is not safe for concurrent use
+type lru struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (interface{}, bool) {
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+	return element.Value.(*lruEntry).value, true
+}
+
+func (l *lru) add(key string, value interface{}) {
+	if l.size <= 0 {
+		return
+	}
+
+	if element, ok := l.entries[key]; ok {
+		element.Value.(*lruEntry).value = value
+		l.order.MoveToFront(element)
+		return
+	}
+
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, value: value})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *lru) len() int {
+	return l.order.Len()
+}
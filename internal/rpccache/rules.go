@@ -0,0 +1,141 @@
+package rpccache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	getBlockHash      = "chain_getBlockHash"
+	getHeader         = "chain_getHeader"
+	getBlock          = "chain_getBlock"
+	getMetadata       = "state_getMetadata"
+	getRuntimeVersion = "state_getRuntimeVersion"
+	// chain_getRuntimeVersion is deprecated alias for state_getRuntimeVersion
+	getRuntimeVersionAlias = "chain_getRuntimeVersion"
+)
+
+type header struct {
+	Number string `json:"number"`
+}
+
+type signedBlock struct {
+	Block struct {
+		Header header `json:"header"`
+	} `json:"block"`
+}
+
+// decodeParams decodes raw request params, params that can't be decoded are returned as nil
+func decodeParams(raw json.RawMessage) interface{} {
+	var params interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &params) != nil {
+		return nil
+	}
+	return params
+}
+
+// requestKey returns cache key for request if request method is block addressed, otherwise returns false
+func requestKey(method string, params interface{}) (string, bool) {
+	switch method {
+	case getBlockHash:
+		number, ok := blockNumberParam(params)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%s:%d", method, number), true
+	case getHeader, getBlock, getMetadata, getRuntimeVersion, getRuntimeVersionAlias:
+		hash, ok := blockHashParam(params)
+		if !ok {
+			return "", false
+		}
+		if method == getRuntimeVersionAlias {
+			method = getRuntimeVersion
+		}
+		return fmt.Sprintf("%s:%s", method, hash), true
+	default:
+		return "", false
+	}
+}
+
+// firstParam returns first positional param, only requests with single param can be block addressed
+func firstParam(params interface{}) (interface{}, bool) {
+	list, ok := params.([]interface{})
+	if !ok || len(list) != 1 {
+		return nil, false
+	}
+	return list[0], true
+}
+
+// blockNumberParam returns block number from params, number can be sent as number or as hex string
+func blockNumberParam(params interface{}) (int64, bool) {
+	param, ok := firstParam(params)
+	if !ok {
+		return 0, false
+	}
+
+	switch number := param.(type) {
+	case float64:
+		if number < 0 || number != float64(int64(number)) {
+			return 0, false
+		}
+		return int64(number), true
+	case string:
+		n, err := parseBlockNumber(number)
+		if err != nil {
+			return 0, false
+		}
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// blockHashParam returns lowercased block hash from params
+func blockHashParam(params interface{}) (string, bool) {
+	param, ok := firstParam(params)
+	if !ok {
+		return "", false
+	}
+
+	hash, ok := param.(string)
+	if !ok || !strings.HasPrefix(hash, "0x") || len(hash) != 66 {
+		return "", false
+	}
+	return strings.ToLower(hash), true
+}
+
+// resultBlockNumber returns block number of header or block contained in result
+func resultBlockNumber(method string, result json.RawMessage) (int64, bool) {
+	var number string
+	switch method {
+	case getHeader:
+		var h header
+		if err := json.Unmarshal(result, &h); err != nil {
+			return 0, false
+		}
+		number = h.Number
+	case getBlock:
+		var b signedBlock
+		if err := json.Unmarshal(result, &b); err != nil {
+			return 0, false
+		}
+		number = b.Block.Header.Number
+	default:
+		return 0, false
+	}
+
+	n, err := parseBlockNumber(number)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseBlockNumber(number string) (int64, error) {
+	if strings.HasPrefix(number, "0x") {
+		return strconv.ParseInt(strings.TrimPrefix(number, "0x"), 16, 64)
+	}
+	return strconv.ParseInt(number, 10, 64)
+}
@@ -0,0 +1,30 @@
+package scheduleapikey
+
+import (
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultScheduleInterval = 10 * time.Second
+)
+
+// StartScheduledTask starts task on DefaultScheduleInterval that saves usage counters of api keys
+func StartScheduledTask() {
+	ticker := time.NewTicker(DefaultScheduleInterval)
+	done := make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Debug("Started task: save api key usage")
+				apikey.Flush()
+			}
+		}
+	}()
+}
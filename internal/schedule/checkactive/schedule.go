@@ -5,6 +5,7 @@ import (
 
 	"github.com/NodeFactoryIo/vedran/internal/actions"
 	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	log "github.com/sirupsen/logrus"
 )
@@ -14,7 +15,7 @@ const (
 )
 
 // Start scheduled task on DefaultScheduleInterval that checks for each active node if it is active
-// and penalizes node if it is not active
+// and penalizes node if it missed ping or its metrics are lagging
 func StartScheduledTask(repos *repositories.Repos) {
 	ticker := time.NewTicker(DefaultScheduleInterval)
 	done := make(chan bool)
@@ -44,7 +45,7 @@ func scheduledTask(repos *repositories.Repos, actions actions.Actions) {
 		}
 
 		if !pingActive {
-			actions.PenalizeNode(node, *repos)
+			actions.PenalizeNode(node, *repos, penalty.MissedPing)
 			continue
 		}
 
@@ -55,11 +56,8 @@ func scheduledTask(repos *repositories.Repos, actions actions.Actions) {
 		}
 
 		if !metricsVald {
-			err = repos.NodeRepo.RemoveNodeFromActive(node.ID)
-			if err != nil {
-				log.Errorf("Unable to remove node %s from active because of %v", node.ID, err)
-			}
-			log.Debugf("Node %s metrics lagging more than 10 blocks, removed node from active", node.ID)
+			log.Debugf("Node %s metrics lagging more than %d blocks", node.ID, active.AllowedBlocksBehind)
+			actions.PenalizeNode(node, *repos, penalty.BlockLag)
 		}
 	}
 }
@@ -2,6 +2,7 @@ package checkactive
 
 import (
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
 	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
@@ -12,15 +13,15 @@ import (
 
 func Test_scheduledTask(t *testing.T) {
 	tests := []struct {
-		name                              string
-		allActiveNodes                    *[]models.Node
-		nodePing                          []*models.Ping
-		nodeMetrics                       []*models.Metrics
-		latestMetrics                     []*models.LatestBlockMetrics
-		penalizedNodes                    []models.Node
-		penalizedNodesNumberOfCalls       int
-		removeNodeFromActiveArgs          []models.Node
-		removeNodeFromActiveNumberOfCalls int
+		name                        string
+		allActiveNodes              *[]models.Node
+		nodePing                    []*models.Ping
+		nodeMetrics                 []*models.Metrics
+		latestMetrics               []*models.LatestBlockMetrics
+		penalizedNodes              []models.Node
+		penalizedNodesNumberOfCalls int
+		laggingNodes                []models.Node
+		laggingNodesNumberOfCalls   int
 	}{
 		{
 			name: "all active nodes",
@@ -142,7 +143,7 @@ func Test_scheduledTask(t *testing.T) {
 			penalizedNodesNumberOfCalls: 2,
 		},
 		{
-			name: "remove from active nodes with bad metrics",
+			name: "penalize nodes with bad metrics for block lag",
 			allActiveNodes: &[]models.Node{
 				{
 					ID: "1",
@@ -217,7 +218,7 @@ func Test_scheduledTask(t *testing.T) {
 			},
 			penalizedNodes:              nil,
 			penalizedNodesNumberOfCalls: 0,
-			removeNodeFromActiveArgs: []models.Node{
+			laggingNodes: []models.Node{
 				{
 					ID: "2",
 				},
@@ -225,7 +226,7 @@ func Test_scheduledTask(t *testing.T) {
 					ID: "4",
 				},
 			},
-			removeNodeFromActiveNumberOfCalls: 2,
+			laggingNodesNumberOfCalls: 2,
 		},
 	}
 	for _, test := range tests {
@@ -234,16 +235,6 @@ func Test_scheduledTask(t *testing.T) {
 			nodeRepoMock := repoMocks.NodeRepository{}
 			nodeRepoMock.On("GetAllActiveNodes").Return(test.allActiveNodes).Once()
 
-			if test.removeNodeFromActiveArgs != nil {
-				if len(test.removeNodeFromActiveArgs) == 1 {
-					nodeRepoMock.On("RemoveNodeFromActive", test.removeNodeFromActiveArgs[0].ID).Return(nil)
-				} else {
-					for _, node := range test.removeNodeFromActiveArgs {
-						nodeRepoMock.On("RemoveNodeFromActive", node.ID).Return(nil).Once()
-					}
-				}
-			}
-
 			pingRepoMock := repoMocks.PingRepository{}
 			if len(test.nodePing) == 1 { // same return value
 				pingRepoMock.On("FindByNodeID", mock.Anything).Return(test.nodePing[0], nil)
@@ -275,9 +266,12 @@ func Test_scheduledTask(t *testing.T) {
 			actionsMockObject := new(actionMocks.Actions)
 			if test.penalizedNodes != nil {
 				for _, pNode := range test.penalizedNodes {
-					actionsMockObject.On("PenalizeNode", pNode, mock.Anything).Return().Once()
+					actionsMockObject.On("PenalizeNode", pNode, mock.Anything, penalty.MissedPing).Return().Once()
 				}
 			}
+			for _, lNode := range test.laggingNodes {
+				actionsMockObject.On("PenalizeNode", lNode, mock.Anything, penalty.BlockLag).Return().Once()
+			}
 
 			scheduledTask(&repositories.Repos{
 				NodeRepo:    &nodeRepoMock,
@@ -286,8 +280,9 @@ func Test_scheduledTask(t *testing.T) {
 				RecordRepo:  &recordRepoMock,
 			}, actionsMockObject)
 
-			actionsMockObject.AssertNumberOfCalls(t, "PenalizeNode", test.penalizedNodesNumberOfCalls)
-			nodeRepoMock.AssertNumberOfCalls(t, "RemoveNodeFromActive", test.removeNodeFromActiveNumberOfCalls)
+			actionsMockObject.AssertNumberOfCalls(
+				t, "PenalizeNode", test.penalizedNodesNumberOfCalls+test.laggingNodesNumberOfCalls)
+			actionsMockObject.AssertExpectations(t)
 			nodeRepoMock.AssertNumberOfCalls(t, "GetAllActiveNodes", 1)
 		})
 	}
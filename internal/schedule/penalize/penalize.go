@@ -1,66 +1,251 @@
 package penalize
 
 import (
+	"sync"
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/history"
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/whitelist"
 	log "github.com/sirupsen/logrus"
 )
 
-const MaxCooldownForPenalizedNode = 17 * time.Hour
+const (
+	DefaultScheduleInterval = 5 * time.Second
+)
 
-var afterFunc = time.AfterFunc
+var now = time.Now
 
-func ScheduleCheckForPenalizedNode(node models.Node, repositories repositories.Repos) {
-	afterFunc(time.Duration(node.Cooldown)*time.Minute, func() {
-		isActive, err := active.CheckIfNodeActive(node, &repositories)
-		if err != nil {
-			log.Errorf("Unable to check if node %s active, because of %v", node.ID, err)
-			return
+// mutex serializes scheduling, checking and cancelling penalties, so penalty can't be cancelled
+// while its check is running
+var mutex sync.Mutex
+
+// ScheduleCheckForPenalizedNode schedules check of node penalized for reason after node cooldown. Due time is
+// persisted so check survives restart, and node has at most one scheduled check as scheduling check replaces
+// previous one.
+func ScheduleCheckForPenalizedNode(node models.Node, reason penalty.Reason, repositories repositories.Repos) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	schedule(node, reason, repositories)
+}
+
+func schedule(node models.Node, reason penalty.Reason, repositories repositories.Repos) {
+	err := repositories.PenaltyRepo.Save(&models.Penalty{
+		NodeID:   node.ID,
+		Cooldown: node.Cooldown,
+		Reason:   string(reason),
+		DueAt:    now().Add(time.Duration(node.Cooldown) * time.Minute),
+	})
+	if err != nil {
+		log.Errorf("Unable to schedule check for penalized node %s, because of %v", node.ID, err)
+	}
+}
+
+// StartScheduledTask schedules checks for penalized nodes that don't have scheduled check and starts
+// task that runs checks that are due on DefaultScheduleInterval
+func StartScheduledTask(repos *repositories.Repos) {
+	restorePenalties(*repos)
+
+	ticker := time.NewTicker(DefaultScheduleInterval)
+	go func() {
+		for range ticker.C {
+			runDueChecks(*repos)
 		}
+	}()
+}
+
+// restorePenalties schedules checks for penalized nodes whose check was not persisted, checks that were
+// persisted keep their due time. Reason of penalty that was not persisted is unknown, so penalty.DefaultRule
+// is applied on its checks.
+func restorePenalties(repos repositories.Repos) {
+	penalizedNodes, err := repos.NodeRepo.GetPenalizedNodes()
+	if err != nil {
+		log.Errorf("Unable to fetch penalized nodes, because of %v", err)
+		return
+	}
+	for _, node := range *penalizedNodes {
+		if _, err := repos.PenaltyRepo.FindByNodeID(node.ID); err != nil {
+			ScheduleCheckForPenalizedNode(node, "", repos)
+		}
+	}
+}
+
+func runDueChecks(repos repositories.Repos) {
+	penalties, err := repos.PenaltyRepo.FindDue(now())
+	if err != nil {
+		log.Errorf("Unable to fetch due penalties, because of %v", err)
+		return
+	}
+	for _, p := range penalties {
+		checkPenalizedNode(p.NodeID, penalty.Reason(p.Reason), repos)
+	}
+}
+
+// checkPenalizedNode adds node back to active nodes if it is active again, otherwise increases node cooldown
+// by escalation of rule for reason and schedules next check. Once cooldown would exceed maximum cooldown of
+// rule, action of rule is applied to node.
+func checkPenalizedNode(nodeID string, reason penalty.Reason, repositories repositories.Repos) {
+	mutex.Lock()
+	defer mutex.Unlock()
 
-		if isActive {
-			_, err := repositories.NodeRepo.ResetNodeCooldown(node.ID)
-			if err != nil {
-				log.Errorf("Unable to reset node %s cooldown, because of %v", node.ID, err)
-				return
-			}
+	node, err := repositories.NodeRepo.FindByID(nodeID)
+	if err != nil {
+		log.Errorf("Unable to fetch penalized node %s, because of %v", nodeID, err)
+		if err.Error() == "not found" {
+			removePenalty(nodeID, repositories)
+		}
+		return
+	}
+	if node.Cooldown == 0 || !node.Active {
+		// penalty was lifted or node was deactivated after check was scheduled
+		removePenalty(nodeID, repositories)
+		return
+	}
 
-			err = repositories.NodeRepo.AddNodeToActive(node.ID)
-			if err != nil {
-				log.Errorf("Unable to set node %s as active, because of %v", node.ID, err)
-			}
-			log.Debugf("Node %s become active again, added to active nodes", node.ID)
+	isActive, err := active.CheckIfNodeActive(*node, &repositories)
+	if err != nil {
+		log.Errorf("Unable to check if node %s active, because of %v", node.ID, err)
+		schedule(*node, reason, repositories)
+		return
+	}
 
+	if isActive {
+		_, err := repositories.NodeRepo.ResetNodeCooldown(node.ID)
+		if err != nil {
+			log.Errorf("Unable to reset node %s cooldown, because of %v", node.ID, err)
+			schedule(*node, reason, repositories)
 			return
 		}
+		removePenalty(node.ID, repositories)
 
-		nodeWithNewCooldown, err := repositories.NodeRepo.IncreaseNodeCooldown(node.ID)
+		err = repositories.NodeRepo.AddNodeToActive(node.ID)
 		if err != nil {
-			log.Errorf("Unable to save new cooldown for node %s, because of %v", node.ID, err)
+			log.Errorf("Unable to set node %s as active, because of %v", node.ID, err)
+			return
 		}
+		history.Record(repositories, models.NodeEvent{NodeID: node.ID, Type: models.NodeReactivated, Reason: string(reason)})
+		log.Debugf("Node %s become active again, added to active nodes", node.ID)
+		return
+	}
 
-		if (time.Duration(nodeWithNewCooldown.Cooldown) * time.Minute) > MaxCooldownForPenalizedNode {
-			log.Debugf("Node %s reached maximum cooldown", node.ID)
+	rule := penalty.RuleFor(reason)
+	nodeWithNewCooldown, err := repositories.NodeRepo.IncreaseNodeCooldown(node.ID, rule.Escalation)
+	if err != nil {
+		log.Errorf("Unable to save new cooldown for node %s, because of %v", node.ID, err)
+		schedule(*node, reason, repositories)
+		return
+	}
 
-			node.Active = false
-			err = repositories.NodeRepo.Save(&node)
-			if err != nil {
-				log.Errorf("Unable to set node %s as inactive, because of %v", node.ID, err)
-			}
+	if rule.ExceedsMaxCooldown(nodeWithNewCooldown.Cooldown) {
+		log.Debugf("Node %s reached maximum cooldown", node.ID)
+		applyMaxCooldownAction(nodeWithNewCooldown, reason, rule, repositories)
+		return
+	}
 
-			err = whitelist.RemoveNodeFromWhitelisted(node.ID)
-			if err != nil {
-				log.Errorf("Unable to remove node %s from whitelisted nodes, because of %v", node.ID, err)
-			}
+	history.Record(repositories, models.NodeEvent{
+		NodeID:   node.ID,
+		Type:     models.NodeCooldownIncreased,
+		Reason:   string(reason),
+		Cooldown: nodeWithNewCooldown.Cooldown,
+	})
+	log.Debugf("Node %s is still not active, on new cooldown for %d minute ", node.ID, nodeWithNewCooldown.Cooldown)
+	schedule(*nodeWithNewCooldown, reason, repositories)
+}
 
-			return
+// applyMaxCooldownAction keeps node on maximum cooldown if rule caps cooldown, otherwise node is set as inactive
+// and, if rule requires it, removed from whitelisted nodes
+func applyMaxCooldownAction(node *models.Node, reason penalty.Reason, rule penalty.Rule, repositories repositories.Repos) {
+	if rule.OnMaxCooldown == penalty.Cap {
+		node.Cooldown = rule.MaxCooldownInMins()
+		err := repositories.NodeRepo.Save(node)
+		if err != nil {
+			log.Errorf("Unable to save new cooldown for node %s, because of %v", node.ID, err)
 		}
+		history.Record(repositories, models.NodeEvent{
+			NodeID:   node.ID,
+			Type:     models.NodeCooldownIncreased,
+			Reason:   string(reason),
+			Cooldown: node.Cooldown,
+			Details:  "cooldown capped at maximum cooldown",
+		})
+		schedule(*node, reason, repositories)
+		return
+	}
+
+	removePenalty(node.ID, repositories)
+
+	node.Active = false
+	err := repositories.NodeRepo.Save(node)
+	if err != nil {
+		log.Errorf("Unable to set node %s as inactive, because of %v", node.ID, err)
+	}
 
-		log.Debugf("Node %s is still not active, on new cooldown for %d minute ", node.ID, nodeWithNewCooldown.Cooldown)
-		ScheduleCheckForPenalizedNode(*nodeWithNewCooldown, repositories)
+	details := "set as inactive after reaching maximum cooldown"
+	if rule.OnMaxCooldown == penalty.RemoveFromWhitelist {
+		err = whitelist.RemoveNodeFromWhitelisted(node.ID)
+		if err != nil {
+			log.Errorf("Unable to remove node %s from whitelisted nodes, because of %v", node.ID, err)
+		}
+		details = "set as inactive and removed from whitelisted nodes after reaching maximum cooldown"
+	}
+	history.Record(repositories, models.NodeEvent{
+		NodeID:   node.ID,
+		Type:     models.NodeExpelled,
+		Reason:   string(reason),
+		Cooldown: node.Cooldown,
+		Details:  details,
 	})
 }
+
+// CancelPenalty cancels scheduled check of penalized node and resets node cooldown, so node is added back
+// to active nodes as soon as it is ready
+func CancelPenalty(nodeID string, repositories repositories.Repos) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	_, err := repositories.PenaltyRepo.FindByNodeID(nodeID)
+	if err != nil {
+		return err
+	}
+	err = repositories.PenaltyRepo.Delete(nodeID)
+	if err != nil {
+		return err
+	}
+	_, err = repositories.NodeRepo.ResetNodeCooldown(nodeID)
+	if err != nil {
+		return err
+	}
+	history.Record(repositories, models.NodeEvent{NodeID: nodeID, Type: models.NodePenaltyCancelled})
+	log.Debugf("Penalty of node %s cancelled", nodeID)
+
+	return active.ActivateNodeIfReady(nodeID, repositories)
+}
+
+// UpdateNode applies update to node and removes its scheduled check, so node state set by update
+// is not changed by check that was scheduled before
+func UpdateNode(nodeID string, update func(node *models.Node), repositories repositories.Repos) (*models.Node, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	node, err := repositories.NodeRepo.FindByID(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	update(node)
+	err = repositories.NodeRepo.Save(node)
+	if err != nil {
+		return nil, err
+	}
+	removePenalty(nodeID, repositories)
+	return node, nil
+}
+
+func removePenalty(nodeID string, repositories repositories.Repos) {
+	err := repositories.PenaltyRepo.Delete(nodeID)
+	if err != nil && err.Error() != "not found" {
+		log.Errorf("Unable to remove penalty of node %s, because of %v", nodeID, err)
+	}
+}
@@ -1,13 +1,16 @@
 package penalize
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	"github.com/NodeFactoryIo/vedran/internal/whitelist"
 	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -25,6 +28,7 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 		nodeMetrics                       []*models.Metrics
 		latestMetrics                     []*models.LatestBlockMetrics
 		increaseNodeCooldown              []*models.Node
+		events                            []string
 	}{
 		{
 			name:   "penalized node becomes active on first check",
@@ -63,6 +67,7 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 			},
 			increaseNodeCooldown:              nil,
 			increaseNodeCooldownNumberOfCalls: 0,
+			events:                            []string{models.NodeReactivated},
 		},
 		{
 			name:   "penalized node schedule one check",
@@ -114,6 +119,7 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 				},
 			},
 			increaseNodeCooldownNumberOfCalls: 1,
+			events:                            []string{models.NodeCooldownIncreased, models.NodeReactivated},
 		},
 		{
 			name:   "penalized node schedule multiple checks",
@@ -180,6 +186,9 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 				},
 			},
 			increaseNodeCooldownNumberOfCalls: 3,
+			events: []string{
+				models.NodeCooldownIncreased, models.NodeCooldownIncreased, models.NodeCooldownIncreased, models.NodeReactivated,
+			},
 		},
 		{
 			name:   "penalized node hits max cooldown",
@@ -222,6 +231,7 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 				},
 			},
 			increaseNodeCooldownNumberOfCalls: 2,
+			events:                            []string{models.NodeCooldownIncreased, models.NodeExpelled},
 		},
 	}
 
@@ -253,10 +263,11 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 					nodeRepoMock.On(
 						"IncreaseNodeCooldown",
 						test.nodeID,
+						2.0,
 					).Return(test.increaseNodeCooldown[0], nil)
 				} else {
 					for _, node := range test.increaseNodeCooldown {
-						nodeRepoMock.On("IncreaseNodeCooldown", test.nodeID).Return(node, nil).Once()
+						nodeRepoMock.On("IncreaseNodeCooldown", test.nodeID, 2.0).Return(node, nil).Once()
 					}
 				}
 			}
@@ -290,22 +301,138 @@ func TestScheduleCheckForPenalizedNode(t *testing.T) {
 
 			recordRepoMock := repoMocks.RecordRepository{}
 
-			afterFunc = func(d time.Duration, f func()) *time.Timer {
-				f()
-				return nil
+			probeRepoMock := repoMocks.ProbeRepository{}
+			probeRepoMock.On("FindByNodeID", test.nodeID).Return(&models.Probe{
+				NodeId:               test.nodeID,
+				Timestamp:            time.Now(),
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			}, nil)
+			probeRepoMock.On("GetLatestBlockMetrics").Return(&models.LatestBlockMetrics{
+				BestBlockHeight:      1001,
+				FinalizedBlockHeight: 998,
+			}, nil)
+
+			// penalty repository keeps single penalty so each node has at most one scheduled check
+			var scheduled *models.Penalty
+			penaltyRepoMock := repoMocks.PenaltyRepository{}
+			penaltyRepoMock.On("Save", mock.Anything).Run(func(args mock.Arguments) {
+				scheduled = args.Get(0).(*models.Penalty)
+			}).Return(nil)
+			penaltyRepoMock.On("Delete", test.nodeID).Run(func(args mock.Arguments) {
+				scheduled = nil
+			}).Return(nil)
+			penaltyRepoMock.On("FindDue", mock.Anything).Return(func(due time.Time) []models.Penalty {
+				if scheduled == nil || scheduled.DueAt.After(due) {
+					return []models.Penalty{}
+				}
+				return []models.Penalty{*scheduled}
+			}, nil)
+			nodeRepoMock.On("FindByID", test.nodeID).Return(func(ID string) *models.Node {
+				return &models.Node{ID: ID, Cooldown: scheduled.Cooldown, Active: true}
+			}, nil)
+
+			var events []string
+			nodeEventRepoMock := repoMocks.NodeEventRepository{}
+			nodeEventRepoMock.On("Save", mock.Anything).Run(func(args mock.Arguments) {
+				events = append(events, args.Get(0).(*models.NodeEvent).Type)
+			}).Return(nil)
+
+			repos := repositories.Repos{
+				NodeRepo:      &nodeRepoMock,
+				PingRepo:      &pingRepoMock,
+				MetricsRepo:   &metricsRepoMock,
+				RecordRepo:    &recordRepoMock,
+				ProbeRepo:     &probeRepoMock,
+				PenaltyRepo:   &penaltyRepoMock,
+				NodeEventRepo: &nodeEventRepoMock,
 			}
+			ScheduleCheckForPenalizedNode(test.node, penalty.MissedPing, repos)
 
-			ScheduleCheckForPenalizedNode(test.node, repositories.Repos{
-				NodeRepo:    &nodeRepoMock,
-				PingRepo:    &pingRepoMock,
-				MetricsRepo: &metricsRepoMock,
-				RecordRepo:  &recordRepoMock,
-			})
+			// checks are not run before penalty is due
+			runDueChecks(repos)
+			nodeRepoMock.AssertNotCalled(t, "FindByID", test.nodeID)
 
+			defer func() { now = time.Now }()
+			for i := 0; i < 10 && scheduled != nil; i++ {
+				due := scheduled.DueAt
+				assert.Equal(t, time.Duration(scheduled.Cooldown)*time.Minute, due.Sub(now()).Round(time.Minute))
+				now = func() time.Time { return due }
+				runDueChecks(repos)
+			}
+
+			assert.Nil(t, scheduled)
 			nodeRepoMock.AssertNumberOfCalls(t, "AddNodeToActive", test.addToActiveNodesNumberOfCalls)
 			nodeRepoMock.AssertNumberOfCalls(t, "IncreaseNodeCooldown", test.increaseNodeCooldownNumberOfCalls)
 			nodeRepoMock.AssertNumberOfCalls(t, "ResetNodeCooldown", test.resetNodeCooldownNumberOfCalls)
 			nodeRepoMock.AssertNumberOfCalls(t, "Save", test.setNodeAsInactiveNumberOfCalls)
+			assert.Equal(t, test.events, events)
 		})
 	}
 }
+
+func TestScheduleCheckForPenalizedNode_ReplacesScheduledCheck(t *testing.T) {
+	var saved []models.Penalty
+	penaltyRepoMock := repoMocks.PenaltyRepository{}
+	penaltyRepoMock.On("Save", mock.Anything).Run(func(args mock.Arguments) {
+		saved = append(saved, *args.Get(0).(*models.Penalty))
+	}).Return(nil)
+	repos := repositories.Repos{PenaltyRepo: &penaltyRepoMock}
+
+	ScheduleCheckForPenalizedNode(models.Node{ID: "1", Cooldown: 1}, penalty.MissedPing, repos)
+	ScheduleCheckForPenalizedNode(models.Node{ID: "1", Cooldown: 4}, penalty.ConsensusMismatch, repos)
+
+	// penalties are stored by node id, so second check replaces first one
+	assert.Equal(t, "1", saved[0].NodeID)
+	assert.Equal(t, "1", saved[1].NodeID)
+	assert.Equal(t, 4, saved[1].Cooldown)
+	assert.Equal(t, string(penalty.ConsensusMismatch), saved[1].Reason)
+}
+
+func TestCancelPenalty(t *testing.T) {
+	penaltyRepoMock := repoMocks.PenaltyRepository{}
+	penaltyRepoMock.On("FindByNodeID", "1").Return(&models.Penalty{NodeID: "1", Cooldown: 2}, nil)
+	penaltyRepoMock.On("FindByNodeID", "2").Return(nil, errors.New("not found"))
+	penaltyRepoMock.On("Delete", "1").Return(nil)
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("ResetNodeCooldown", "1").Return(&models.Node{ID: "1"}, nil)
+	// activating node once it is ready is covered by active package tests
+	nodeRepoMock.On("IsNodeOnCooldown", "1").Return(true, nil)
+	nodeEventRepoMock := repoMocks.NodeEventRepository{}
+	nodeEventRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, PenaltyRepo: &penaltyRepoMock, NodeEventRepo: &nodeEventRepoMock}
+
+	assert.NoError(t, CancelPenalty("1", repos))
+	penaltyRepoMock.AssertCalled(t, "Delete", "1")
+	nodeEventRepoMock.AssertCalled(t, "Save", mock.MatchedBy(func(event *models.NodeEvent) bool {
+		return event.NodeID == "1" && event.Type == models.NodePenaltyCancelled
+	}))
+	nodeRepoMock.AssertCalled(t, "ResetNodeCooldown", "1")
+
+	assert.Error(t, CancelPenalty("2", repos))
+	penaltyRepoMock.AssertNumberOfCalls(t, "Delete", 1)
+}
+
+func TestUpdateNode(t *testing.T) {
+	penaltyRepoMock := repoMocks.PenaltyRepository{}
+	penaltyRepoMock.On("Delete", "1").Return(errors.New("not found"))
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("FindByID", "1").Return(&models.Node{ID: "1", Cooldown: 4, Active: true}, nil)
+	nodeRepoMock.On("FindByID", "2").Return(nil, errors.New("not found"))
+	nodeRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, PenaltyRepo: &penaltyRepoMock}
+
+	node, err := UpdateNode("1", func(node *models.Node) {
+		node.Cooldown = 0
+		node.Active = false
+	}, repos)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Node{ID: "1"}, node)
+	nodeRepoMock.AssertCalled(t, "Save", &models.Node{ID: "1"})
+	penaltyRepoMock.AssertCalled(t, "Delete", "1")
+
+	_, err = UpdateNode("2", func(node *models.Node) {}, repos)
+	assert.Error(t, err)
+	nodeRepoMock.AssertNumberOfCalls(t, "Save", 1)
+}
@@ -0,0 +1,196 @@
+package scheduleprobe
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/actions"
+	"github.com/NodeFactoryIo/vedran/internal/active"
+	"github.com/NodeFactoryIo/vedran/internal/blocks"
+	"github.com/NodeFactoryIo/vedran/internal/capability"
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/probe"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpccache"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultScheduleInterval = 10 * time.Second
+)
+
+var probeNode = probe.ProbeNode
+
+// StartScheduledTask starts scheduled task on DefaultScheduleInterval that probes each node with open tunnel,
+// saves observed state and activates, deactivates or penalizes node based on observed state
+func StartScheduledTask(repos *repositories.Repos) {
+	ticker := time.NewTicker(DefaultScheduleInterval)
+	done := make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				scheduledTask(repos, actions.NewActions())
+			}
+		}
+	}()
+}
+
+func scheduledTask(repos *repositories.Repos, actions actions.Actions) {
+	log.Debug("Started task: probe nodes")
+	nodes, err := repos.NodeRepo.GetAll()
+	if err != nil {
+		if err.Error() != "not found" {
+			log.Errorf("Unable to fetch nodes for probing because of %v", err)
+		}
+		return
+	}
+
+	// probe all nodes concurrently so one slow node doesn't delay probing others
+	var probedNodes []models.Node
+	var probes []*models.Probe
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range *nodes {
+		if !node.Active {
+			continue
+		}
+		if _, err := configuration.Config.PortPool.GetHTTPPort(node.ID); err != nil {
+			// node tunnel not opened
+			continue
+		}
+
+		wg.Add(1)
+		go func(node models.Node) {
+			defer wg.Done()
+			p := probeNode(node.ID)
+			mutex.Lock()
+			probedNodes = append(probedNodes, node)
+			probes = append(probes, p)
+			mutex.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
+	for i, p := range probes {
+		flagMetricsMismatch(p, repos)
+		err = repos.ProbeRepo.Save(p)
+		if err != nil {
+			log.Errorf("Unable to save probe for node %s because of %v", p.NodeId, err)
+			probes[i] = nil
+		}
+	}
+
+	updateFinalizedState(probes, repos)
+	updateNodeBlocks(probes)
+	updateNodeCapabilities(probes)
+
+	for i, node := range probedNodes {
+		if probes[i] != nil {
+			applyProbe(node, probes[i], repos, actions)
+		}
+	}
+}
+
+// updateFinalizedState passes finalized state observed by probing to rpc cache so it can
+// decide which responses are immutable
+func updateFinalizedState(probes []*models.Probe, repos *repositories.Repos) {
+	latestBlockMetrics, err := repos.ProbeRepo.GetLatestBlockMetrics()
+	if err != nil {
+		log.Errorf("Unable to fetch latest observed block metrics because of %v", err)
+		return
+	}
+	rpccache.SetFinalizedHeight(latestBlockMetrics.FinalizedBlockHeight)
+
+	for _, p := range probes {
+		if p != nil && p.Healthy {
+			rpccache.AddFinalizedHash(p.FinalizedBlockHash, p.FinalizedBlockHeight)
+		}
+	}
+}
+
+// updateNodeBlocks passes blocks observed by probing to block tracker so requests for recent blocks
+// are routed to nodes that have them
+func updateNodeBlocks(probes []*models.Probe) {
+	for _, p := range probes {
+		if p == nil || !p.Healthy {
+			continue
+		}
+		blocks.SetNodeHeight(p.NodeId, p.BestBlockHeight)
+		blocks.AddNodeHash(p.NodeId, p.BestBlockHash, p.BestBlockHeight)
+		blocks.AddNodeHash(p.NodeId, p.FinalizedBlockHash, p.FinalizedBlockHeight)
+	}
+}
+
+// updateNodeCapabilities passes capabilities observed by probing to capability registry so requests
+// are routed to nodes capable of answering them
+func updateNodeCapabilities(probes []*models.Probe) {
+	for _, p := range probes {
+		if p != nil && p.Healthy {
+			capability.Observe(p.NodeId, capability.Observed(*p))
+		}
+	}
+}
+
+// flagMetricsMismatch marks probe if metrics reported by node daemon differ from probed state
+// for more than active.AllowedBlocksBehind blocks
+func flagMetricsMismatch(p *models.Probe, repos *repositories.Repos) {
+	if !p.Healthy {
+		return
+	}
+	metrics, err := repos.MetricsRepo.FindByID(p.NodeId)
+	if err != nil {
+		return
+	}
+	if abs(metrics.BestBlockHeight-p.BestBlockHeight) > active.AllowedBlocksBehind ||
+		abs(metrics.FinalizedBlockHeight-p.FinalizedBlockHeight) > active.AllowedBlocksBehind {
+		p.MetricsMismatch = true
+		log.Warnf(
+			"Node %s reported metrics don't match observed state. "+
+				"Reported: BestBlockHeight[%d], FinalizedBlockHeight[%d] "+
+				"Observed: BestBlockHeight[%d], FinalizedBlockHeight[%d]",
+			p.NodeId,
+			metrics.BestBlockHeight, metrics.FinalizedBlockHeight,
+			p.BestBlockHeight, p.FinalizedBlockHeight,
+		)
+	}
+}
+
+func applyProbe(node models.Node, p *models.Probe, repos *repositories.Repos, actions actions.Actions) {
+	if !repos.NodeRepo.IsNodeActive(node.ID) {
+		err := active.ActivateNodeIfReady(node.ID, *repos)
+		if err != nil && err.Error() != "not found" {
+			log.Errorf("Unable to activate node %s because of %v", node.ID, err)
+		}
+		return
+	}
+
+	if !p.Healthy {
+		log.Debugf("Node %s failed probe: %s", node.ID, p.Error)
+		actions.PenalizeNode(node, *repos, penalty.ProbeFailure)
+		return
+	}
+
+	probeValid, err := active.CheckIfProbeValid(node.ID, repos)
+	if err != nil {
+		log.Errorf("Unable to check node %s probe because of %v", node.ID, err)
+		return
+	}
+
+	if !probeValid {
+		log.Debugf("Node %s observed blocks lagging more than %d blocks", node.ID, active.AllowedBlocksBehind)
+		actions.PenalizeNode(node, *repos, penalty.BlockLag)
+	}
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
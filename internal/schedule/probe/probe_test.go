@@ -0,0 +1,182 @@
+package scheduleprobe
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
+	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
+	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_scheduledTask(t *testing.T) {
+	tests := []struct {
+		name                          string
+		node                          models.Node
+		nodeIsActive                  bool
+		tunnelOpened                  bool
+		probe                         *models.Probe
+		reportedMetrics               *models.Metrics
+		probeRepoSaveNumberOfCalls    int
+		penalizeNodeNumberOfCalls     int
+		penalizeReason                penalty.Reason
+		isNodeOnCooldownNumberOfCalls int
+		expectedMetricsMismatch       bool
+	}{
+		{
+			name:         "healthy active node stays active",
+			node:         models.Node{ID: "1", Active: true},
+			nodeIsActive: true,
+			tunnelOpened: true,
+			probe: &models.Probe{
+				NodeId:               "1",
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			reportedMetrics: &models.Metrics{
+				NodeId:               "1",
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			probeRepoSaveNumberOfCalls: 1,
+		},
+		{
+			name:         "reported metrics don't match observed state",
+			node:         models.Node{ID: "1", Active: true},
+			nodeIsActive: true,
+			tunnelOpened: true,
+			probe: &models.Probe{
+				NodeId:               "1",
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			reportedMetrics: &models.Metrics{
+				NodeId:               "1",
+				BestBlockHeight:      1500,
+				FinalizedBlockHeight: 1495,
+			},
+			probeRepoSaveNumberOfCalls: 1,
+			expectedMetricsMismatch:    true,
+		},
+		{
+			name:         "unhealthy active node is penalized",
+			node:         models.Node{ID: "1", Active: true},
+			nodeIsActive: true,
+			tunnelOpened: true,
+			probe: &models.Probe{
+				NodeId:  "1",
+				Healthy: false,
+				Error:   "node has no peers",
+			},
+			probeRepoSaveNumberOfCalls: 1,
+			penalizeNodeNumberOfCalls:  1,
+			penalizeReason:             penalty.ProbeFailure,
+		},
+		{
+			name:         "lagging active node is penalized for block lag",
+			node:         models.Node{ID: "1", Active: true},
+			nodeIsActive: true,
+			tunnelOpened: true,
+			probe: &models.Probe{
+				NodeId:               "1",
+				Healthy:              true,
+				BestBlockHeight:      900,
+				FinalizedBlockHeight: 895,
+			},
+			reportedMetrics: &models.Metrics{
+				NodeId:               "1",
+				BestBlockHeight:      900,
+				FinalizedBlockHeight: 895,
+			},
+			probeRepoSaveNumberOfCalls: 1,
+			penalizeNodeNumberOfCalls:  1,
+			penalizeReason:             penalty.BlockLag,
+		},
+		{
+			name:         "inactive node is checked for activation",
+			node:         models.Node{ID: "1", Active: true},
+			nodeIsActive: false,
+			tunnelOpened: true,
+			probe: &models.Probe{
+				NodeId:               "1",
+				Healthy:              true,
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			reportedMetrics: &models.Metrics{
+				NodeId:               "1",
+				BestBlockHeight:      1000,
+				FinalizedBlockHeight: 995,
+			},
+			probeRepoSaveNumberOfCalls:    1,
+			isNodeOnCooldownNumberOfCalls: 1,
+		},
+		{
+			name:         "node without opened tunnel is not probed",
+			node:         models.Node{ID: "1", Active: true},
+			tunnelOpened: false,
+		},
+		{
+			name:         "node marked as inactive is not probed",
+			node:         models.Node{ID: "1", Active: false},
+			tunnelOpened: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			poolerMock := &tunnelMocks.Pooler{}
+			if test.tunnelOpened {
+				poolerMock.On("GetHTTPPort", test.node.ID).Return(8000, nil)
+			} else {
+				poolerMock.On("GetHTTPPort", test.node.ID).Return(0, errors.New("not found"))
+			}
+			configuration.Config.PortPool = poolerMock
+
+			probeNode = func(nodeID string) *models.Probe {
+				test.probe.Timestamp = time.Now()
+				return test.probe
+			}
+
+			nodeRepoMock := repoMocks.NodeRepository{}
+			nodeRepoMock.On("GetAll").Return(&[]models.Node{test.node}, nil)
+			nodeRepoMock.On("IsNodeActive", test.node.ID).Return(test.nodeIsActive)
+			nodeRepoMock.On("IsNodeOnCooldown", test.node.ID).Return(true, nil)
+
+			metricsRepoMock := repoMocks.MetricsRepository{}
+			metricsRepoMock.On("FindByID", test.node.ID).Return(test.reportedMetrics, nil)
+
+			probeRepoMock := repoMocks.ProbeRepository{}
+			probeRepoMock.On("Save", mock.Anything).Return(nil)
+			probeRepoMock.On("FindByNodeID", test.node.ID).Return(test.probe, nil)
+			probeRepoMock.On("GetLatestBlockMetrics").Return(&models.LatestBlockMetrics{
+				BestBlockHeight:      1001,
+				FinalizedBlockHeight: 998,
+			}, nil)
+
+			actionsMockObject := new(actionMocks.Actions)
+			actionsMockObject.On("PenalizeNode", test.node, mock.Anything, test.penalizeReason).Return()
+
+			scheduledTask(&repositories.Repos{
+				NodeRepo:    &nodeRepoMock,
+				MetricsRepo: &metricsRepoMock,
+				ProbeRepo:   &probeRepoMock,
+			}, actionsMockObject)
+
+			probeRepoMock.AssertNumberOfCalls(t, "Save", test.probeRepoSaveNumberOfCalls)
+			actionsMockObject.AssertNumberOfCalls(t, "PenalizeNode", test.penalizeNodeNumberOfCalls)
+			nodeRepoMock.AssertNumberOfCalls(t, "IsNodeOnCooldown", test.isNodeOnCooldownNumberOfCalls)
+			if test.probe != nil {
+				assert.Equal(t, test.expectedMetricsMismatch, test.probe.MetricsMismatch)
+			}
+		})
+	}
+}
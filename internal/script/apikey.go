@@ -0,0 +1,86 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/NodeFactoryIo/go-substrate-rpc-client/signature"
+	"github.com/NodeFactoryIo/vedran/internal/constants"
+	"github.com/NodeFactoryIo/vedran/internal/controllers"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CreateAPIKey creates api key on loadbalancer and returns it with generated key
+func CreateAPIKey(secret string, loadbalancerUrl *url.URL, request controllers.APIKeyRequest) (*models.APIKey, error) {
+	apiKey := models.APIKey{}
+	err := sendAPIKeyRequest(secret, "POST", apiKeysEndpoint(loadbalancerUrl), request, &apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// UpdateAPIKey updates quotas, disabled and verified flags of api key on loadbalancer
+func UpdateAPIKey(secret string, loadbalancerUrl *url.URL, request controllers.APIKeyRequest) (*models.APIKey, error) {
+	apiKey := models.APIKey{}
+	err := sendAPIKeyRequest(secret, "PUT", apiKeyEndpoint(loadbalancerUrl, request.Name), request, &apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// DeleteAPIKey deletes api key from loadbalancer
+func DeleteAPIKey(secret string, loadbalancerUrl *url.URL, name string) error {
+	return sendAPIKeyRequest(secret, "DELETE", apiKeyEndpoint(loadbalancerUrl, name), nil, nil)
+}
+
+// ListAPIKeys returns all api keys with their usage from loadbalancer
+func ListAPIKeys(secret string, loadbalancerUrl *url.URL) ([]models.APIKey, error) {
+	var apiKeys []models.APIKey
+	err := sendAPIKeyRequest(secret, "GET", apiKeysEndpoint(loadbalancerUrl), nil, &apiKeys)
+	if err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func sendAPIKeyRequest(secret string, method string, endpoint *url.URL, body interface{}, response interface{}) error {
+	sig, err := signature.Sign([]byte(constants.StatsSignedData), secret)
+	if err != nil {
+		return err
+	}
+
+	payloadBuf := new(bytes.Buffer)
+	if body != nil {
+		_ = json.NewEncoder(payloadBuf).Encode(body)
+	}
+
+	request, _ := http.NewRequest(method, endpoint.String(), payloadBuf)
+	request.Header.Set("X-Signature", hexutil.Encode(sig))
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	c := &http.Client{}
+	resp, err := c.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("loadbalancer responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
@@ -4,6 +4,7 @@ import "net/url"
 
 var stats, _ = url.Parse("/api/v1/stats")
 var ws, _ = url.Parse("/ws")
+var apiKeys, _ = url.Parse("/api/v1/keys")
 
 func statsEndpoint(loadbalancerUrl *url.URL) *url.URL {
 	return loadbalancerUrl.ResolveReference(stats)
@@ -14,3 +15,12 @@ func wsEndpoint(loadbalancerUrl *url.URL) *url.URL {
 	loadbalancerWsUrl.Scheme = "ws"
 	return loadbalancerWsUrl
 }
+
+func apiKeysEndpoint(loadbalancerUrl *url.URL) *url.URL {
+	return loadbalancerUrl.ResolveReference(apiKeys)
+}
+
+func apiKeyEndpoint(loadbalancerUrl *url.URL, name string) *url.URL {
+	apiKey := &url.URL{Path: apiKeys.Path + "/" + name}
+	return loadbalancerUrl.ResolveReference(apiKey)
+}
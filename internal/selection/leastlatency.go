@@ -0,0 +1,35 @@
+package selection
+
+import (
+	"sort"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+type leastLatencySelector struct {
+	tracker *Tracker
+}
+
+// NewLeastLatencySelector creates selector that prefers nodes with lowest moving average
+// of latency. Nodes without recorded latency are preferred so their latency gets measured.
+func NewLeastLatencySelector(tracker *Tracker) Selector {
+	return &leastLatencySelector{tracker: tracker}
+}
+
+func (s *leastLatencySelector) Select(nodes []models.Node) []models.Node {
+	result := copyNodes(nodes)
+	latencies := make(map[string]time.Duration, len(result))
+	for _, node := range result {
+		latency, _ := s.tracker.Latency(node.ID)
+		latencies[node.ID] = latency
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		li, lj := latencies[result[i].ID], latencies[result[j].ID]
+		if li == lj {
+			return result[i].LastUsed < result[j].LastUsed
+		}
+		return li < lj
+	})
+	return result
+}
@@ -0,0 +1,33 @@
+package selection
+
+import (
+	"sort"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+type leastOutstandingSelector struct {
+	tracker *Tracker
+}
+
+// NewLeastOutstandingSelector creates selector that prefers nodes with fewest requests in flight,
+// nodes with same number of requests in flight are ordered as in round-robin selection
+func NewLeastOutstandingSelector(tracker *Tracker) Selector {
+	return &leastOutstandingSelector{tracker: tracker}
+}
+
+func (s *leastOutstandingSelector) Select(nodes []models.Node) []models.Node {
+	result := copyNodes(nodes)
+	outstanding := make(map[string]int64, len(result))
+	for _, node := range result {
+		outstanding[node.ID] = s.tracker.Outstanding(node.ID)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		oi, oj := outstanding[result[i].ID], outstanding[result[j].ID]
+		if oi == oj {
+			return result[i].LastUsed < result[j].LastUsed
+		}
+		return oi < oj
+	})
+	return result
+}
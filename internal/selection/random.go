@@ -0,0 +1,48 @@
+package selection
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+// lockedRand is rand source safe for concurrent use
+type lockedRand struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rand.Float64()
+}
+
+func (r *lockedRand) Shuffle(n int, swap func(i, j int)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rand.Shuffle(n, swap)
+}
+
+type randomSelector struct {
+	rand *lockedRand
+}
+
+// NewRandomSelector creates selector that orders nodes randomly
+func NewRandomSelector() Selector {
+	return &randomSelector{rand: newLockedRand()}
+}
+
+func (s *randomSelector) Select(nodes []models.Node) []models.Node {
+	result := copyNodes(nodes)
+	s.rand.Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
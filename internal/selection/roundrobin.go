@@ -0,0 +1,22 @@
+package selection
+
+import (
+	"sort"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+type roundRobinSelector struct{}
+
+// NewRoundRobinSelector creates selector that prefers nodes that were least recently used
+func NewRoundRobinSelector() Selector {
+	return &roundRobinSelector{}
+}
+
+func (s *roundRobinSelector) Select(nodes []models.Node) []models.Node {
+	result := copyNodes(nodes)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastUsed < result[j].LastUsed
+	})
+	return result
+}
@@ -0,0 +1,85 @@
+package selection
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+const (
+	RoundRobin       = "round-robin"
+	Random           = "random"
+	LeastLatency     = "least-latency"
+	LeastOutstanding = "least-outstanding"
+	WeightedRandom   = "weighted-random"
+)
+
+// Selector orders active nodes by preference for serving next request
+type Selector interface {
+	// Select returns provided nodes ordered so that first node is best candidate.
+	// Provided slice is not modified.
+	Select(nodes []models.Node) []models.Node
+}
+
+// Factory creates new Selector that reads request statistics from provided tracker
+type Factory func(tracker *Tracker) Selector
+
+var (
+	registryMutex = &sync.RWMutex{}
+	factories     = make(map[string]Factory)
+)
+
+func init() {
+	Register(RoundRobin, func(_ *Tracker) Selector { return NewRoundRobinSelector() })
+	Register(Random, func(_ *Tracker) Selector { return NewRandomSelector() })
+	Register(LeastLatency, func(t *Tracker) Selector { return NewLeastLatencySelector(t) })
+	Register(LeastOutstanding, func(t *Tracker) Selector { return NewLeastOutstandingSelector(t) })
+	Register(WeightedRandom, func(t *Tracker) Selector { return NewWeightedRandomSelector(t) })
+}
+
+// Register makes selection strategy available under provided name, registering
+// strategy with already registered name replaces previous strategy
+func Register(name string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	factories[name] = factory
+}
+
+// IsRegistered checks if selection strategy with provided name is registered
+func IsRegistered(name string) bool {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names returns sorted names of all registered selection strategies
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates selector registered under provided name that uses DefaultTracker
+func New(name string) (Selector, error) {
+	registryMutex.RLock()
+	factory, ok := factories[name]
+	registryMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown selection strategy %s", name)
+	}
+	return factory(DefaultTracker), nil
+}
+
+func copyNodes(nodes []models.Node) []models.Node {
+	result := make([]models.Node, len(nodes))
+	_ = copy(result, nodes)
+	return result
+}
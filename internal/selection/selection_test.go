@@ -0,0 +1,105 @@
+package selection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func nodeIDs(nodes []models.Node) []string {
+	ids := make([]string, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+	return ids
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range []string{RoundRobin, Random, LeastLatency, LeastOutstanding, WeightedRandom} {
+		t.Run(name, func(t *testing.T) {
+			assert.True(t, IsRegistered(name))
+			selector, err := New(name)
+			assert.NoError(t, err)
+			assert.NotNil(t, selector)
+		})
+	}
+
+	_, err := New("invalid")
+	assert.Error(t, err)
+	assert.False(t, IsRegistered("invalid"))
+}
+
+func TestRegister(t *testing.T) {
+	Register("custom", func(_ *Tracker) Selector { return NewRoundRobinSelector() })
+	defer func() {
+		registryMutex.Lock()
+		delete(factories, "custom")
+		registryMutex.Unlock()
+	}()
+
+	assert.True(t, IsRegistered("custom"))
+	assert.Contains(t, Names(), "custom")
+}
+
+func TestRoundRobinSelector_Select(t *testing.T) {
+	nodes := []models.Node{{ID: "1", LastUsed: 3}, {ID: "2", LastUsed: 1}, {ID: "3", LastUsed: 2}}
+
+	selected := NewRoundRobinSelector().Select(nodes)
+
+	assert.Equal(t, []string{"2", "3", "1"}, nodeIDs(selected))
+	assert.Equal(t, "1", nodes[0].ID, "Provided nodes should not be reordered")
+}
+
+func TestRandomSelector_Select(t *testing.T) {
+	nodes := []models.Node{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	selected := NewRandomSelector().Select(nodes)
+
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, nodeIDs(selected))
+}
+
+func TestLeastLatencySelector_Select(t *testing.T) {
+	tracker := NewTracker()
+	tracker.finish("1", 300*time.Millisecond)
+	tracker.finish("2", 100*time.Millisecond)
+	nodes := []models.Node{{ID: "1"}, {ID: "2"}, {ID: "3"}}
+
+	selected := NewLeastLatencySelector(tracker).Select(nodes)
+
+	// node without measured latency is tried first
+	assert.Equal(t, []string{"3", "2", "1"}, nodeIDs(selected))
+}
+
+func TestLeastOutstandingSelector_Select(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Begin("1")
+	tracker.Begin("1")
+	tracker.Begin("2")
+	nodes := []models.Node{{ID: "1", LastUsed: 1}, {ID: "2", LastUsed: 2}, {ID: "3", LastUsed: 3}}
+
+	selected := NewLeastOutstandingSelector(tracker).Select(nodes)
+
+	assert.Equal(t, []string{"3", "2", "1"}, nodeIDs(selected))
+}
+
+func TestWeightedRandomSelector_Select(t *testing.T) {
+	tracker := NewTracker()
+	tracker.finish("fast", 10*time.Millisecond)
+	tracker.finish("slow", 1000*time.Millisecond)
+	nodes := []models.Node{{ID: "fast"}, {ID: "slow"}}
+	selector := NewWeightedRandomSelector(tracker)
+
+	fastFirst := 0
+	for i := 0; i < 1000; i++ {
+		selected := selector.Select(nodes)
+		assert.Len(t, selected, 2)
+		if selected[0].ID == "fast" {
+			fastFirst++
+		}
+	}
+
+	// fast node has 100 times bigger weight so it should be selected first most of the time
+	assert.Greater(t, fastFirst, 900)
+}
@@ -0,0 +1,98 @@
+package selection
+
+import (
+	"sync"
+	"time"
+)
+
+// EWMADecay is weight given to newest latency sample when calculating moving average
+const EWMADecay = 0.3
+
+type nodeStats struct {
+	latency     float64
+	hasLatency  bool
+	outstanding int64
+}
+
+// Tracker records latency and number of outstanding requests for each node
+type Tracker struct {
+	mutex sync.RWMutex
+	stats map[string]*nodeStats
+}
+
+// DefaultTracker is tracker shared by controllers and selectors created with New
+var DefaultTracker = NewTracker()
+
+func NewTracker() *Tracker {
+	return &Tracker{stats: make(map[string]*nodeStats)}
+}
+
+// Begin marks start of request toward node and returns function that
+// should be invoked once request toward node is finished
+func (t *Tracker) Begin(nodeID string) func() {
+	start := time.Now()
+
+	t.mutex.Lock()
+	t.get(nodeID).outstanding++
+	t.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.finish(nodeID, time.Since(start))
+		})
+	}
+}
+
+func (t *Tracker) finish(nodeID string, latency time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	stats := t.get(nodeID)
+	stats.outstanding--
+	sample := float64(latency)
+	if !stats.hasLatency {
+		stats.latency = sample
+		stats.hasLatency = true
+	} else {
+		stats.latency = EWMADecay*sample + (1-EWMADecay)*stats.latency
+	}
+}
+
+// Latency returns exponentially weighted moving average of node latency and
+// false if there is no latency recorded for node
+func (t *Tracker) Latency(nodeID string) (time.Duration, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	stats, ok := t.stats[nodeID]
+	if !ok || !stats.hasLatency {
+		return 0, false
+	}
+	return time.Duration(stats.latency), true
+}
+
+// Outstanding returns number of requests toward node that are not yet finished
+func (t *Tracker) Outstanding(nodeID string) int64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	stats, ok := t.stats[nodeID]
+	if !ok {
+		return 0
+	}
+	return stats.outstanding
+}
+
+// get returns stats for node, caller must hold write lock
+func (t *Tracker) get(nodeID string) *nodeStats {
+	stats, ok := t.stats[nodeID]
+	if !ok {
+		stats = &nodeStats{}
+		t.stats[nodeID] = stats
+	}
+	return stats
+}
+
+// Track marks start of request toward node on DefaultTracker
+func Track(nodeID string) func() {
+	return DefaultTracker.Begin(nodeID)
+}
@@ -0,0 +1,35 @@
+package selection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_Begin(t *testing.T) {
+	tracker := NewTracker()
+
+	done := tracker.Begin("1")
+	assert.Equal(t, int64(1), tracker.Outstanding("1"))
+	_, ok := tracker.Latency("1")
+	assert.False(t, ok, "Latency should not be recorded before request finished")
+
+	done()
+	done()
+	assert.Equal(t, int64(0), tracker.Outstanding("1"), "Finishing same request twice should have no effect")
+	_, ok = tracker.Latency("1")
+	assert.True(t, ok)
+}
+
+func TestTracker_Latency(t *testing.T) {
+	tracker := NewTracker()
+
+	tracker.finish("1", 100*time.Millisecond)
+	latency, _ := tracker.Latency("1")
+	assert.Equal(t, 100*time.Millisecond, latency, "First sample should be used as average")
+
+	tracker.finish("1", 200*time.Millisecond)
+	latency, _ = tracker.Latency("1")
+	assert.Equal(t, 130*time.Millisecond, latency)
+}
@@ -0,0 +1,63 @@
+package selection
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/models"
+)
+
+// minWeightedLatency caps node weight so single very fast measurement can't starve other nodes
+const minWeightedLatency = time.Millisecond
+
+type weightedRandomSelector struct {
+	tracker *Tracker
+	rand    *lockedRand
+}
+
+// NewWeightedRandomSelector creates selector that orders nodes randomly, where chance of node being
+// selected first is proportional to inverse of its moving average latency. Nodes without recorded
+// latency get average weight of measured nodes.
+func NewWeightedRandomSelector(tracker *Tracker) Selector {
+	return &weightedRandomSelector{tracker: tracker, rand: newLockedRand()}
+}
+
+func (s *weightedRandomSelector) Select(nodes []models.Node) []models.Node {
+	result := copyNodes(nodes)
+
+	weights := make(map[string]float64, len(result))
+	measuredWeightSum := 0.0
+	measured := 0
+	for _, node := range result {
+		latency, ok := s.tracker.Latency(node.ID)
+		if !ok {
+			continue
+		}
+		if latency < minWeightedLatency {
+			latency = minWeightedLatency
+		}
+		weights[node.ID] = 1 / latency.Seconds()
+		measuredWeightSum += weights[node.ID]
+		measured++
+	}
+	defaultWeight := 1.0
+	if measured > 0 {
+		defaultWeight = measuredWeightSum / float64(measured)
+	}
+
+	// weighted random ordering without replacement, each node gets key u^(1/w)
+	// and nodes are ordered by descending key
+	keys := make(map[string]float64, len(result))
+	for _, node := range result {
+		weight, ok := weights[node.ID]
+		if !ok {
+			weight = defaultWeight
+		}
+		keys[node.ID] = math.Pow(s.rand.Float64(), 1/weight)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return keys[result[i].ID] > keys[result[j].ID]
+	})
+	return result
+}
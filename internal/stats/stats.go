@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"github.com/NodeFactoryIo/vedran/internal/capability"
 	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/repositories"
 	log "github.com/sirupsen/logrus"
@@ -78,8 +79,15 @@ func CalculateNodeStatisticsForInterval(
 		return nil, err
 	}
 
-	return &models.NodeStatsDetails{
+	capabilities := capability.Get(nodeId)
+	details := &models.NodeStatsDetails{
 		TotalPings:    totalPings,
 		TotalRequests: float64(len(recordsInInterval)),
-	}, nil
+		Pruning:       capabilities.Pruning,
+		RPCModules:    capabilities.RPCModules,
+	}
+	if capabilities.IsArchive() {
+		details.RewardWeight = capability.ArchiveRewardWeight()
+	}
+	return details, nil
 }
@@ -4,12 +4,19 @@ import (
 	"fmt"
 
 	"github.com/NodeFactoryIo/vedran/internal/auth"
+	"github.com/NodeFactoryIo/vedran/internal/nodeclient"
 	"github.com/NodeFactoryIo/vedran/pkg/http-tunnel/server"
 	log "github.com/sirupsen/logrus"
 )
 
 func StartHttpTunnelServer(serverPort string, portPool *server.AddrPool) {
 	logger := log.WithField("context", "http-tunnel")
+	// tear down pooled node connections when tunnel is disconnected
+	portPool.SetReleaseHandler(func(remote server.RemoteID) {
+		if remote.PortName == "http" {
+			nodeclient.Release(remote.Port)
+		}
+	})
 	s, err := server.NewServer(&server.ServerConfig{
 		Address:  fmt.Sprintf(":%s", serverPort),
 		PortPool: portPool,
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"github.com/NodeFactoryIo/vedran/internal/models"
 	"github.com/NodeFactoryIo/vedran/internal/payout"
 	"github.com/gosuri/uitable"
 )
@@ -16,3 +17,31 @@ func DisplayTransactionsStatus(transactions []*payout.TransactionDetails) {
 	}
 	fmt.Println(table)
 }
+
+func DisplayAPIKeys(apiKeys []models.APIKey) {
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("Name", "Key", "Daily quota", "Monthly quota", "Disabled", "Verified", "Requests today", "Requests this month", "Total requests")
+	for _, apiKey := range apiKeys {
+		table.AddRow(
+			apiKey.Name,
+			apiKey.Key,
+			displayQuota(apiKey.DailyQuota),
+			displayQuota(apiKey.MonthlyQuota),
+			apiKey.Disabled,
+			apiKey.Verified,
+			apiKey.Usage.DailyRequests,
+			apiKey.Usage.MonthlyRequests,
+			apiKey.Usage.TotalRequests,
+		)
+	}
+	fmt.Println(table)
+}
+
+func displayQuota(quota int64) string {
+	if quota == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprint(quota)
+}
@@ -0,0 +1,150 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/NodeFactoryIo/vedran/internal/hedge"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+)
+
+const (
+	// DefaultNodes is default number of distinct nodes verified request is sent to
+	DefaultNodes = 3
+)
+
+// Config defines which requests are verified by sending them to multiple nodes
+type Config struct {
+	// Methods are verified for all consumers, requests with verified api key are verified for all methods
+	Methods []string
+	// Nodes is number of distinct nodes verified request is sent to, response is returned
+	// only if majority of them returned same response
+	Nodes int
+}
+
+// Verifier decides which requests are verified and compares node responses
+type Verifier struct {
+	methods map[string]bool
+	nodes   int
+}
+
+// New creates verifier from config, error is returned if less than 2 nodes are set or
+// if method that is not idempotent is set as verified
+func New(config Config) (*Verifier, error) {
+	if config.Nodes < 2 {
+		return nil, fmt.Errorf("invalid number of verifying nodes %d, at least 2 nodes are required", config.Nodes)
+	}
+	v := &Verifier{methods: make(map[string]bool), nodes: config.Nodes}
+	for _, method := range config.Methods {
+		if !hedge.IsIdempotent(method) {
+			return nil, fmt.Errorf("method %s can't be verified because it is not idempotent", method)
+		}
+		v.methods[method] = true
+	}
+	return v, nil
+}
+
+// Required returns if request with method should be verified, verifiedKey tells if request
+// was sent with verified api key. Methods that are not idempotent are never verified.
+func (v *Verifier) Required(method string, verifiedKey bool) bool {
+	return (verifiedKey || v.methods[method]) && hedge.IsIdempotent(method)
+}
+
+// Nodes returns number of distinct nodes verified request is sent to
+func (v *Verifier) Nodes() int {
+	return v.nodes
+}
+
+// Quorum returns number of nodes that must return same response for response to be accepted
+func (v *Verifier) Quorum() int {
+	return v.nodes/2 + 1
+}
+
+// Canonicalize returns result or error of node response as json with sorted object keys and without
+// insignificant whitespace, so responses of different nodes can be compared
+func Canonicalize(response []byte) (string, error) {
+	var rpcResponse rpc.RPCResponse
+	if err := json.Unmarshal(response, &rpcResponse); err != nil {
+		return "", err
+	}
+
+	var content interface{}
+	switch {
+	case rpcResponse.Error != nil:
+		content = map[string]interface{}{"error": rpcResponse.Error}
+	case rpcResponse.Result != nil:
+		decoder := json.NewDecoder(bytes.NewReader(*rpcResponse.Result))
+		// numbers are kept as they are so big numbers don't lose precision
+		decoder.UseNumber()
+		var result interface{}
+		if err := decoder.Decode(&result); err != nil {
+			return "", err
+		}
+		content = map[string]interface{}{"result": result}
+	default:
+		return "", errors.New("response has neither result nor error")
+	}
+
+	canonical, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+// Vote finds canonical response returned by at least quorum nodes, responses are canonical responses
+// by node id. Nodes that returned other responses are returned as faulty, sorted by id. If no response
+// reached quorum, ok is false and no node is returned as faulty, as it can't be told which nodes are wrong.
+func Vote(responses map[string]string, quorum int) (majority string, faulty []string, ok bool) {
+	votes := make(map[string]int)
+	for _, response := range responses {
+		votes[response]++
+	}
+	for response, count := range votes {
+		if count >= quorum {
+			majority, ok = response, true
+			break
+		}
+	}
+	if !ok {
+		return "", nil, false
+	}
+
+	for nodeID, response := range responses {
+		if response != majority {
+			faulty = append(faulty, nodeID)
+		}
+	}
+	sort.Strings(faulty)
+	return majority, faulty, true
+}
+
+var verifier, _ = New(Config{Nodes: DefaultNodes})
+
+// Init replaces default verifier with verifier created from config
+func Init(config Config) error {
+	v, err := New(config)
+	if err != nil {
+		return err
+	}
+	verifier = v
+	return nil
+}
+
+// Required checks if request should be verified on default verifier
+func Required(method string, verifiedKey bool) bool {
+	return verifier.Required(method, verifiedKey)
+}
+
+// Nodes returns number of verifying nodes of default verifier
+func Nodes() int {
+	return verifier.Nodes()
+}
+
+// Quorum returns quorum of default verifier
+func Quorum() int {
+	return verifier.Quorum()
+}
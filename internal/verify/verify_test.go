@@ -0,0 +1,93 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := New(Config{Nodes: 1})
+	assert.Error(t, err)
+	_, err = New(Config{Nodes: 3, Methods: []string{"author_submitExtrinsic"}})
+	assert.Error(t, err)
+	_, err = New(Config{Nodes: 3, Methods: []string{"chain_subscribeNewHeads"}})
+	assert.Error(t, err)
+}
+
+func TestVerifier_Required(t *testing.T) {
+	v, err := New(Config{Nodes: 3, Methods: []string{"state_getStorage"}})
+	assert.NoError(t, err)
+
+	assert.True(t, v.Required("state_getStorage", false))
+	assert.False(t, v.Required("chain_getBlockHash", false))
+	assert.True(t, v.Required("chain_getBlockHash", true))
+	assert.False(t, v.Required("author_submitExtrinsic", true))
+	assert.Equal(t, 2, v.Quorum())
+	assert.Equal(t, 3, v.Nodes())
+}
+
+func TestCanonicalize(t *testing.T) {
+	first, err := Canonicalize([]byte(`{"id": 1, "jsonrpc": "2.0", "result": {"b": 1, "a": 123456789012345678901234567890}}`))
+	assert.NoError(t, err)
+	second, err := Canonicalize([]byte(`{"jsonrpc":"2.0","result":{"a":123456789012345678901234567890,"b":1},"id":2}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"result":{"a":123456789012345678901234567890,"b":1}}`, first)
+	assert.Equal(t, first, second)
+
+	errResponse, err := Canonicalize([]byte(`{"id":1,"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params"}}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, errResponse)
+
+	_, err = Canonicalize([]byte(`{"id":1,"jsonrpc":"2.0"}`))
+	assert.Error(t, err)
+	_, err = Canonicalize([]byte(`invalid`))
+	assert.Error(t, err)
+}
+
+func TestVote(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    map[string]string
+		quorum       int
+		wantMajority string
+		wantFaulty   []string
+		wantOk       bool
+	}{
+		{
+			name:         "all nodes agree",
+			responses:    map[string]string{"1": "a", "2": "a", "3": "a"},
+			quorum:       2,
+			wantMajority: "a",
+			wantOk:       true,
+		},
+		{
+			name:         "single node disagrees",
+			responses:    map[string]string{"1": "a", "2": "b", "3": "a"},
+			quorum:       2,
+			wantMajority: "a",
+			wantFaulty:   []string{"2"},
+			wantOk:       true,
+		},
+		{
+			name:      "no response reaches quorum",
+			responses: map[string]string{"1": "a", "2": "b", "3": "c"},
+			quorum:    2,
+			wantOk:    false,
+		},
+		{
+			name:      "not enough responses",
+			responses: map[string]string{"1": "a"},
+			quorum:    2,
+			wantOk:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			majority, faulty, ok := Vote(test.responses, test.quorum)
+			assert.Equal(t, test.wantMajority, majority)
+			assert.Equal(t, test.wantFaulty, faulty)
+			assert.Equal(t, test.wantOk, ok)
+		})
+	}
+}
@@ -7,11 +7,14 @@ import (
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"os"
+	"sync"
 )
 
 var (
 	fileWithWhitelistedNodes string
 	whitelistedNodes         []string
+	// mutex guards whitelisted nodes, as they can be changed at runtime through admin api
+	mutex sync.Mutex
 )
 
 var newLine = []byte{'\n'}
@@ -52,6 +55,9 @@ func initWhitelistedNodesFromFile(filePath string) error {
 }
 
 func IsNodeWhitelisted(nodeId string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	if fileWithWhitelistedNodes != "" {
 		file, err := ioutil.ReadFile(fileWithWhitelistedNodes)
 		if err != nil {
@@ -75,6 +81,9 @@ func IsNodeWhitelisted(nodeId string) bool {
 }
 
 func RemoveNodeFromWhitelisted(nodeId string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
 	if fileWithWhitelistedNodes != "" {
 		return removeNodeFromWhitelistFile(nodeId)
 	} else if len(whitelistedNodes) != 0 {
@@ -85,6 +94,65 @@ func RemoveNodeFromWhitelisted(nodeId string) error {
 	}
 }
 
+// GetWhitelistedNodes returns IDs of all whitelisted nodes
+func GetWhitelistedNodes() ([]string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if fileWithWhitelistedNodes != "" {
+		file, err := ioutil.ReadFile(fileWithWhitelistedNodes)
+		if err != nil {
+			return nil, err
+		}
+		nodes := []string{}
+		for _, nodeIdBytes := range bytes.Split(file, newLine) {
+			if len(nodeIdBytes) != 0 {
+				nodes = append(nodes, string(nodeIdBytes))
+			}
+		}
+		return nodes, nil
+	}
+	return append([]string{}, whitelistedNodes...), nil
+}
+
+// AddNodeToWhitelisted adds node to whitelisted nodes, if whitelisting is enabled
+func AddNodeToWhitelisted(nodeId string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if fileWithWhitelistedNodes != "" {
+		return addNodeToWhitelistFile(nodeId)
+	} else if whitelistedNodes != nil {
+		for _, id := range whitelistedNodes {
+			if id == nodeId {
+				return nil
+			}
+		}
+		whitelistedNodes = append(whitelistedNodes, nodeId)
+		return nil
+	} else {
+		return errors.New("whitelisting disabled")
+	}
+}
+
+func addNodeToWhitelistFile(nodeId string) error {
+	file, err := ioutil.ReadFile(fileWithWhitelistedNodes)
+	if err != nil {
+		return err
+	}
+	for _, nodeIdBytes := range bytes.Split(file, newLine) {
+		if string(nodeIdBytes) == nodeId {
+			return nil
+		}
+	}
+	// append node id as new line
+	if len(file) != 0 && !bytes.HasSuffix(file, newLine) {
+		file = append(file, newLine...)
+	}
+	file = append(file, []byte(nodeId)...)
+	return ioutil.WriteFile(fileWithWhitelistedNodes, file, 0644)
+}
+
 func removeNodeFromWhitelistFile(nodeId string) error {
 	file, err := ioutil.ReadFile(fileWithWhitelistedNodes)
 	if err != nil {
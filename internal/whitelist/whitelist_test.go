@@ -177,3 +177,40 @@ func Test_InitWhitelistedNodesFromFile_FileDoesntExist(t *testing.T) {
 	assert.Error(t, initWhitelistedNodesFromFile("test-file.txt"))
 	reset()
 }
+
+func Test_AddNodeToWhitelisted_FromMemory(t *testing.T) {
+	_ = initWhitelistedNodes([]string{"node1"})
+	defer reset()
+
+	assert.NoError(t, AddNodeToWhitelisted("node2"))
+	// adding already whitelisted node is noop
+	assert.NoError(t, AddNodeToWhitelisted("node1"))
+
+	nodes, err := GetWhitelistedNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node1", "node2"}, nodes)
+	assert.True(t, IsNodeWhitelisted("node2"))
+}
+
+func Test_AddNodeToWhitelisted_FromFile(t *testing.T) {
+	createTmpWhitelistTestFile(t, "node1\nnode2\n")
+	defer os.Remove("./tmp_whitelist_test.txt")
+	_ = initWhitelistedNodesFromFile("./tmp_whitelist_test.txt")
+	defer reset()
+
+	assert.NoError(t, AddNodeToWhitelisted("node3"))
+	assert.NoError(t, AddNodeToWhitelisted("node2"))
+
+	fileContent, _ := ioutil.ReadFile("./tmp_whitelist_test.txt")
+	assert.Equal(t, "node1\nnode2\nnode3", string(fileContent))
+	nodes, err := GetWhitelistedNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node1", "node2", "node3"}, nodes)
+}
+
+func Test_AddNodeToWhitelisted_Disabled(t *testing.T) {
+	assert.Error(t, AddNodeToWhitelisted("node1"))
+	nodes, err := GetWhitelistedNodes()
+	assert.NoError(t, err)
+	assert.Empty(t, nodes)
+}
@@ -0,0 +1,407 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/actions"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/record"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// sharedSubscriptions maps subscribe methods whose notifications are same for every client
+// to their unsubscribe methods
+var sharedSubscriptions = map[string]string{
+	"chain_subscribeNewHeads":       "chain_unsubscribeNewHeads",
+	"chain_subscribeFinalizedHeads": "chain_unsubscribeFinalizedHeads",
+	"state_subscribeRuntimeVersion": "state_unsubscribeRuntimeVersion",
+}
+
+// IsSharedSubscribeMethod returns if subscription opened with rpc method can be shared between clients
+func IsSharedSubscribeMethod(method string) bool {
+	_, ok := sharedSubscriptions[method]
+	return ok
+}
+
+func isSharedUnsubscribeMethod(method string) bool {
+	for _, unsubscribeMethod := range sharedSubscriptions {
+		if unsubscribeMethod == method {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriber is client session subscribed to shared subscription under its own subscription id,
+// clientID is id of subscribe request and is set until client is answered
+type subscriber struct {
+	session  *Session
+	subID    json.RawMessage
+	clientID json.RawMessage
+}
+
+// feed is single node subscription whose notifications are fanned out to subscribers. Subscribers
+// that subscribed before node confirmed subscription are waiting for confirmation.
+type feed struct {
+	key           string
+	method        string
+	params        json.RawMessage
+	node          models.Node
+	upstream      *websocket.Conn
+	requestID     uint64
+	upstreamSubID json.RawMessage
+	subscribers   map[string]*subscriber
+	waiting       []*subscriber
+	last          []byte
+	failedNodes   map[string]bool
+}
+
+func (f *feed) empty() bool {
+	return len(f.subscribers) == 0 && len(f.waiting) == 0
+}
+
+// delivery is message that should be sent to client session
+type delivery struct {
+	session *Session
+	msg     []byte
+}
+
+// Hub keeps single node subscription for each distinct shared subscription method and params and
+// fans its notifications out to all subscribed sessions, each under its own subscription id. Node
+// subscription is moved to next node if node fails and closed when last client unsubscribes.
+type Hub struct {
+	repos     repositories.Repos
+	actions   actions.Actions
+	nextNodes func() []models.Node
+
+	mutex     sync.Mutex
+	sendMutex sync.Mutex
+	nextSubID uint64
+	feeds     map[string]*feed
+	subs      map[string]*feed
+}
+
+// NewHub creates hub, nextNodes is used to fetch candidate nodes for node subscriptions
+func NewHub(repos repositories.Repos, actions actions.Actions, nextNodes func() []models.Node) *Hub {
+	return &Hub{
+		repos:     repos,
+		actions:   actions,
+		nextNodes: nextNodes,
+		feeds:     make(map[string]*feed),
+		subs:      make(map[string]*feed),
+	}
+}
+
+// Subscribe subscribes session to shared subscription, opening node subscription if there is none
+// for request method and params. Client is answered once node confirms subscription.
+func (h *Hub) Subscribe(session *Session, request rpc.RPCRequest) {
+	h.mutex.Lock()
+
+	h.nextSubID++
+	sub := &subscriber{
+		session:  session,
+		subID:    json.RawMessage(strconv.Quote(fmt.Sprintf("vedran-%d", h.nextSubID))),
+		clientID: request.ID,
+	}
+
+	key := feedKey(request.Method, request.Params)
+	f, ok := h.feeds[key]
+	if !ok {
+		f = &feed{
+			key:         key,
+			method:      request.Method,
+			params:      request.Params,
+			subscribers: make(map[string]*subscriber),
+			failedNodes: make(map[string]bool),
+		}
+		h.feeds[key] = f
+	}
+	h.subs[rpc.IDKey(sub.subID)] = f
+
+	var deliveries []delivery
+	switch {
+	case f.upstreamSubID != nil:
+		deliveries = h.confirmLocked(f, sub)
+	case !ok:
+		f.waiting = append(f.waiting, sub)
+		deliveries = h.connectLocked(f)
+	default:
+		f.waiting = append(f.waiting, sub)
+	}
+	h.unlockAndDeliver(deliveries)
+}
+
+// Unsubscribe removes session subscription and returns if subscription from request params
+// is shared subscription owned by session
+func (h *Hub) Unsubscribe(session *Session, request rpc.RPCRequest) bool {
+	var params []json.RawMessage
+	if json.Unmarshal(request.Params, &params) != nil || len(params) == 0 {
+		return false
+	}
+
+	h.mutex.Lock()
+	f, ok := h.subs[rpc.IDKey(params[0])]
+	if !ok || !h.removeSubscriberLocked(f, rpc.IDKey(params[0]), session) {
+		h.mutex.Unlock()
+		return false
+	}
+	if f.empty() {
+		h.closeFeedLocked(f)
+	}
+
+	result := json.RawMessage("true")
+	response, _ := json.Marshal(rpc.RPCResponse{JSONRPC: "2.0", ID: request.ID, Result: &result})
+	h.unlockAndDeliver([]delivery{{session: session, msg: response}})
+	return true
+}
+
+// RemoveSession removes all session subscriptions, it should be called when session is closed
+func (h *Hub) RemoveSession(session *Session) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for subID, f := range h.subs {
+		if h.removeSubscriberLocked(f, subID, session) && f.empty() {
+			h.closeFeedLocked(f)
+		}
+	}
+}
+
+func (h *Hub) removeSubscriberLocked(f *feed, subID string, session *Session) bool {
+	if sub, ok := f.subscribers[subID]; ok && sub.session == session {
+		delete(f.subscribers, subID)
+		delete(h.subs, subID)
+		return true
+	}
+	for i, sub := range f.waiting {
+		if rpc.IDKey(sub.subID) == subID && sub.session == session {
+			f.waiting = append(f.waiting[:i], f.waiting[i+1:]...)
+			delete(h.subs, subID)
+			return true
+		}
+	}
+	return false
+}
+
+// confirmLocked adds subscriber to feed and returns subscribe response for it, followed by
+// last notification so subscriber receives current state as it would from node
+func (h *Hub) confirmLocked(f *feed, sub *subscriber) []delivery {
+	f.subscribers[rpc.IDKey(sub.subID)] = sub
+
+	subID := sub.subID
+	response, _ := json.Marshal(rpc.RPCResponse{JSONRPC: "2.0", ID: sub.clientID, Result: &subID})
+	sub.clientID = nil
+
+	deliveries := []delivery{{session: sub.session, msg: response}}
+	if f.last != nil {
+		deliveries = append(deliveries, delivery{
+			session: sub.session,
+			msg:     replaceField(f.last, []string{"params", "subscription"}, sub.subID),
+		})
+	}
+	return deliveries
+}
+
+// connectLocked opens node subscription for feed on first available node, if there is none
+// feed is dropped
+func (h *Hub) connectLocked(f *feed) []delivery {
+	for _, node := range h.nextNodes() {
+		if f.failedNodes[node.ID] {
+			continue
+		}
+		upstream, connErr := DialNode(node.ID)
+		if connErr != nil {
+			log.Errorf("Establishing connection with node %s failed because of %v", node.ID, connErr)
+			if connErr.IsNodeError() {
+				go h.actions.PenalizeNode(node, h.repos, penalty.WSHandshakeFailure)
+			}
+			f.failedNodes[node.ID] = true
+			continue
+		}
+
+		f.requestID++
+		msg, _ := json.Marshal(rpc.RPCRequest{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage(strconv.FormatUint(f.requestID, 10)),
+			Method:  f.method,
+			Params:  f.params,
+		})
+		err := upstream.WriteMessage(websocket.TextMessage, msg)
+		if err != nil {
+			log.Errorf("Sending request to node %s failed because of %v", node.ID, err)
+			closeConn(upstream, fmt.Sprintf("error on closing ws connection towards node %s", node.ID))
+			go record.FailedRequest(node, h.repos, h.actions, penalty.RPCFailure)
+			f.failedNodes[node.ID] = true
+			continue
+		}
+
+		f.node = node
+		f.upstream = upstream
+		go h.repos.NodeRepo.UpdateNodeUsed(node)
+		go h.readFeed(f, node, upstream)
+		return nil
+	}
+
+	log.Errorf("Failed opening shared subscription %s on any node", f.method)
+	return h.dropFeedLocked(f, nil)
+}
+
+// dropFeedLocked closes feed that can't be served. Waiting subscribers are answered with error and
+// sessions of confirmed subscribers are closed as their subscriptions can't be served anymore.
+func (h *Hub) dropFeedLocked(f *feed, rpcErr *rpc.RPCError) []delivery {
+	if rpcErr == nil {
+		rpcErr = &rpc.RPCError{Code: rpc.InternalServerError, Message: "Internal Server Error"}
+	}
+
+	var deliveries []delivery
+	for _, sub := range f.waiting {
+		delete(h.subs, rpc.IDKey(sub.subID))
+		response, _ := json.Marshal(rpc.RPCResponse{JSONRPC: "2.0", ID: sub.clientID, Error: rpcErr})
+		deliveries = append(deliveries, delivery{session: sub.session, msg: response})
+	}
+	for subID, sub := range f.subscribers {
+		delete(h.subs, subID)
+		go sub.session.Close()
+	}
+	f.waiting = nil
+	f.subscribers = make(map[string]*subscriber)
+
+	h.closeFeedLocked(f)
+	return deliveries
+}
+
+// closeFeedLocked unsubscribes node subscription and closes node connection
+func (h *Hub) closeFeedLocked(f *feed) {
+	if h.feeds[f.key] == f {
+		delete(h.feeds, f.key)
+	}
+	if f.upstream == nil {
+		return
+	}
+
+	if f.upstreamSubID != nil {
+		f.requestID++
+		params, _ := json.Marshal([]json.RawMessage{f.upstreamSubID})
+		msg, _ := json.Marshal(rpc.RPCRequest{
+			JSONRPC: "2.0",
+			ID:      json.RawMessage(strconv.FormatUint(f.requestID, 10)),
+			Method:  sharedSubscriptions[f.method],
+			Params:  params,
+		})
+		_ = f.upstream.WriteMessage(websocket.TextMessage, msg)
+	}
+	closeConn(f.upstream, fmt.Sprintf("error on closing ws connection towards node %s", f.node.ID))
+	f.upstream = nil
+	f.upstreamSubID = nil
+}
+
+func (h *Hub) readFeed(f *feed, node models.Node, upstream *websocket.Conn) {
+	for {
+		_, msg, err := upstream.ReadMessage()
+		if err != nil {
+			h.failover(f, node, upstream)
+			return
+		}
+
+		subscribers := h.handleFeedMessage(f, upstream, msg)
+		if subscribers > 0 {
+			record.SharedNotification(node, h.repos, subscribers)
+		}
+	}
+}
+
+// handleFeedMessage handles node message on feed connection and returns number of subscribers
+// message was fanned out to if message is subscription notification
+func (h *Hub) handleFeedMessage(f *feed, upstream *websocket.Conn, msg []byte) int {
+	h.mutex.Lock()
+	if f.upstream != upstream {
+		h.mutex.Unlock()
+		return 0
+	}
+
+	var m message
+	if json.Unmarshal(msg, &m) != nil {
+		h.mutex.Unlock()
+		return 0
+	}
+
+	var deliveries []delivery
+	switch {
+	case m.ID != nil:
+		if rpc.IDKey(m.ID) != strconv.FormatUint(f.requestID, 10) || f.upstreamSubID != nil {
+			break
+		}
+		if m.Error != nil || m.Result == nil {
+			log.Errorf("Opening shared subscription %s failed on node %s", f.method, f.node.ID)
+			deliveries = h.dropFeedLocked(f, m.Error)
+			break
+		}
+		f.upstreamSubID = m.Result
+		f.failedNodes = make(map[string]bool)
+		for _, sub := range f.waiting {
+			deliveries = append(deliveries, h.confirmLocked(f, sub)...)
+		}
+		f.waiting = nil
+	case m.Params != nil && f.upstreamSubID != nil && rpc.IDKey(m.Params.Subscription) == rpc.IDKey(f.upstreamSubID):
+		f.last = msg
+		for _, sub := range f.subscribers {
+			deliveries = append(deliveries, delivery{
+				session: sub.session,
+				msg:     replaceField(msg, []string{"params", "subscription"}, sub.subID),
+			})
+		}
+		h.unlockAndDeliver(deliveries)
+		return len(deliveries)
+	}
+
+	h.unlockAndDeliver(deliveries)
+	return 0
+}
+
+// failover moves feed to next available node, subscribers keep their subscription ids
+func (h *Hub) failover(f *feed, failedNode models.Node, failedUpstream *websocket.Conn) {
+	h.mutex.Lock()
+	if f.upstream != failedUpstream {
+		h.mutex.Unlock()
+		return
+	}
+
+	log.Errorf("Shared subscription %s failed on node %s, moving it to next node", f.method, failedNode.ID)
+	closeConn(failedUpstream, fmt.Sprintf("error on closing ws connection towards node %s", failedNode.ID))
+	go record.FailedRequest(failedNode, h.repos, h.actions, penalty.RPCFailure)
+	f.failedNodes[failedNode.ID] = true
+	f.upstream = nil
+	f.upstreamSubID = nil
+
+	h.unlockAndDeliver(h.connectLocked(f))
+}
+
+// unlockAndDeliver releases hub lock and sends messages to clients, messages are sent in same
+// order they were produced so subscribe response always precedes first notification
+func (h *Hub) unlockAndDeliver(deliveries []delivery) {
+	h.sendMutex.Lock()
+	h.mutex.Unlock()
+	defer h.sendMutex.Unlock()
+
+	for _, d := range deliveries {
+		if !d.session.writeClient(websocket.TextMessage, d.msg) {
+			go d.session.Close()
+		}
+	}
+}
+
+func feedKey(method string, params json.RawMessage) string {
+	var compact bytes.Buffer
+	if len(params) == 0 || json.Compact(&compact, params) != nil || compact.String() == "null" {
+		return method + "[]"
+	}
+	return method + compact.String()
+}
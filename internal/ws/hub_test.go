@@ -0,0 +1,180 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
+	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
+	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// feedNode answers subscriptions, records received methods and sends notification to
+// all subscriptions when notify is called
+type feedNode struct {
+	methods chan string
+
+	mutex sync.Mutex
+	conns map[*websocket.Conn]string
+}
+
+func (n *feedNode) handle(w http.ResponseWriter, r *http.Request) {
+	conn, err := testUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request rpc.RPCRequest
+		_ = json.Unmarshal(msg, &request)
+		n.methods <- request.Method
+
+		n.mutex.Lock()
+		if IsSubscribeMethod(request.Method) {
+			n.conns[conn] = fmt.Sprintf("up-%d", len(n.conns)+1)
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, request.ID, n.conns[conn])))
+		} else {
+			delete(n.conns, conn)
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":true}`, request.ID)))
+		}
+		n.mutex.Unlock()
+	}
+}
+
+func (n *feedNode) notify(result string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for conn, subID := range n.conns {
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(
+			`{"jsonrpc":"2.0","method":"chain_newHead","params":{"subscription":"%s","result":"%s"}}`,
+			subID, result)))
+	}
+}
+
+type notification struct {
+	Params struct {
+		Subscription json.RawMessage `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func TestHub_FanOut(t *testing.T) {
+	node := &feedNode{methods: make(chan string, 10), conns: make(map[*websocket.Conn]string)}
+	nodeServer := httptest.NewServer(http.HandlerFunc(node.handle))
+	defer nodeServer.Close()
+
+	poolerMock := &tunnelMocks.Pooler{}
+	poolerMock.On("GetWSPort", "1").Return(wsPort(nodeServer), nil)
+	configuration.Config.PortPool = poolerMock
+	defer func() { configuration.Config.PortPool = nil }()
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, RecordRepo: &recordRepoMock}
+	actionsMockObject := new(actionMocks.Actions)
+
+	nodes := []models.Node{{ID: "1"}}
+	nextNodes := func() []models.Node { return nodes }
+	hub := NewHub(repos, actionsMockObject, nextNodes)
+
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		session := NewSession(client, repos, actionsMockObject, nextNodes, SessionOptions{Hub: hub})
+		upstream, connErr := DialNode("1")
+		if connErr != nil {
+			_ = client.Close()
+			return
+		}
+		session.Start(nodes[0], upstream)
+	}))
+	defer lb.Close()
+
+	var clients []*websocket.Conn
+	var subIDs []json.RawMessage
+	for i := 0; i < 2; i++ {
+		client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(lb.URL, "http"), nil)
+		assert.NoError(t, err)
+		defer client.Close()
+		_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		err = client.WriteMessage(websocket.TextMessage,
+			[]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"chain_subscribeNewHeads","params":[]}`, i)))
+		assert.NoError(t, err)
+
+		var response rpc.RPCResponse
+		err = client.ReadJSON(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, json.RawMessage(fmt.Sprint(i)), response.ID)
+		assert.NotNil(t, response.Result)
+		clients = append(clients, client)
+		subIDs = append(subIDs, *response.Result)
+	}
+	assert.NotEqual(t, subIDs[0], subIDs[1])
+	assert.Equal(t, "chain_subscribeNewHeads", <-node.methods)
+
+	// single node notification is delivered to both clients under their subscription ids
+	node.notify("head")
+	for i, client := range clients {
+		var n notification
+		err := client.ReadJSON(&n)
+		assert.NoError(t, err)
+		assert.Equal(t, subIDs[i], n.Params.Subscription)
+		assert.Equal(t, json.RawMessage(`"head"`), n.Params.Result)
+	}
+
+	// node subscription is closed only after last client unsubscribes
+	for i, client := range clients {
+		err := client.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(
+			`{"jsonrpc":"2.0","id":"u%d","method":"chain_unsubscribeNewHeads","params":[%s]}`, i, subIDs[i])))
+		assert.NoError(t, err)
+
+		var response rpc.RPCResponse
+		err = client.ReadJSON(&response)
+		assert.NoError(t, err)
+		assert.Equal(t, json.RawMessage(fmt.Sprintf(`"u%d"`, i)), response.ID)
+		assert.Equal(t, json.RawMessage("true"), *response.Result)
+
+		if i == 0 {
+			assert.Len(t, node.methods, 0)
+		}
+	}
+	select {
+	case method := <-node.methods:
+		assert.Equal(t, "chain_unsubscribeNewHeads", method)
+	case <-time.After(5 * time.Second):
+		t.Fatal("node subscription was not closed")
+	}
+	recordRepoMock.AssertNumberOfCalls(t, "Save", 1)
+}
+
+func TestFeedKey(t *testing.T) {
+	assert.Equal(t, feedKey("m", nil), feedKey("m", json.RawMessage("[]")))
+	assert.Equal(t, feedKey("m", json.RawMessage("null")), feedKey("m", json.RawMessage("[ ]")))
+	assert.Equal(t, feedKey("m", json.RawMessage(`["a", 1]`)), feedKey("m", json.RawMessage(`["a",1]`)))
+	assert.NotEqual(t, feedKey("m", json.RawMessage(`["a"]`)), feedKey("m", json.RawMessage(`["b"]`)))
+}
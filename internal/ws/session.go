@@ -0,0 +1,619 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/NodeFactoryIo/vedran/internal/actions"
+	"github.com/NodeFactoryIo/vedran/internal/apikey"
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/fallback"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/penalty"
+	"github.com/NodeFactoryIo/vedran/internal/policy"
+	"github.com/NodeFactoryIo/vedran/internal/ratelimit"
+	"github.com/NodeFactoryIo/vedran/internal/record"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// IsSubscribeMethod returns if rpc method opens subscription on node
+func IsSubscribeMethod(method string) bool {
+	return strings.Contains(method, "_subscribe") || method == "author_submitAndWatchExtrinsic"
+}
+
+// IsUnsubscribeMethod returns if rpc method closes subscription on node
+func IsUnsubscribeMethod(method string) bool {
+	return strings.Contains(method, "_unsubscribe") || method == "author_unwatchExtrinsic"
+}
+
+// message is json rpc frame received from node, it is either response or subscription notification
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params *struct {
+		Subscription json.RawMessage `json:"subscription"`
+	} `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpc.RPCError   `json:"error"`
+}
+
+// subscription is client subscription that is re-issued on new node if node serving it fails
+type subscription struct {
+	method        string
+	params        json.RawMessage
+	clientSubID   json.RawMessage
+	upstreamSubID json.RawMessage
+}
+
+// pendingRequest is request sent to node waiting for response, if resubscribe is set request
+// re-issues subscription after failover and response is not sent to client
+type pendingRequest struct {
+	clientID    json.RawMessage
+	method      string
+	params      json.RawMessage
+	resubscribe *subscription
+}
+
+// RouteFunc routes single request that is not subscription related to any node and returns response,
+// nil is returned for requests that are not answered
+type RouteFunc func(request rpc.RPCRequest) []byte
+
+// SessionOptions holds optional session features
+type SessionOptions struct {
+	// Route, if set, routes plain request/response calls message by message so only subscription
+	// calls are pinned to session node
+	Route RouteFunc
+	// Hub, if set, serves shared subscriptions instead of session node
+	Hub *Hub
+	// Consumer is api key client requests are counted against, empty for anonymous clients
+	Consumer string
+	// Client is key under which client requests are rate limited
+	Client string
+	// OnClose, if set, is called once when session is closed
+	OnClose func()
+}
+
+// Session proxies client websocket connection to node websocket connection. Request ids are rewritten
+// so requests re-issued on failover can't collide with client requests, and active subscriptions are
+// recorded so they can be re-issued on next node if node serving them fails.
+type Session struct {
+	client      *websocket.Conn
+	clientMutex sync.Mutex
+	repos       repositories.Repos
+	actions     actions.Actions
+	nextNodes   func() []models.Node
+	route       RouteFunc
+	hub         *Hub
+	consumer    string
+	clientKey   string
+	onClose     func()
+
+	mutex         sync.Mutex
+	node          models.Node
+	upstream      *websocket.Conn
+	closed        bool
+	nextID        uint64
+	failedNodes   map[string]bool
+	pending       map[string]*pendingRequest
+	subscriptions map[string]*subscription
+	upstreamSubs  map[string]*subscription
+}
+
+// NewSession creates session for client connection, nextNodes is used to fetch candidate nodes on failover
+func NewSession(
+	client *websocket.Conn,
+	repos repositories.Repos,
+	actions actions.Actions,
+	nextNodes func() []models.Node,
+	options SessionOptions,
+) *Session {
+	return &Session{
+		client:        client,
+		repos:         repos,
+		actions:       actions,
+		nextNodes:     nextNodes,
+		route:         options.Route,
+		hub:           options.Hub,
+		consumer:      options.Consumer,
+		clientKey:     options.Client,
+		onClose:       options.OnClose,
+		failedNodes:   make(map[string]bool),
+		pending:       make(map[string]*pendingRequest),
+		subscriptions: make(map[string]*subscription),
+		upstreamSubs:  make(map[string]*subscription),
+	}
+}
+
+// Start starts proxying client messages to node connection and node messages to client
+func (s *Session) Start(node models.Node, upstream *websocket.Conn) {
+	s.mutex.Lock()
+	s.node = node
+	s.upstream = upstream
+	s.mutex.Unlock()
+
+	go s.readClient()
+	go s.readUpstream(node, nil, upstream)
+}
+
+// StartFallback starts proxying client messages to fallback endpoint connection, used when no node
+// accepted connection. Messages served by fallback endpoint are not recorded as node requests.
+func (s *Session) StartFallback(endpoint *fallback.Endpoint, upstream *websocket.Conn) {
+	s.mutex.Lock()
+	s.node = models.Node{ID: endpoint.Name()}
+	s.upstream = upstream
+	s.mutex.Unlock()
+
+	go s.readClient()
+	go s.readUpstream(s.node, endpoint, upstream)
+}
+
+// Close closes both client and node connection
+func (s *Session) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closeLocked()
+}
+
+func (s *Session) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.onClose != nil {
+		s.onClose()
+	}
+	if s.hub != nil {
+		go s.hub.RemoveSession(s)
+	}
+	closeConn(s.client, "error on closing ws connection towards loadbalancer")
+	if s.upstream != nil {
+		closeConn(s.upstream, fmt.Sprintf("error on closing ws connection towards node %s", s.node.ID))
+	}
+}
+
+func (s *Session) readClient() {
+	maxSize := configuration.Config.MaxWSFrameSize
+	if maxSize <= 0 {
+		maxSize = math.MaxInt64 - 1
+	}
+	for {
+		msgType, reader, err := s.client.NextReader()
+		if err != nil {
+			log.Errorf("Reading request from client failed because of %v:", err)
+			s.Close()
+			return
+		}
+		msg, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+		if err != nil {
+			log.Errorf("Reading request from client failed because of %v:", err)
+			s.Close()
+			return
+		}
+		if int64(len(msg)) > maxSize {
+			// rest of message is discarded without being kept in memory
+			_, _ = io.Copy(ioutil.Discard, reader)
+			s.reject(rpc.RPCRequest{}, &rpc.RPCError{
+				Code:    rpc.InvalidRequest,
+				Message: fmt.Sprintf("Message too large, maximum size is %d bytes", maxSize),
+			})
+			continue
+		}
+		if maxLength := configuration.Config.MaxBatchLength; maxLength > 0 && rpc.IsBatch(msg) &&
+			countRequests(msg, true) > maxLength {
+			s.reject(rpc.RPCRequest{}, &rpc.RPCError{
+				Code:    rpc.InvalidRequest,
+				Message: fmt.Sprintf("Batch too large, maximum length is %d", maxLength),
+			})
+			continue
+		}
+		s.handleClientMessage(msgType, msg)
+	}
+}
+
+func (s *Session) handleClientMessage(msgType int, msg []byte) {
+	isBatch := rpc.IsBatch(msg)
+	requests := countRequests(msg, isBatch)
+	if rpcErr := ratelimit.Allow(s.clientKey, requests); rpcErr != nil {
+		s.reject(rpc.RPCRequest{}, rpcErr)
+		return
+	}
+	if rpcErr := apikey.Use(s.consumer, requests); rpcErr != nil {
+		s.reject(rpc.RPCRequest{}, rpcErr)
+		return
+	}
+	if !json.Valid(msg) {
+		// frames that are not json can't be executed by node and are forwarded unchanged
+		s.mutex.Lock()
+		s.writeUpstreamLocked(msgType, msg)
+		s.mutex.Unlock()
+		return
+	}
+	if isBatch {
+		if batch, ok := s.checkBatch(msg); ok {
+			s.mutex.Lock()
+			s.writeUpstreamLocked(websocket.TextMessage, batch)
+			s.mutex.Unlock()
+		}
+		return
+	}
+
+	request, errResponse := rpc.ParseRequest(msg)
+	if errResponse != nil {
+		s.writeResponse(errResponse)
+		return
+	}
+	if rpcErr := policy.Check(s.clientKey, request); rpcErr != nil {
+		s.reject(request, rpcErr)
+		return
+	}
+
+	if request.IsNotification() {
+		// notifications are forwarded as parsed, so node executes same method that was checked
+		notification, _ := json.Marshal(request)
+		s.mutex.Lock()
+		s.writeUpstreamLocked(websocket.TextMessage, notification)
+		s.mutex.Unlock()
+		return
+	}
+
+	if s.hub != nil {
+		if IsSharedSubscribeMethod(request.Method) {
+			s.hub.Subscribe(s, request)
+			return
+		}
+		if isSharedUnsubscribeMethod(request.Method) && s.hub.Unsubscribe(s, request) {
+			return
+		}
+	}
+
+	if s.route != nil && !IsSubscribeMethod(request.Method) && !IsUnsubscribeMethod(request.Method) {
+		go func() {
+			response := s.route(request)
+			if response != nil && !s.writeClient(websocket.TextMessage, response) {
+				s.Close()
+			}
+		}()
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	params := request.Params
+	if IsUnsubscribeMethod(request.Method) {
+		params = s.unsubscribeLocked(params)
+	}
+	s.sendUpstreamLocked(&pendingRequest{
+		clientID: request.ID,
+		method:   request.Method,
+		params:   params,
+	})
+}
+
+// countRequests returns number of json rpc calls in client message
+func countRequests(msg []byte, isBatch bool) int {
+	var elements []json.RawMessage
+	if isBatch && json.Unmarshal(msg, &elements) == nil {
+		return len(elements)
+	}
+	return 1
+}
+
+// reject answers request with error, requests without id are answered with null id
+// unless they are valid notifications
+func (s *Session) reject(request rpc.RPCRequest, rpcErr *rpc.RPCError) {
+	log.Debugf("Request rejected because of: %s", rpcErr.Message)
+	if request.IsNotification() && request.Method != "" {
+		return
+	}
+	response, _ := json.Marshal(rpc.CreateRPCErrorResponse(request.ID, rpcErr))
+	if !s.writeClient(websocket.TextMessage, response) {
+		s.Close()
+	}
+}
+
+// checkBatch checks batch elements against method policy and returns batch as parsed, so node executes
+// same methods that were checked. Batch responses must arrive in single frame so batch with any invalid
+// or rejected element is answered with errors as whole and false is returned.
+func (s *Session) checkBatch(msg []byte) ([]byte, bool) {
+	requests, errResponses, errResponse := rpc.ParseBatch(msg)
+	if errResponse != nil {
+		s.writeResponse(errResponse)
+		return nil, false
+	}
+
+	rpcErrors := make([]*rpc.RPCError, len(requests))
+	invalid, denied := false, false
+	for i, request := range requests {
+		if errResponses[i] != nil {
+			invalid = true
+			continue
+		}
+		rpcErrors[i] = policy.Check(s.clientKey, request)
+		denied = denied || rpcErrors[i] != nil
+	}
+	if !invalid && !denied {
+		batch, _ := json.Marshal(requests)
+		return batch, true
+	}
+
+	message := "Batch contains invalid requests"
+	if denied {
+		message = "Batch contains methods that are not allowed"
+	}
+
+	var responses []rpc.RPCResponse
+	for i, request := range requests {
+		switch {
+		case errResponses[i] != nil:
+			responses = append(responses, *errResponses[i])
+		case request.IsNotification():
+			continue
+		case rpcErrors[i] != nil:
+			responses = append(responses, rpc.CreateSingleRPCError(request.ID, rpcErrors[i].Code, rpcErrors[i].Message))
+		default:
+			responses = append(responses, rpc.CreateSingleRPCError(request.ID, rpc.InvalidRequest, message))
+		}
+	}
+	log.Debugf("Batch rejected because of: %s", message)
+	if len(responses) > 0 {
+		response, _ := json.Marshal(responses)
+		if !s.writeClient(websocket.TextMessage, response) {
+			s.Close()
+		}
+	}
+	return nil, false
+}
+
+// writeResponse writes error response to client
+func (s *Session) writeResponse(response *rpc.RPCResponse) {
+	out, _ := json.Marshal(response)
+	if !s.writeClient(websocket.TextMessage, out) {
+		s.Close()
+	}
+}
+
+// unsubscribeLocked removes subscription and returns unsubscribe params with node subscription id
+func (s *Session) unsubscribeLocked(params json.RawMessage) json.RawMessage {
+	var list []json.RawMessage
+	if json.Unmarshal(params, &list) != nil || len(list) == 0 {
+		return params
+	}
+
+	sub, ok := s.subscriptions[rpc.IDKey(list[0])]
+	if !ok {
+		return params
+	}
+	delete(s.subscriptions, rpc.IDKey(sub.clientSubID))
+	delete(s.upstreamSubs, rpc.IDKey(sub.upstreamSubID))
+
+	list[0] = sub.upstreamSubID
+	upstreamParams, _ := json.Marshal(list)
+	return upstreamParams
+}
+
+// sendUpstreamLocked sends request to node under new request id
+func (s *Session) sendUpstreamLocked(p *pendingRequest) {
+	s.nextID++
+	id := json.RawMessage(strconv.FormatUint(s.nextID, 10))
+	s.pending[rpc.IDKey(id)] = p
+
+	msg, _ := json.Marshal(rpc.RPCRequest{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  p.method,
+		Params:  p.params,
+	})
+	s.writeUpstreamLocked(websocket.TextMessage, msg)
+}
+
+func (s *Session) writeUpstreamLocked(msgType int, msg []byte) {
+	if s.closed || s.upstream == nil {
+		return
+	}
+	err := s.upstream.WriteMessage(msgType, msg)
+	if err != nil {
+		// node connection reader fails over to next node and answers pending requests
+		log.Errorf("Sending request to node %s failed because of %v", s.node.ID, err)
+	}
+}
+
+// readUpstream forwards messages of node connection to client, endpoint is set if connection
+// is fallback endpoint connection instead of node connection
+func (s *Session) readUpstream(node models.Node, endpoint *fallback.Endpoint, upstream *websocket.Conn) {
+	for {
+		msgType, msg, err := upstream.ReadMessage()
+		if err != nil {
+			log.Errorf("Failed reading message from node %s because of %v:", node.ID, err)
+			s.failover(node, endpoint, upstream)
+			return
+		}
+
+		out, forward := s.handleUpstreamMessage(msg)
+		if !forward {
+			continue
+		}
+		if out == nil {
+			out = msg
+		} else {
+			msgType = websocket.TextMessage
+		}
+		if !s.writeClient(msgType, out) {
+			s.Close()
+			return
+		}
+		if endpoint != nil {
+			endpoint.RecordRequest()
+		} else {
+			record.SuccessfulRequest(node, s.repos)
+		}
+	}
+}
+
+// handleUpstreamMessage restores client request ids and subscription ids in node message. Returns
+// rewritten message, or nil if message should be forwarded unchanged, and if it should be forwarded at all.
+func (s *Session) handleUpstreamMessage(msg []byte) ([]byte, bool) {
+	var m message
+	if rpc.IsBatch(msg) || json.Unmarshal(msg, &m) != nil {
+		return nil, true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if m.ID != nil {
+		p, ok := s.pending[rpc.IDKey(m.ID)]
+		if !ok {
+			return nil, true
+		}
+		delete(s.pending, rpc.IDKey(m.ID))
+
+		if p.resubscribe != nil {
+			if m.Error == nil && m.Result != nil {
+				p.resubscribe.upstreamSubID = m.Result
+				s.upstreamSubs[rpc.IDKey(m.Result)] = p.resubscribe
+			} else {
+				log.Errorf("Re-issuing subscription %s failed on node %s", p.method, s.node.ID)
+			}
+			return nil, false
+		}
+
+		if IsSubscribeMethod(p.method) && m.Error == nil && m.Result != nil {
+			sub := &subscription{
+				method:        p.method,
+				params:        p.params,
+				clientSubID:   m.Result,
+				upstreamSubID: m.Result,
+			}
+			s.subscriptions[rpc.IDKey(m.Result)] = sub
+			s.upstreamSubs[rpc.IDKey(m.Result)] = sub
+		}
+		return replaceField(msg, []string{"id"}, p.clientID), true
+	}
+
+	if m.Method != "" && m.Params != nil && m.Params.Subscription != nil {
+		sub, ok := s.upstreamSubs[rpc.IDKey(m.Params.Subscription)]
+		if !ok || rpc.IDKey(sub.clientSubID) == rpc.IDKey(sub.upstreamSubID) {
+			return nil, true
+		}
+		return replaceField(msg, []string{"params", "subscription"}, sub.clientSubID), true
+	}
+
+	return nil, true
+}
+
+// failover replaces failed node connection with connection to next available node and re-issues
+// all active subscriptions on it. If no node is available, connection is moved to fallback endpoint.
+// Requests that were waiting for response are answered with error.
+func (s *Session) failover(failedNode models.Node, failedEndpoint *fallback.Endpoint, failedUpstream *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed || s.upstream != failedUpstream {
+		return
+	}
+	closeConn(failedUpstream, fmt.Sprintf("error on closing ws connection towards node %s", failedNode.ID))
+	if failedEndpoint != nil {
+		failedEndpoint.RecordFailure()
+	} else {
+		go record.FailedRequest(failedNode, s.repos, s.actions, penalty.RPCFailure)
+		s.failedNodes[failedNode.ID] = true
+	}
+	s.upstream = nil
+
+	var unanswered []json.RawMessage
+	for id, p := range s.pending {
+		if p.resubscribe == nil {
+			unanswered = append(unanswered, p.clientID)
+		}
+		delete(s.pending, id)
+	}
+	for _, clientID := range unanswered {
+		errResponse, _ := json.Marshal(
+			rpc.CreateSingleRPCError(clientID, rpc.InternalServerError, "Internal Server Error"))
+		_ = s.writeClient(websocket.TextMessage, errResponse)
+	}
+
+	for _, node := range s.nextNodes() {
+		if s.failedNodes[node.ID] {
+			continue
+		}
+		upstream, connErr := DialNode(node.ID)
+		if connErr != nil {
+			log.Errorf("Establishing connection with node %s failed because of %v", node.ID, connErr)
+			if connErr.IsNodeError() {
+				go s.actions.PenalizeNode(node, s.repos, penalty.WSHandshakeFailure)
+			}
+			s.failedNodes[node.ID] = true
+			continue
+		}
+
+		log.Debugf("Client connection moved from node %s to node %s", failedNode.ID, node.ID)
+		go s.repos.NodeRepo.UpdateNodeUsed(node)
+		s.moveLocked(node, nil, upstream)
+		return
+	}
+
+	if upstream, endpoint, err := fallback.Dial(); err == nil {
+		log.Debugf("Client connection moved from node %s to fallback endpoint %s", failedNode.ID, endpoint.Name())
+		s.moveLocked(models.Node{ID: endpoint.Name()}, endpoint, upstream)
+		return
+	}
+
+	log.Error("Failed establishing connection with any node, closing client connection")
+	s.closeLocked()
+}
+
+// moveLocked replaces session connection and re-issues all active subscriptions on new connection
+func (s *Session) moveLocked(node models.Node, endpoint *fallback.Endpoint, upstream *websocket.Conn) {
+	s.node = node
+	s.upstream = upstream
+
+	s.upstreamSubs = make(map[string]*subscription)
+	for _, sub := range s.subscriptions {
+		s.sendUpstreamLocked(&pendingRequest{
+			method:      sub.method,
+			params:      sub.params,
+			resubscribe: sub,
+		})
+	}
+	go s.readUpstream(node, endpoint, upstream)
+}
+
+func (s *Session) writeClient(msgType int, msg []byte) bool {
+	s.clientMutex.Lock()
+	defer s.clientMutex.Unlock()
+	err := s.client.WriteMessage(msgType, msg)
+	if err != nil {
+		log.Errorf("Sending response client failed because of %v:", err)
+		return false
+	}
+	return true
+}
+
+// replaceField returns json object with value on path replaced with provided value
+func replaceField(msg []byte, path []string, value json.RawMessage) []byte {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(msg, &object) != nil {
+		return msg
+	}
+	if len(path) == 1 {
+		object[path[0]] = value
+	} else {
+		object[path[0]] = replaceField(object[path[0]], path[1:], value)
+	}
+	out, err := json.Marshal(object)
+	if err != nil {
+		return msg
+	}
+	return out
+}
@@ -0,0 +1,377 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodeFactoryIo/vedran/internal/configuration"
+	"github.com/NodeFactoryIo/vedran/internal/models"
+	"github.com/NodeFactoryIo/vedran/internal/repositories"
+	"github.com/NodeFactoryIo/vedran/internal/rpc"
+	actionMocks "github.com/NodeFactoryIo/vedran/mocks/actions"
+	tunnelMocks "github.com/NodeFactoryIo/vedran/mocks/http-tunnel/server"
+	repoMocks "github.com/NodeFactoryIo/vedran/mocks/repositories"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testUpgrader = websocket.Upgrader{}
+
+// mockNode answers subscription with subscription id unique for node, sends one notification
+// for subscription and closes connection after it if closeAfterNotification is set
+type mockNode struct {
+	name                   string
+	closeAfterNotification bool
+}
+
+func (n *mockNode) handle(w http.ResponseWriter, r *http.Request) {
+	conn, err := testUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request rpc.RPCRequest
+		_ = json.Unmarshal(msg, &request)
+
+		switch request.Method {
+		case "chain_subscribeNewHeads":
+			subID := "sub-" + n.name
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, request.ID, subID)))
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(
+				fmt.Sprintf(`{"jsonrpc":"2.0","method":"chain_newHead","params":{"subscription":"%s","result":"%s"}}`,
+					subID, n.name)))
+			if n.closeAfterNotification {
+				return
+			}
+		default:
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"%s"}`, request.ID, n.name)))
+		}
+	}
+}
+
+func wsPort(server *httptest.Server) int {
+	port, _ := strconv.Atoi(strings.Split(server.URL, ":")[2])
+	return port
+}
+
+func TestSession_Failover(t *testing.T) {
+	firstNode := httptest.NewServer(http.HandlerFunc((&mockNode{name: "1", closeAfterNotification: true}).handle))
+	defer firstNode.Close()
+	secondNode := httptest.NewServer(http.HandlerFunc((&mockNode{name: "2"}).handle))
+	defer secondNode.Close()
+
+	poolerMock := &tunnelMocks.Pooler{}
+	poolerMock.On("GetWSPort", "1").Return(wsPort(firstNode), nil)
+	poolerMock.On("GetWSPort", "2").Return(wsPort(secondNode), nil)
+	configuration.Config.PortPool = poolerMock
+	defer func() { configuration.Config.PortPool = nil }()
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	actionsMockObject := new(actionMocks.Actions)
+	actionsMockObject.On("PenalizeNode", mock.Anything, mock.Anything, mock.Anything).Return()
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, RecordRepo: &recordRepoMock}
+
+	nodes := []models.Node{{ID: "1"}, {ID: "2"}}
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		session := NewSession(client, repos, actionsMockObject, func() []models.Node { return nodes }, SessionOptions{})
+		upstream, connErr := DialNode("1")
+		if connErr != nil {
+			_ = client.Close()
+			return
+		}
+		session.Start(nodes[0], upstream)
+	}))
+	defer lb.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(lb.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer client.Close()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":"a","method":"chain_subscribeNewHeads","params":[]}`))
+	assert.NoError(t, err)
+
+	var response rpc.RPCResponse
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`"a"`), response.ID)
+	assert.Equal(t, json.RawMessage(`"sub-1"`), *response.Result)
+
+	// notification from first node, second one arrives from second node after failover
+	for _, expectedResult := range []string{`"1"`, `"2"`} {
+		var notification struct {
+			Params struct {
+				Subscription json.RawMessage `json:"subscription"`
+				Result       json.RawMessage `json:"result"`
+			} `json:"params"`
+		}
+		err = client.ReadJSON(&notification)
+		assert.NoError(t, err)
+		assert.Equal(t, json.RawMessage(`"sub-1"`), notification.Params.Subscription)
+		assert.Equal(t, json.RawMessage(expectedResult), notification.Params.Result)
+	}
+
+	// plain requests keep working on second node with original ids
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":7,"method":"system_health","params":[]}`))
+	assert.NoError(t, err)
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`7`), response.ID)
+	assert.Equal(t, json.RawMessage(`"2"`), *response.Result)
+}
+
+func TestSession_RoutesPlainCalls(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc((&mockNode{name: "1"}).handle))
+	defer node.Close()
+
+	poolerMock := &tunnelMocks.Pooler{}
+	poolerMock.On("GetWSPort", "1").Return(wsPort(node), nil)
+	configuration.Config.PortPool = poolerMock
+	defer func() { configuration.Config.PortPool = nil }()
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, RecordRepo: &recordRepoMock}
+
+	routed := make(chan string, 10)
+	route := func(request rpc.RPCRequest) []byte {
+		routed <- request.Method
+		return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":"routed"}`, request.ID))
+	}
+
+	nodes := []models.Node{{ID: "1"}}
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		session := NewSession(client, repos, new(actionMocks.Actions), func() []models.Node { return nodes }, SessionOptions{Route: route})
+		upstream, connErr := DialNode("1")
+		if connErr != nil {
+			_ = client.Close()
+			return
+		}
+		session.Start(nodes[0], upstream)
+	}))
+	defer lb.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(lb.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer client.Close()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// plain call is routed
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":"x","method":"system_health","params":[]}`))
+	assert.NoError(t, err)
+	var response rpc.RPCResponse
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`"x"`), response.ID)
+	assert.Equal(t, json.RawMessage(`"routed"`), *response.Result)
+	assert.Equal(t, "system_health", <-routed)
+
+	// subscription is pinned to node connection
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":"y","method":"chain_subscribeNewHeads","params":[]}`))
+	assert.NoError(t, err)
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage(`"y"`), response.ID)
+	assert.Equal(t, json.RawMessage(`"sub-1"`), *response.Result)
+	assert.Len(t, routed, 0)
+}
+
+func TestSession_RejectsNotAllowedMethods(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc((&mockNode{name: "1"}).handle))
+	defer node.Close()
+
+	poolerMock := &tunnelMocks.Pooler{}
+	poolerMock.On("GetWSPort", "1").Return(wsPort(node), nil)
+	configuration.Config.PortPool = poolerMock
+	defer func() { configuration.Config.PortPool = nil }()
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, RecordRepo: &recordRepoMock}
+
+	nodes := []models.Node{{ID: "1"}}
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		session := NewSession(client, repos, new(actionMocks.Actions), func() []models.Node { return nodes }, SessionOptions{})
+		upstream, connErr := DialNode("1")
+		if connErr != nil {
+			_ = client.Close()
+			return
+		}
+		session.Start(nodes[0], upstream)
+	}))
+	defer lb.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(lb.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer client.Close()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":1,"method":"author_rotateKeys","params":[]}`))
+	assert.NoError(t, err)
+	_, msg, err := client.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method author_rotateKeys is not allowed"}}`,
+		string(msg))
+
+	err = client.WriteMessage(websocket.TextMessage, []byte(`[{"jsonrpc":"2.0","id":2,"method":"system_health"},`+
+		`{"jsonrpc":"2.0","id":3,"method":"author_insertKey","params":[]}]`))
+	assert.NoError(t, err)
+	_, msg, err = client.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"Batch contains methods that are not allowed"}},`+
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"Method author_insertKey is not allowed"}}]`, string(msg))
+
+	// method can't be hidden from policy behind key that differs only in case
+	err = client.WriteMessage(websocket.TextMessage,
+		[]byte(`{"jsonrpc":"2.0","id":6,"method":"author_rotateKeys","Method":"system_health"}`))
+	assert.NoError(t, err)
+	_, msg, err = client.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":6,"error":{"code":-32600,"message":"Invalid Request"}}`, string(msg))
+
+	// allowed methods are still forwarded to node
+	err = client.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":4,"method":"system_health"}`))
+	assert.NoError(t, err)
+	var response rpc.RPCResponse
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage("4"), response.ID)
+	assert.Equal(t, json.RawMessage(`"1"`), *response.Result)
+}
+
+func TestSession_RejectsTooLargeMessages(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc((&mockNode{name: "1"}).handle))
+	defer node.Close()
+
+	poolerMock := &tunnelMocks.Pooler{}
+	poolerMock.On("GetWSPort", "1").Return(wsPort(node), nil)
+	configuration.Config.PortPool = poolerMock
+	configuration.Config.MaxWSFrameSize = 200
+	configuration.Config.MaxBatchLength = 2
+	defer func() {
+		configuration.Config.PortPool = nil
+		configuration.Config.MaxWSFrameSize = 0
+		configuration.Config.MaxBatchLength = 0
+	}()
+
+	nodeRepoMock := repoMocks.NodeRepository{}
+	nodeRepoMock.On("UpdateNodeUsed", mock.Anything).Return()
+	recordRepoMock := repoMocks.RecordRepository{}
+	recordRepoMock.On("Save", mock.Anything).Return(nil)
+	repos := repositories.Repos{NodeRepo: &nodeRepoMock, RecordRepo: &recordRepoMock}
+
+	nodes := []models.Node{{ID: "1"}}
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		session := NewSession(client, repos, new(actionMocks.Actions), func() []models.Node { return nodes }, SessionOptions{})
+		upstream, connErr := DialNode("1")
+		if connErr != nil {
+			_ = client.Close()
+			return
+		}
+		session.Start(nodes[0], upstream)
+	}))
+	defer lb.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(lb.URL, "http"), nil)
+	assert.NoError(t, err)
+	defer client.Close()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	err = client.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"system_health","params":["`+
+		strings.Repeat("a", 1000)+`"]}`))
+	assert.NoError(t, err)
+	_, msg, err := client.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Message too large, maximum size is 200 bytes"}}`,
+		string(msg))
+
+	err = client.WriteMessage(websocket.TextMessage, []byte(`[{"jsonrpc":"2.0","id":2,"method":"a"},`+
+		`{"jsonrpc":"2.0","id":3,"method":"b"},{"jsonrpc":"2.0","id":4,"method":"c"}]`))
+	assert.NoError(t, err)
+	_, msg, err = client.ReadMessage()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Batch too large, maximum length is 2"}}`,
+		string(msg))
+
+	// session is kept open after rejected messages
+	err = client.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":5,"method":"system_health"}`))
+	assert.NoError(t, err)
+	var response rpc.RPCResponse
+	err = client.ReadJSON(&response)
+	assert.NoError(t, err)
+	assert.Equal(t, json.RawMessage("5"), response.ID)
+}
+
+func TestReplaceField(t *testing.T) {
+	tests := []struct {
+		name  string
+		msg   string
+		path  []string
+		value string
+		want  string
+	}{
+		{
+			name:  "replaces top level field",
+			msg:   `{"id":1,"jsonrpc":"2.0","result":"x"}`,
+			path:  []string{"id"},
+			value: `"a"`,
+			want:  `{"id":"a","jsonrpc":"2.0","result":"x"}`,
+		},
+		{
+			name:  "replaces nested field",
+			msg:   `{"jsonrpc":"2.0","method":"m","params":{"result":1,"subscription":"x"}}`,
+			path:  []string{"params", "subscription"},
+			value: `7`,
+			want:  `{"jsonrpc":"2.0","method":"m","params":{"result":1,"subscription":7}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := replaceField([]byte(test.msg), test.path, json.RawMessage(test.value))
+			assert.JSONEq(t, test.want, string(got))
+		})
+	}
+}
@@ -4,6 +4,7 @@ package mocks
 
 import mock "github.com/stretchr/testify/mock"
 import models "github.com/NodeFactoryIo/vedran/internal/models"
+import penalty "github.com/NodeFactoryIo/vedran/internal/penalty"
 import repositories "github.com/NodeFactoryIo/vedran/internal/repositories"
 
 // Actions is an autogenerated mock type for the Actions type
@@ -11,7 +12,7 @@ type Actions struct {
 	mock.Mock
 }
 
-// PenalizeNode provides a mock function with given fields: node, _a1
-func (_m *Actions) PenalizeNode(node models.Node, _a1 repositories.Repos) {
-	_m.Called(node, _a1)
+// PenalizeNode provides a mock function with given fields: node, _a1, reason
+func (_m *Actions) PenalizeNode(node models.Node, _a1 repositories.Repos, reason penalty.Reason) {
+	_m.Called(node, _a1, reason)
 }
@@ -0,0 +1,62 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+// APIKeyRepository is an autogenerated mock type for the APIKeyRepository type
+type APIKeyRepository struct {
+	mock.Mock
+}
+
+// Delete provides a mock function with given fields: apiKey
+func (_m *APIKeyRepository) Delete(apiKey *models.APIKey) error {
+	ret := _m.Called(apiKey)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.APIKey) error); ok {
+		r0 = rf(apiKey)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetAll provides a mock function with given fields:
+func (_m *APIKeyRepository) GetAll() (*[]models.APIKey, error) {
+	ret := _m.Called()
+
+	var r0 *[]models.APIKey
+	if rf, ok := ret.Get(0).(func() *[]models.APIKey); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*[]models.APIKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Save provides a mock function with given fields: apiKey
+func (_m *APIKeyRepository) Save(apiKey *models.APIKey) error {
+	ret := _m.Called(apiKey)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.APIKey) error); ok {
+		r0 = rf(apiKey)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,57 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+import time "time"
+
+// AuditLogRepository is an autogenerated mock type for the AuditLogRepository type
+type AuditLogRepository struct {
+	mock.Mock
+}
+
+// Find provides a mock function with given fields: from, to, offset, limit
+func (_m *AuditLogRepository) Find(from time.Time, to time.Time, offset int, limit int) ([]models.AuditLogEntry, int, error) {
+	ret := _m.Called(from, to, offset, limit)
+
+	var r0 []models.AuditLogEntry
+	if rf, ok := ret.Get(0).(func(time.Time, time.Time, int, int) []models.AuditLogEntry); ok {
+		r0 = rf(from, to, offset, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.AuditLogEntry)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(time.Time, time.Time, int, int) int); ok {
+		r1 = rf(from, to, offset, limit)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(time.Time, time.Time, int, int) error); ok {
+		r2 = rf(from, to, offset, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Save provides a mock function with given fields: entry
+func (_m *AuditLogRepository) Save(entry *models.AuditLogEntry) error {
+	ret := _m.Called(entry)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.AuditLogEntry) error); ok {
+		r0 = rf(entry)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,50 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+import time "time"
+
+// DisagreementRepository is an autogenerated mock type for the DisagreementRepository type
+type DisagreementRepository struct {
+	mock.Mock
+}
+
+// FindSince provides a mock function with given fields: from
+func (_m *DisagreementRepository) FindSince(from time.Time) ([]models.Disagreement, error) {
+	ret := _m.Called(from)
+
+	var r0 []models.Disagreement
+	if rf, ok := ret.Get(0).(func(time.Time) []models.Disagreement); ok {
+		r0 = rf(from)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Disagreement)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(from)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Save provides a mock function with given fields: disagreement
+func (_m *DisagreementRepository) Save(disagreement *models.Disagreement) error {
+	ret := _m.Called(disagreement)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.Disagreement) error); ok {
+		r0 = rf(disagreement)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -0,0 +1,57 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+import time "time"
+
+// NodeEventRepository is an autogenerated mock type for the NodeEventRepository type
+type NodeEventRepository struct {
+	mock.Mock
+}
+
+// FindByNodeID provides a mock function with given fields: nodeID, from, to, offset, limit
+func (_m *NodeEventRepository) FindByNodeID(nodeID string, from time.Time, to time.Time, offset int, limit int) ([]models.NodeEvent, int, error) {
+	ret := _m.Called(nodeID, from, to, offset, limit)
+
+	var r0 []models.NodeEvent
+	if rf, ok := ret.Get(0).(func(string, time.Time, time.Time, int, int) []models.NodeEvent); ok {
+		r0 = rf(nodeID, from, to, offset, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.NodeEvent)
+		}
+	}
+
+	var r1 int
+	if rf, ok := ret.Get(1).(func(string, time.Time, time.Time, int, int) int); ok {
+		r1 = rf(nodeID, from, to, offset, limit)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string, time.Time, time.Time, int, int) error); ok {
+		r2 = rf(nodeID, from, to, offset, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Save provides a mock function with given fields: event
+func (_m *NodeEventRepository) Save(event *models.NodeEvent) error {
+	ret := _m.Called(event)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.NodeEvent) error); ok {
+		r0 = rf(event)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -4,6 +4,7 @@ package mocks
 
 import mock "github.com/stretchr/testify/mock"
 import models "github.com/NodeFactoryIo/vedran/internal/models"
+import repositories "github.com/NodeFactoryIo/vedran/internal/repositories"
 
 // NodeRepository is an autogenerated mock type for the NodeRepository type
 type NodeRepository struct {
@@ -24,6 +25,20 @@ func (_m *NodeRepository) AddNodeToActive(ID string) error {
 	return r0
 }
 
+// Delete provides a mock function with given fields: ID
+func (_m *NodeRepository) Delete(ID string) error {
+	ret := _m.Called(ID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(ID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // FindByID provides a mock function with given fields: ID
 func (_m *NodeRepository) FindByID(ID string) (*models.Node, error) {
 	ret := _m.Called(ID)
@@ -47,13 +62,13 @@ func (_m *NodeRepository) FindByID(ID string) (*models.Node, error) {
 	return r0, r1
 }
 
-// GetActiveNodes provides a mock function with given fields: selection
-func (_m *NodeRepository) GetActiveNodes(selection string) *[]models.Node {
-	ret := _m.Called(selection)
+// GetActiveNodes provides a mock function with given fields:
+func (_m *NodeRepository) GetActiveNodes() *[]models.Node {
+	ret := _m.Called()
 
 	var r0 *[]models.Node
-	if rf, ok := ret.Get(0).(func(string) *[]models.Node); ok {
-		r0 = rf(selection)
+	if rf, ok := ret.Get(0).(func() *[]models.Node); ok {
+		r0 = rf()
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*[]models.Node)
@@ -102,6 +117,22 @@ func (_m *NodeRepository) GetAllActiveNodes() *[]models.Node {
 	return r0
 }
 
+// GetPreviouslyActiveNodes provides a mock function with given fields:
+func (_m *NodeRepository) GetPreviouslyActiveNodes() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
 // GetPenalizedNodes provides a mock function with given fields:
 func (_m *NodeRepository) GetPenalizedNodes() (*[]models.Node, error) {
 	ret := _m.Called()
@@ -125,13 +156,13 @@ func (_m *NodeRepository) GetPenalizedNodes() (*[]models.Node, error) {
 	return r0, r1
 }
 
-// IncreaseNodeCooldown provides a mock function with given fields: ID
-func (_m *NodeRepository) IncreaseNodeCooldown(ID string) (*models.Node, error) {
-	ret := _m.Called(ID)
+// IncreaseNodeCooldown provides a mock function with given fields: ID, escalation
+func (_m *NodeRepository) IncreaseNodeCooldown(ID string, escalation float64) (*models.Node, error) {
+	ret := _m.Called(ID, escalation)
 
 	var r0 *models.Node
-	if rf, ok := ret.Get(0).(func(string) *models.Node); ok {
-		r0 = rf(ID)
+	if rf, ok := ret.Get(0).(func(string, float64) *models.Node); ok {
+		r0 = rf(ID, escalation)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*models.Node)
@@ -139,8 +170,8 @@ func (_m *NodeRepository) IncreaseNodeCooldown(ID string) (*models.Node, error)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(string) error); ok {
-		r1 = rf(ID)
+	if rf, ok := ret.Get(1).(func(string, float64) error); ok {
+		r1 = rf(ID, escalation)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -183,6 +214,11 @@ func (_m *NodeRepository) IsNodeOnCooldown(ID string) (bool, error) {
 	return r0, r1
 }
 
+// OnActiveNodesChange provides a mock function with given fields: listener
+func (_m *NodeRepository) OnActiveNodesChange(listener func(repositories.ActiveNodesChange)) {
+	_m.Called(listener)
+}
+
 // RemoveNodeFromActive provides a mock function with given fields: ID
 func (_m *NodeRepository) RemoveNodeFromActive(ID string) error {
 	ret := _m.Called(ID)
@@ -0,0 +1,110 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+import time "time"
+
+// PenaltyRepository is an autogenerated mock type for the PenaltyRepository type
+type PenaltyRepository struct {
+	mock.Mock
+}
+
+// Delete provides a mock function with given fields: nodeID
+func (_m *PenaltyRepository) Delete(nodeID string) error {
+	ret := _m.Called(nodeID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(nodeID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindByNodeID provides a mock function with given fields: nodeID
+func (_m *PenaltyRepository) FindByNodeID(nodeID string) (*models.Penalty, error) {
+	ret := _m.Called(nodeID)
+
+	var r0 *models.Penalty
+	if rf, ok := ret.Get(0).(func(string) *models.Penalty); ok {
+		r0 = rf(nodeID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Penalty)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(nodeID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDue provides a mock function with given fields: due
+func (_m *PenaltyRepository) FindDue(due time.Time) ([]models.Penalty, error) {
+	ret := _m.Called(due)
+
+	var r0 []models.Penalty
+	if rf, ok := ret.Get(0).(func(time.Time) []models.Penalty); ok {
+		r0 = rf(due)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Penalty)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time) error); ok {
+		r1 = rf(due)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAll provides a mock function with given fields:
+func (_m *PenaltyRepository) GetAll() ([]models.Penalty, error) {
+	ret := _m.Called()
+
+	var r0 []models.Penalty
+	if rf, ok := ret.Get(0).(func() []models.Penalty); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Penalty)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Save provides a mock function with given fields: penalty
+func (_m *PenaltyRepository) Save(penalty *models.Penalty) error {
+	ret := _m.Called(penalty)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.Penalty) error); ok {
+		r0 = rf(penalty)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
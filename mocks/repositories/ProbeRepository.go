@@ -0,0 +1,94 @@
+// Code generated by mockery v1.0.0. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+import models "github.com/NodeFactoryIo/vedran/internal/models"
+
+// ProbeRepository is an autogenerated mock type for the ProbeRepository type
+type ProbeRepository struct {
+	mock.Mock
+}
+
+// FindByNodeID provides a mock function with given fields: nodeId
+func (_m *ProbeRepository) FindByNodeID(nodeId string) (*models.Probe, error) {
+	ret := _m.Called(nodeId)
+
+	var r0 *models.Probe
+	if rf, ok := ret.Get(0).(func(string) *models.Probe); ok {
+		r0 = rf(nodeId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Probe)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(nodeId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAll provides a mock function with given fields:
+func (_m *ProbeRepository) GetAll() (*[]models.Probe, error) {
+	ret := _m.Called()
+
+	var r0 *[]models.Probe
+	if rf, ok := ret.Get(0).(func() *[]models.Probe); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*[]models.Probe)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLatestBlockMetrics provides a mock function with given fields:
+func (_m *ProbeRepository) GetLatestBlockMetrics() (*models.LatestBlockMetrics, error) {
+	ret := _m.Called()
+
+	var r0 *models.LatestBlockMetrics
+	if rf, ok := ret.Get(0).(func() *models.LatestBlockMetrics); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.LatestBlockMetrics)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Save provides a mock function with given fields: probe
+func (_m *ProbeRepository) Save(probe *models.Probe) error {
+	ret := _m.Called(probe)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*models.Probe) error); ok {
+		r0 = rf(probe)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
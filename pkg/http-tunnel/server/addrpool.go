@@ -14,11 +14,12 @@ type RemoteID struct {
 }
 
 type AddrPool struct {
-	first   int
-	last    int
-	used    int
-	mutex   sync.Mutex
-	addrMap map[int]*RemoteID
+	first          int
+	last           int
+	used           int
+	mutex          sync.Mutex
+	addrMap        map[int]*RemoteID
+	releaseHandler func(remote RemoteID)
 }
 
 type Pooler interface {
@@ -75,10 +76,17 @@ func (ap *AddrPool) Acquire(cname string, pname string) (int, error) {
 	return assignedPort, nil
 }
 
-func (ap *AddrPool) Release(id string) error {
+// SetReleaseHandler sets function that is invoked with released remote
+// each time port is returned to pool
+func (ap *AddrPool) SetReleaseHandler(handler func(remote RemoteID)) {
 	ap.mutex.Lock()
 	defer ap.mutex.Unlock()
-	found := false
+	ap.releaseHandler = handler
+}
+
+func (ap *AddrPool) Release(id string) error {
+	ap.mutex.Lock()
+	var released *RemoteID
 	// search for the first unnused port
 	for i := ap.first; i < ap.last; i++ {
 		cur := ap.addrMap[i]
@@ -86,14 +94,22 @@ func (ap *AddrPool) Release(id string) error {
 			//empty
 			ap.used--
 			ap.addrMap[i] = nil
-			found = true
+			released = cur
 			break
 		}
 	}
-	if !found {
+	handler := ap.releaseHandler
+	ap.mutex.Unlock()
+
+	if released == nil {
 		return fmt.Errorf("ID %s not found in pool", id)
 	}
 
+	// invoke handler outside of lock so it can safely use pool
+	if handler != nil {
+		handler(*released)
+	}
+
 	return nil
 }
 
@@ -150,6 +150,32 @@ func TestAddrPool_Release(t *testing.T) {
 	}
 }
 
+func TestAddrPool_ReleaseHandler(t *testing.T) {
+	ap := &AddrPool{}
+	_ = ap.Init("100:102")
+	_, _ = ap.Acquire("valid-id", "http")
+	_, _ = ap.Acquire("valid-id", "ws")
+
+	var released []RemoteID
+	ap.SetReleaseHandler(func(remote RemoteID) {
+		released = append(released, remote)
+	})
+
+	_ = ap.Release("valid-id")
+	_ = ap.Release("valid-id")
+	_ = ap.Release("valid-id")
+
+	if len(released) != 2 {
+		t.Fatalf("AddrPool release handler called %d times, want 2", len(released))
+	}
+	if released[0].Port != 100 || released[0].PortName != "http" {
+		t.Errorf("AddrPool release handler got %v, want http port 100", released[0])
+	}
+	if released[1].Port != 101 || released[1].PortName != "ws" {
+		t.Errorf("AddrPool release handler got %v, want ws port 101", released[1])
+	}
+}
+
 func TestAddrPool_GetHTTPPort(t *testing.T) {
 	addrMap := make(map[int]*RemoteID)
 	addrMap[100] = &RemoteID{